@@ -9,6 +9,7 @@ import (
 
 	"github.com/thediveo/lxkns/model"
 	"github.com/thediveo/whalewatcher/watcher"
+	"golang.org/x/exp/slices"
 )
 
 // Detector identifies a particular socket service activator by its well-known
@@ -39,7 +40,29 @@ type EngineFinder interface {
 
 // EngineIdentification specifies the information needed to detect API endpoints
 // for socket-activatable container engines, as well as the engine process name.
+//
+// Some engines don't always show up under the same process name, such as when
+// they re-execute themselves via “/proc/self/exe”, so the process “comm”
+// becomes “exe”. Such engines can additionally specify alternative process
+// names that are tried in order after the primary process name.
 type EngineIdentification struct {
-	APIEndpointSuffix string // API endpoint name such as "foo.sock", without any path.
-	ProcessName       string // name of engine process.
+	APIEndpointSuffix string   // API endpoint name such as "foo.sock", without any path.
+	ProcessName       string   // name of engine process.
+	AltProcessNames   []string // alternative names of engine process, if any.
+}
+
+// ProcessNames returns the candidate process names of the engine, starting
+// with the primary process name, followed by any alternative process names.
+func (i EngineIdentification) ProcessNames() []string {
+	names := make([]string, 0, 1+len(i.AltProcessNames))
+	if i.ProcessName != "" {
+		names = append(names, i.ProcessName)
+	}
+	for _, name := range i.AltProcessNames {
+		if name == "" || slices.Contains(names, name) {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
 }
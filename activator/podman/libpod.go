@@ -0,0 +1,224 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package podman
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/docker/docker/client"
+	detect "github.com/siemens/turtlefinder/detector"
+	"github.com/thediveo/lxkns/model"
+	"github.com/thediveo/whalewatcher"
+	"github.com/thediveo/whalewatcher/engineclient"
+	mobyengine "github.com/thediveo/whalewatcher/engineclient/moby"
+	"github.com/thediveo/whalewatcher/watcher"
+)
+
+// PodIDLabel is the name of the container label carrying the ID of the pod a
+// podman container belongs to, when using podman's native API.
+const PodIDLabel = "turtlefinder/podman/pod/id"
+
+// PodNameLabel is the name of the container label carrying the name of the pod
+// a podman container belongs to, when using podman's native API.
+const PodNameLabel = "turtlefinder/podman/pod/name"
+
+// libpodBaseURL is the base URL for talking HTTP to podman's native “libpod”
+// API. As we always dial the API's unix domain socket, the host part doesn't
+// matter.
+const libpodBaseURL = "http://podman/libpod"
+
+// podClient is a Docker-compatible engine client for podman that additionally
+// picks up the pod membership of containers using podman's native “libpod”
+// API, attaching it in form of container labels.
+//
+// Please note that we still use podman's Docker-compatible API for the workload
+// watching, and the native API only to fill in the pod details.
+type podClient struct {
+	*mobyengine.MobyWatcher
+	libpod *http.Client // HTTP client for podman's native API.
+}
+
+// Make sure that the EngineClient and Preflighter interfaces are fully
+// implemented.
+var _ (engineclient.EngineClient) = (*podClient)(nil)
+var _ (engineclient.Preflighter) = (*podClient)(nil)
+
+// libpodContainer represents the (few) container details we're interested in
+// when listing containers via podman's native API.
+type libpodContainer struct {
+	ID      string `json:"Id"`
+	Pod     string `json:"Pod"`
+	PodName string `json:"PodName"`
+}
+
+// newNativeWatcher returns a new watcher for the podman engine at the
+// specified API path that additionally labels containers with their pods, or
+// nil if podman's native API is not available.
+func newNativeWatcher(ctx context.Context, pid model.PIDType, api string) watcher.Watcher {
+	lg := detect.LoggerFrom(ctx)
+	libpod := newLibpodHTTPClient(api, detect.Dialer(ctx))
+	ctx, cancel := context.WithTimeout(ctx, detect.ClientTimeout(ctx, 10*time.Second))
+	defer cancel()
+	if err := libpodPing(ctx, libpod); err != nil {
+		libpod.CloseIdleConnections()
+		lg.Debugf("podman native API endpoint 'unix://%s' failed: %s", api, err.Error())
+		return nil
+	}
+	moby, err := client.NewClientWithOpts(mobyClientOpts(ctx, api)...)
+	if err != nil {
+		libpod.CloseIdleConnections()
+		lg.Debugf("podman API endpoint 'unix://%s' failed: %s", api, err.Error())
+		return nil
+	}
+	if _, err := moby.Info(ctx); err != nil {
+		libpod.CloseIdleConnections()
+		moby.Close()
+		lg.Debugf("podman API endpoint 'unix://%s' failed: %s", api, err.Error())
+		return nil
+	}
+	w := watcher.New(&podClient{
+		MobyWatcher: mobyengine.NewMobyWatcher(moby,
+			mobyengine.WithPID(int(pid)),
+			mobyengine.WithDemonType(Type)),
+		libpod: libpod,
+	}, nil)
+	return detect.WithAPIVersion(w, moby.ClientVersion())
+}
+
+// newLibpodHTTPClient returns a HTTP client always talking to the unix domain
+// socket at the specified API path, using the specified dialer.
+func newLibpodHTTPClient(api string, d *net.Dialer) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return d.DialContext(ctx, "unix", api)
+			},
+		},
+	}
+}
+
+// mobyClientOpts returns the Docker client options for talking to podman's
+// Docker-compatible API at the specified API path, using the custom dialer
+// passed in the specified context, if any.
+func mobyClientOpts(ctx context.Context, api string) []client.Opt {
+	opts := []client.Opt{
+		client.FromEnv,
+		client.WithAPIVersionNegotiation(),
+		client.WithHost("unix://" + api),
+	}
+	if dial := detect.DialContextFunc(ctx, api); dial != nil {
+		opts = append(opts, client.WithDialContext(dial))
+	}
+	return opts
+}
+
+// libpodPing checks that podman's native API is available, returning nil if
+// it is.
+func libpodPing(ctx context.Context, libpod *http.Client) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, libpodBaseURL+"/_ping", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := libpod.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Libpod-Api-Version") == "" {
+		return fmt.Errorf("no native podman API, status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close cleans up and releases any engine client resources.
+func (c *podClient) Close() {
+	c.libpod.CloseIdleConnections()
+	c.MobyWatcher.Close()
+}
+
+// List all the currently alive and kicking containers, together with their
+// pod memberships.
+func (c *podClient) List(ctx context.Context) ([]*whalewatcher.Container, error) {
+	lg := detect.LoggerFrom(ctx)
+	containers, err := c.MobyWatcher.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := c.pods(ctx, "")
+	if err != nil {
+		lg.Debugf("cannot determine pods from podman native API, reason: %s", err.Error())
+		return containers, nil
+	}
+	for _, container := range containers {
+		addPodLabels(container, pods[container.ID])
+	}
+	return containers, nil
+}
+
+// Inspect (only) those container details of interest to us, including pod
+// membership, given the name or ID of a container.
+func (c *podClient) Inspect(ctx context.Context, nameorid string) (*whalewatcher.Container, error) {
+	lg := detect.LoggerFrom(ctx)
+	container, err := c.MobyWatcher.Inspect(ctx, nameorid)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := c.pods(ctx, container.ID)
+	if err != nil {
+		lg.Debugf("cannot determine pod from podman native API, reason: %s", err.Error())
+		return container, nil
+	}
+	addPodLabels(container, pods[container.ID])
+	return container, nil
+}
+
+// pods returns the pod-related container details, optionally only for the
+// container with the specified ID. The details are indexed by container ID.
+func (c *podClient) pods(ctx context.Context, id string) (map[string]libpodContainer, error) {
+	u := libpodBaseURL + "/containers/json"
+	if id != "" {
+		u += "?filters=" + url.QueryEscape(`{"id":["`+id+`"]}`)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.libpod.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing containers failed with status %d", resp.StatusCode)
+	}
+	var containers []libpodContainer
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return nil, err
+	}
+	pods := make(map[string]libpodContainer, len(containers))
+	for _, container := range containers {
+		pods[container.ID] = container
+	}
+	return pods, nil
+}
+
+// addPodLabels adds the pod ID and name labels to the specified container, if
+// it belongs to a pod.
+func addPodLabels(container *whalewatcher.Container, details libpodContainer) {
+	if details.Pod == "" {
+		return
+	}
+	if container.Labels == nil {
+		container.Labels = map[string]string{}
+	}
+	container.Labels[PodIDLabel] = details.Pod
+	container.Labels[PodNameLabel] = details.PodName
+}
@@ -0,0 +1,110 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package podman
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"path/filepath"
+
+	"github.com/thediveo/whalewatcher"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// startFakeLibpod serves a minimal fake podman native API on a unix domain
+// socket, returning the socket path.
+func startFakeLibpod() string {
+	GinkgoHelper()
+	api := filepath.Join(GinkgoT().TempDir(), "podman.sock")
+	l, err := net.Listen("unix", api)
+	Expect(err).NotTo(HaveOccurred())
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Api-Version", "1.41")
+		_, _ = w.Write([]byte("OK"))
+	})
+	mux.HandleFunc("/v1.41/info", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("/libpod/_ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Libpod-Api-Version", "4.9.3")
+		_, _ = w.Write([]byte("OK"))
+	})
+	mux.HandleFunc("/libpod/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("filters") != "" {
+			_, _ = w.Write([]byte(`[{"Id":"abc","Pod":"p0d","PodName":"peas"}]`))
+			return
+		}
+		_, _ = w.Write([]byte(`[{"Id":"abc","Pod":"p0d","PodName":"peas"},{"Id":"def"}]`))
+	})
+	srv := &http.Server{Handler: mux}
+	go func() { _ = srv.Serve(l) }()
+	DeferCleanup(func() { _ = srv.Close() })
+	return api
+}
+
+var _ = Describe("podman native API", func() {
+
+	It("rejects non-podman API endpoints", func(ctx context.Context) {
+		api := filepath.Join(GinkgoT().TempDir(), "docker.sock")
+		l, err := net.Listen("unix", api)
+		Expect(err).NotTo(HaveOccurred())
+		srv := &http.Server{Handler: http.NotFoundHandler()}
+		go func() { _ = srv.Serve(l) }()
+		defer srv.Close()
+
+		libpod := newLibpodHTTPClient(api, &net.Dialer{})
+		defer libpod.CloseIdleConnections()
+		Expect(libpodPing(ctx, libpod)).To(HaveOccurred())
+	})
+
+	It("prefers the native API only when told so", func(ctx context.Context) {
+		Expect(PreferNativeAPI(ctx)).To(BeFalse())
+		Expect(PreferNativeAPI(WithPreferNativeAPI(ctx))).To(BeTrue())
+	})
+
+	It("falls back when the native API isn't available", func(ctx context.Context) {
+		api := filepath.Join(GinkgoT().TempDir(), "podman.sock")
+		Expect(newNativeWatcher(ctx, 42, api)).To(BeNil())
+	})
+
+	It("reports the negotiated API version", func(ctx context.Context) {
+		api := startFakeLibpod()
+		w := newNativeWatcher(ctx, 42, api)
+		Expect(w).NotTo(BeNil())
+		defer w.Close()
+		Expect(w).To(HaveField("APIVersion()", "1.41"))
+	})
+
+	It("labels containers with their pods", func(ctx context.Context) {
+		api := startFakeLibpod()
+		libpod := newLibpodHTTPClient(api, &net.Dialer{})
+		defer libpod.CloseIdleConnections()
+		Expect(libpodPing(ctx, libpod)).To(Succeed())
+
+		c := &podClient{libpod: libpod}
+		pods, err := c.pods(ctx, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pods).To(HaveLen(2))
+
+		podded := &whalewatcher.Container{ID: "abc"}
+		addPodLabels(podded, pods[podded.ID])
+		Expect(podded.Labels).To(And(
+			HaveKeyWithValue(PodIDLabel, "p0d"),
+			HaveKeyWithValue(PodNameLabel, "peas")))
+
+		loner := &whalewatcher.Container{ID: "def"}
+		addPodLabels(loner, pods[loner.ID])
+		Expect(loner.Labels).To(BeEmpty())
+
+		pods, err = c.pods(ctx, "abc")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pods).To(HaveLen(1))
+	})
+
+})
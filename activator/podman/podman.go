@@ -10,12 +10,11 @@ import (
 
 	"github.com/docker/docker/client" // priceless
 	"github.com/siemens/turtlefinder/activator"
+	detect "github.com/siemens/turtlefinder/detector"
 	"github.com/thediveo/go-plugger/v3"
-	"github.com/thediveo/lxkns/log"
 	"github.com/thediveo/lxkns/model"
 	mobyengine "github.com/thediveo/whalewatcher/engineclient/moby"
 	"github.com/thediveo/whalewatcher/watcher"
-	"github.com/thediveo/whalewatcher/watcher/moby"
 )
 
 // Type identifying podman workloads and as returned by Watcher.Type().
@@ -28,20 +27,47 @@ func init() {
 		&Engine{}, plugger.WithPlugin("podman"))
 }
 
+// Engine finds socket-activated podman engines and creates workload watchers
+// for them.
 type Engine struct{}
 
+// preferNativeAPIKey is the context key for telling the podman engine finder
+// to prefer podman's native API.
+type preferNativeAPIKey struct{}
+
+// WithPreferNativeAPI returns a new context telling the podman engine finder
+// to prefer podman's native “libpod” API when available, in order to
+// additionally label containers with the ID and name of the pod they belong to
+// (using the [PodIDLabel] and [PodNameLabel] labels). If podman's native API
+// cannot be reached, the podman engine finder falls back to podman's
+// Docker-compatible API.
+func WithPreferNativeAPI(ctx context.Context) context.Context {
+	return context.WithValue(ctx, preferNativeAPIKey{}, true)
+}
+
+// PreferNativeAPI returns true if the specified context tells the podman engine
+// finder to prefer podman's native API, see also [WithPreferNativeAPI].
+func PreferNativeAPI(ctx context.Context) bool {
+	prefer, _ := ctx.Value(preferNativeAPIKey{}).(bool)
+	return prefer
+}
+
 // Ident returns information in order to detect engine API endpoints and
 // their corresponding container engine processes.
 func (e *Engine) Ident() activator.EngineIdentification {
 	return activator.EngineIdentification{
 		APIEndpointSuffix: "podman.sock",
 		ProcessName:       "podman", // don't call it "podmand"...!
+		// A podman service re-executing itself, such as when rootless,
+		// does so via /proc/self/exe and thus shows up as "exe".
+		AltProcessNames: []string{"exe"},
 	}
 }
 
 // NewWatcher returns a watcher tracking the alive container workload of the
 // container engine accessible by the specified API path.
 func (e *Engine) NewWatcher(ctx context.Context, pid model.PIDType, api string) watcher.Watcher {
+	lg := detect.LoggerFrom(ctx)
 	var err error
 	var w watcher.Watcher
 	defer func() {
@@ -50,6 +76,16 @@ func (e *Engine) NewWatcher(ctx context.Context, pid model.PIDType, api string)
 		}
 	}()
 
+	// When asked to, try podman's native API first in order to additionally
+	// gather pod details; if this fails, fall back to the Docker API.
+	if PreferNativeAPI(ctx) {
+		lg.Debugf("dialing podman native endpoint 'unix://%s'", api)
+		if w = newNativeWatcher(ctx, pid, api); w != nil {
+			return w
+		}
+		lg.Debugf("falling back to podman's Docker-compatible API at 'unix://%s'", api)
+	}
+
 	// We use the Docker API on podman, not least as the podman-specific API is
 	// very-very hard to use in production (as the @thediveo/sealwatcher
 	// experiment unfortunately has shown) and the podman developers basically
@@ -61,25 +97,26 @@ func (e *Engine) NewWatcher(ctx context.Context, pid model.PIDType, api string)
 	// not sufficient to just create the watcher, we also need to check that we
 	// actually can successfully talk with the daemon. Querying the daemon's
 	// info sufficies and ensures that a partiular API path is useful.
-	log.Debugf("dialing podman endpoint 'unix://%s'", api)
-	w, err = moby.New("unix://"+api, nil,
-		mobyengine.WithPID(int(pid)),
-		mobyengine.WithDemonType(Type))
+	lg.Debugf("dialing podman endpoint 'unix://%s'", api)
+	cl, err := client.NewClientWithOpts(mobyClientOpts(ctx, api)...)
 	if err != nil {
-		log.Debugf("podman API endpoint 'unix://%s' failed: %s", api, err.Error())
+		lg.Debugf("podman API endpoint 'unix://%s' failed: %s", api, err.Error())
 		return nil
 	}
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	w = watcher.New(mobyengine.NewMobyWatcher(cl,
+		mobyengine.WithPID(int(pid)),
+		mobyengine.WithDemonType(Type)), nil)
+	ctx, cancel := context.WithTimeout(ctx, detect.ClientTimeout(ctx, 10*time.Second))
 	defer cancel()
 	_, err = w.Client().(*client.Client).Info(ctx)
 	if ctxerr := ctx.Err(); ctxerr != nil {
 		err = ctxerr
-		log.Debugf("Docker API Info call context hit deadline: %s", err.Error())
+		lg.Debugf("Docker API Info call context hit deadline: %s", err.Error())
 		return nil
 	}
 	if err != nil {
-		log.Debugf("podman API endpoint 'unix://%s' failed: %s", api, err.Error())
+		lg.Debugf("podman API endpoint 'unix://%s' failed: %s", api, err.Error())
 		return nil
 	}
-	return w
+	return detect.WithAPIVersion(w, w.Client().(*client.Client).ClientVersion())
 }
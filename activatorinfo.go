@@ -0,0 +1,106 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/thediveo/lxkns/model"
+)
+
+// ActivatorInfo describes a socket activator currently known, together with
+// the listening unix domain sockets observed at it.
+//
+// The Hash over the socket file descriptors of a socket activator changes
+// whenever the socket activator gets reconfigured, such as when socket units
+// get added, changed, or removed. A steadily climbing HashChanges count thus
+// signals a misbehaving socket activator, such as one whose socket units get
+// rewritten over and over again by some buggy generator, causing constant
+// rediscoveries.
+type ActivatorInfo struct {
+	PID         model.PIDType     // PID of socket activator process.
+	Name        string            // process name of socket activator.
+	Sockets     []ActivatorSocket // observed listening sockets, sorted by path.
+	Hash        uint64            // current hash over the socket fds; zero if not read yet.
+	HashChanges uint64            // number of times the hash changed since the activator was found.
+}
+
+// ActivatorSocket describes a listening unix domain socket observed at a socket
+// activator.
+type ActivatorSocket struct {
+	Path   string // path of socket in the mount namespace of the socket activator.
+	Ino    uint64 // inode number of socket.
+	Engine string // name of the engine finder plugin matching this socket; "" if none.
+}
+
+// Activators returns information about the socket activators currently known,
+// sorted by their PIDs. For each socket activator, the listening unix domain
+// sockets observed at it are included, telling which sockets have been
+// matched to a socket-activatable container engine (such as a podman
+// service), and which haven't.
+//
+// Please note that a matched socket doesn't imply that its container engine
+// has been successfully activated and is now being monitored; please see
+// [TurtleFinder.Engines] for the engines currently monitored.
+func (f *TurtleFinder) Activators() []ActivatorInfo {
+	f.mux.Lock()
+	activators := make([]*socketActivatorProcess, 0, len(f.activators))
+	for _, activator := range f.activators {
+		activators = append(activators, activator)
+	}
+	f.mux.Unlock()
+	infos := make([]ActivatorInfo, 0, len(activators))
+	for _, activator := range activators {
+		infos = append(infos, activator.info())
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].PID < infos[j].PID
+	})
+	return infos
+}
+
+// info returns information about this socket activator and the listening
+// sockets observed at it.
+func (s *socketActivatorProcess) info() ActivatorInfo {
+	s.mu.Lock()
+	sockets := make([]ActivatorSocket, 0, len(s.observed))
+	for ino, path := range s.observed {
+		sockets = append(sockets, ActivatorSocket{Path: path, Ino: ino})
+	}
+	s.mu.Unlock()
+	for idx := range sockets {
+		sockets[idx].Engine = s.enginePluginName(sockets[idx].Path)
+	}
+	sort.Slice(sockets, func(i, j int) bool {
+		return sockets[i].Path < sockets[j].Path
+	})
+	hash, changes := s.configHash()
+	return ActivatorInfo{
+		PID:         s.proc.PID,
+		Name:        s.proc.Name,
+		Sockets:     sockets,
+		Hash:        hash,
+		HashChanges: changes,
+	}
+}
+
+// enginePluginName returns the name of the (allowed) engine finder plugin
+// responsible for the specified API endpoint path, or "" if there is none.
+func (s *socketActivatorProcess) enginePluginName(api string) string {
+	if api == "" {
+		return ""
+	}
+	for _, plugin := range s.demonDetectorPlugins {
+		if !strings.HasSuffix(api, plugin.ident.APIEndpointSuffix) {
+			continue
+		}
+		if !s.enginefilter.allowsPlugin(plugin.pluginname) {
+			return ""
+		}
+		return plugin.pluginname
+	}
+	return ""
+}
@@ -0,0 +1,106 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+
+	"github.com/siemens/turtlefinder/activator"
+	"github.com/thediveo/lxkns/model"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("socket activator information", func() {
+
+	It("reports no socket activators", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx })
+		defer tf.Close()
+		Expect(tf.Activators()).To(BeEmpty())
+	})
+
+	It("reports socket activators and their sockets", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx })
+		defer tf.Close()
+		plugins := []*demonFinderPlugin{
+			{
+				ident:      activator.EngineIdentification{APIEndpointSuffix: "/podman/podman.sock", ProcessName: "podman"},
+				pluginname: "podman",
+			},
+			{
+				ident:      activator.EngineIdentification{APIEndpointSuffix: "/docker.sock", ProcessName: "dockerd"},
+				pluginname: "dockerd",
+			},
+		}
+		tf.activators[42] = &socketActivatorProcess{
+			proc:                 &model.Process{PID: 42, ProTaskCommon: model.ProTaskCommon{Name: "systemd"}},
+			demonDetectorPlugins: plugins,
+			observed: map[uint64]string{
+				666: "/run/podman/podman.sock",
+				123: "/run/foo.sock",
+				1:   "",
+			},
+		}
+		tf.activators[1] = &socketActivatorProcess{
+			proc:                 &model.Process{PID: 1, ProTaskCommon: model.ProTaskCommon{Name: "systemd"}},
+			demonDetectorPlugins: plugins,
+			enginefilter:         newEngineTypeFilter([]string{"podman"}),
+			observed: map[uint64]string{
+				777: "/run/docker.sock",
+			},
+		}
+
+		var o ActivatorOverseer = tf
+		Expect(o.Activators()).To(HaveExactElements(
+			And(
+				HaveField("PID", model.PIDType(1)),
+				HaveField("Sockets", HaveExactElements(
+					ActivatorSocket{Path: "/run/docker.sock", Ino: 777},
+				)),
+			),
+			And(
+				HaveField("PID", model.PIDType(42)),
+				HaveField("Name", "systemd"),
+				HaveField("Sockets", HaveExactElements(
+					ActivatorSocket{Path: "", Ino: 1},
+					ActivatorSocket{Path: "/run/foo.sock", Ino: 123},
+					ActivatorSocket{Path: "/run/podman/podman.sock", Ino: 666, Engine: "podman"},
+				)),
+			),
+		))
+	})
+
+	It("reports socket activator reconfigurations", func(ctx context.Context) {
+		useSockFS(&memSockFS{})
+		tf := New(func() context.Context { return ctx })
+		defer tf.Close()
+		s := &socketActivatorProcess{
+			proc:     &model.Process{PID: 42, ProTaskCommon: model.ProTaskCommon{Name: "systemd"}},
+			procroot: "/proc",
+			observed: map[uint64]string{},
+		}
+		tf.activators[42] = s
+		Expect(tf.Activators()).To(ConsistOf(And(
+			HaveField("Hash", BeZero()),
+			HaveField("HashChanges", BeZero()))))
+
+		_ = s.discoverAPIPaths(nil, 0x1234, 1, nil)
+		s.rediscover()
+		_ = s.discoverAPIPaths(nil, 0x1234, 2, nil)
+		Expect(tf.Activators()).To(ConsistOf(And(
+			HaveField("Hash", uint64(0x1234)),
+			HaveField("HashChanges", BeZero()))))
+
+		_ = s.discoverAPIPaths(nil, 0x5678, 3, nil)
+		_ = s.discoverAPIPaths(nil, 0x5678, 4, nil)
+		_ = s.discoverAPIPaths(nil, 0x9abc, 5, nil)
+		_ = s.discoverAPIPaths(nil, 0x1234, 4, nil) // outdated read.
+		Expect(tf.Activators()).To(ConsistOf(And(
+			HaveField("Hash", uint64(0x9abc)),
+			HaveField("HashChanges", uint64(2)))))
+	})
+
+})
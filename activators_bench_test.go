@@ -0,0 +1,52 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/thediveo/lxkns/model"
+)
+
+// numSyntheticActivators is the number of synthetic socket activators to
+// update in the activator update benchmarks.
+const numSyntheticActivators = 32
+
+// BenchmarkUpdateActivators benchmarks updating several socket activators
+// sequentially (using a single worker) versus in parallel. The synthetic
+// socket activators all refer to our own process, so each update reads our
+// own socket fds.
+func BenchmarkUpdateActivators(b *testing.B) {
+	for _, workers := range []int{1, 0} {
+		name := "parallel"
+		if workers == 1 {
+			name = "sequential"
+		}
+		b.Run(name, func(b *testing.B) {
+			ctx := context.Background()
+			tf := New(func() context.Context { return ctx }, WithWorkers(workers))
+			defer tf.Close()
+			for pid := model.PIDType(1); pid <= numSyntheticActivators; pid++ {
+				tf.activators[pid] = newSocketActivator(
+					&model.Process{PID: model.PIDType(os.Getpid())},
+					tf.procroot,
+					tf.initialsyncwait,
+					tf.contexter,
+					tf.enginefilter,
+					nil)
+			}
+			b.ReportMetric(float64(tf.numworkers), "workers")
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var wg sync.WaitGroup
+				tf.updateActivators(nil, nil, &wg, nil)
+				wg.Wait()
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+//go:build !turtlefinder_safe
+// +build !turtlefinder_safe
+
+package turtlefinder
+
+import "unsafe"
+
+// asString returns a string for the specified byte slice, without allocating
+// memory and without copying the contents. In consequence, the underlying byte
+// slice must not be changed while the returned string is alive. Moreover, this
+// variant of alloc-free byte slice to string conversion expects the caller to
+// always pass non-nil byte slices (which is easily guaranteed in our specific
+// contexts).
+//
+// As for the correct usage of unsafe.String please also see
+// https://go101.org/article/unsafe.html.
+func asString(b []byte) string { return unsafe.String(unsafe.SliceData(b), len(b)) }
@@ -0,0 +1,13 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+//go:build turtlefinder_safe
+// +build turtlefinder_safe
+
+package turtlefinder
+
+// asString returns a string for the specified byte slice, copying the contents.
+// This is the variant for builds using the “turtlefinder_safe” build tag that
+// must not use unsafe, at the cost of an allocation per conversion.
+func asString(b []byte) string { return string(b) }
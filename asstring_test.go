@@ -0,0 +1,35 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// Please note that these tests are shared between the default and
+// “turtlefinder_safe” builds, so both asString variants must pass them.
+var _ = Describe("byte slice to string conversion", func() {
+
+	DescribeTable("converts byte slices",
+		func(s string) {
+			b := []byte(s)
+			Expect(asString(b)).To(Equal(s))
+			Expect(len(asString(b))).To(Equal(len(b)))
+		},
+		Entry("empty", ""),
+		Entry("ASCII", "/run/docker.sock"),
+		Entry("UTF-8", "/run/🐢/podman.sock"),
+		Entry("net/unix line",
+			"0000000000000000: 00000002 00000000 00010000 0001 01 1234 /run/containerd/containerd.sock"),
+	)
+
+	It("converts byte subslices", func() {
+		b := []byte("@abstract /run/docker.sock")
+		Expect(asString(b[10:])).To(Equal("/run/docker.sock"))
+		Expect(asString(b[:0])).To(BeEmpty())
+	})
+
+})
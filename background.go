@@ -0,0 +1,60 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"time"
+
+	"github.com/thediveo/lxkns/model"
+)
+
+// startBackgroundDiscovery starts the background discovery goroutine if a
+// background discovery interval has been set using [WithBackgroundDiscovery].
+func (f *TurtleFinder) startBackgroundDiscovery() {
+	if f.bginterval <= 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(f.contexter())
+	f.bgcancel = cancel
+	f.bgdone = make(chan struct{})
+	f.logger.Infof("discovering container engines in the background every %s", f.bginterval)
+	go f.discoverInBackground(ctx)
+}
+
+// discoverInBackground periodically prunes vanished engines and looks for new
+// ones until the specified context gets cancelled, such as when closing the
+// TurtleFinder.
+func (f *TurtleFinder) discoverInBackground(ctx context.Context) {
+	defer close(f.bgdone)
+	ticker := time.NewTicker(f.bginterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		var procs model.ProcessTable
+		if f.bgprocs != nil {
+			procs = f.bgprocs()
+		}
+		if procs == nil {
+			procs = model.NewProcessTableFromProcfs(false, false, f.procroot)
+		}
+		f.refresh(ctx, procs)
+	}
+}
+
+// stopBackgroundDiscovery stops the background discovery goroutine, if any,
+// and waits for it to terminate. Stopping an already stopped background
+// discovery is a no-op.
+func (f *TurtleFinder) stopBackgroundDiscovery() {
+	if f.bgcancel == nil {
+		return
+	}
+	f.bgcancel()
+	<-f.bgdone
+}
@@ -0,0 +1,75 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/thediveo/lxkns/model"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gleak"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("background discovery", func() {
+
+	BeforeEach(func() {
+		goodgos := Goroutines()
+		DeferCleanup(func() {
+			Eventually(Goroutines).WithTimeout(goroutinesUnwindTimeout).WithPolling(goroutinesUnwindPolling).
+				ShouldNot(HaveLeaked(goodgos))
+		})
+	})
+
+	It("doesn't discover in the background by default", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx })
+		defer tf.Close()
+		Expect(tf.bgcancel).To(BeNil())
+		Expect(tf.bgdone).To(BeNil())
+	})
+
+	It("periodically discovers engines until closed", func(ctx context.Context) {
+		canarysockpath := GinkgoT().TempDir() + "/canary.sock"
+		lsock := Successful(net.Listen("unix", canarysockpath))
+		defer lsock.Close()
+
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "acceptd"}}
+		var passes atomic.Int64
+		watchctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		d := &acceptingDetector{}
+		tf := New(func() context.Context { return watchctx },
+			WithGettingOnlineWait(100*time.Millisecond),
+			WithoutSocketActivators(),
+			WithBackgroundDiscovery(50*time.Millisecond),
+			WithBackgroundDiscoveryProcesses(func() model.ProcessTable {
+				passes.Add(1)
+				return model.ProcessTable{self.PID: self}
+			}))
+		// Replacing the engine plugins races with the background discovery,
+		// so we temporarily stop it for this.
+		tf.stopBackgroundDiscovery()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "acceptd"}}
+		tf.startBackgroundDiscovery()
+
+		Eventually(tf.Engines).Should(HaveLen(1))
+		Eventually(passes.Load).Should(BeNumerically(">=", 2))
+
+		tf.Close()
+		Expect(tf.bgdone).To(BeClosed())
+		stopped := passes.Load()
+		Consistently(passes.Load).WithTimeout(150 * time.Millisecond).Should(Equal(stopped))
+		tf.Close() // must be idempotent.
+		cancel()
+	})
+
+})
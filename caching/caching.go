@@ -0,0 +1,183 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package caching
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/siemens/turtlefinder"
+	"github.com/thediveo/lxkns/containerizer"
+	"github.com/thediveo/lxkns/model"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// DefaultTTL is the time-to-live of cached container discovery results when
+// not specifying a positive TTL.
+const DefaultTTL = 5 * time.Second
+
+// CachingContainerizer wraps a [turtlefinder.TurtleFinder], serving cached
+// container discovery results for a configurable time-to-live (TTL) and
+// refreshing stale results in the background. It can be safely used from
+// multiple goroutines.
+//
+// Please note that background refreshes use the process table and PID mapper
+// of the [CachingContainerizer.Containers] call finding the cached results to
+// be stale. Callers thus get containers with PIDs (and prefixes) as of the
+// most recent discovery, which might lag behind the process table they passed
+// in.
+type CachingContainerizer struct {
+	tf  *turtlefinder.TurtleFinder
+	ctx context.Context // for background refreshes.
+	ttl time.Duration
+
+	mu         sync.Mutex
+	containers []*model.Container // most recently discovered containers.
+	discovered time.Time          // when the containers were discovered; zero if never.
+	first      chan struct{}      // closed when the first discovery has finished; nil if not started.
+	refreshing bool               // background refresh in progress.
+	closed     bool               // no more background refreshes.
+	wg         sync.WaitGroup     // background refreshes.
+}
+
+var (
+	_ containerizer.Containerizer    = (*CachingContainerizer)(nil)
+	_ turtlefinder.ActivatorOverseer = (*CachingContainerizer)(nil)
+)
+
+// New returns a new CachingContainerizer wrapping the specified
+// [turtlefinder.TurtleFinder] and serving cached container discovery results
+// for the specified TTL; a zero or negative TTL uses [DefaultTTL] instead. The
+// supplied context is used for background refreshes and should be long-running
+// in the same way as the turtlefinder's contexts for watching engines.
+func New(ctx context.Context, tf *turtlefinder.TurtleFinder, ttl time.Duration) *CachingContainerizer {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &CachingContainerizer{
+		tf:  tf,
+		ctx: ctx,
+		ttl: ttl,
+	}
+}
+
+// Containers returns the cached containers of the most recent discovery. If
+// there are no cached containers yet, Containers runs a discovery first and
+// waits for it to finish; concurrent callers wait for this first discovery
+// instead of running their own discoveries. If the cached containers are older than the TTL,
+// Containers starts a background refresh, unless there's already one in
+// progress, but still returns the stale containers.
+//
+// Each call gets its own copies of the containers and their engines, so callers
+// are free to modify them, such as when lxkns links containers to processes
+// during its discovery.
+func (c *CachingContainerizer) Containers(
+	ctx context.Context, procs model.ProcessTable, pidmap model.PIDMapper,
+) []*model.Container {
+	c.mu.Lock()
+	if c.discovered.IsZero() {
+		if first := c.first; first != nil {
+			// Another caller is already running the first discovery, so wait
+			// for it to finish and then serve its results.
+			c.mu.Unlock()
+			select {
+			case <-first:
+			case <-ctx.Done():
+				return nil
+			}
+			c.mu.Lock()
+			containers := c.containers
+			c.mu.Unlock()
+			return cloneContainers(containers)
+		}
+		first := make(chan struct{})
+		c.first = first
+		c.mu.Unlock()
+		defer close(first)
+		discovered := time.Now()
+		containers := c.tf.Containers(ctx, procs, pidmap)
+		c.store(containers, discovered)
+		return cloneContainers(containers)
+	}
+	if !c.refreshing && !c.closed && time.Since(c.discovered) >= c.ttl {
+		c.refreshing = true
+		c.wg.Add(1)
+		go c.refresh(procs, pidmap)
+	}
+	containers := c.containers
+	c.mu.Unlock()
+	return cloneContainers(containers)
+}
+
+// refresh runs a background discovery, caching its results.
+func (c *CachingContainerizer) refresh(procs model.ProcessTable, pidmap model.PIDMapper) {
+	defer c.wg.Done()
+	discovered := time.Now()
+	containers := c.tf.Containers(c.ctx, procs, pidmap)
+	c.store(containers, discovered)
+}
+
+// store caches the specified containers as discovered at the specified time,
+// unless more recent containers have already been cached in the meantime.
+func (c *CachingContainerizer) store(containers []*model.Container, discovered time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refreshing = false
+	if discovered.Before(c.discovered) {
+		return
+	}
+	c.containers = containers
+	c.discovered = discovered
+}
+
+// Close waits for any background refresh to finish and then closes the wrapped
+// turtlefinder.
+func (c *CachingContainerizer) Close() {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	c.wg.Wait()
+	c.tf.Close()
+}
+
+// Engines returns information about the container engines currently being
+// monitored by the wrapped turtlefinder.
+func (c *CachingContainerizer) Engines() []*model.ContainerEngine {
+	return c.tf.Engines()
+}
+
+// Activators returns information about the socket activators currently known
+// to the wrapped turtlefinder.
+func (c *CachingContainerizer) Activators() []turtlefinder.ActivatorInfo {
+	return c.tf.Activators()
+}
+
+// cloneContainers returns copies of the specified containers, together with
+// copies of their engines. The container labels are copied too, so that
+// modifying the copies never affects the originals.
+func cloneContainers(containers []*model.Container) []*model.Container {
+	engines := map[*model.ContainerEngine]*model.ContainerEngine{}
+	clones := make([]*model.Container, 0, len(containers))
+	for _, container := range containers {
+		clone := *container
+		clone.Labels = maps.Clone(container.Labels)
+		clone.Groups = slices.Clone(container.Groups)
+		if engine := container.Engine; engine != nil {
+			engineclone, ok := engines[engine]
+			if !ok {
+				e := *engine
+				e.Containers = make([]*model.Container, 0, len(engine.Containers))
+				engineclone = &e
+				engines[engine] = engineclone
+			}
+			engineclone.Containers = append(engineclone.Containers, &clone)
+			clone.Engine = engineclone
+		}
+		clones = append(clones, &clone)
+	}
+	return clones
+}
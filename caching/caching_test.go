@@ -0,0 +1,140 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package caching
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/siemens/turtlefinder"
+	"github.com/thediveo/lxkns/model"
+	"github.com/thediveo/whalewatcher"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gleak"
+)
+
+// slowTracer is a turtlefinder.Tracer slowing down and counting container
+// discoveries.
+type slowTracer struct {
+	discoveries atomic.Int32
+}
+
+func (t *slowTracer) Start(ctx context.Context, name string, kv ...any) (context.Context, turtlefinder.Span) {
+	if name == turtlefinder.SpanContainers {
+		t.discoveries.Add(1)
+		time.Sleep(100 * time.Millisecond)
+	}
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttributes(kv ...any) {}
+func (nopSpan) End()                    {}
+
+var _ = Describe("caching containerizer", func() {
+
+	BeforeEach(func() {
+		goodgos := Goroutines()
+		DeferCleanup(func() {
+			Eventually(Goroutines).Within(2 * time.Second).ProbeEvery(100 * time.Millisecond).
+				ShouldNot(HaveLeaked(goodgos))
+		})
+	})
+
+	It("defaults the TTL", func(ctx context.Context) {
+		c := New(ctx, turtlefinder.New(func() context.Context { return ctx }), 0)
+		defer c.Close()
+		Expect(c.ttl).To(Equal(DefaultTTL))
+	})
+
+	It("serves cached containers and refreshes them in the background", func(ctx context.Context) {
+		moby := turtlefinder.NewStaticEngine("docker.com", "moby-1", "/run/docker.sock", 42,
+			&whalewatcher.Container{ID: "1234", Name: "foo", PID: 666})
+		tf := turtlefinder.New(func() context.Context { return ctx },
+			turtlefinder.WithInjectedEngines(moby))
+		c := New(ctx, tf, 100*time.Millisecond)
+		defer c.Close()
+
+		Expect(c.Engines()).To(ConsistOf(HaveField("ID", "moby-1")))
+		Expect(c.Activators()).To(BeEmpty())
+
+		By("initially discovering synchronously")
+		containers := c.Containers(ctx, model.ProcessTable{}, nil)
+		Expect(containers).To(ConsistOf(HaveField("Name", "foo")))
+
+		By("serving cached containers within the TTL")
+		moby.Portfolio().Add(&whalewatcher.Container{ID: "5678", Name: "bar", PID: 667})
+		Expect(c.Containers(ctx, model.ProcessTable{}, nil)).To(ConsistOf(HaveField("Name", "foo")))
+
+		By("refreshing stale containers in the background")
+		time.Sleep(150 * time.Millisecond)
+		Expect(c.Containers(ctx, model.ProcessTable{}, nil)).To(ConsistOf(HaveField("Name", "foo")))
+		Eventually(func() []*model.Container {
+			return c.Containers(ctx, model.ProcessTable{}, nil)
+		}).Within(time.Second).ProbeEvery(10 * time.Millisecond).Should(ConsistOf(
+			HaveField("Name", "foo"),
+			HaveField("Name", "bar")))
+	})
+
+	It("runs only a single first discovery for concurrent callers", func(ctx context.Context) {
+		moby := turtlefinder.NewStaticEngine("docker.com", "moby-1", "/run/docker.sock", 42,
+			&whalewatcher.Container{ID: "1234", Name: "foo", PID: 666})
+		tracer := &slowTracer{}
+		c := New(ctx, turtlefinder.New(func() context.Context { return ctx },
+			turtlefinder.WithInjectedEngines(moby),
+			turtlefinder.WithTracer(tracer)), time.Hour)
+		defer c.Close()
+
+		const callers = 5
+		var wg sync.WaitGroup
+		results := make(chan []*model.Container, callers)
+		for i := 0; i < callers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results <- c.Containers(ctx, model.ProcessTable{}, nil)
+			}()
+		}
+		wg.Wait()
+		close(results)
+		Expect(tracer.discoveries.Load()).To(Equal(int32(1)))
+		for containers := range results {
+			Expect(containers).To(ConsistOf(HaveField("Name", "foo")))
+		}
+	})
+
+	It("hands out independent copies", func(ctx context.Context) {
+		moby := turtlefinder.NewStaticEngine("docker.com", "moby-1", "/run/docker.sock", 42,
+			&whalewatcher.Container{ID: "1234", Name: "foo", PID: 666, Labels: map[string]string{"bar": "baz"}},
+			&whalewatcher.Container{ID: "5678", Name: "bar", PID: 667})
+		c := New(ctx, turtlefinder.New(func() context.Context { return ctx },
+			turtlefinder.WithInjectedEngines(moby)), time.Hour)
+		defer c.Close()
+
+		containers := c.Containers(ctx, model.ProcessTable{}, nil)
+		Expect(containers).To(HaveLen(2))
+		Expect(containers[0].Engine).To(BeIdenticalTo(containers[1].Engine))
+		Expect(containers[0].Engine.Containers).To(ConsistOf(containers[0], containers[1]))
+		for _, container := range containers {
+			container.Labels["foo"] = "bar"
+			container.Engine.Containers = nil
+			container.Process = &model.Process{PID: container.PID}
+		}
+
+		containers = c.Containers(ctx, model.ProcessTable{}, nil)
+		Expect(containers).To(HaveLen(2))
+		for _, container := range containers {
+			Expect(container.Labels).NotTo(HaveKey("foo"))
+			Expect(container.Process).To(BeNil())
+			Expect(container.Engine.Containers).To(HaveLen(2))
+		}
+	})
+
+})
@@ -0,0 +1,14 @@
+/*
+Package caching provides a [CachingContainerizer] that wraps a turtlefinder in
+order to serve cached container discovery results, such as for high-QPS APIs.
+
+A CachingContainerizer hands out the most recently discovered containers until
+they get older than the configured time-to-live (TTL). Stale results are then
+refreshed in the background, while still serving the stale results in the
+meantime, so callers never block on a discovery except for the very first one.
+
+	tf := turtlefinder.New(func() context.Context { return enginectx })
+	containerizer := caching.New(enginectx, tf, 5*time.Second)
+	defer containerizer.Close()
+*/
+package caching
@@ -0,0 +1,17 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package caching
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestCaching(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "turtlefinder/caching")
+}
@@ -0,0 +1,95 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/thediveo/lxkns/model"
+)
+
+// processCgroupPaths returns the cgroup paths of the process with the
+// specified PID, as read from “/proc/[PID]/cgroup” in the proc filesystem
+// mounted at procroot. On cgroup v1 and hybrid systems there are multiple
+// cgroup paths, one for each hierarchy, whereas on pure cgroup v2 systems
+// there's only a single cgroup path. processCgroupPaths returns nil if the
+// cgroup information of the process cannot be read.
+func processCgroupPaths(procroot string, pid model.PIDType) []string {
+	cgroups, err := os.ReadFile(procroot + "/" + strconv.FormatUint(uint64(pid), 10) + "/cgroup")
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for _, line := range strings.Split(string(cgroups), "\n") {
+		// Each line has the format "hierarchy-ID:controller-list:cgroup-path".
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 || fields[2] == "" {
+			continue
+		}
+		paths = append(paths, fields[2])
+	}
+	return paths
+}
+
+// cgroupMatches returns true if any of the specified cgroup paths matches any
+// of the specified cgroup patterns. Patterns without any slash match the final
+// cgroup path element only, while patterns with slashes match the full cgroup
+// path. Malformed patterns never match.
+func cgroupMatches(paths []string, patterns []string) bool {
+	for _, pattern := range patterns {
+		full := strings.Contains(pattern, "/")
+		for _, cgpath := range paths {
+			if !full {
+				cgpath = path.Base(cgpath)
+			}
+			if ok, _ := path.Match(pattern, cgpath); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasCgroupPatterns returns true if at least one of the specified engine
+// detector plugins has cgroup patterns.
+func hasCgroupPatterns(engineplugins []enginePlugin) bool {
+	for idx := range engineplugins {
+		if len(engineplugins[idx].cgrouppatterns) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// cgroupEnginePlugin returns the engine detector plugin with cgroup patterns
+// matching the cgroup paths of the specified process, or nil if there is none.
+// The process's cgroup paths are read from the proc filesystem mounted at
+// procroot. As a cgroup, such as of a systemd service, usually contains further
+// processes besides the engine process, only the topmost process of a matching
+// cgroup is considered to be the engine process; that is, the parent process
+// must not match the same cgroup patterns.
+func cgroupEnginePlugin(procroot string, proc *model.Process, engineplugins []enginePlugin) *enginePlugin {
+	if !hasCgroupPatterns(engineplugins) {
+		return nil
+	}
+	paths := processCgroupPaths(procroot, proc.PID)
+	if paths == nil {
+		return nil
+	}
+	for idx := range engineplugins {
+		if !cgroupMatches(paths, engineplugins[idx].cgrouppatterns) {
+			continue
+		}
+		if proc.PPID != 0 && cgroupMatches(
+			processCgroupPaths(procroot, proc.PPID), engineplugins[idx].cgrouppatterns) {
+			return nil
+		}
+		return &engineplugins[idx]
+	}
+	return nil
+}
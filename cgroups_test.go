@@ -0,0 +1,113 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/thediveo/lxkns/model"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// cgroupDetector is an endpointlessDetector that additionally has cgroup
+// patterns.
+type cgroupDetector struct {
+	endpointlessDetector
+	patterns []string
+}
+
+func (d *cgroupDetector) CgroupPatterns() []string { return d.patterns }
+
+var _ = Describe("cgroup-based engine detection", func() {
+
+	It("reads cgroup paths", func() {
+		procroot := GinkgoT().TempDir()
+		Expect(processCgroupPaths(procroot, 42)).To(BeNil())
+
+		Expect(os.MkdirAll(filepath.Join(procroot, "42"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(procroot, "42", "cgroup"), []byte(
+			"12:pids:/system.slice/docker.service\n"+
+				"1:name=systemd:/system.slice/docker.service\n"+
+				"0::/system.slice/docker.service\n"+
+				"garbage\n"), 0644)).To(Succeed())
+		Expect(processCgroupPaths(procroot, 42)).To(HaveExactElements(
+			"/system.slice/docker.service",
+			"/system.slice/docker.service",
+			"/system.slice/docker.service"))
+	})
+
+	DescribeTable("matching cgroup patterns",
+		func(paths []string, patterns []string, expected bool) {
+			Expect(cgroupMatches(paths, patterns)).To(Equal(expected))
+		},
+		Entry(nil, []string{"/system.slice/docker.service"}, []string{"docker.service"}, true),
+		Entry(nil, []string{"/system.slice/docker.service"}, []string{"docker.*"}, true),
+		Entry(nil, []string{"/system.slice/docker.service"}, []string{"/system.slice/docker.service"}, true),
+		Entry(nil, []string{"/system.slice/docker.service"}, []string{"/*/docker.service"}, true),
+		Entry(nil, []string{"/system.slice/docker.service"}, []string{"docker.socket", "system.slice"}, false),
+		Entry(nil, []string{"/system.slice/docker.service"}, []string{"/docker.service"}, false),
+		Entry(nil, []string{"/system.slice/docker.service"}, []string{"["}, false),
+		Entry(nil, nil, []string{"docker.service"}, false),
+	)
+
+	It("considers only the topmost process of a cgroup", func() {
+		procroot := GinkgoT().TempDir()
+		for pid, cgroup := range map[string]string{
+			"1":  "/init.scope",
+			"42": "/system.slice/docker.service",
+			"43": "/system.slice/docker.service",
+		} {
+			Expect(os.MkdirAll(filepath.Join(procroot, pid), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(procroot, pid, "cgroup"),
+				[]byte("0::"+cgroup+"\n"), 0644)).To(Succeed())
+		}
+		plugins := []enginePlugin{{cgrouppatterns: []string{"docker.service"}, pluginname: "dockerd"}}
+		dockerd := &model.Process{PID: 42, PPID: 1}
+		proxy := &model.Process{PID: 43, PPID: 42}
+		Expect(cgroupEnginePlugin(procroot, dockerd, plugins)).To(BeIdenticalTo(&plugins[0]))
+		Expect(cgroupEnginePlugin(procroot, proxy, plugins)).To(BeNil())
+	})
+
+	It("detects engine processes by their cgroups", func(ctx context.Context) {
+		cgpaths := processCgroupPaths(defaultProcRoot, model.PIDType(os.Getpid()))
+		if len(cgpaths) == 0 {
+			Skip("no cgroup information available")
+		}
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "exe"}}
+		procs := model.ProcessTable{self.PID: self}
+
+		d := &cgroupDetector{patterns: []string{"/rumpelpumpel/" + strconv.Itoa(os.Getpid())}}
+		tf := New(func() context.Context { return ctx }, WithGettingOnlineWait(100*time.Millisecond))
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{
+			names:          d.EngineNames(),
+			cgrouppatterns: d.CgroupPatterns(),
+			detector:       d,
+			pluginname:     "endlessd",
+		}}
+		_ = tf.Containers(ctx, procs, nil)
+		Expect(tf.Engines()).To(BeEmpty())
+
+		d.patterns = []string{cgpaths[0]}
+		tf = New(func() context.Context { return ctx }, WithGettingOnlineWait(100*time.Millisecond))
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{
+			names:          d.EngineNames(),
+			cgrouppatterns: d.CgroupPatterns(),
+			detector:       d,
+			pluginname:     "endlessd",
+		}}
+		_ = tf.Containers(ctx, procs, nil)
+		Expect(tf.Engines()).To(ConsistOf(HaveField("Type", "idle")))
+	})
+
+})
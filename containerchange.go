@@ -0,0 +1,119 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"sync"
+
+	"github.com/thediveo/whalewatcher"
+	"github.com/thediveo/whalewatcher/engineclient"
+	"github.com/thediveo/whalewatcher/watcher"
+)
+
+// ContainerChange describes a container lifecycle change of a container
+// managed by a container engine the turtlefinder monitors, see also
+// [WithContainerChangeHandler].
+type ContainerChange struct {
+	Type      engineclient.ContainerEventType // started, exited, paused, or unpaused.
+	Container *whalewatcher.Container         // container details as known to the engine's watcher.
+	Engine    *Engine                         // engine managing the container.
+}
+
+// containerChanges subscribes to the container lifecycle events of workload
+// watchers and forwards them to a container change handler, together with the
+// Engine of a watcher. As the Engine objects only get created after the
+// watchers have started watching, and thus after the initial synchronization
+// has been kicked off, containerChanges subscribes to watchers as soon as they
+// have been created and buffers events until the Engine of a watcher becomes
+// known.
+type containerChanges struct {
+	handler func(change ContainerChange)
+
+	mu      sync.Mutex
+	pending map[watcher.Watcher]chan *Engine // watchers still waiting for their Engine.
+}
+
+// newContainerChanges returns a new containerChanges forwarder for the
+// specified handler, or nil if handler is nil.
+func newContainerChanges(handler func(change ContainerChange)) *containerChanges {
+	if handler == nil {
+		return nil
+	}
+	return &containerChanges{
+		handler: handler,
+		pending: map[watcher.Watcher]chan *Engine{},
+	}
+}
+
+// subscribe to the container lifecycle events of the specified watcher, which
+// must not have started watching yet. The events then get forwarded as soon as
+// the Engine of the watcher becomes known via bind. Forwarding ends when the
+// watcher gets closed. subscribe is a no-op on a nil containerChanges.
+func (c *containerChanges) subscribe(w watcher.Watcher) {
+	if c == nil {
+		return
+	}
+	enginech := make(chan *Engine, 1)
+	c.mu.Lock()
+	c.pending[w] = enginech
+	c.mu.Unlock()
+	evs := w.Events()
+	go func() {
+		defer c.forget(w)
+		var engine *Engine
+		var backlog []watcher.ContainerEvent
+		for {
+			select {
+			case engine = <-enginech:
+				enginech = nil // we won't ever receive any other engine.
+				for _, ev := range backlog {
+					c.forward(ev, engine)
+				}
+				backlog = nil
+			case ev, ok := <-evs:
+				if !ok {
+					return
+				}
+				if engine == nil {
+					backlog = append(backlog, ev)
+					continue
+				}
+				c.forward(ev, engine)
+			}
+		}
+	}()
+}
+
+// bind the specified Engine to its previously subscribed watcher, so that the
+// container lifecycle events of the watcher now get forwarded. bind is a no-op
+// on a nil containerChanges or if the engine's watcher hasn't been subscribed.
+func (c *containerChanges) bind(e *Engine) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	enginech, ok := c.pending[e.Watcher]
+	delete(c.pending, e.Watcher)
+	c.mu.Unlock()
+	if ok {
+		enginech <- e
+	}
+}
+
+// forget the specified watcher, in case it never got bound to an Engine.
+func (c *containerChanges) forget(w watcher.Watcher) {
+	c.mu.Lock()
+	delete(c.pending, w)
+	c.mu.Unlock()
+}
+
+// forward the specified container lifecycle event to the handler.
+func (c *containerChanges) forward(ev watcher.ContainerEvent, e *Engine) {
+	c.handler(ContainerChange{
+		Type:      ev.Type,
+		Container: ev.Container,
+		Engine:    e,
+	})
+}
@@ -0,0 +1,144 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/thediveo/lxkns/model"
+	"github.com/thediveo/whalewatcher"
+	"github.com/thediveo/whalewatcher/engineclient"
+	"github.com/thediveo/whalewatcher/watcher"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gleak"
+)
+
+// eventingWatcher is an idleWatcher with container lifecycle events under the
+// control of a test.
+type eventingWatcher struct {
+	idleWatcher
+	events    chan watcher.ContainerEvent
+	closeonce sync.Once
+}
+
+func newEventingWatcher() *eventingWatcher {
+	return &eventingWatcher{
+		idleWatcher: idleWatcher{ready: make(chan struct{})},
+		events:      make(chan watcher.ContainerEvent, 10),
+	}
+}
+
+func (w *eventingWatcher) Events() <-chan watcher.ContainerEvent { return w.events }
+func (w *eventingWatcher) Close()                                { w.closeonce.Do(func() { close(w.events) }) }
+
+// eventingDetector returns a single eventingWatcher per engine process.
+type eventingDetector struct {
+	mu       sync.Mutex
+	watchers []*eventingWatcher
+}
+
+func (d *eventingDetector) EngineNames() []string { return []string{"eventd"} }
+func (d *eventingDetector) Endpointless()         {}
+
+func (d *eventingDetector) NewWatchers(ctx context.Context, pid model.PIDType, apis []string) []watcher.Watcher {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	w := newEventingWatcher()
+	d.watchers = append(d.watchers, w)
+	return []watcher.Watcher{w}
+}
+
+var _ = Describe("container changes", func() {
+
+	BeforeEach(func() {
+		goodgos := Goroutines()
+		DeferCleanup(func() {
+			Eventually(Goroutines).Within(2 * time.Second).ProbeEvery(100 * time.Millisecond).
+				ShouldNot(HaveLeaked(goodgos))
+		})
+	})
+
+	It("doesn't forward without a handler", func() {
+		cc := newContainerChanges(nil)
+		Expect(cc).To(BeNil())
+		Expect(func() {
+			cc.subscribe(newEventingWatcher())
+			cc.bind(&Engine{})
+		}).NotTo(Panic())
+	})
+
+	It("buffers events until the engine becomes known", func() {
+		changes := make(chan ContainerChange, 10)
+		cc := newContainerChanges(func(change ContainerChange) { changes <- change })
+
+		w := newEventingWatcher()
+		defer w.Close()
+		cc.subscribe(w)
+		w.events <- watcher.ContainerEvent{
+			Type:      engineclient.ContainerStarted,
+			Container: &whalewatcher.Container{ID: "1234", Name: "foo"},
+		}
+		Consistently(changes).WithTimeout(100 * time.Millisecond).ShouldNot(Receive())
+
+		e := &Engine{Watcher: w}
+		cc.bind(e)
+		Eventually(changes).Should(Receive(And(
+			HaveField("Type", engineclient.ContainerStarted),
+			HaveField("Container.Name", "foo"),
+			HaveField("Engine", BeIdenticalTo(e)))))
+
+		w.events <- watcher.ContainerEvent{
+			Type:      engineclient.ContainerExited,
+			Container: &whalewatcher.Container{ID: "1234", Name: "foo"},
+		}
+		Eventually(changes).Should(Receive(
+			HaveField("Type", engineclient.ContainerExited)))
+	})
+
+	It("stops forwarding when the watcher gets closed without an engine", func() {
+		cc := newContainerChanges(func(change ContainerChange) {})
+		w := newEventingWatcher()
+		cc.subscribe(w)
+		w.Close()
+		Eventually(func() int {
+			cc.mu.Lock()
+			defer cc.mu.Unlock()
+			return len(cc.pending)
+		}).Should(BeZero())
+	})
+
+	It("forwards container changes of discovered engines", func(ctx context.Context) {
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "eventd"}}
+		changes := make(chan ContainerChange, 10)
+		d := &eventingDetector{}
+		tf := New(func() context.Context { return ctx },
+			WithGettingOnlineWait(100*time.Millisecond),
+			WithContainerChangeHandler(func(change ContainerChange) { changes <- change }))
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "eventd"}}
+		_ = tf.Containers(ctx, model.ProcessTable{self.PID: self}, nil)
+		Expect(tf.Engines()).To(HaveLen(1))
+
+		d.mu.Lock()
+		Expect(d.watchers).To(HaveLen(1))
+		w := d.watchers[0]
+		d.mu.Unlock()
+		w.events <- watcher.ContainerEvent{
+			Type:      engineclient.ContainerPaused,
+			Container: &whalewatcher.Container{ID: "1234", Name: "foo", Paused: true},
+		}
+		Eventually(changes).Should(Receive(And(
+			HaveField("Type", engineclient.ContainerPaused),
+			HaveField("Container.ID", "1234"),
+			HaveField("Engine.ID", "idle"))))
+	})
+
+})
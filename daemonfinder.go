@@ -17,8 +17,17 @@ import (
 // specified (unix domain) socket, returning the process PID. If a suitable
 // child process cannot be found, a zero PID is returned instead.
 //
-// In order to slightly optimize, findDaemon only looks at the direct child
-// processes of the additionally specified parent, or socket activator.
+// In order to slightly optimize, findDaemon only looks at the child processes
+// of the additionally specified parent, or socket activator, as well as their
+// descendants with the same name.
+//
+// The latter is necessary to cope with rootless engines, such as rootless
+// podman, that on start re-execute themselves inside a new user namespace: the
+// service process with the activator as its parent then just waits for the
+// re-executed child process that actually serves the API. As both processes
+// share the listening socket fd, findDaemon returns the PID of the deepest
+// descendant serving the socket. As PIDs are unaffected by user namespaces,
+// there's no need to map any PIDs though.
 //
 // Unfortunately, we have to take this longer route, as the peer credentials
 // returned when connecting to a daemon API socket are specifying the PID of the
@@ -41,50 +50,185 @@ import (
 //
 // And finally, how's that old adage? “Don't call it daemon”
 //
+// The PIDs are relative to the proc filesystem mounted at procroot.
+//
 // [proc(5) man page]: https://man7.org/linux/man-pages/man5/proc.5.html
-func findDaemon(ppid model.PIDType, name string, udsino uint64) model.PIDType {
+func findDaemon(procroot string, ppid model.PIDType, name string, udsino uint64) model.PIDType {
 	// It's quicker to compare the fd (pseudo) link target strings than to parse
 	// each one individually and converting them to numbers.
 	sockettext := "socket:[" + strconv.FormatUint(udsino, 10) + "]"
-	// In the same vein, a string compare for the PPID is simpler than all the
-	// string to number conversions...
-	ppidtext := strconv.FormatInt(int64(ppid), 10) + " "
 
-	pids, err := unsorted.ReadDir("/proc")
+	pids, err := unsorted.ReadDir(procroot)
 	if err != nil {
 		return 0
 	}
+	// Gather all processes with the sought-after name, together with their
+	// PPIDs. In the same vein as before, we keep the PIDs and PPIDs in text
+	// format, as this is simpler than all the string to number conversions...
+	named := map[string]string{}
 	for _, pid := range pids {
-		base := "/proc/" + pid.Name() + "/"
-		stat, err := os.ReadFile(base + "stat")
+		stat, err := os.ReadFile(procroot + "/" + pid.Name() + "/stat")
 		if err != nil {
 			continue
 		}
-		if !processStatusMatch(string(stat), name, ppidtext) {
-			continue
-		}
-		// Now check that it is in fact the correct daemon process, that is, the
-		// one that serves the specified (listening) unix domain socket...
-		fdbase := base + "fd"
-		fds, err := unsorted.ReadDir(fdbase)
-		if err != nil {
+		ppidtext, ok := processStatusPPID(string(stat), name)
+		if !ok {
 			continue
 		}
-		fdbase += "/"
-		for _, fd := range fds {
-			link, err := os.Readlink(fdbase + fd.Name())
-			if err != nil {
-				continue
-			}
-			if link != sockettext {
+		named[pid.Name()] = ppidtext
+	}
+	// Now descend from the specified parent process generation by generation
+	// through the named processes, checking that a process is in fact the
+	// correct daemon process, that is, the one that serves the specified
+	// (listening) unix domain socket...
+	var found string
+	parents := map[string]struct{}{strconv.FormatInt(int64(ppid), 10): {}}
+	for generation := 0; len(parents) > 0 && generation < maxDaemonGenerations; generation++ {
+		children := map[string]struct{}{}
+		for pid, ppidtext := range named {
+			if _, ok := parents[ppidtext]; !ok {
 				continue
 			}
-			// It's a match, but now we need to return the PID...
-			pid, err := strconv.ParseInt(pid.Name(), 10, 32)
-			if err != nil {
-				return 0
+			children[pid] = struct{}{}
+			if servesSocket(procroot+"/"+pid+"/", sockettext) {
+				found = pid
 			}
-			return model.PIDType(pid)
+		}
+		parents = children
+	}
+	if found == "" {
+		return 0
+	}
+	// It's a match, but now we need to return the PID...
+	pid, err := strconv.ParseInt(found, 10, 32)
+	if err != nil {
+		return 0
+	}
+	return model.PIDType(pid)
+}
+
+// maxDaemonGenerations limits how deep findDaemon descends through same-named
+// descendants of a socket activator's child process.
+const maxDaemonGenerations = 4
+
+// servesSocket returns true if the process with the specified proc filesystem
+// base path (including a trailing slash) has an open fd referencing the socket
+// described by sockettext, in the form of “socket:[INO]”.
+func servesSocket(base string, sockettext string) bool {
+	fdbase := base + "fd"
+	fds, err := unsorted.ReadDir(fdbase)
+	if err != nil {
+		return false
+	}
+	fdbase += "/"
+	for _, fd := range fds {
+		link, err := os.Readlink(fdbase + fd.Name())
+		if err != nil {
+			continue
+		}
+		if link == sockettext {
+			return true
+		}
+	}
+	return false
+}
+
+// daemonLocator locates the (socket-activated) child process of a socket
+// activator that services a specific (unix domain) socket. It allows
+// [activateAndStartWatch] to optionally reuse a recently discovered process
+// table instead of always walking the proc filesystem from scratch.
+type daemonLocator interface {
+	// findDaemon returns the PID of the child process with the specified name
+	// of the parent process ppid that services the socket with inode number
+	// udsino, or zero if no such process could be found.
+	findDaemon(ppid model.PIDType, name string, udsino uint64) model.PIDType
+}
+
+// procfsDaemonLocator locates daemon processes by always walking the proc
+// filesystem.
+type procfsDaemonLocator struct {
+	procroot string // where the proc filesystem is mounted.
+}
+
+func (l procfsDaemonLocator) findDaemon(ppid model.PIDType, name string, udsino uint64) model.PIDType {
+	return findDaemon(l.procroot, ppid, name, udsino)
+}
+
+// childLocator is optionally implemented by daemonLocators that additionally
+// can tell whether a socket activator has spawned any child process with a
+// specific name at all, regardless of whether it already serves a socket.
+type childLocator interface {
+	// hasChild returns true if the parent process ppid has a child process
+	// with the specified name.
+	hasChild(ppid model.PIDType, name string) bool
+}
+
+func (l procfsDaemonLocator) hasChild(ppid model.PIDType, name string) bool {
+	return hasChildNamed(l.procroot, ppid, name)
+}
+
+// hasChildNamed returns true if the parent process ppid has a child process
+// with the specified name. As freshly activated child processes most probably
+// aren't yet included in any recent process discovery, hasChildNamed always
+// walks the proc filesystem mounted at procroot.
+func hasChildNamed(procroot string, ppid model.PIDType, name string) bool {
+	pids, err := unsorted.ReadDir(procroot)
+	if err != nil {
+		return false
+	}
+	ppidtext := strconv.FormatInt(int64(ppid), 10)
+	for _, pid := range pids {
+		stat, err := os.ReadFile(procroot + "/" + pid.Name() + "/stat")
+		if err != nil {
+			continue
+		}
+		if processStatusMatch(string(stat), name, ppidtext) {
+			return true
+		}
+	}
+	return false
+}
+
+// proctableDaemonLocator locates daemon processes by first consulting a
+// recently discovered process table, falling back to walking the proc
+// filesystem only if the daemon process is too new to appear in the process
+// table.
+type proctableDaemonLocator struct {
+	procroot string // where the proc filesystem is mounted.
+	procs    model.ProcessTable
+}
+
+func (l proctableDaemonLocator) findDaemon(ppid model.PIDType, name string, udsino uint64) model.PIDType {
+	if parent := l.procs[ppid]; parent != nil {
+		sockettext := "socket:[" + strconv.FormatUint(udsino, 10) + "]"
+		if pid := servingDescendant(l.procroot, parent, name, sockettext, maxDaemonGenerations); pid != 0 {
+			return pid
+		}
+	}
+	return findDaemon(l.procroot, ppid, name, udsino)
+}
+
+func (l proctableDaemonLocator) hasChild(ppid model.PIDType, name string) bool {
+	return hasChildNamed(l.procroot, ppid, name)
+}
+
+// servingDescendant returns the PID of the deepest descendant process of the
+// specified parent process with the specified name that serves the socket
+// described by sockettext, only descending through same-named processes. It
+// returns zero if there is no such descendant.
+func servingDescendant(procroot string, parent *model.Process, name string, sockettext string, generations int) model.PIDType {
+	if generations <= 0 {
+		return 0
+	}
+	for _, child := range parent.Children {
+		if child.Name != name {
+			continue
+		}
+		if pid := servingDescendant(procroot, child, name, sockettext, generations-1); pid != 0 {
+			return pid
+		}
+		if servesSocket(procroot+"/"+strconv.FormatInt(int64(child.PID), 10)+"/", sockettext) {
+			return child.PID
 		}
 	}
 	return 0
@@ -95,32 +239,56 @@ func findDaemon(ppid model.PIDType, name string, udsino uint64) model.PIDType {
 // for reasons of speed, so we don't need text-to-int conversions), returning
 // true for a match, false otherwise.
 func processStatusMatch(statline string, name string, ppidtext string) bool {
-	// Get the process name, or "comm" field #2 and check if it is the name
+	statppid, ok := processStatusPPID(statline, name)
+	return ok && statppid == ppidtext
+}
+
+// processStatusPPID takes a proc filesystem process “stat” line and checks it
+// against the sought-after process name, returning the PPID in text format if
+// the process name matches. Otherwise, it returns false.
+//
+// As process names may contain spaces as well as opening and closing brackets
+// themselves, processStatusPPID takes the process name to lie between the first
+// opening and the last closing bracket in the stat line. It then splits the
+// remaining stat line after the last closing bracket into its fields, where
+// the first field is the process state (field #3) and the next field is the
+// PPID (field #4). For robustness, any non-numeric fields following the state
+// field are skipped too.
+func processStatusPPID(statline string, name string) (ppidtext string, ok bool) {
+	// Get the process name, or "comm" field #2, and check if it is the name
 	// we're looking for...
-	idx := strings.Index(statline, " ")
-	if idx < 0 {
-		return false
+	openidx := strings.IndexByte(statline, '(')
+	if openidx < 0 {
+		return "", false
 	}
-	// skip " (" that embraces field #2 and look for the last closing
-	// bracket (note that process names may contain closing brackets
-	// themselves, fwiw)...
-	idx += 2
-	lastidx := strings.LastIndex(statline[idx:], ")")
-	if lastidx < 0 {
-		return false
+	closeidx := strings.LastIndexByte(statline, ')')
+	if closeidx < openidx || statline[openidx+1:closeidx] != name {
+		return "", false
 	}
-	if statline[idx:idx+lastidx] != name {
-		return false
+	// ...and then get its parent process PID from field #4, skipping the
+	// "state" field #3.
+	fields := strings.Fields(statline[closeidx+1:])
+	if len(fields) < 2 {
+		return "", false
 	}
-	// ...with the correct parent process...? For this, we need to look at
-	// field #4, skipping the "state" field.
-	idx += lastidx + 2
-	if idx > len(statline) {
-		return false
+	for _, field := range fields[1:] {
+		if isDecimal(field) {
+			return field, true
+		}
 	}
-	lastidx = strings.Index(statline[idx:], " ")
-	if lastidx < 0 {
+	return "", false
+}
+
+// isDecimal returns true if the specified text is a non-empty sequence of
+// decimal digits only.
+func isDecimal(text string) bool {
+	if text == "" {
 		return false
 	}
-	return strings.HasPrefix(statline[idx+lastidx+1:], ppidtext)
+	for _, ch := range text {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return true
 }
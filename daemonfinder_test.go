@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"os/exec"
 	"strconv"
 	"strings"
 	"time"
@@ -35,6 +36,31 @@ var _ = Describe("finding socket-activated demons", Serial, Ordered, func() {
 		Entry("no PPID", "42 (duhkr)", "duhkr", "1", false),
 		Entry("other PID", "42 (duhkr) zx81 666 ", "duhkr", "1", false),
 		Entry("match", "42 (duhkr;)-) spectrum 1 ", "duhkr;)-", "1", true),
+		Entry("PPID with same prefix", "42 (duhkr) S 12 ", "duhkr", "1", false),
+	)
+
+	DescribeTable("getting the PPID from a process status",
+		func(statline, name, expectedppid string, expected bool) {
+			ppid, ok := processStatusPPID(statline, name)
+			Expect(ok).To(Equal(expected))
+			Expect(ppid).To(Equal(expectedppid))
+		},
+		Entry("not our name", "42 (foobar) S 1 ", "duhkr", "", false),
+		Entry("no PPID", "42 (duhkr)", "duhkr", "", false),
+		Entry("PPID", "42 (duhkr) S 666 42 ", "duhkr", "666", true),
+		Entry("PPID at end", "42 (duhkr) S 666", "duhkr", "666", true),
+		Entry("no comm field", "42 S 666 42", "duhkr", "", false),
+		Entry("only closing bracket", "42 duhkr) S 666 42", "duhkr)", "", false),
+		Entry("name with spaces", "42 (duhkr d) S 666 42", "duhkr d", "666", true),
+		Entry("name with brackets", "42 (dockerd) )() S 666 42", "dockerd) )(", "666", true),
+		Entry("bracketed name", "42 ((dockerd) )() S 666 42", "(dockerd) )(", "666", true),
+		Entry("name with closing bracket and PPID", "42 (dockerd) 1) S 666 42", "dockerd) 1", "666", true),
+		Entry("empty name", "42 () S 666 42", "", "666", true),
+		Entry("multi-word state", "42 (duhkr) D disk sleep 666 42", "duhkr", "666", true),
+		Entry("extra whitespace", "42 (duhkr)  S   666  42", "duhkr", "666", true),
+		Entry("trailing newline", "42 (duhkr) S 666\n", "duhkr", "666", true),
+		Entry("state only", "42 (duhkr) S ", "duhkr", "", false),
+		Entry("non-numeric PPID", "42 (duhkr) S abc", "duhkr", "", false),
 	)
 
 	It("finds the socket-activated Docker demon's PID", func(ctx context.Context) {
@@ -71,7 +97,7 @@ var _ = Describe("finding socket-activated demons", Serial, Ordered, func() {
 		By("searching the demon")
 		var dpid model.PIDType
 		Eventually(func() model.PIDType {
-			dpid = findDaemon(1, "dockerd", udsino)
+			dpid = findDaemon(defaultProcRoot, 1, "dockerd", udsino)
 			return dpid
 		}).Within(2*time.Second).ProbeEvery(100*time.Millisecond).
 			ShouldNot(BeZero(), "didn't find a suitable dockerd process at all")
@@ -80,7 +106,86 @@ var _ = Describe("finding socket-activated demons", Serial, Ordered, func() {
 	})
 
 	It("returns a zero PID when the daemon could not be found", func() {
-		Expect(findDaemon(1, "duhkr-deh", 0)).To(BeZero())
+		Expect(findDaemon(defaultProcRoot, 1, "duhkr-deh", 0)).To(BeZero())
+	})
+
+	It("tells whether a parent process has a child process with a specific name", func() {
+		sleepy := exec.Command("sleep", "10")
+		Expect(sleepy.Start()).To(Succeed())
+		defer func() {
+			_ = sleepy.Process.Kill()
+			_ = sleepy.Wait()
+		}()
+		self := model.PIDType(os.Getpid())
+		Expect(hasChildNamed(defaultProcRoot, self, "sleep")).To(BeTrue())
+		Expect(hasChildNamed(defaultProcRoot, self, "duhkr-deh")).To(BeFalse())
+		Expect(procfsDaemonLocator{procroot: defaultProcRoot}.hasChild(self, "sleep")).To(BeTrue())
+		Expect(proctableDaemonLocator{procroot: defaultProcRoot}.hasChild(self, "sleep")).To(BeTrue())
+	})
+
+	It("finds the demon in a recent process table", func() {
+		By("creating a listening unix socket as our canary")
+		fakesockdir := Successful(os.MkdirTemp("", "fakesock-*"))
+		defer os.RemoveAll(fakesockdir)
+		canarysockpath := fakesockdir + "/canary.sock"
+		lsock := Successful(net.Listen("unix", canarysockpath))
+		defer lsock.Close()
+		var udsino uint64
+		for ino, path := range listeningUDSVisibleToProcess(defaultProcRoot, model.PIDType(os.Getpid())) {
+			if path == canarysockpath {
+				udsino = ino
+				break
+			}
+		}
+		Expect(udsino).NotTo(BeZero())
+
+		By("locating ourselves as the demon using a fake process table")
+		const fakeppid = model.PIDType(-42)
+		self := &model.Process{PID: model.PIDType(os.Getpid()), PPID: fakeppid,
+			ProTaskCommon: model.ProTaskCommon{Name: "duhkr"}}
+		parent := &model.Process{PID: fakeppid, Children: []*model.Process{self}}
+		self.Parent = parent
+		locator := proctableDaemonLocator{procroot: defaultProcRoot, procs: model.ProcessTable{
+			parent.PID: parent,
+			self.PID:   self,
+		}}
+		Expect(locator.findDaemon(fakeppid, "duhkr", udsino)).To(Equal(self.PID))
+		Expect(locator.findDaemon(fakeppid, "duhkr-deh", udsino)).To(BeZero())
+	})
+
+	It("finds a re-executed rootless demon in a recent process table", func() {
+		By("creating a listening unix socket as our canary")
+		fakesockdir := Successful(os.MkdirTemp("", "fakesock-*"))
+		defer os.RemoveAll(fakesockdir)
+		canarysockpath := fakesockdir + "/canary.sock"
+		lsock := Successful(net.Listen("unix", canarysockpath))
+		defer lsock.Close()
+		var udsino uint64
+		for ino, path := range listeningUDSVisibleToProcess(defaultProcRoot, model.PIDType(os.Getpid())) {
+			if path == canarysockpath {
+				udsino = ino
+				break
+			}
+		}
+		Expect(udsino).NotTo(BeZero())
+
+		By("locating ourselves as the re-executed demon's child using a fake process table")
+		const fakeppid = model.PIDType(-42)
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "duhkr"}}
+		reexec := &model.Process{PID: model.PIDType(os.Getppid()), PPID: fakeppid,
+			ProTaskCommon: model.ProTaskCommon{Name: "duhkr"},
+			Children:      []*model.Process{self}}
+		self.PPID = reexec.PID
+		self.Parent = reexec
+		parent := &model.Process{PID: fakeppid, Children: []*model.Process{reexec}}
+		reexec.Parent = parent
+		locator := proctableDaemonLocator{procroot: defaultProcRoot, procs: model.ProcessTable{
+			parent.PID: parent,
+			reexec.PID: reexec,
+			self.PID:   self,
+		}}
+		Expect(locator.findDaemon(fakeppid, "duhkr", udsino)).To(Equal(self.PID))
 	})
 
 })
@@ -0,0 +1,63 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"strings"
+
+	"github.com/thediveo/lxkns/model"
+	"github.com/thediveo/whalewatcher/watcher/containerd"
+	"github.com/thediveo/whalewatcher/watcher/moby"
+)
+
+// mobyNamespacePrefix is the ID prefix of containers in containerd's “moby”
+// namespace, where Docker keeps its containers when using containerd.
+const mobyNamespacePrefix = "moby/"
+
+// dedupMobyContainers removes the containers in containerd's “moby” namespace
+// that duplicate containers of a Docker engine also being watched, returning
+// the remaining containers. Such duplicates appear when watching all
+// containerd namespaces, such as on Docker Desktop/WSL2 with its “sidekick”
+// containerd. Duplicates are identified by their container IDs, as Docker
+// uses its container IDs also as the containerd container IDs. The
+// duplicates are also removed from the container lists of their containerd
+// engines.
+func dedupMobyContainers(containers []*model.Container) []*model.Container {
+	dockerIDs := map[string]struct{}{}
+	for _, container := range containers {
+		if container.Type == moby.Type {
+			dockerIDs[container.ID] = struct{}{}
+		}
+	}
+	if len(dockerIDs) == 0 {
+		return containers
+	}
+	deduped := containers[:0]
+	for _, container := range containers {
+		if container.Type == containerd.Type && strings.HasPrefix(container.ID, mobyNamespacePrefix) {
+			if _, ok := dockerIDs[strings.TrimPrefix(container.ID, mobyNamespacePrefix)]; ok {
+				removeEngineContainer(container)
+				continue
+			}
+		}
+		deduped = append(deduped, container)
+	}
+	return deduped
+}
+
+// removeEngineContainer removes the specified container from the container
+// list of its engine, if any.
+func removeEngineContainer(container *model.Container) {
+	engine := container.Engine
+	if engine == nil {
+		return
+	}
+	for idx, cntr := range engine.Containers {
+		if cntr == container {
+			engine.Containers = append(engine.Containers[:idx], engine.Containers[idx+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+
+	"github.com/thediveo/lxkns/model"
+	"github.com/thediveo/whalewatcher"
+	"github.com/thediveo/whalewatcher/watcher/containerd"
+	"github.com/thediveo/whalewatcher/watcher/moby"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("deduplicating containers", func() {
+
+	It("leaves containers alone without any Docker engine", func() {
+		ctrd := &model.ContainerEngine{Type: containerd.Type}
+		ctrd.AddContainer(&model.Container{ID: "moby/1234", Type: containerd.Type})
+		Expect(dedupMobyContainers(ctrd.Containers)).To(HaveLen(1))
+	})
+
+	It("removes containerd moby namespace duplicates of Docker containers", func(ctx context.Context) {
+		docker := NewStaticEngine(moby.Type, "moby-1", "/run/docker.sock", 42,
+			&whalewatcher.Container{ID: "1234", Name: "foo", PID: 666})
+		ctrd := NewStaticEngine(containerd.Type, "ctrd-1", "/run/containerd/containerd.sock", 43,
+			&whalewatcher.Container{ID: "moby/1234", Name: "moby/1234", PID: 666},
+			&whalewatcher.Container{ID: "moby/5678", Name: "moby/5678", PID: 667},
+			&whalewatcher.Container{ID: "1234", Name: "bar", PID: 668})
+		tf := New(func() context.Context { return ctx }, WithInjectedEngines(docker, ctrd))
+		defer tf.Close()
+
+		containers := tf.Containers(ctx, model.ProcessTable{}, nil)
+		Expect(containers).To(ConsistOf(
+			And(HaveField("ID", "1234"), HaveField("Type", moby.Type)),
+			And(HaveField("ID", "moby/5678"), HaveField("Type", containerd.Type)),
+			And(HaveField("ID", "1234"), HaveField("Type", containerd.Type)),
+		))
+		for _, container := range containers {
+			if container.Type != containerd.Type {
+				continue
+			}
+			Expect(container.Engine.Containers).To(ConsistOf(
+				HaveField("ID", "moby/5678"),
+				HaveField("ID", "1234"),
+			))
+			break
+		}
+	})
+
+})
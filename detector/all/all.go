@@ -5,7 +5,12 @@
 package all
 
 import (
+	_ "github.com/siemens/turtlefinder/detector/apptainer"  // detect Apptainer starters
+	_ "github.com/siemens/turtlefinder/detector/buildkit"   // detect stand-alone buildkit
 	_ "github.com/siemens/turtlefinder/detector/containerd" // detect containerd
 	_ "github.com/siemens/turtlefinder/detector/crio"       // detect cri-o
+	_ "github.com/siemens/turtlefinder/detector/garden"     // detect Cloud Foundry Garden
+	_ "github.com/siemens/turtlefinder/detector/k3s"        // detect k3s' embedded containerd
+	_ "github.com/siemens/turtlefinder/detector/machined"   // detect systemd-machined containers
 	_ "github.com/siemens/turtlefinder/detector/moby"       // detect Docker
 )
@@ -21,8 +21,27 @@ var _ = Describe("detector plugins", func() {
 			names = append(names, namer.EngineNames()...)
 		}
 		Expect(names).To(ConsistOf(
-			"containerd", "dockerd", "crio",
+			"containerd", "dockerd", "crio", "buildkitd", "guardian", "gdn",
+			"k3s-server", "k3s-agent", "starter", "starter-suid",
+			"systemd-machined", "systemd-machine",
 		))
 	})
 
+	It("advertises the default API paths of the engine detector plugins", func() {
+		paths := map[string][]string{}
+		for _, d := range plugger.Group[detector.Detector]().Symbols() {
+			if defaultpaths := detector.DefaultAPIPaths(d); defaultpaths != nil {
+				paths[d.EngineNames()[0]] = defaultpaths
+			}
+		}
+		Expect(paths).To(Equal(map[string][]string{
+			"dockerd":          {"/run/docker.sock"},
+			"containerd":       {"/run/containerd/containerd.sock"},
+			"crio":             {"/run/crio/crio.sock"},
+			"buildkitd":        {"/run/buildkit/buildkitd.sock"},
+			"k3s-server":       {"/run/k3s/containerd/containerd.sock"},
+			"systemd-machined": {"/run/systemd/machine/io.systemd.Machine"},
+		}))
+	})
+
 })
@@ -0,0 +1,32 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package detector
+
+import "github.com/thediveo/whalewatcher/watcher"
+
+// APIVersioner is optionally implemented by watchers that know the API version
+// negotiated with (or reported by) their container engine. This API version is
+// distinct from the engine's product version: for instance, Docker 24.0.7
+// serves API version “1.43”, while a CRI endpoint reports its runtime API
+// version, such as “v1”.
+type APIVersioner interface {
+	// APIVersion returns the API version used when talking to the container
+	// engine, or "" if unknown.
+	APIVersion() string
+}
+
+// WithAPIVersion returns the specified watcher wrapped so that it additionally
+// implements the [APIVersioner] interface, reporting the specified API version.
+// Detector plugins use this to stash the API version they've negotiated with a
+// container engine alongside the watcher they create for it. If the version is
+// empty, the watcher is returned unwrapped.
+func WithAPIVersion(w watcher.Watcher, version string) watcher.Watcher {
+	if w == nil || version == "" {
+		return w
+	}
+	iw := newInfoWatcher(w)
+	iw.apiversion = version
+	return iw
+}
@@ -0,0 +1,36 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package detector
+
+import (
+	"github.com/thediveo/whalewatcher/watcher"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// typedWatcher is a watcher.Watcher stub only telling its engine type.
+type typedWatcher struct {
+	watcher.Watcher
+}
+
+func (w *typedWatcher) Type() string { return "fooengine" }
+
+var _ = Describe("engine API version", func() {
+
+	It("doesn't wrap without API version", func() {
+		w := &typedWatcher{}
+		Expect(WithAPIVersion(w, "")).To(BeIdenticalTo(w))
+		Expect(WithAPIVersion(nil, "1.43")).To(BeNil())
+	})
+
+	It("stashes the API version with a watcher", func() {
+		w := WithAPIVersion(&typedWatcher{}, "1.43")
+		Expect(w).To(BeAssignableToTypeOf(&infoWatcher{}))
+		Expect(w.(APIVersioner).APIVersion()).To(Equal("1.43"))
+		Expect(w.Type()).To(Equal("fooengine"))
+	})
+
+})
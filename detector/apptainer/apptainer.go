@@ -0,0 +1,56 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package apptainer
+
+import (
+	"context"
+
+	detect "github.com/siemens/turtlefinder/detector"
+
+	"github.com/thediveo/go-plugger/v3"
+	"github.com/thediveo/lxkns/model"
+	"github.com/thediveo/whalewatcher/watcher"
+)
+
+// Register this Apptainer container (engine) discovery plugin. This statically
+// ensures that the Detector interface is fully implemented.
+func init() {
+	plugger.Group[detect.Detector]().Register(
+		&Detector{}, plugger.WithPlugin("apptainer"))
+}
+
+// Detector implements the detect.Detector interface. This is automatically
+// type-checked by the previous plugin registration (Generics can be sweet,
+// sometimes *snicker*).
+type Detector struct{}
+
+// Make sure that the EndpointlessDetector interface is fully implemented.
+var _ (detect.EndpointlessDetector) = (*Detector)(nil)
+
+// EngineNames returns the process names of Apptainer's starter processes.
+func (d *Detector) EngineNames() []string {
+	return []string{"starter", "starter-suid"}
+}
+
+// Endpointless marks Apptainer starter processes as not serving any API
+// endpoints.
+func (d *Detector) Endpointless() {}
+
+// NewWatchers returns a watcher for tracking the container of the Apptainer
+// starter process with the specified PID. As Apptainer doesn't have any API
+// endpoints, the specified API paths are ignored. As “starter” is a rather
+// generic process name, NewWatchers returns no watcher if the starter process
+// doesn't belong to Apptainer (or Singularity). NewWatchers looks at the
+// starter process via the proc filesystem configured for discovery.
+func (d *Detector) NewWatchers(ctx context.Context, pid model.PIDType, apis []string) []watcher.Watcher {
+	lg := detect.LoggerFrom(ctx)
+	procroot := detect.ProcRoot(ctx)
+	if !isStarter(procroot, int(pid)) {
+		lg.Debugf("process %d isn't an Apptainer starter", pid)
+		return nil
+	}
+	ac := NewApptainerClient(int(pid), WithProcRoot(procroot))
+	return []watcher.Watcher{detect.WithPing(watcher.New(ac, nil), ac.Ping)}
+}
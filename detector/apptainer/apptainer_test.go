@@ -0,0 +1,146 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package apptainer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	detect "github.com/siemens/turtlefinder/detector"
+	"github.com/thediveo/go-plugger/v3"
+	"github.com/thediveo/whalewatcher/engineclient"
+	"github.com/thediveo/whalewatcher/watcher"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeStarter creates a fake proc filesystem entry for a starter process with
+// the specified PID, process title, executable, and child process, returning
+// the fake proc root path.
+func fakeStarter(procroot string, pid string, cmdline string, exe string, child string) {
+	GinkgoHelper()
+	base := filepath.Join(procroot, pid)
+	Expect(os.MkdirAll(filepath.Join(base, "task", pid), 0755)).To(Succeed())
+	Expect(os.WriteFile(filepath.Join(base, "cmdline"), []byte(cmdline), 0644)).To(Succeed())
+	if exe != "" {
+		Expect(os.Symlink(exe, filepath.Join(base, "exe"))).To(Succeed())
+	}
+	Expect(os.WriteFile(filepath.Join(base, "task", pid, "children"), []byte(child), 0644)).To(Succeed())
+}
+
+var _ = Describe("Apptainer detector", func() {
+
+	It("registers correctly", func() {
+		Expect(plugger.Group[detect.Detector]().Plugins()).To(ContainElement("apptainer"))
+		var d detect.Detector = &Detector{}
+		_, ok := d.(detect.EndpointlessDetector)
+		Expect(ok).To(BeTrue())
+		Expect(d.EngineNames()).To(ConsistOf("starter", "starter-suid"))
+	})
+
+	It("identifies Apptainer starters", func() {
+		procroot := GinkgoT().TempDir()
+		fakeStarter(procroot, "42", "starter\x00", "/usr/libexec/apptainer/bin/starter", "")
+		fakeStarter(procroot, "43", "Singularity instance: root [foo]\x00", "", "")
+		fakeStarter(procroot, "44", "starter\x00", "/usr/bin/starter", "")
+		Expect(isStarter(procroot, 42)).To(BeTrue())
+		Expect(isStarter(procroot, 43)).To(BeTrue())
+		Expect(isStarter(procroot, 44)).To(BeFalse())
+		Expect(isStarter(procroot, 666)).To(BeFalse())
+	})
+
+	DescribeTable("getting instance names",
+		func(cmdline string, expected string) {
+			procroot := GinkgoT().TempDir()
+			fakeStarter(procroot, "42", cmdline, "", "")
+			Expect(instanceName(procroot, 42)).To(Equal(expected))
+		},
+		Entry("no instance", "starter\x00", ""),
+		Entry("Apptainer instance", "Apptainer instance: root [foo]\x00", "foo"),
+		Entry("Singularity instance", "Singularity instance: jdoe [bar-baz]", "bar-baz"),
+		Entry("broken instance title", "Apptainer instance: root [foo", ""),
+	)
+
+	It("lists the container of a starter and notices the starter terminating", func(ctx context.Context) {
+		procroot := GinkgoT().TempDir()
+		fakeStarter(procroot, "42", "Apptainer instance: root [foo]\x00",
+			"/usr/libexec/apptainer/bin/starter-suid", "4242 4243 ")
+
+		ac := NewApptainerClient(42, WithProcRoot(procroot), WithPollInterval(50*time.Millisecond))
+		defer ac.Close()
+		Expect(ac.Type()).To(Equal(Type))
+		Expect(ac.API()).To(BeEmpty())
+		Expect(ac.PID()).To(Equal(42))
+		Expect(ac.ID(ctx)).To(Equal("apptainer-42"))
+
+		containers, err := ac.List(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(containers).To(ConsistOf(And(
+			HaveField("ID", "apptainer-42"),
+			HaveField("Name", "foo"),
+			HaveField("PID", 4242),
+		)))
+		Expect(ac.Inspect(ctx, "foo")).To(HaveField("PID", 4242))
+		_, err = ac.Inspect(ctx, "bar")
+		Expect(err).To(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		evs, errs := ac.LifecycleEvents(ctx)
+		Consistently(evs).WithTimeout(200 * time.Millisecond).ShouldNot(Receive())
+		Expect(os.RemoveAll(filepath.Join(procroot, "42"))).To(Succeed())
+		Eventually(evs).Should(Receive(Equal(engineclient.ContainerEvent{
+			Type: engineclient.ContainerExited,
+			ID:   "apptainer-42",
+		})))
+		Eventually(errs).Should(Receive(MatchError(ErrStarterGone)))
+		_, err = ac.List(ctx)
+		Expect(err).To(MatchError(ErrStarterGone))
+	})
+
+	It("uses the starter's PID in absence of a child", func(ctx context.Context) {
+		procroot := GinkgoT().TempDir()
+		fakeStarter(procroot, "42", "starter\x00", "/usr/libexec/apptainer/bin/starter", "")
+		ac := NewApptainerClient(42, WithProcRoot(procroot))
+		Expect(ac.List(ctx)).To(ConsistOf(And(
+			HaveField("Name", "apptainer-42"),
+			HaveField("PID", 42),
+		)))
+	})
+
+	It("watches a starter until it terminates", func(ctx context.Context) {
+		procroot := GinkgoT().TempDir()
+		fakeStarter(procroot, "42", "starter\x00", "/usr/libexec/apptainer/bin/starter", "4242")
+		w := watcher.New(NewApptainerClient(42,
+			WithProcRoot(procroot), WithPollInterval(50*time.Millisecond)), nil)
+		defer w.Close()
+		done := make(chan error, 1)
+		go func() { done <- w.Watch(ctx) }()
+		Eventually(w.Ready()).Should(BeClosed())
+		Expect(w.Portfolio().ContainerTotal()).To(Equal(1))
+		Expect(os.RemoveAll(filepath.Join(procroot, "42"))).To(Succeed())
+		Eventually(done).Should(Receive(HaveOccurred()))
+	})
+
+	It("doesn't watch non-Apptainer starters", func(ctx context.Context) {
+		Expect((&Detector{}).NewWatchers(ctx, 0, nil)).To(BeEmpty())
+	})
+
+	It("identifies starters in the proc filesystem passed", func(ctx context.Context) {
+		procroot := GinkgoT().TempDir()
+		fakeStarter(procroot, "42", "Apptainer instance: root [foo]\x00",
+			"/usr/libexec/apptainer/bin/starter", "")
+		ctx = detect.WithProcRoot(ctx, procroot)
+		ws := (&Detector{}).NewWatchers(ctx, 42, nil)
+		Expect(ws).To(HaveLen(1))
+		defer ws[0].Close()
+		Expect(ws[0].PID()).To(Equal(42))
+		Expect((&Detector{}).NewWatchers(ctx, 666, nil)).To(BeEmpty())
+	})
+
+})
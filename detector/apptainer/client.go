@@ -0,0 +1,265 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package apptainer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thediveo/whalewatcher"
+	"github.com/thediveo/whalewatcher/engineclient"
+)
+
+// Type is the type identifier for Apptainer “engines” and as returned by
+// Watcher.Type().
+const Type = "apptainer.org"
+
+// defaultPollInterval is the interval for checking that a starter process is
+// still alive, as Apptainer doesn't stream any lifecycle events.
+const defaultPollInterval = 2 * time.Second
+
+// ErrStarterGone is returned when the Apptainer starter process has terminated.
+var ErrStarterGone = errors.New("Apptainer starter process terminated")
+
+// ApptainerClient is a (minimal) engine client implementing the whalewatcher
+// engineclient.EngineClient interface for a single Apptainer starter process
+// and its container.
+type ApptainerClient struct {
+	pid          int           // PID of the starter process.
+	procroot     string        // where the proc filesystem is mounted.
+	pollinterval time.Duration // interval for checking that the starter is still alive.
+}
+
+// Make sure that the EngineClient interface is fully implemented.
+var _ (engineclient.EngineClient) = (*ApptainerClient)(nil)
+
+// NewOption represents options to NewApptainerClient when creating new
+// Apptainer engine clients.
+type NewOption func(*ApptainerClient)
+
+// WithProcRoot sets the path where the proc filesystem is mounted; defaults to
+// “/proc”.
+func WithProcRoot(procroot string) NewOption {
+	return func(ac *ApptainerClient) {
+		ac.procroot = procroot
+	}
+}
+
+// WithPollInterval sets the interval for checking that the starter process is
+// still alive.
+func WithPollInterval(d time.Duration) NewOption {
+	return func(ac *ApptainerClient) {
+		ac.pollinterval = d
+	}
+}
+
+// NewApptainerClient returns a new engine client for the Apptainer starter
+// process with the specified PID.
+func NewApptainerClient(pid int, opts ...NewOption) *ApptainerClient {
+	ac := &ApptainerClient{
+		pid:          pid,
+		procroot:     "/proc",
+		pollinterval: defaultPollInterval,
+	}
+	for _, opt := range opts {
+		opt(ac)
+	}
+	return ac
+}
+
+// List returns the container of the starter process, or ErrStarterGone if the
+// starter process has terminated.
+func (ac *ApptainerClient) List(ctx context.Context) ([]*whalewatcher.Container, error) {
+	container, err := ac.container()
+	if err != nil {
+		return nil, err
+	}
+	return []*whalewatcher.Container{container}, nil
+}
+
+// Inspect returns the container of the starter process, if its ID or name
+// matches.
+func (ac *ApptainerClient) Inspect(ctx context.Context, nameorid string) (*whalewatcher.Container, error) {
+	container, err := ac.container()
+	if err != nil {
+		return nil, err
+	}
+	if container.ID != nameorid && container.Name != nameorid {
+		return nil, engineclient.NewProcesslessContainerError(nameorid, "Apptainer")
+	}
+	return container, nil
+}
+
+// container returns the container of the starter process, or ErrStarterGone
+// if the starter process has terminated. The container ID is derived from the
+// starter's PID, while the container name is the name of the Apptainer
+// instance, if any; otherwise, it is the ID. The container PID is the PID of the
+// starter's child process; if there isn't any (yet), it is the starter's PID.
+func (ac *ApptainerClient) container() (*whalewatcher.Container, error) {
+	if !ac.alive() {
+		return nil, ErrStarterGone
+	}
+	id := ac.ID(context.Background())
+	name := instanceName(ac.procroot, ac.pid)
+	if name == "" {
+		name = id
+	}
+	pid := firstChild(ac.procroot, ac.pid)
+	if pid == 0 {
+		pid = ac.pid
+	}
+	return &whalewatcher.Container{
+		ID:     id,
+		Name:   name,
+		Labels: map[string]string{},
+		PID:    pid,
+	}, nil
+}
+
+// alive returns true as long as the starter process is still around.
+func (ac *ApptainerClient) alive() bool {
+	_, err := os.Stat(ac.procroot + "/" + strconv.Itoa(ac.pid))
+	return err == nil
+}
+
+// Ping checks that the starter process is still alive, returning
+// ErrStarterGone otherwise.
+func (ac *ApptainerClient) Ping(ctx context.Context) error {
+	if !ac.alive() {
+		return ErrStarterGone
+	}
+	return nil
+}
+
+// LifecycleEvents streams container lifecycle events. As Apptainer doesn't
+// offer any event streaming, LifecycleEvents periodically checks that the
+// starter process is still alive; when it is gone, LifecycleEvents reports the
+// container as exited and then ErrStarterGone.
+func (ac *ApptainerClient) LifecycleEvents(ctx context.Context) (<-chan engineclient.ContainerEvent, <-chan error) {
+	evs := make(chan engineclient.ContainerEvent)
+	errs := make(chan error, 1)
+	go func() {
+		ticker := time.NewTicker(ac.pollinterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			case <-ticker.C:
+			}
+			if ac.alive() {
+				continue
+			}
+			select {
+			case evs <- engineclient.ContainerEvent{
+				Type: engineclient.ContainerExited,
+				ID:   ac.ID(ctx),
+			}:
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+			errs <- ErrStarterGone
+			return
+		}
+	}()
+	return evs, errs
+}
+
+// ID returns an identifier for this Apptainer “engine”, derived from the PID
+// of the starter process, as there is no engine ID.
+func (ac *ApptainerClient) ID(ctx context.Context) string {
+	return "apptainer-" + strconv.Itoa(ac.pid)
+}
+
+// Type returns the type identifier for this engine client.
+func (ac *ApptainerClient) Type() string { return Type }
+
+// Version returns the version information of this engine. As there's no API
+// to ask for it, the version is always empty.
+func (ac *ApptainerClient) Version(ctx context.Context) string { return "" }
+
+// API returns the API endpoint path, which is always empty, as Apptainer
+// doesn't have any API endpoint.
+func (ac *ApptainerClient) API() string { return "" }
+
+// PID returns the PID of the starter process.
+func (ac *ApptainerClient) PID() int { return ac.pid }
+
+// Client returns nil, as there is no underlying engine client.
+func (ac *ApptainerClient) Client() interface{} { return nil }
+
+// Close cleans up and releases any engine client resources; there are none.
+func (ac *ApptainerClient) Close() {}
+
+// instanceMarker is part of the process title Apptainer (and Singularity)
+// gives the starter processes of container instances, such as “Apptainer
+// instance: root [foo]”.
+const instanceMarker = " instance: "
+
+// isStarter returns true if the process with the specified PID is a starter
+// process belonging to Apptainer or Singularity, based on either the path of
+// its executable or its process title.
+func isStarter(procroot string, pid int) bool {
+	base := procroot + "/" + strconv.Itoa(pid)
+	if exe, err := os.Readlink(base + "/exe"); err == nil &&
+		(strings.Contains(exe, "/apptainer/") || strings.Contains(exe, "/singularity/")) {
+		return true
+	}
+	cmdline, err := os.ReadFile(base + "/cmdline")
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(string(cmdline), "Apptainer"+instanceMarker) ||
+		strings.HasPrefix(string(cmdline), "Singularity"+instanceMarker)
+}
+
+// instanceName returns the name of the Apptainer instance run by the starter
+// process with the specified PID, or "" if the starter process doesn't run an
+// instance.
+func instanceName(procroot string, pid int) string {
+	cmdline, err := os.ReadFile(procroot + "/" + strconv.Itoa(pid) + "/cmdline")
+	if err != nil {
+		return ""
+	}
+	title := strings.TrimRight(string(cmdline), "\x00 ")
+	if !strings.Contains(title, instanceMarker) {
+		return ""
+	}
+	start := strings.LastIndex(title, "[")
+	if start < 0 || !strings.HasSuffix(title, "]") {
+		return ""
+	}
+	return title[start+1 : len(title)-1]
+}
+
+// firstChild returns the PID of the first child process of the process with
+// the specified PID, or zero if there is no child process. As children can be
+// created by any task of a process, we need to check the children of all
+// tasks.
+func firstChild(procroot string, pid int) int {
+	taskbase := procroot + "/" + strconv.Itoa(pid) + "/task"
+	tasks, err := os.ReadDir(taskbase)
+	if err != nil {
+		return 0
+	}
+	for _, task := range tasks {
+		children, err := os.ReadFile(taskbase + "/" + task.Name() + "/children")
+		if err != nil {
+			continue
+		}
+		for _, child := range strings.Fields(string(children)) {
+			if childpid, err := strconv.Atoi(child); err == nil {
+				return childpid
+			}
+		}
+	}
+	return 0
+}
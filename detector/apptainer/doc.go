@@ -0,0 +1,19 @@
+/*
+Package apptainer implements the engine detector for [Apptainer] (formerly
+Singularity) containers.
+
+Unlike the other container engines, Apptainer doesn't have any long-lived
+engine daemon with an API endpoint. Instead, each Apptainer container (instance)
+is run by its own “starter” (or “starter-suid”) process. This detector thus
+scans for these starter processes and treats each one of them as a separate
+process-scan “engine” managing exactly one container: the starter's child
+process. As there is no API endpoint, the engine API path is always empty.
+
+Please note that there is no live event stream either: the engine client
+implemented by this package instead periodically checks that its starter
+process is still around. When the starter process terminates, so does the
+watch and the corresponding “engine” then gets pruned in due course.
+
+[Apptainer]: https://apptainer.org
+*/
+package apptainer
@@ -0,0 +1,67 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package buildkit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	detect "github.com/siemens/turtlefinder/detector"
+
+	"github.com/thediveo/go-plugger/v3"
+	"github.com/thediveo/lxkns/model"
+	"github.com/thediveo/whalewatcher/watcher"
+)
+
+// Register this buildkit (engine) discovery plugin. This statically ensures
+// that the Detector interface is fully implemented.
+func init() {
+	plugger.Group[detect.Detector]().Register(
+		&Detector{}, plugger.WithPlugin("buildkitd"))
+}
+
+// Detector implements the detect.Detector interface. This is automatically
+// type-checked by the previous plugin registration (Generics can be sweet,
+// sometimes *snicker*).
+type Detector struct{}
+
+// Make sure that the DefaultAPIPathsDetector and ErrorReportingDetector
+// interfaces are fully implemented.
+var (
+	_ (detect.DefaultAPIPathsDetector) = (*Detector)(nil)
+	_ (detect.ErrorReportingDetector)  = (*Detector)(nil)
+)
+
+// EngineNames returns the process name of the stand-alone buildkit engine
+// process.
+func (d *Detector) EngineNames() []string {
+	return []string{"buildkitd"}
+}
+
+// DefaultAPIPaths returns the canonical API endpoint path of the stand-alone
+// buildkit engine.
+func (d *Detector) DefaultAPIPaths() []string {
+	return []string{"/run/buildkit/buildkitd.sock"}
+}
+
+// NewWatchers would return a watcher tracking the build executions of a
+// buildkitd engine as “containers”. As long as there is no buildkit engine
+// client available, it instead gracefully returns no watchers at all.
+func (d *Detector) NewWatchers(ctx context.Context, pid model.PIDType, apis []string) []watcher.Watcher {
+	watchers, _ := d.NewWatchersWithError(ctx, pid, apis)
+	return watchers
+}
+
+// NewWatchersWithError returns no watchers, but instead
+// [detect.ErrUnsupportedEngine], as long as there is no buildkit engine client
+// available. This way, buildkitd engines are neither retried nor reported as
+// unreachable.
+func (d *Detector) NewWatchersWithError(ctx context.Context, pid model.PIDType, apis []string) ([]watcher.Watcher, error) {
+	detect.LoggerFrom(ctx).Debugf("buildkitd engine (PID %d) with API endpoint(s) %s not watched: no buildkit engine client available",
+		pid, strings.Join(apis, ", "))
+	return nil, fmt.Errorf("buildkitd engine (PID %d): no buildkit engine client available, %w",
+		pid, detect.ErrUnsupportedEngine)
+}
@@ -0,0 +1,36 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package buildkit
+
+import (
+	"context"
+
+	detect "github.com/siemens/turtlefinder/detector"
+	"github.com/thediveo/go-plugger/v3"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("buildkit detector", func() {
+
+	It("registers correctly", func() {
+		Expect(plugger.Group[detect.Detector]().Plugins()).To(
+			ContainElement("buildkitd"))
+	})
+
+	It("gracefully returns no watchers", func(ctx context.Context) {
+		d := &Detector{}
+		Expect(d.NewWatchers(ctx, 0, []string{"/run/buildkit/buildkitd.sock"})).To(BeEmpty())
+	})
+
+	It("reports buildkitd as unsupported", func(ctx context.Context) {
+		d := &Detector{}
+		ws, err := d.NewWatchersWithError(ctx, 0, []string{"/run/buildkit/buildkitd.sock"})
+		Expect(ws).To(BeEmpty())
+		Expect(err).To(MatchError(detect.ErrUnsupportedEngine))
+	})
+
+})
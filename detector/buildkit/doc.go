@@ -0,0 +1,11 @@
+/*
+Package buildkit implements the engine detector for stand-alone buildkit
+“buildkitd” processes.
+
+Please note that at this time the upstream whalewatcher module doesn't offer an
+engine client for buildkit's control API. The buildkit detector thus only
+registers itself and recognizes buildkitd processes, but doesn't return any
+watchers yet. Instead, it reports buildkitd processes as unsupported, so that
+the turtlefinder doesn't list them as unreachable engines.
+*/
+package buildkit
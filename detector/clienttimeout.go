@@ -0,0 +1,33 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package detector
+
+import (
+	"context"
+	"time"
+)
+
+// clientTimeoutKey is the context key for passing an engine client timeout to
+// detector plugins.
+type clientTimeoutKey struct{}
+
+// WithClientTimeout returns a new context carrying the specified timeout for
+// detector plugins to use when probing a potential container engine API
+// endpoint, such as when checking that an engine is alive by querying its
+// version information. A timeout of zero or less tells detector plugins to use
+// their own defaults.
+func WithClientTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, clientTimeoutKey{}, d)
+}
+
+// ClientTimeout returns the engine client timeout carried by the specified
+// context, if any. Otherwise, it returns the specified default timeout of the
+// detector plugin.
+func ClientTimeout(ctx context.Context, def time.Duration) time.Duration {
+	if d, ok := ctx.Value(clientTimeoutKey{}).(time.Duration); ok && d > 0 {
+		return d
+	}
+	return def
+}
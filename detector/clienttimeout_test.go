@@ -0,0 +1,27 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package detector
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("engine client timeout", func() {
+
+	It("defaults", func(ctx context.Context) {
+		Expect(ClientTimeout(ctx, 5*time.Second)).To(Equal(5 * time.Second))
+		Expect(ClientTimeout(WithClientTimeout(ctx, 0), 5*time.Second)).To(Equal(5 * time.Second))
+	})
+
+	It("passes on a client timeout", func(ctx context.Context) {
+		Expect(ClientTimeout(WithClientTimeout(ctx, 42*time.Second), 5*time.Second)).
+			To(Equal(42 * time.Second))
+	})
+
+})
@@ -6,21 +6,23 @@ package containerd
 
 import (
 	"context"
+	"net"
 	"sort"
 	"strings"
 	"time"
 
 	detect "github.com/siemens/turtlefinder/detector"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
 	runtime "k8s.io/cri-api/pkg/apis/runtime/v1"
 
 	cdclient "github.com/containerd/containerd"
 	"github.com/thediveo/go-plugger/v3"
-	"github.com/thediveo/lxkns/log"
 	"github.com/thediveo/lxkns/model"
 	cdengine "github.com/thediveo/whalewatcher/engineclient/containerd"
 	criengine "github.com/thediveo/whalewatcher/engineclient/cri"
 	"github.com/thediveo/whalewatcher/watcher"
-	"github.com/thediveo/whalewatcher/watcher/containerd"
 	"github.com/thediveo/whalewatcher/watcher/cri"
 )
 
@@ -31,78 +33,243 @@ func init() {
 		&Detector{}, plugger.WithPlugin("containerd"))
 }
 
+// ttrpcSuffix is the suffix of containerd's ttrpc API endpoint paths, as
+// opposed to the gRPC API endpoint path without this suffix.
+const ttrpcSuffix = ".ttrpc"
+
 // Detector implements the detect.Detector interface. This is automatically
 // type-checked by the previous plugin registration (Generics can be sweet,
 // sometimes *snicker*).
 type Detector struct{}
 
+// Make sure that the DefaultAPIPathsDetector and ExeDetector interfaces are
+// fully implemented.
+var (
+	_ (detect.DefaultAPIPathsDetector) = (*Detector)(nil)
+	_ (detect.ExeDetector)             = (*Detector)(nil)
+)
+
 // EngineNames returns the process name of the containerd engine process.
 func (d *Detector) EngineNames() []string {
 	return []string{"containerd"}
 }
 
+// DefaultAPIPaths returns the canonical API endpoint path of the containerd
+// engine.
+func (d *Detector) DefaultAPIPaths() []string {
+	return []string{"/run/containerd/containerd.sock"}
+}
+
+// EngineExePaths returns the executable basename of the containerd engine, so
+// that the engine gets detected even if its process name has been changed.
+// Please note that this deliberately doesn't match containerd's runtime shims.
+func (d *Detector) EngineExePaths() []string {
+	return []string{"containerd"}
+}
+
 // NewWatcher returns a watcher for tracking alive containerd containers.
+//
+// Depending on the CRI mode passed in the context using [WithCRIMode],
+// NewWatchers returns a
+// watcher for containerd's native API, optionally accompanied by a watcher for
+// containerd's CRI API, only a CRI API watcher, or only a native API watcher.
 func (d *Detector) NewWatchers(ctx context.Context, pid model.PIDType, apis []string) []watcher.Watcher {
-	sort.Strings(apis) // in-place
+	lg := detect.LoggerFrom(ctx)
+	mode := CRIModeFrom(ctx)
+	apis = grpcAPIs(lg, apis)
 	for _, apipathname := range apis {
-		if strings.HasSuffix(apipathname, ".ttrpc") {
-			continue
+		// When told to only watch the CRI API, try that first and fall back
+		// to the native API only if CRI isn't enabled, so we still see
+		// something at all.
+		if mode == CRIOnly {
+			if criw := newCRIWatcher(ctx, pid, apipathname); criw != nil {
+				return []watcher.Watcher{criw}
+			}
 		}
 
 		// Remember: containerd not only has its own native API, but might also
 		// have CRI enabled.
-		watchers := []watcher.Watcher{}
-
-		// As containerd's go client will accept more or less any API pathname
-		// we throw at it and throw up only when actually trying to communicate
-		// with the engine and only after some time, it's not sufficient to just
-		// create the watcher, we also need to check that we actually can
-		// successfully talk with the daemon. Querying the daemon's version
-		// information sufficies and ensures that a partiular API path is
-		// useful.
-		log.Debugf("dialing containerd endpoint '%s'", apipathname)
-		w, err := containerd.New(apipathname, nil, cdengine.WithPID(int(pid)))
-		if err != nil {
-			log.Debugf("containerd API endpoint '%s' failed: %s", apipathname, err.Error())
+		w := newNativeWatcher(ctx, pid, apipathname)
+		if w == nil {
 			continue
 		}
-		versionctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-		_, err = w.Client().(*cdclient.Client).Version(versionctx)
-		if ctxerr := ctx.Err(); ctxerr != nil {
-			cancel()
-			log.Debugf("containerd API Info call context hit deadline: %s", err.Error())
-			w.Close()
+		watchers := []watcher.Watcher{w}
+		switch mode {
+		case CRIOnly:
+			lg.Debugf("containerd CRI API disabled, falling back to native API")
+			return watchers // we already tried CRI above.
+		case CRINone:
+			return watchers // not interested in CRI at all.
+		}
+
+		// Do we get the bonus CRI API...?
+		if criw := newCRIWatcher(ctx, pid, apipathname); criw != nil {
+			// containerd's native API doesn't tell us about its storage, so
+			// we reuse what we've learnt via the CRI API.
+			if si, ok := criw.(detect.StorageInfoer); ok {
+				watchers[0] = detect.WithStorageInfo(w, si.StorageDriver(), si.DataRoot())
+			}
+			watchers = append(watchers, criw)
+		}
+		return watchers
+	}
+	lg.Errorf("no working containerd API endpoint found, tried: %s",
+		strings.Join(apis, ", "))
+	return nil
+}
+
+// grpcAPIs returns the sorted list of containerd gRPC API endpoints from the
+// specified API endpoints. As containerd's ttrpc endpoints are only for shims
+// and of no use to us, grpcAPIs drops them. However, as on some systems only
+// the ttrpc endpoint might be discoverable while the gRPC endpoint gets
+// created lazily, grpcAPIs derives the sibling gRPC endpoint from a ttrpc
+// endpoint, if the gRPC endpoint isn't already present.
+func grpcAPIs(lg detect.Logger, apis []string) []string {
+	grpcapis := make([]string, 0, len(apis))
+	known := make(map[string]struct{}, len(apis))
+	for _, apipathname := range apis {
+		if strings.HasSuffix(apipathname, ttrpcSuffix) {
 			continue
 		}
-		cancel()
-		if err != nil {
-			w.Close()
+		grpcapis = append(grpcapis, apipathname)
+		known[apipathname] = struct{}{}
+	}
+	for _, apipathname := range apis {
+		if !strings.HasSuffix(apipathname, ttrpcSuffix) {
+			continue
+		}
+		sibling := strings.TrimSuffix(apipathname, ttrpcSuffix)
+		if _, ok := known[sibling]; ok {
+			lg.Debugf("ignoring containerd ttrpc API endpoint '%s' in favor of gRPC endpoint '%s'",
+				apipathname, sibling)
 			continue
 		}
-		watchers = append(watchers, w)
+		lg.Infof("ignoring containerd ttrpc API endpoint '%s', trying expected gRPC endpoint '%s' instead",
+			apipathname, sibling)
+		grpcapis = append(grpcapis, sibling)
+		known[sibling] = struct{}{}
+	}
+	sort.Strings(grpcapis)
+	return grpcapis
+}
 
-		// Do we get the bonus CRI API...?
-		criw, err := cri.New(apipathname, nil, criengine.WithPID(int(pid)))
+// newNativeWatcher returns a watcher for containerd's native API at the
+// specified API path, or nil if containerd cannot be successfully talked to at
+// this API path.
+func newNativeWatcher(ctx context.Context, pid model.PIDType, apipathname string) watcher.Watcher {
+	lg := detect.LoggerFrom(ctx)
+	// As containerd's go client will accept more or less any API pathname we
+	// throw at it and throw up only when actually trying to communicate with
+	// the engine and only after some time, it's not sufficient to just create
+	// the watcher, we also need to check that we actually can successfully
+	// talk with the daemon. Querying the daemon's version information
+	// sufficies and ensures that a partiular API path is useful.
+	lg.Debugf("dialing containerd endpoint '%s'", apipathname)
+	client, err := newClient(ctx, apipathname)
+	if err != nil {
+		lg.Debugf("containerd API endpoint '%s' failed: %s", apipathname, err.Error())
+		return nil
+	}
+	opts, watched := newNamespaceClientOptions(ctx)
+	w := watcher.New(&namespaceClient{
+		ContainerdWatcher: cdengine.NewContainerdWatcher(client,
+			append(opts, cdengine.WithPID(int(pid)))...),
+		watched: watched,
+	}, nil)
+	versionctx, cancel := context.WithTimeout(ctx, detect.ClientTimeout(ctx, 5*time.Second))
+	defer cancel()
+	_, err = w.Client().(*cdclient.Client).Version(versionctx)
+	if ctxerr := ctx.Err(); ctxerr != nil {
+		lg.Debugf("containerd API Info call context hit deadline: %s", ctxerr.Error())
+		w.Close()
+		return nil
+	}
+	if err != nil {
+		w.Close()
+		return nil
+	}
+	// containerd's native gRPC API doesn't negotiate any API version, so
+	// there's no API version to stash with this watcher.
+	return w
+}
+
+// newClient returns a containerd client for the specified API endpoint. For
+// TCP endpoints, newClient dials the endpoint itself, using the TLS client
+// configuration passed in the specified context, if any. For vsock endpoints,
+// newClient dials the VM socket itself. Otherwise, newClient uses the custom
+// dialer passed in the specified context, if any.
+func newClient(ctx context.Context, apipathname string) (*cdclient.Client, error) {
+	if strings.HasPrefix(apipathname, detect.VsockScheme) {
+		conn, err := grpc.Dial("passthrough:///"+apipathname,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return detect.DialVsock(ctx, apipathname)
+			}))
 		if err != nil {
-			log.Debugf("containerd CRI API disabled: %s", err.Error())
-			return watchers // NOPE!
+			return nil, err
 		}
-		// Creating the engine client usually succeeds, even if the CRI API
-		// isn't enabled, because that's not really checked yet. So we try
-		// some CRI API function in order to see if that succeeds...
-		versionctx, cancel = context.WithTimeout(ctx, 5*time.Second)
-		_, err = criw.Client().(*criengine.Client).RuntimeService().
-			Version(versionctx, &runtime.VersionRequest{Version: "0.1.0"})
-		cancel()
+		return cdclient.NewWithConn(conn)
+	}
+	dial := detect.DialContextFunc(ctx, apipathname)
+	if !strings.HasPrefix(apipathname, detect.TCPScheme) {
+		if dial == nil {
+			return cdclient.New(apipathname)
+		}
+		conn, err := grpc.Dial("passthrough:///"+apipathname,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+				return dial(ctx, "unix", addr)
+			}))
 		if err != nil {
-			criw.Close()
-			log.Debugf("containerd CRI API disabled: %s", err.Error())
-			return watchers // NOPE!
+			return nil, err
 		}
+		return cdclient.NewWithConn(conn)
+	}
+	creds := insecure.NewCredentials()
+	if tlsconfig := detect.EngineTLS(ctx, apipathname); tlsconfig != nil {
+		creds = credentials.NewTLS(tlsconfig)
+	}
+	dialopts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if dial != nil {
+		dialopts = append(dialopts, grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return dial(ctx, "tcp", addr)
+		}))
+	}
+	conn, err := grpc.Dial(strings.TrimPrefix(apipathname, detect.TCPScheme), dialopts...)
+	if err != nil {
+		return nil, err
+	}
+	return cdclient.NewWithConn(conn)
+}
 
-		watchers = append(watchers, criw)
-		return watchers
+// newCRIWatcher returns a watcher for containerd's CRI API at the specified API
+// path, or nil if the CRI API isn't enabled.
+func newCRIWatcher(ctx context.Context, pid model.PIDType, apipathname string) watcher.Watcher {
+	lg := detect.LoggerFrom(ctx)
+	if strings.HasPrefix(apipathname, detect.TCPScheme) ||
+		strings.HasPrefix(apipathname, detect.VsockScheme) {
+		lg.Debugf("containerd CRI API not supported on non-unix endpoint '%s'", apipathname)
+		return nil
 	}
-	log.Errorf("no working containerd API endpoint found.")
-	return nil
+	criw, err := cri.New(apipathname, nil, criengine.WithPID(int(pid)))
+	if err != nil {
+		lg.Debugf("containerd CRI API disabled: %s", err.Error())
+		return nil // NOPE!
+	}
+	// Creating the engine client usually succeeds, even if the CRI API isn't
+	// enabled, because that's not really checked yet. So we try some CRI API
+	// function in order to see if that succeeds...
+	versionctx, cancel := context.WithTimeout(ctx, detect.ClientTimeout(ctx, 5*time.Second))
+	defer cancel()
+	rs := criw.Client().(*criengine.Client).RuntimeService()
+	version, err := rs.Version(versionctx, &runtime.VersionRequest{Version: "0.1.0"})
+	if err != nil {
+		criw.Close()
+		lg.Debugf("containerd CRI API disabled: %s", err.Error())
+		return nil // NOPE!
+	}
+	snapshotter, dataroot := criStorageInfo(versionctx, rs)
+	return detect.WithStorageInfo(
+		detect.WithAPIVersion(criw, version.GetRuntimeApiVersion()),
+		snapshotter, dataroot)
 }
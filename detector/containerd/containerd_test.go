@@ -21,6 +21,7 @@ import (
 	"github.com/thediveo/morbyd/timestamper"
 	"github.com/thediveo/whalewatcher/engineclient/cri/test/img"
 	"github.com/thediveo/whalewatcher/test"
+	"github.com/thediveo/whalewatcher/watcher/cri"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -181,4 +182,26 @@ var _ = Describe("containerd turtle watcher", Ordered, func() {
 			Should(ContainElement(testNamespace + "/" + testContainerName))
 	})
 
+	It("watches only CRI in CRI-only mode", NodeTimeout(30*time.Second), func(ctx context.Context) {
+		d := &Detector{}
+		wormhole := fmt.Sprintf("/proc/%d/root", Successful(providerCntr.PID(ctx)))
+		ws := d.NewWatchers(WithCRIMode(ctx, CRIOnly), 0, []string{
+			wormhole + "/run/containerd/containerd.sock",
+		})
+		Expect(ws).To(HaveLen(1), "expected only a single watcher")
+		defer ws[0].Close()
+		Expect(ws[0].Type()).To(Equal(cri.Type))
+	})
+
+	It("doesn't probe CRI in no-CRI mode", NodeTimeout(30*time.Second), func(ctx context.Context) {
+		d := &Detector{}
+		wormhole := fmt.Sprintf("/proc/%d/root", Successful(providerCntr.PID(ctx)))
+		ws := d.NewWatchers(WithCRIMode(ctx, CRINone), 0, []string{
+			wormhole + "/run/containerd/containerd.sock",
+		})
+		Expect(ws).To(HaveLen(1), "expected only a single watcher")
+		defer ws[0].Close()
+		Expect(ws[0].Type()).NotTo(Equal(cri.Type))
+	})
+
 })
@@ -0,0 +1,61 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package containerd
+
+import (
+	"context"
+	"strconv"
+)
+
+// CRIMode controls which of containerd's APIs the containerd detector watches.
+type CRIMode int32
+
+const (
+	// CRIBonus watches containerd's native API and additionally its CRI API,
+	// if enabled. This is the default.
+	CRIBonus CRIMode = iota
+	// CRIOnly watches only containerd's CRI API, such as on Kubernetes nodes
+	// where the native containerd namespaces are just noise. If the CRI API
+	// isn't enabled, the containerd detector falls back to watching the
+	// native API, so that there's still something to see.
+	CRIOnly
+	// CRINone watches only containerd's native API and doesn't even probe
+	// for the CRI API, such as on hosts with CRI enabled but where
+	// Kubernetes workloads are of no interest. This avoids doubling the
+	// watchers and thus the engine queries per containerd engine.
+	CRINone
+)
+
+// criModeKey is the context key for passing the CRI mode to the containerd
+// detector.
+type criModeKey struct{}
+
+// WithCRIMode returns a new context carrying the specified CRI mode for the
+// containerd detector.
+func WithCRIMode(ctx context.Context, mode CRIMode) context.Context {
+	return context.WithValue(ctx, criModeKey{}, mode)
+}
+
+// CRIModeFrom returns the CRI mode carried by the specified context, if any.
+// Otherwise, it returns [CRIBonus].
+func CRIModeFrom(ctx context.Context) CRIMode {
+	if mode, ok := ctx.Value(criModeKey{}).(CRIMode); ok {
+		return mode
+	}
+	return CRIBonus
+}
+
+// String returns the textual representation of a CRI mode.
+func (m CRIMode) String() string {
+	switch m {
+	case CRIBonus:
+		return "CRIBonus"
+	case CRIOnly:
+		return "CRIOnly"
+	case CRINone:
+		return "CRINone"
+	}
+	return "CRIMode(" + strconv.Itoa(int(m)) + ")"
+}
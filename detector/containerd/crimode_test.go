@@ -0,0 +1,28 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package containerd
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CRI mode", func() {
+
+	It("passes the CRI mode in contexts", func(ctx context.Context) {
+		Expect(CRIModeFrom(ctx)).To(Equal(CRIBonus))
+		Expect(CRIModeFrom(WithCRIMode(ctx, CRIOnly))).To(Equal(CRIOnly))
+	})
+
+	It("stringifies", func() {
+		Expect(CRIBonus.String()).To(Equal("CRIBonus"))
+		Expect(CRIOnly.String()).To(Equal("CRIOnly"))
+		Expect(CRINone.String()).To(Equal("CRINone"))
+		Expect(CRIMode(42).String()).To(Equal("CRIMode(42)"))
+	})
+
+})
@@ -4,5 +4,24 @@ Package containerd implements the engine detector for containerd processes.
 containerd is differs slightly from the usual in that it can return two
 watchers, one for containerd's native API and workload, but optionally also
 another one for the CRI API workload (when CRI is enabled).
+
+The native API watcher by default ignores the “moby” and “k8s.io” containerd
+namespaces, as these are better watched via the Docker engine and the CRI API
+respectively. Use [WithWatchedNamespaces] to watch other sets of namespaces,
+such as only the “default” namespace used by nerdctl. The native API watcher labels
+all containers with their containerd namespaces, using the [NamespaceLabel].
+
+Multiple containerd instances on the same host, such as the system containerd
+and the containerd embedded in k3s, are picked up as separate engines, as long
+as their processes show up under the usual “containerd” process name or run
+the “containerd” executable under a changed process name. Each
+instance is then talked to only via the API endpoints it is listening on
+itself, such as “/run/containerd/containerd.sock” and
+“/run/k3s/containerd/containerd.sock”.
+
+As containerd's native API doesn't reveal the snapshotter and root directory
+in use, this information is learnt from the verbose runtime status of the CRI
+API instead, when available. It is then reported for both the native and CRI
+API watchers.
 */
 package containerd
@@ -0,0 +1,35 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package containerd
+
+import (
+	detect "github.com/siemens/turtlefinder/detector"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("containerd API endpoints", func() {
+
+	DescribeTable("picking gRPC endpoints",
+		func(apis []string, expected []string) {
+			Expect(grpcAPIs(detect.Logger{}, apis)).To(Equal(expected))
+		},
+		Entry("no endpoints", nil, []string{}),
+		Entry("only gRPC",
+			[]string{"/run/containerd/containerd.sock"},
+			[]string{"/run/containerd/containerd.sock"}),
+		Entry("gRPC with ttrpc sibling",
+			[]string{"/run/containerd/containerd.sock.ttrpc", "/run/containerd/containerd.sock"},
+			[]string{"/run/containerd/containerd.sock"}),
+		Entry("only ttrpc",
+			[]string{"/run/containerd/containerd.sock.ttrpc"},
+			[]string{"/run/containerd/containerd.sock"}),
+		Entry("sorted",
+			[]string{"/run/zzz.sock", "/run/containerd/containerd.sock.ttrpc", "/run/aaa.sock"},
+			[]string{"/run/aaa.sock", "/run/containerd/containerd.sock", "/run/zzz.sock"}),
+	)
+
+})
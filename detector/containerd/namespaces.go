@@ -0,0 +1,194 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package containerd
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/thediveo/whalewatcher"
+	"github.com/thediveo/whalewatcher/engineclient"
+	cdengine "github.com/thediveo/whalewatcher/engineclient/containerd"
+)
+
+// AllNamespaces tells [WithWatchedNamespaces] to watch all containerd
+// namespaces, including the “moby” and “k8s.io” namespaces that are otherwise
+// ignored by default.
+const AllNamespaces = "*"
+
+// NamespaceLabel is the name of the container label carrying the containerd
+// namespace a container belongs to, when watching containerd's native API.
+const NamespaceLabel = "turtlefinder/containerd/namespace"
+
+// defaultNamespace is the name of containerd's default namespace, such as used
+// by nerdctl. Containers in this namespace have IDs without any namespace
+// prefix.
+const defaultNamespace = "default"
+
+// watchedNamespacesKey is the context key for passing the containerd
+// namespaces to watch to the containerd detector.
+type watchedNamespacesKey struct{}
+
+// WithWatchedNamespaces returns a new context carrying the containerd
+// namespaces for the containerd detector to watch. Without any namespaces,
+// the native API watchers watch all
+// namespaces except for the “moby” and “k8s.io” namespaces, as these are
+// usually better watched at the level of the Docker engine and the CRI API
+// respectively. This is the default. Specifying [AllNamespaces] watches all
+// namespaces, including “moby” and “k8s.io”. Otherwise, only the specified
+// namespaces are watched, such as “default” for nerdctl workloads.
+//
+// When watching the “moby” namespace while also watching the Docker engine
+// using this containerd, the turtlefinder drops the containerd duplicates of
+// the Docker containers, based on their container IDs.
+func WithWatchedNamespaces(ctx context.Context, namespaces ...string) context.Context {
+	return context.WithValue(ctx, watchedNamespacesKey{}, append([]string(nil), namespaces...))
+}
+
+// WatchedNamespaces returns the containerd namespaces to watch as carried by
+// the specified context, or nil if the default namespaces are to be watched.
+func WatchedNamespaces(ctx context.Context) []string {
+	namespaces, _ := ctx.Value(watchedNamespacesKey{}).([]string)
+	return namespaces
+}
+
+// namespaceClient is a containerd engine client that additionally labels
+// containers with their containerd namespaces and optionally watches only a
+// specific set of namespaces.
+type namespaceClient struct {
+	*cdengine.ContainerdWatcher
+	watched map[string]struct{} // namespaces to watch; nil for all.
+}
+
+// Make sure that the EngineClient interface is fully implemented.
+var _ (engineclient.EngineClient) = (*namespaceClient)(nil)
+
+// errUnwatchedNamespace signals a container in a namespace not being watched.
+var errUnwatchedNamespace = errors.New("container in unwatched containerd namespace")
+
+// newNamespaceClientOptions returns the engine client options and the set of
+// namespaces to watch according to the namespaces to watch carried by the
+// specified context.
+func newNamespaceClientOptions(ctx context.Context) (opts []cdengine.NewOption, watched map[string]struct{}) {
+	namespaces := WatchedNamespaces(ctx)
+	if namespaces == nil {
+		return nil, nil
+	}
+	// As we're filtering namespaces ourselves, we don't want the engine client
+	// to ignore any namespaces.
+	opts = []cdengine.NewOption{cdengine.WithIgnoredNamespaces([]string{})}
+	watched = map[string]struct{}{}
+	for _, namespace := range namespaces {
+		if namespace == AllNamespaces {
+			return opts, nil
+		}
+		watched[namespace] = struct{}{}
+	}
+	return opts, watched
+}
+
+// namespaceOf returns the containerd namespace of the container with the
+// specified ID, which might be prefixed by its namespace.
+func namespaceOf(id string) string {
+	namespace, _, ok := strings.Cut(id, "/")
+	if !ok {
+		return defaultNamespace
+	}
+	return namespace
+}
+
+// watches returns true if the container with the specified ID is in a
+// namespace being watched.
+func (c *namespaceClient) watches(id string) bool {
+	if c.watched == nil {
+		return true
+	}
+	_, ok := c.watched[namespaceOf(id)]
+	return ok
+}
+
+// List all the currently alive and kicking containers in the namespaces being
+// watched, labelled with their namespaces.
+func (c *namespaceClient) List(ctx context.Context) ([]*whalewatcher.Container, error) {
+	containers, err := c.ContainerdWatcher.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	watched := containers[:0]
+	for _, container := range containers {
+		if !c.watches(container.ID) {
+			continue
+		}
+		addNamespaceLabel(container)
+		watched = append(watched, container)
+	}
+	return watched, nil
+}
+
+// Inspect (only) those container details of interest to us, including the
+// namespace, given the name or ID of a container.
+func (c *namespaceClient) Inspect(ctx context.Context, nameorid string) (*whalewatcher.Container, error) {
+	if !c.watches(nameorid) {
+		return nil, errUnwatchedNamespace
+	}
+	container, err := c.ContainerdWatcher.Inspect(ctx, nameorid)
+	if err != nil {
+		return nil, err
+	}
+	addNamespaceLabel(container)
+	return container, nil
+}
+
+// LifecycleEvents streams the lifecycle events of containers in the
+// namespaces being watched.
+func (c *namespaceClient) LifecycleEvents(ctx context.Context) (<-chan engineclient.ContainerEvent, <-chan error) {
+	evs, errs := c.ContainerdWatcher.LifecycleEvents(ctx)
+	if c.watched == nil {
+		return evs, errs
+	}
+	return c.filterEvents(ctx, evs), errs
+}
+
+// filterEvents returns a channel passing on only the lifecycle events of
+// containers in the namespaces being watched from the specified event channel.
+// The returned channel gets closed when the specified event channel closes or
+// the context gets cancelled.
+func (c *namespaceClient) filterEvents(
+	ctx context.Context, evs <-chan engineclient.ContainerEvent,
+) <-chan engineclient.ContainerEvent {
+	filtered := make(chan engineclient.ContainerEvent)
+	go func() {
+		defer close(filtered)
+		for {
+			select {
+			case ev, ok := <-evs:
+				if !ok {
+					return
+				}
+				if !c.watches(ev.ID) {
+					continue
+				}
+				select {
+				case filtered <- ev:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return filtered
+}
+
+// addNamespaceLabel adds the containerd namespace label to the specified
+// container.
+func addNamespaceLabel(container *whalewatcher.Container) {
+	if container.Labels == nil {
+		container.Labels = map[string]string{}
+	}
+	container.Labels[NamespaceLabel] = namespaceOf(container.ID)
+}
@@ -0,0 +1,82 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package containerd
+
+import (
+	"context"
+
+	"github.com/thediveo/whalewatcher"
+	"github.com/thediveo/whalewatcher/engineclient"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("containerd namespaces", func() {
+
+	It("watches all but the ignored namespaces by default", func(ctx context.Context) {
+		opts, watched := newNamespaceClientOptions(ctx)
+		Expect(opts).To(BeEmpty())
+		Expect(watched).To(BeNil())
+
+		opts, watched = newNamespaceClientOptions(
+			WithWatchedNamespaces(WithWatchedNamespaces(ctx, "foo")))
+		Expect(opts).To(BeEmpty())
+		Expect(watched).To(BeNil())
+	})
+
+	It("watches all namespaces", func(ctx context.Context) {
+		opts, watched := newNamespaceClientOptions(WithWatchedNamespaces(ctx, AllNamespaces))
+		Expect(opts).To(HaveLen(1))
+		Expect(watched).To(BeNil())
+	})
+
+	It("watches only specific namespaces", func(ctx context.Context) {
+		namespaces := []string{"default", "foo"}
+		ctx = WithWatchedNamespaces(ctx, namespaces...)
+		namespaces[1] = "bar"
+		opts, watched := newNamespaceClientOptions(ctx)
+		Expect(opts).To(HaveLen(1))
+		Expect(watched).To(HaveLen(2))
+		Expect(watched).To(HaveKey("default"))
+		Expect(watched).To(HaveKey("foo"))
+
+		c := &namespaceClient{watched: watched}
+		Expect(c.watches("abc")).To(BeTrue())
+		Expect(c.watches("foo/abc")).To(BeTrue())
+		Expect(c.watches("moby/abc")).To(BeFalse())
+	})
+
+	It("filters lifecycle events by namespace", func(ctx context.Context) {
+		c := &namespaceClient{watched: map[string]struct{}{"default": {}}}
+		evs := make(chan engineclient.ContainerEvent)
+		filtered := c.filterEvents(ctx, evs)
+		go func() {
+			evs <- engineclient.ContainerEvent{ID: "moby/abc"}
+			evs <- engineclient.ContainerEvent{ID: "abc"}
+			close(evs)
+		}()
+		Eventually(filtered).Should(Receive(HaveField("ID", "abc")))
+		Eventually(filtered).Should(BeClosed())
+	})
+
+	It("stops filtering lifecycle events when cancelled", func(ctx context.Context) {
+		ctx, cancel := context.WithCancel(ctx)
+		c := &namespaceClient{watched: map[string]struct{}{"default": {}}}
+		filtered := c.filterEvents(ctx, make(chan engineclient.ContainerEvent))
+		cancel()
+		Eventually(filtered).Should(BeClosed())
+	})
+
+	It("labels containers with their namespaces", func() {
+		Expect(namespaceOf("abc")).To(Equal("default"))
+		Expect(namespaceOf("k8s.io/abc")).To(Equal("k8s.io"))
+
+		c := &whalewatcher.Container{ID: "foo/abc"}
+		addNamespaceLabel(c)
+		Expect(c.Labels).To(HaveKeyWithValue(NamespaceLabel, "foo"))
+	})
+
+})
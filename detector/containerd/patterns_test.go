@@ -0,0 +1,18 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package containerd
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("containerd engine process patterns", func() {
+
+	It("matches the executable of the containerd engine", func() {
+		Expect((&Detector{}).EngineExePaths()).To(ConsistOf("containerd"))
+	})
+
+})
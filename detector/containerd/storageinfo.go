@@ -0,0 +1,46 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package containerd
+
+import (
+	"context"
+	"encoding/json"
+
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// criStatusConfig is the part of the containerd CRI plugin configuration we're
+// interested in, as reported in the “config” information of a verbose CRI
+// runtime status.
+type criStatusConfig struct {
+	ContainerdRootDir string `json:"containerdRootDir"`
+	Containerd        struct {
+		Snapshotter string `json:"snapshotter"`
+	} `json:"containerd"`
+}
+
+// criStorageInfo returns the snapshotter and data root directory of the
+// containerd engine serving the specified CRI runtime service, as learnt from
+// the engine's verbose runtime status. It returns empty strings if the engine
+// doesn't tell.
+func criStorageInfo(ctx context.Context, rs runtime.RuntimeServiceClient) (snapshotter string, dataroot string) {
+	status, err := rs.Status(ctx, &runtime.StatusRequest{Verbose: true})
+	if err != nil {
+		return "", ""
+	}
+	return parseCRIStatusConfig(status.GetInfo()["config"])
+}
+
+// parseCRIStatusConfig returns the snapshotter and containerd root directory
+// from the specified CRI plugin configuration in JSON textual format. It
+// returns empty strings if the configuration is invalid or lacks the
+// information.
+func parseCRIStatusConfig(config string) (snapshotter string, dataroot string) {
+	var cfg criStatusConfig
+	if config == "" || json.Unmarshal([]byte(config), &cfg) != nil {
+		return "", ""
+	}
+	return cfg.Containerd.Snapshotter, cfg.ContainerdRootDir
+}
@@ -0,0 +1,29 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package containerd
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("storage information", func() {
+
+	It("parses the CRI plugin configuration", func() {
+		snapshotter, dataroot := parseCRIStatusConfig(
+			`{"containerd":{"snapshotter":"overlayfs","defaultRuntimeName":"runc"},"containerdRootDir":"/var/lib/containerd"}`)
+		Expect(snapshotter).To(Equal("overlayfs"))
+		Expect(dataroot).To(Equal("/var/lib/containerd"))
+	})
+
+	It("handles missing and invalid configurations", func() {
+		for _, config := range []string{"", "{", `{"foo":"bar"}`} {
+			snapshotter, dataroot := parseCRIStatusConfig(config)
+			Expect(snapshotter).To(BeEmpty(), "config %q", config)
+			Expect(dataroot).To(BeEmpty(), "config %q", config)
+		}
+	})
+
+})
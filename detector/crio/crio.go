@@ -6,17 +6,20 @@ package crio
 
 import (
 	"context"
+	"errors"
+	"io/fs"
 	"sort"
+	"strings"
 	"time"
 
 	detect "github.com/siemens/turtlefinder/detector"
 
 	"github.com/thediveo/go-plugger/v3"
-	"github.com/thediveo/lxkns/log"
 	"github.com/thediveo/lxkns/model"
 	criengine "github.com/thediveo/whalewatcher/engineclient/cri"
 	"github.com/thediveo/whalewatcher/watcher"
 	"github.com/thediveo/whalewatcher/watcher/cri"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1"
 )
 
 // Register this CRI-O container (engine) discovery plugin. This statically
@@ -31,32 +34,81 @@ func init() {
 // sometimes *snicker*).
 type Detector struct{}
 
+// Make sure that the DefaultAPIPathsDetector interface is fully implemented.
+var _ (detect.DefaultAPIPathsDetector) = (*Detector)(nil)
+
 // EngineNames returns the process name of the containerd engine process.
 func (d *Detector) EngineNames() []string {
 	return []string{"crio"} // it's crio, not criod, or cri-o, ...
 }
 
-// NewWatcher returns a watcher for tracking alive containerd containers.
+// DefaultAPIPaths returns the canonical API endpoint path of the CRI-O engine.
+func (d *Detector) DefaultAPIPaths() []string {
+	return []string{"/run/crio/crio.sock"}
+}
+
+// criAPIVersion is the CRI API version we announce when asking CRI-O for its
+// version information.
+const criAPIVersion = "0.1.0"
+
+// NewWatchers returns a watcher for tracking alive CRI-O containers.
 func (d *Detector) NewWatchers(ctx context.Context, pid model.PIDType, apis []string) []watcher.Watcher {
-	sort.Strings(apis) // in-place
+	lg := detect.LoggerFrom(ctx)
+	sort.Strings(apis)  // in-place
+	var denied []string // API endpoints we weren't allowed to talk to.
 	for _, apipathname := range apis {
-		log.Debugf("dialing CRI-O API endpoint '%s'", apipathname)
+		lg.Debugf("dialing CRI-O API endpoint '%s'", apipathname)
 		w, err := cri.New(apipathname, nil, criengine.WithPID(int(pid)))
 		if err != nil {
-			log.Debugf("CRI-O API endpoint '%s' failed: %s", apipathname, err.Error())
+			lg.Debugf("CRI-O API endpoint '%s' failed: %s", apipathname, err.Error())
+			if isPermissionDenied(err) {
+				denied = append(denied, apipathname)
+			}
 			continue
 		}
-		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-		version := w.Version(ctx)
-		if err := ctx.Err(); err != nil || version == "" {
-			log.Debugf("CRI-O API Info call context hit deadline: %s", err.Error())
-		}
+		// Creating the engine client usually succeeds, as it doesn't talk to
+		// the CRI API yet. So we explicitly ask for the CRI version
+		// information, in the same way as the containerd CRI probe does.
+		versionctx, cancel := context.WithTimeout(ctx, detect.ClientTimeout(ctx, 5*time.Second))
+		version, err := w.Client().(*criengine.Client).RuntimeService().
+			Version(versionctx, &runtime.VersionRequest{Version: criAPIVersion})
 		cancel()
-		if err == nil {
-			return []watcher.Watcher{w}
+		if err != nil {
+			lg.Debugf("CRI-O API endpoint '%s' version request failed: %s", apipathname, err.Error())
+			if isPermissionDenied(err) {
+				denied = append(denied, apipathname)
+			}
+			w.Close()
+			continue
 		}
-		w.Close()
+		return []watcher.Watcher{detect.WithAPIVersion(w, version.GetRuntimeApiVersion())}
+	}
+	if len(denied) > 0 {
+		lg.Errorf("%s", permissionDeniedMessage(denied))
+		return nil
 	}
-	log.Errorf("no working CRI-O API endpoint found.")
+	lg.Errorf("no working CRI-O API endpoint found.")
 	return nil
 }
+
+// isPermissionDenied returns true if the specified error is caused by being
+// denied access to an API endpoint. As gRPC turns dial errors into status
+// errors, we unfortunately cannot unwrap these but have to check the error
+// text instead.
+func isPermissionDenied(err error) bool {
+	return errors.Is(err, fs.ErrPermission) ||
+		strings.Contains(err.Error(), "permission denied")
+}
+
+// permissionDeniedMessage returns an actionable error message for the specified
+// CRI-O API endpoints we were denied access to. On OpenShift nodes, this
+// usually is SELinux blocking access to the API socket through the
+// “/proc/[PID]/root” wormhole of the CRI-O process, rather than plain file
+// access permissions.
+func permissionDeniedMessage(apis []string) string {
+	return "permission denied when accessing CRI-O API endpoint(s) '" +
+		strings.Join(apis, "', '") + "'; " +
+		"on SELinux-enforcing nodes, such as OpenShift, please make sure " +
+		"to run with an SELinux context allowed to access CRI-O's API socket, " +
+		"such as \"spc_t\" for privileged containers"
+}
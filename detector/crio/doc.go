@@ -1,4 +1,9 @@
 /*
 Package crio implements the engine detector for cri-o engine processes.
+
+On SELinux-enforcing nodes, such as OpenShift, access to CRI-O's API socket
+might be denied even when running as root. In this case, the detector reports
+the API endpoint(s) that couldn't be accessed together with a hint to check
+the SELinux context of the discovery process.
 */
 package crio
@@ -0,0 +1,115 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package crio
+
+import (
+	"context"
+	"io/fs"
+	"net"
+	"sync"
+
+	detect "github.com/siemens/turtlefinder/detector"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+// fakeRuntimeService is a CRI runtime service that only answers version
+// requests, recording the requested CRI API versions.
+type fakeRuntimeService struct {
+	runtime.UnimplementedRuntimeServiceServer
+	mu       sync.Mutex
+	versions []string
+	fail     bool
+	err      error // if non-nil, the error to fail with.
+}
+
+func (s *fakeRuntimeService) Version(ctx context.Context, req *runtime.VersionRequest) (*runtime.VersionResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.versions = append(s.versions, req.Version)
+	if s.err != nil {
+		return nil, s.err
+	}
+	if s.fail {
+		return nil, status.Error(codes.Unimplemented, "no version for you")
+	}
+	return &runtime.VersionResponse{
+		Version:           criAPIVersion,
+		RuntimeName:       "cri-o",
+		RuntimeVersion:    "1.30.0",
+		RuntimeApiVersion: "v1",
+	}, nil
+}
+
+// serveFakeRuntimeService serves the specified fake CRI runtime service on a
+// unix domain socket, returning the socket path.
+func serveFakeRuntimeService(s *fakeRuntimeService) string {
+	GinkgoHelper()
+	api := GinkgoT().TempDir() + "/crio.sock"
+	l := Successful(net.Listen("unix", api))
+	srv := grpc.NewServer()
+	runtime.RegisterRuntimeServiceServer(srv, s)
+	go func() { _ = srv.Serve(l) }()
+	DeferCleanup(srv.Stop)
+	return api
+}
+
+var _ = Describe("CRI-O version probe", func() {
+
+	It("explicitly asks for the CRI version", func(ctx context.Context) {
+		s := &fakeRuntimeService{}
+		api := serveFakeRuntimeService(s)
+		ws := (&Detector{}).NewWatchers(ctx, 0, []string{api})
+		Expect(ws).To(HaveLen(1))
+		ws[0].Close()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		Expect(s.versions).To(ConsistOf(criAPIVersion))
+	})
+
+	It("rejects API endpoints failing version requests", func(ctx context.Context) {
+		api := serveFakeRuntimeService(&fakeRuntimeService{fail: true})
+		Expect((&Detector{}).NewWatchers(ctx, 0, []string{api})).To(BeEmpty())
+	})
+
+	It("tells when access to API endpoints is denied", func(ctx context.Context) {
+		var errmsgs []string
+		ctx = detect.WithLogFunc(ctx, func(level, msg string, kv ...any) {
+			if level == detect.LevelError {
+				errmsgs = append(errmsgs, msg)
+			}
+		})
+
+		api := serveFakeRuntimeService(&fakeRuntimeService{fail: true})
+		Expect((&Detector{}).NewWatchers(ctx, 0, []string{api})).To(BeEmpty())
+		Expect(errmsgs).To(ConsistOf("no working CRI-O API endpoint found."))
+
+		errmsgs = nil
+		api = serveFakeRuntimeService(&fakeRuntimeService{
+			err: status.Error(codes.Unavailable,
+				"connection error: desc = \"transport: Error while dialing: dial unix /run/crio/crio.sock: connect: permission denied\""),
+		})
+		Expect((&Detector{}).NewWatchers(ctx, 0, []string{api})).To(BeEmpty())
+		Expect(errmsgs).To(ConsistOf(
+			"permission denied when accessing CRI-O API endpoint(s) '" + api + "'; " +
+				"on SELinux-enforcing nodes, such as OpenShift, please make sure " +
+				"to run with an SELinux context allowed to access CRI-O's API socket, " +
+				"such as \"spc_t\" for privileged containers"))
+	})
+
+	It("detects permission denied errors", func() {
+		Expect(isPermissionDenied(fs.ErrPermission)).To(BeTrue())
+		Expect(isPermissionDenied(status.Error(codes.Unavailable, "connect: permission denied"))).To(BeTrue())
+		Expect(isPermissionDenied(status.Error(codes.Unavailable, "connect: no such file or directory"))).To(BeFalse())
+	})
+
+})
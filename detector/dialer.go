@@ -0,0 +1,59 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package detector
+
+import (
+	"context"
+	"net"
+	"strings"
+)
+
+// dialerKey is the context key for passing a custom dialer for connecting to
+// container engine API endpoints to detector plugins.
+type dialerKey struct{}
+
+// WithDialer returns a new context carrying the specified dialer for detector
+// plugins to use when connecting to container engine API endpoints, such as
+// for connecting via a proxy or with custom socket options. A nil dialer tells
+// detector plugins to use their default dialing.
+func WithDialer(ctx context.Context, d *net.Dialer) context.Context {
+	return context.WithValue(ctx, dialerKey{}, d)
+}
+
+// CustomDialer returns the dialer carried by the specified context, or nil if
+// there is none.
+func CustomDialer(ctx context.Context) *net.Dialer {
+	d, _ := ctx.Value(dialerKey{}).(*net.Dialer)
+	return d
+}
+
+// Dialer returns the dialer carried by the specified context, if any.
+// Otherwise, it returns a zero-value dialer.
+func Dialer(ctx context.Context) *net.Dialer {
+	if d := CustomDialer(ctx); d != nil {
+		return d
+	}
+	return &net.Dialer{}
+}
+
+// DialContextFunc returns a dial function always connecting to the specified
+// API endpoint using the custom dialer carried by the specified context, for
+// use with HTTP transports and engine clients. The API endpoint is either a
+// TCP endpoint “tcp://host:port” or a unix domain socket path, optionally
+// prefixed with “unix://”. DialContextFunc returns nil if the context doesn't
+// carry a custom dialer, so that engine clients keep dialing on their own.
+func DialContextFunc(ctx context.Context, api string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	d := CustomDialer(ctx)
+	if d == nil {
+		return nil
+	}
+	network, addr := "unix", strings.TrimPrefix(api, "unix://")
+	if strings.HasPrefix(api, TCPScheme) {
+		network, addr = "tcp", strings.TrimPrefix(api, TCPScheme)
+	}
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return d.DialContext(ctx, network, addr)
+	}
+}
@@ -0,0 +1,55 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package detector
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"syscall"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("engine dialer", func() {
+
+	It("defaults to a zero-value dialer", func(ctx context.Context) {
+		Expect(CustomDialer(ctx)).To(BeNil())
+		Expect(Dialer(ctx)).To(Equal(&net.Dialer{}))
+		Expect(DialContextFunc(ctx, "/run/docker.sock")).To(BeNil())
+
+		Expect(CustomDialer(WithDialer(ctx, nil))).To(BeNil())
+	})
+
+	It("dials using the custom dialer", func(ctx context.Context) {
+		sockpath := GinkgoT().TempDir() + "/engine.sock"
+		lsock := Successful(net.Listen("unix", sockpath))
+		defer lsock.Close()
+
+		var controlled atomic.Int32
+		d := &net.Dialer{
+			Control: func(network, address string, c syscall.RawConn) error {
+				controlled.Add(1)
+				return nil
+			},
+		}
+		ctx = WithDialer(ctx, d)
+		Expect(CustomDialer(ctx)).To(BeIdenticalTo(d))
+		Expect(Dialer(ctx)).To(BeIdenticalTo(d))
+
+		for _, api := range []string{sockpath, "unix://" + sockpath} {
+			dial := DialContextFunc(ctx, api)
+			Expect(dial).NotTo(BeNil())
+			// the dial function always connects to the API endpoint,
+			// regardless of what it is being asked for.
+			conn := Successful(dial(ctx, "tcp", "docker.sock:80"))
+			conn.Close()
+		}
+		Expect(controlled.Load()).To(Equal(int32(2)))
+	})
+
+})
@@ -0,0 +1,54 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package detector
+
+import (
+	"context"
+	"crypto/tls"
+	"strings"
+)
+
+// TCPScheme is the scheme prefix of TCP API endpoints, as opposed to the usual
+// unix domain socket API endpoint paths.
+const TCPScheme = "tcp://"
+
+// engineTLSKey is the context key for passing TLS client configurations for TCP
+// API endpoints to detector plugins.
+type engineTLSKey struct{}
+
+// engineTLS is a TLS client configuration for the TCP API endpoints matching
+// an endpoint prefix.
+type engineTLS struct {
+	match  string
+	config *tls.Config
+}
+
+// WithEngineTLS returns a new context carrying the specified TLS client
+// configuration for detector plugins to use when talking to TCP API endpoints,
+// such as “tcp://host:2376”, that start with the specified endpoint match.
+// Multiple TLS client configurations can be passed by calling WithEngineTLS
+// multiple times, where the configuration passed first wins. Unix domain socket
+// API endpoints are never affected.
+func WithEngineTLS(ctx context.Context, endpointMatch string, config *tls.Config) context.Context {
+	tlses, _ := ctx.Value(engineTLSKey{}).([]engineTLS)
+	tlses = append(tlses[:len(tlses):len(tlses)], engineTLS{match: endpointMatch, config: config})
+	return context.WithValue(ctx, engineTLSKey{}, tlses)
+}
+
+// EngineTLS returns the TLS client configuration carried by the specified
+// context for the specified TCP API endpoint, if any. Otherwise, it returns
+// nil, especially for unix domain socket API endpoints.
+func EngineTLS(ctx context.Context, api string) *tls.Config {
+	if !strings.HasPrefix(api, TCPScheme) {
+		return nil
+	}
+	tlses, _ := ctx.Value(engineTLSKey{}).([]engineTLS)
+	for _, t := range tlses {
+		if strings.HasPrefix(api, t.match) {
+			return t.config
+		}
+	}
+	return nil
+}
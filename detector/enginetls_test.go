@@ -0,0 +1,39 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package detector
+
+import (
+	"context"
+	"crypto/tls"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("engine TLS", func() {
+
+	It("doesn't return TLS configurations by default", func(ctx context.Context) {
+		Expect(EngineTLS(ctx, "tcp://localhost:2376")).To(BeNil())
+	})
+
+	It("returns matching TLS configurations for TCP endpoints only", func(ctx context.Context) {
+		foo := &tls.Config{ServerName: "foo"}
+		bar := &tls.Config{ServerName: "bar"}
+		any := &tls.Config{ServerName: "any"}
+		ctx = WithEngineTLS(ctx, "tcp://foo:", foo)
+		barctx := WithEngineTLS(ctx, "tcp://bar:2376", bar)
+		anyctx := WithEngineTLS(barctx, "", any)
+
+		Expect(EngineTLS(barctx, "tcp://foo:2376")).To(BeIdenticalTo(foo))
+		Expect(EngineTLS(barctx, "tcp://bar:2376")).To(BeIdenticalTo(bar))
+		Expect(EngineTLS(barctx, "tcp://baz:2376")).To(BeNil())
+		Expect(EngineTLS(anyctx, "tcp://baz:2376")).To(BeIdenticalTo(any))
+		Expect(EngineTLS(ctx, "tcp://bar:2376")).To(BeNil())
+
+		Expect(EngineTLS(anyctx, "/run/docker.sock")).To(BeNil())
+		Expect(EngineTLS(anyctx, "unix:///run/docker.sock")).To(BeNil())
+	})
+
+})
@@ -0,0 +1,23 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package detector
+
+import "github.com/thediveo/whalewatcher/watcher"
+
+// WithEngineType returns the specified watcher wrapped so that it reports the
+// specified engine type instead of its own type. Detector plugins use this when
+// they learn only after connecting to a container engine what kind of engine
+// they are actually talking to, such as podman serving a Docker-compatible API.
+// If the engine type is empty or the same as the watcher's type, the watcher is
+// returned unwrapped. Any API version and storage information of an already
+// wrapped watcher (see [WithAPIVersion] and [WithStorageInfo]) is kept.
+func WithEngineType(w watcher.Watcher, enginetype string) watcher.Watcher {
+	if w == nil || enginetype == "" || enginetype == w.Type() {
+		return w
+	}
+	iw := newInfoWatcher(w)
+	iw.enginetype = enginetype
+	return iw
+}
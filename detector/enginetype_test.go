@@ -0,0 +1,34 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package detector
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("engine types", func() {
+
+	It("doesn't wrap without a different engine type", func() {
+		w := &typedWatcher{}
+		Expect(WithEngineType(w, "")).To(BeIdenticalTo(w))
+		Expect(WithEngineType(w, "fooengine")).To(BeIdenticalTo(w))
+		Expect(WithEngineType(nil, "podman.io")).To(BeNil())
+	})
+
+	It("overrides the engine type while keeping other information", func() {
+		w := WithEngineType(
+			WithStorageInfo(WithAPIVersion(&typedWatcher{}, "1.41"), "overlay", "/var/lib/containers/storage"),
+			"podman.io")
+		Expect(w.Type()).To(Equal("podman.io"))
+		Expect(w.(APIVersioner).APIVersion()).To(Equal("1.41"))
+		Expect(w.(StorageInfoer).StorageDriver()).To(Equal("overlay"))
+
+		w = WithAPIVersion(w, "1.42")
+		Expect(w.Type()).To(Equal("podman.io"))
+		Expect(w.(APIVersioner).APIVersion()).To(Equal("1.42"))
+	})
+
+})
@@ -0,0 +1,337 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package garden
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	detect "github.com/siemens/turtlefinder/detector"
+	"github.com/thediveo/whalewatcher"
+	"github.com/thediveo/whalewatcher/engineclient"
+)
+
+// Type is the type identifier for Garden container engines and as returned by
+// Watcher.Type().
+const Type = "cloudfoundry.org/garden"
+
+// baseURL is the base URL for talking HTTP to Garden's API. As we always dial
+// the API's unix domain socket, the host part doesn't matter.
+const baseURL = "http://garden"
+
+// runcRoot is the runc state directory Guardian's containers live in, relative
+// to the (mount namespace of the) Guardian engine process.
+const runcRoot = "/run/runc"
+
+// defaultPollInterval is the interval for polling Garden for container
+// lifecycle changes, as Garden doesn't stream any lifecycle events.
+const defaultPollInterval = 2 * time.Second
+
+// GardenClient is a (minimal) Garden engine client implementing the
+// whalewatcher engineclient.EngineClient interface.
+type GardenClient struct {
+	api          string        // path of API endpoint unix domain socket.
+	pid          int           // PID of Garden engine process, if known.
+	client       *http.Client  // HTTP client dialing the API endpoint.
+	dialer       *net.Dialer   // dialer for connecting to the API endpoint.
+	procroot     string        // where the proc filesystem is mounted.
+	staterootdir string        // runc state directory for looking up container PIDs.
+	pollinterval time.Duration // interval for polling container lifecycle changes.
+}
+
+// Make sure that the EngineClient interface is fully implemented.
+var _ (engineclient.EngineClient) = (*GardenClient)(nil)
+
+// NewOption represents options to NewGardenClient when creating new Garden
+// engine clients.
+type NewOption func(*GardenClient)
+
+// WithPID sets the PID of the Garden engine process. It also determines the
+// location of the runc state used for looking up the PIDs of containers.
+func WithPID(pid int) NewOption {
+	return func(gc *GardenClient) {
+		gc.pid = pid
+	}
+}
+
+// WithProcRoot sets the path where the proc filesystem is mounted; defaults to
+// “/proc”. Together with the PID of the Garden engine process it determines the
+// location of the runc state used for looking up the PIDs of containers.
+func WithProcRoot(procroot string) NewOption {
+	return func(gc *GardenClient) {
+		gc.procroot = procroot
+	}
+}
+
+// WithDialer sets the dialer to use for connecting to Garden's API endpoint,
+// instead of a zero-value dialer.
+func WithDialer(d *net.Dialer) NewOption {
+	return func(gc *GardenClient) {
+		if d != nil {
+			gc.dialer = d
+		}
+	}
+}
+
+// NewGardenClient returns a new Garden engine client talking to the Garden API
+// at the specified unix domain socket path.
+func NewGardenClient(api string, opts ...NewOption) *GardenClient {
+	gc := &GardenClient{
+		api:          api,
+		pollinterval: defaultPollInterval,
+		dialer:       &net.Dialer{},
+		procroot:     detect.DefaultProcRoot,
+	}
+	gc.client = &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return gc.dialer.DialContext(ctx, "unix", api)
+			},
+		},
+	}
+	for _, opt := range opts {
+		opt(gc)
+	}
+	if gc.pid != 0 {
+		gc.staterootdir = gc.procroot + "/" + strconv.Itoa(gc.pid) + "/root" + runcRoot
+	} else {
+		gc.staterootdir = runcRoot
+	}
+	return gc
+}
+
+// containerInfo represents the (few) details we're interested in from Garden's
+// container information.
+type containerInfo struct {
+	State      string            `json:"State"`
+	Properties map[string]string `json:"Properties"`
+}
+
+// containerInfoEntry represents an individual container's information as part
+// of Garden's bulk container information.
+type containerInfoEntry struct {
+	Info containerInfo `json:"Info"`
+	Err  *struct {
+		Message string `json:"Message"`
+	} `json:"Err"`
+}
+
+// get a JSON response from the specified Garden API path and decode it into
+// the specified result.
+func (gc *GardenClient) get(ctx context.Context, path string, result any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := gc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("garden API %s failed with status %d", path, resp.StatusCode)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// Ping checks that the Garden engine is responsive.
+func (gc *GardenClient) Ping(ctx context.Context) error {
+	return gc.get(ctx, "/ping", nil)
+}
+
+// handles returns the handles of all Garden containers.
+func (gc *GardenClient) handles(ctx context.Context) ([]string, error) {
+	var handles struct {
+		Handles []string `json:"Handles"`
+	}
+	if err := gc.get(ctx, "/containers", &handles); err != nil {
+		return nil, err
+	}
+	return handles.Handles, nil
+}
+
+// List all the currently alive and kicking containers.
+func (gc *GardenClient) List(ctx context.Context) ([]*whalewatcher.Container, error) {
+	handles, err := gc.handles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(handles) == 0 {
+		return nil, nil
+	}
+	infos := map[string]containerInfoEntry{}
+	if err := gc.get(ctx,
+		"/containers/bulk_info?handles="+url.QueryEscape(strings.Join(handles, ",")),
+		&infos); err != nil {
+		return nil, err
+	}
+	containers := make([]*whalewatcher.Container, 0, len(infos))
+	for handle, entry := range infos {
+		if entry.Err != nil {
+			continue
+		}
+		if container := gc.container(handle, entry.Info); container != nil {
+			containers = append(containers, container)
+		}
+	}
+	return containers, nil
+}
+
+// Inspect (only) those container details of interest to us, given the handle
+// of a Garden container.
+func (gc *GardenClient) Inspect(ctx context.Context, handle string) (*whalewatcher.Container, error) {
+	var info containerInfo
+	if err := gc.get(ctx, "/containers/"+url.PathEscape(handle)+"/info", &info); err != nil {
+		return nil, err
+	}
+	container := gc.container(handle, info)
+	if container == nil {
+		return nil, engineclient.NewProcesslessContainerError(handle, "Garden")
+	}
+	return container, nil
+}
+
+// container returns the whalewatcher container for the specified Garden
+// container handle and information, or nil if the container isn't alive.
+func (gc *GardenClient) container(handle string, info containerInfo) *whalewatcher.Container {
+	if info.State != "active" {
+		return nil
+	}
+	pid := gc.containerPID(handle)
+	if pid == 0 {
+		return nil
+	}
+	labels := make(map[string]string, len(info.Properties))
+	for k, v := range info.Properties {
+		labels[k] = v
+	}
+	return &whalewatcher.Container{
+		ID:     handle,
+		Name:   handle,
+		Labels: labels,
+		PID:    pid,
+	}
+}
+
+// containerPID returns the PID of the initial process of the Garden container
+// with the specified handle, based on the runc state information, or zero if
+// the PID cannot be determined.
+func (gc *GardenClient) containerPID(handle string) int {
+	statejson, err := os.ReadFile(gc.staterootdir + "/" + handle + "/state.json")
+	if err != nil {
+		return 0
+	}
+	var state struct {
+		InitProcessPID int `json:"init_process_pid"`
+	}
+	if err := json.Unmarshal(statejson, &state); err != nil {
+		return 0
+	}
+	return state.InitProcessPID
+}
+
+// LifecycleEvents streams container lifecycle events. As Garden doesn't offer
+// any event streaming, LifecycleEvents periodically polls the Garden
+// containers and reports newly appeared and vanished containers.
+func (gc *GardenClient) LifecycleEvents(ctx context.Context) (<-chan engineclient.ContainerEvent, <-chan error) {
+	evs := make(chan engineclient.ContainerEvent)
+	errs := make(chan error, 1)
+	go func() {
+		known, err := gc.handles(ctx)
+		if err != nil {
+			errs <- err
+			return
+		}
+		seen := map[string]struct{}{}
+		for _, handle := range known {
+			seen[handle] = struct{}{}
+		}
+		ticker := time.NewTicker(gc.pollinterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			case <-ticker.C:
+			}
+			handles, err := gc.handles(ctx)
+			if err != nil {
+				errs <- err
+				return
+			}
+			current := make(map[string]struct{}, len(handles))
+			for _, handle := range handles {
+				current[handle] = struct{}{}
+				if _, ok := seen[handle]; ok {
+					continue
+				}
+				if !gc.send(ctx, evs, engineclient.ContainerStarted, handle) {
+					return
+				}
+			}
+			for handle := range seen {
+				if _, ok := current[handle]; ok {
+					continue
+				}
+				if !gc.send(ctx, evs, engineclient.ContainerExited, handle) {
+					return
+				}
+			}
+			seen = current
+		}
+	}()
+	return evs, errs
+}
+
+// send the specified container lifecycle event, returning false if the context
+// got cancelled in the meantime.
+func (gc *GardenClient) send(
+	ctx context.Context,
+	evs chan<- engineclient.ContainerEvent,
+	typ engineclient.ContainerEventType,
+	handle string,
+) bool {
+	select {
+	case evs <- engineclient.ContainerEvent{Type: typ, ID: handle}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// ID returns an identifier for this Garden engine. As Garden doesn't have any
+// engine ID, we use its API endpoint path instead.
+func (gc *GardenClient) ID(ctx context.Context) string { return gc.api }
+
+// Type returns the type identifier for this engine client.
+func (gc *GardenClient) Type() string { return Type }
+
+// Version returns the version information of this engine. As Garden doesn't
+// report its version via its API, the version is always empty.
+func (gc *GardenClient) Version(ctx context.Context) string { return "" }
+
+// API returns the Garden API endpoint path.
+func (gc *GardenClient) API() string { return gc.api }
+
+// PID returns the PID of the Garden engine process, if known; otherwise zero.
+func (gc *GardenClient) PID() int { return gc.pid }
+
+// Client returns the underlying HTTP client talking to the Garden API.
+func (gc *GardenClient) Client() interface{} { return gc.client }
+
+// Close cleans up and releases any engine client resources.
+func (gc *GardenClient) Close() { gc.client.CloseIdleConnections() }
@@ -0,0 +1,16 @@
+/*
+Package garden implements the engine detector for Cloud Foundry's Garden
+container engine in form of its “Guardian” backend (“gdn”), as used on Diego
+cells.
+
+As the upstream whalewatcher module doesn't offer an engine client for
+Garden, this package brings its own (minimal) engine client talking to
+Garden's HTTP API via its unix domain socket, usually located beneath
+“/run/gdn/”. Garden doesn't stream container lifecycle events, so the engine
+client instead periodically polls the list of containers.
+
+Garden containers don't have any PIDs in Garden's API. The engine client thus
+looks up the PIDs of the initial container processes from the state that the
+runc low-level runtime keeps on behalf of Guardian.
+*/
+package garden
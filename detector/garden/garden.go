@@ -0,0 +1,66 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package garden
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	detect "github.com/siemens/turtlefinder/detector"
+
+	"github.com/thediveo/go-plugger/v3"
+	"github.com/thediveo/lxkns/model"
+	"github.com/thediveo/whalewatcher/watcher"
+)
+
+// Register this Garden container (engine) discovery plugin. This statically
+// ensures that the Detector interface is fully implemented.
+func init() {
+	plugger.Group[detect.Detector]().Register(
+		&Detector{}, plugger.WithPlugin("garden"))
+}
+
+// Detector implements the detect.Detector interface. This is automatically
+// type-checked by the previous plugin registration (Generics can be sweet,
+// sometimes *snicker*).
+type Detector struct{}
+
+// EngineNames returns the process names of the Garden engine process.
+func (d *Detector) EngineNames() []string {
+	return []string{"guardian", "gdn"}
+}
+
+// NewWatchers returns a watcher for tracking alive Garden containers. As the
+// Garden client only talks to unix domain socket API endpoints, NewWatchers
+// skips any TCP and vsock API endpoints.
+func (d *Detector) NewWatchers(ctx context.Context, pid model.PIDType, apis []string) []watcher.Watcher {
+	lg := detect.LoggerFrom(ctx)
+	sort.Strings(apis) // in-place
+	for _, apipathname := range apis {
+		if strings.HasPrefix(apipathname, detect.TCPScheme) ||
+			strings.HasPrefix(apipathname, detect.VsockScheme) {
+			lg.Debugf("Garden API not supported on non-unix endpoint '%s'", apipathname)
+			continue
+		}
+		lg.Debugf("dialing Garden API endpoint '%s'", apipathname)
+		gc := NewGardenClient(apipathname,
+			WithPID(int(pid)),
+			WithProcRoot(detect.ProcRoot(ctx)),
+			WithDialer(detect.CustomDialer(ctx)))
+		pingctx, cancel := context.WithTimeout(ctx, detect.ClientTimeout(ctx, 5*time.Second))
+		err := gc.Ping(pingctx)
+		cancel()
+		if err != nil {
+			lg.Debugf("Garden API endpoint '%s' failed: %s", apipathname, err.Error())
+			gc.Close()
+			continue
+		}
+		return []watcher.Watcher{detect.WithPing(watcher.New(gc, nil), gc.Ping)}
+	}
+	lg.Errorf("no working Garden API endpoint found.")
+	return nil
+}
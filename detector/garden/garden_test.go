@@ -0,0 +1,220 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package garden
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	detect "github.com/siemens/turtlefinder/detector"
+	"github.com/thediveo/go-plugger/v3"
+	"github.com/thediveo/whalewatcher/engineclient"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeGarden serves a minimal fake Garden API on a unix domain socket.
+type fakeGarden struct {
+	mu         sync.Mutex
+	containers map[string]containerInfo
+}
+
+func (g *fakeGarden) set(handle string, info *containerInfo) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if info == nil {
+		delete(g.containers, handle)
+		return
+	}
+	g.containers[handle] = *info
+}
+
+// start serving the fake Garden API, returning the API socket path.
+func (g *fakeGarden) start() string {
+	GinkgoHelper()
+	api := filepath.Join(GinkgoT().TempDir(), "gdn.sock")
+	l, err := net.Listen("unix", api)
+	Expect(err).NotTo(HaveOccurred())
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/containers", func(w http.ResponseWriter, r *http.Request) {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		handles := []string{}
+		for handle := range g.containers {
+			handles = append(handles, handle)
+		}
+		_ = json.NewEncoder(w).Encode(map[string][]string{"Handles": handles})
+	})
+	mux.HandleFunc("/containers/bulk_info", func(w http.ResponseWriter, r *http.Request) {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		infos := map[string]containerInfoEntry{}
+		for _, handle := range strings.Split(r.URL.Query().Get("handles"), ",") {
+			if info, ok := g.containers[handle]; ok {
+				infos[handle] = containerInfoEntry{Info: info}
+			}
+		}
+		_ = json.NewEncoder(w).Encode(infos)
+	})
+	mux.HandleFunc("/containers/", func(w http.ResponseWriter, r *http.Request) {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		handle := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/containers/"), "/info")
+		info, ok := g.containers[handle]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(info)
+	})
+	srv := &http.Server{Handler: mux}
+	go func() { _ = srv.Serve(l) }()
+	DeferCleanup(func() { _ = srv.Close() })
+	return api
+}
+
+// writeRuncState writes a fake runc state for the specified container handle.
+func writeRuncState(rootdir string, handle string, pid int) {
+	GinkgoHelper()
+	Expect(os.MkdirAll(filepath.Join(rootdir, handle), 0o755)).To(Succeed())
+	statejson, err := json.Marshal(map[string]int{"init_process_pid": pid})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(os.WriteFile(filepath.Join(rootdir, handle, "state.json"), statejson, 0o644)).To(Succeed())
+}
+
+var _ = Describe("Garden detector", func() {
+
+	var garden *fakeGarden
+	var api string
+	var staterootdir string
+
+	BeforeEach(func() {
+		garden = &fakeGarden{containers: map[string]containerInfo{}}
+		api = garden.start()
+		staterootdir = GinkgoT().TempDir()
+	})
+
+	newClient := func() *GardenClient {
+		gc := NewGardenClient(api, WithPID(42))
+		gc.staterootdir = staterootdir
+		gc.pollinterval = 50 * time.Millisecond
+		DeferCleanup(gc.Close)
+		return gc
+	}
+
+	It("registers correctly", func() {
+		Expect(plugger.Group[detect.Detector]().Plugins()).To(
+			ContainElement("garden"))
+	})
+
+	It("tries unsuccessfully", NodeTimeout(30*time.Second), func(ctx context.Context) {
+		d := &Detector{}
+		Expect(d.NewWatchers(ctx, 0, []string{"/etc/rumpelpumpel"})).To(BeEmpty())
+	})
+
+	It("skips TCP and vsock API endpoints", NodeTimeout(30*time.Second), func(ctx context.Context) {
+		var mu sync.Mutex
+		var dialed []string
+		ctx = detect.WithLogFunc(ctx, func(level, msg string, kv ...any) {
+			if strings.HasPrefix(msg, "dialing Garden API endpoint") {
+				mu.Lock()
+				defer mu.Unlock()
+				dialed = append(dialed, msg)
+			}
+		})
+
+		d := &Detector{}
+		Expect(d.NewWatchers(ctx, 42, []string{
+			detect.TCPScheme + "127.0.0.1:7777",
+			detect.VsockScheme + "3:7777",
+		})).To(BeEmpty())
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(dialed).To(BeEmpty())
+	})
+
+	It("returns a watcher", NodeTimeout(30*time.Second), func(ctx context.Context) {
+		d := &Detector{}
+		ws := d.NewWatchers(ctx, 42, []string{api})
+		Expect(ws).To(HaveLen(1))
+		defer ws[0].Close()
+		Expect(ws[0].Type()).To(Equal(Type))
+		Expect(ws[0].PID()).To(Equal(42))
+	})
+
+	It("locates the runc state in the proc filesystem passed", func(ctx context.Context) {
+		Expect(NewGardenClient(api, WithPID(42)).staterootdir).To(
+			Equal("/proc/42/root/run/runc"))
+		Expect(NewGardenClient(api).staterootdir).To(Equal("/run/runc"))
+
+		procroot := GinkgoT().TempDir()
+		garden.set("alive", &containerInfo{State: "active"})
+		writeRuncState(procroot+"/42/root/run/runc", "alive", 1234)
+		d := &Detector{}
+		ws := d.NewWatchers(detect.WithProcRoot(ctx, procroot), 42, []string{api})
+		Expect(ws).To(HaveLen(1))
+		w := ws[0]
+		defer w.Close()
+		go func() { _ = w.Watch(ctx) }()
+		Eventually(w.Ready).Should(BeClosed())
+		Expect(w.Portfolio().Container("alive")).To(HaveField("PID", 1234))
+	})
+
+	It("lists and inspects alive containers", func(ctx context.Context) {
+		garden.set("alive", &containerInfo{State: "active", Properties: map[string]string{"foo": "bar"}})
+		garden.set("stopped", &containerInfo{State: "stopped"})
+		garden.set("pidless", &containerInfo{State: "active"})
+		writeRuncState(staterootdir, "alive", 1234)
+		writeRuncState(staterootdir, "stopped", 666)
+
+		gc := newClient()
+		containers, err := gc.List(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(containers).To(ConsistOf(And(
+			HaveField("ID", "alive"),
+			HaveField("Name", "alive"),
+			HaveField("PID", 1234),
+			HaveField("Labels", HaveKeyWithValue("foo", "bar")),
+		)))
+
+		container, err := gc.Inspect(ctx, "alive")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(container.PID).To(Equal(1234))
+
+		_, err = gc.Inspect(ctx, "pidless")
+		Expect(engineclient.IsProcesslessContainer(err)).To(BeTrue())
+	})
+
+	It("polls for lifecycle events", func(ctx context.Context) {
+		garden.set("old", &containerInfo{State: "active"})
+
+		gc := newClient()
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		evs, errs := gc.LifecycleEvents(ctx)
+
+		time.Sleep(100 * time.Millisecond)
+		garden.set("new", &containerInfo{State: "active"})
+		Eventually(evs).Should(Receive(Equal(engineclient.ContainerEvent{
+			Type: engineclient.ContainerStarted, ID: "new"})))
+
+		garden.set("old", nil)
+		Eventually(evs).Should(Receive(Equal(engineclient.ContainerEvent{
+			Type: engineclient.ContainerExited, ID: "old"})))
+
+		cancel()
+		Eventually(errs).Should(Receive(MatchError(context.Canceled)))
+	})
+
+})
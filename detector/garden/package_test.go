@@ -0,0 +1,17 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package garden
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestDetectorGarden(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "turtlefinder/detector/garden")
+}
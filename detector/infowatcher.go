@@ -0,0 +1,76 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package detector
+
+import (
+	"context"
+
+	"github.com/thediveo/whalewatcher/watcher"
+)
+
+// infoWatcher adds engine information learnt by detector plugins, such as the
+// API version, storage information, and the definitive engine type, as well as
+// a means to ping the engine, to an existing watcher.
+type infoWatcher struct {
+	watcher.Watcher
+	apiversion    string
+	storagedriver string
+	dataroot      string
+	enginetype    string                          // if non-empty, overrides the wrapped watcher's type.
+	ping          func(ctx context.Context) error // optional engine ping.
+}
+
+var (
+	_ APIVersioner  = (*infoWatcher)(nil)
+	_ StorageInfoer = (*infoWatcher)(nil)
+	_ Pinger        = (*infoWatcher)(nil)
+)
+
+// newInfoWatcher returns a new infoWatcher for the specified watcher. If the
+// watcher already is an infoWatcher, a copy of it is returned instead, so that
+// multiple pieces of engine information don't end up in nested wrappers,
+// hiding each other.
+func newInfoWatcher(w watcher.Watcher) *infoWatcher {
+	if iw, ok := w.(*infoWatcher); ok {
+		cpy := *iw
+		return &cpy
+	}
+	return &infoWatcher{Watcher: w}
+}
+
+// Type returns the type of the container engine, preferring the engine type
+// set using [WithEngineType] over the wrapped watcher's type.
+func (w *infoWatcher) Type() string {
+	if w.enginetype != "" {
+		return w.enginetype
+	}
+	return w.Watcher.Type()
+}
+
+// APIVersion returns the API version used when talking to the container
+// engine.
+func (w *infoWatcher) APIVersion() string {
+	return w.apiversion
+}
+
+// StorageDriver returns the storage driver of the container engine.
+func (w *infoWatcher) StorageDriver() string {
+	return w.storagedriver
+}
+
+// DataRoot returns the root directory of the container engine's persistent
+// data.
+func (w *infoWatcher) DataRoot() string {
+	return w.dataroot
+}
+
+// Ping checks that the container engine is alive and responsive, returning
+// [ErrPingUnsupported] if no ping function has been set using [WithPing].
+func (w *infoWatcher) Ping(ctx context.Context) error {
+	if w.ping == nil {
+		return ErrPingUnsupported
+	}
+	return w.ping(ctx)
+}
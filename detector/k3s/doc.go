@@ -0,0 +1,18 @@
+/*
+Package k3s implements the engine detector for the containerd engine embedded
+in and supervised by [k3s].
+
+k3s bundles containerd with its API endpoint at a non-standard location, namely
+“/run/k3s/containerd/containerd.sock”. When k3s's containerd child process
+shows up under its usual “containerd” process name, the stock containerd
+detector already picks it up. In all other cases, this detector looks for the
+k3s supervisor processes instead and then talks to the embedded containerd via
+its well-known API endpoint, using the stock containerd detector to create the
+native as well as CRI API watchers. As the k3s supervisor itself doesn't
+listen on any unix domain sockets, this detector is endpointless and looks up
+the API endpoint in the supervisor's root via the proc filesystem configured
+for discovery.
+
+[k3s]: https://k3s.io
+*/
+package k3s
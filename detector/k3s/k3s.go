@@ -0,0 +1,135 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package k3s
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+
+	detect "github.com/siemens/turtlefinder/detector"
+	"github.com/siemens/turtlefinder/detector/containerd"
+
+	"github.com/thediveo/go-plugger/v3"
+	"github.com/thediveo/lxkns/model"
+	"github.com/thediveo/whalewatcher/watcher"
+)
+
+// Register this k3s container (engine) discovery plugin. This statically
+// ensures that the Detector interface is fully implemented.
+func init() {
+	plugger.Group[detect.Detector]().Register(
+		&Detector{}, plugger.WithPlugin("k3s"))
+}
+
+// ContainerdAPIPath is the well-known path of the API endpoint of the
+// containerd engine embedded in k3s.
+const ContainerdAPIPath = "/run/k3s/containerd/containerd.sock"
+
+// containerdName is the usual process name of k3s's containerd child process.
+const containerdName = "containerd"
+
+// Detector implements the detect.Detector interface. This is automatically
+// type-checked by the previous plugin registration (Generics can be sweet,
+// sometimes *snicker*).
+type Detector struct{}
+
+// Make sure that the DefaultAPIPathsDetector and EndpointlessDetector
+// interfaces are fully implemented.
+var (
+	_ (detect.DefaultAPIPathsDetector) = (*Detector)(nil)
+	_ (detect.EndpointlessDetector)    = (*Detector)(nil)
+)
+
+// EngineNames returns the process names of the k3s supervisor processes.
+func (d *Detector) EngineNames() []string {
+	return []string{"k3s-server", "k3s-agent"}
+}
+
+// DefaultAPIPaths returns the well-known API endpoint path of the containerd
+// engine embedded in k3s.
+func (d *Detector) DefaultAPIPaths() []string {
+	return []string{ContainerdAPIPath}
+}
+
+// Endpointless marks the k3s detector as not relying on the k3s supervisor
+// process to serve any API endpoints: the embedded containerd's API endpoint is
+// created by a child process of the supervisor process instead, so the
+// supervisor process itself doesn't show any listening unix domain sockets.
+func (d *Detector) Endpointless() {}
+
+// NewWatchers returns watchers for tracking alive containers of the containerd
+// engine embedded in k3s, using containerd's native API as well as the CRI API,
+// subject to the containerd detector's CRI mode (see [containerd.WithCRIMode]).
+// If the k3s supervisor process has a child process going by the usual
+// “containerd” process name, NewWatchers leaves it to the stock containerd
+// detector instead, as to not watch the same engine twice.
+//
+// As the k3s detector is endpointless, NewWatchers usually gets passed no API
+// endpoints, but instead reaches the well-known API endpoint via the proc
+// filesystem passed in the context, see also [detect.WithProcRoot]. Any API
+// endpoints passed are tried instead.
+func (d *Detector) NewWatchers(ctx context.Context, pid model.PIDType, apis []string) []watcher.Watcher {
+	apis = apiEndpoints(ctx, pid, apis)
+	if len(apis) == 0 {
+		return nil
+	}
+	return (&containerd.Detector{}).NewWatchers(ctx, pid, apis)
+}
+
+// apiEndpoints returns the API endpoints to try for the embedded containerd
+// of the k3s supervisor process with the specified PID, or nil if the embedded
+// containerd is handled by the stock containerd detector or its well-known API
+// endpoint doesn't exist.
+func apiEndpoints(ctx context.Context, pid model.PIDType, apis []string) []string {
+	lg := detect.LoggerFrom(ctx)
+	procroot := detect.ProcRoot(ctx)
+	if hasChildNamed(procroot, pid, containerdName) {
+		lg.Debugf("k3s (PID %d) containerd is handled by containerd detector", pid)
+		return nil
+	}
+	if len(apis) > 0 {
+		return apis
+	}
+	// The k3s supervisor process itself doesn't serve containerd's API
+	// endpoint, so we need to reach the well-known API endpoint via the proc
+	// filesystem wormhole of the k3s process.
+	apipathname := procroot + "/" + strconv.FormatUint(uint64(pid), 10) + "/root" + ContainerdAPIPath
+	if _, err := os.Stat(apipathname); err != nil {
+		lg.Debugf("k3s (PID %d) without embedded containerd API endpoint: %s", pid, err.Error())
+		return nil
+	}
+	lg.Debugf("trying embedded containerd API endpoint '%s' of k3s (PID %d)", apipathname, pid)
+	return []string{apipathname}
+}
+
+// hasChildNamed returns true if the process with the specified PID has a child
+// process with the specified name, using the proc filesystem mounted at
+// procroot. As children can be created by any task of a process, we need to
+// check the children of all tasks.
+func hasChildNamed(procroot string, pid model.PIDType, name string) bool {
+	taskbase := procroot + "/" + strconv.FormatUint(uint64(pid), 10) + "/task"
+	tasks, err := os.ReadDir(taskbase)
+	if err != nil {
+		return false
+	}
+	for _, task := range tasks {
+		children, err := os.ReadFile(taskbase + "/" + task.Name() + "/children")
+		if err != nil {
+			continue
+		}
+		for _, child := range strings.Fields(string(children)) {
+			comm, err := os.ReadFile(procroot + "/" + child + "/comm")
+			if err != nil {
+				continue
+			}
+			if strings.TrimSuffix(string(comm), "\n") == name {
+				return true
+			}
+		}
+	}
+	return false
+}
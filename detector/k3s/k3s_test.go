@@ -0,0 +1,60 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package k3s
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	detect "github.com/siemens/turtlefinder/detector"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("k3s detector", func() {
+
+	It("finds child processes by name", func() {
+		procroot := GinkgoT().TempDir()
+		Expect(os.MkdirAll(filepath.Join(procroot, "42/task/42"), 0755)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(procroot, "42/task/43"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(procroot, "42/task/42/children"), []byte("100 "), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(procroot, "42/task/43/children"), []byte("101 666 "), 0644)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(procroot, "100"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(procroot, "100/comm"), []byte("coredns\n"), 0644)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(procroot, "101"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(procroot, "101/comm"), []byte("containerd\n"), 0644)).To(Succeed())
+
+		Expect(hasChildNamed(procroot, 42, "containerd")).To(BeTrue())
+		Expect(hasChildNamed(procroot, 42, "coredns")).To(BeTrue())
+		Expect(hasChildNamed(procroot, 42, "dockerd")).To(BeFalse())
+		Expect(hasChildNamed(procroot, 666, "containerd")).To(BeFalse())
+	})
+
+	It("returns no watchers when there's no embedded containerd", func(ctx context.Context) {
+		Expect((&Detector{}).NewWatchers(ctx, 0, nil)).To(BeEmpty())
+	})
+
+	It("finds the embedded containerd API endpoint in the proc filesystem passed", func(ctx context.Context) {
+		procroot := GinkgoT().TempDir()
+		ctx = detect.WithProcRoot(ctx, procroot)
+		Expect(apiEndpoints(ctx, 42, nil)).To(BeEmpty())
+
+		apipath := filepath.Join(procroot, "42/root", ContainerdAPIPath)
+		Expect(os.MkdirAll(filepath.Dir(apipath), 0755)).To(Succeed())
+		Expect(os.WriteFile(apipath, nil, 0644)).To(Succeed())
+		Expect(apiEndpoints(ctx, 42, nil)).To(ConsistOf(apipath))
+		Expect(apiEndpoints(ctx, 42, []string{"/run/other.sock"})).To(ConsistOf("/run/other.sock"))
+
+		By("leaving a containerd child process to the containerd detector")
+		Expect(os.MkdirAll(filepath.Join(procroot, "42/task/42"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(procroot, "42/task/42/children"), []byte("100 "), 0644)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(procroot, "100"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(procroot, "100/comm"), []byte("containerd\n"), 0644)).To(Succeed())
+		Expect(apiEndpoints(ctx, 42, nil)).To(BeEmpty())
+	})
+
+})
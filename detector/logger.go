@@ -0,0 +1,103 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package detector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/thediveo/lxkns/log"
+)
+
+// LogFunc receives the log messages emitted during container engine discovery
+// and watching, together with optional structured key-value pairs describing
+// the message context, such as the engine type and PID.
+type LogFunc func(level, msg string, kv ...any)
+
+// The log levels passed to a LogFunc.
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+// logFuncKey is the context key for passing a LogFunc to detector plugins and
+// the discovery machinery.
+type logFuncKey struct{}
+
+// WithLogFunc returns a new context carrying the specified LogFunc; the
+// context can then be passed to detector plugins, so that they log through
+// this LogFunc. A nil LogFunc logs via lxkns' log package.
+func WithLogFunc(ctx context.Context, fn LogFunc) context.Context {
+	return context.WithValue(ctx, logFuncKey{}, fn)
+}
+
+// Logger logs either through a LogFunc or otherwise through lxkns' log
+// package. The zero Logger logs through lxkns' log package.
+type Logger struct {
+	fn LogFunc
+	kv []any
+}
+
+// NewLogger returns a Logger logging through the specified LogFunc; if nil,
+// the Logger logs through lxkns' log package.
+func NewLogger(fn LogFunc) Logger {
+	return Logger{fn: fn}
+}
+
+// LoggerFrom returns a Logger using the LogFunc carried by the specified
+// context, if any. Otherwise, the Logger logs through lxkns' log package.
+func LoggerFrom(ctx context.Context) Logger {
+	fn, _ := ctx.Value(logFuncKey{}).(LogFunc)
+	return Logger{fn: fn}
+}
+
+// With returns a new Logger that additionally passes the specified structured
+// key-value pairs to a LogFunc. When logging through lxkns' log package, these
+// key-value pairs are ignored, as the log messages themselves are expected to
+// already contain the essential information.
+func (l Logger) With(kv ...any) Logger {
+	return Logger{
+		fn: l.fn,
+		kv: append(l.kv[:len(l.kv):len(l.kv)], kv...),
+	}
+}
+
+// Debugf logs a debug message.
+func (l Logger) Debugf(format string, args ...any) {
+	if l.fn == nil {
+		log.Debugf(format, args...)
+		return
+	}
+	l.fn(LevelDebug, fmt.Sprintf(format, args...), l.kv...)
+}
+
+// Infof logs an informational message.
+func (l Logger) Infof(format string, args ...any) {
+	if l.fn == nil {
+		log.Infof(format, args...)
+		return
+	}
+	l.fn(LevelInfo, fmt.Sprintf(format, args...), l.kv...)
+}
+
+// Warnf logs a warning message.
+func (l Logger) Warnf(format string, args ...any) {
+	if l.fn == nil {
+		log.Warnf(format, args...)
+		return
+	}
+	l.fn(LevelWarn, fmt.Sprintf(format, args...), l.kv...)
+}
+
+// Errorf logs an error message.
+func (l Logger) Errorf(format string, args ...any) {
+	if l.fn == nil {
+		log.Errorf(format, args...)
+		return
+	}
+	l.fn(LevelError, fmt.Sprintf(format, args...), l.kv...)
+}
@@ -0,0 +1,57 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package detector
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type logEntry struct {
+	level string
+	msg   string
+	kv    []any
+}
+
+var _ = Describe("logger", func() {
+
+	It("logs through a context's log function", func() {
+		var entries []logEntry
+		ctx := WithLogFunc(context.Background(), func(level, msg string, kv ...any) {
+			entries = append(entries, logEntry{level: level, msg: msg, kv: kv})
+		})
+		lg := LoggerFrom(ctx)
+		lg.Debugf("debug %d", 1)
+		lg.With("pid", 42).Infof("info %d", 2)
+		lg.Warnf("warn %d", 3)
+		lg.With("type", "docker.com").With("pid", 42).Errorf("error %d", 4)
+		Expect(entries).To(Equal([]logEntry{
+			{level: LevelDebug, msg: "debug 1"},
+			{level: LevelInfo, msg: "info 2", kv: []any{"pid", 42}},
+			{level: LevelWarn, msg: "warn 3"},
+			{level: LevelError, msg: "error 4", kv: []any{"type", "docker.com", "pid", 42}},
+		}))
+	})
+
+	It("doesn't mix up key-value pairs of derived loggers", func() {
+		var kvs [][]any
+		lg := NewLogger(func(level, msg string, kv ...any) { kvs = append(kvs, kv) }).
+			With("a", 1)
+		lg.With("b", 2).Infof("")
+		lg.With("c", 3).Infof("")
+		Expect(kvs).To(Equal([][]any{{"a", 1, "b", 2}, {"a", 1, "c", 3}}))
+	})
+
+	It("falls back to lxkns' logging", func() {
+		Expect(func() {
+			lg := LoggerFrom(context.Background())
+			lg.Debugf("debug")
+			lg.With("foo", "bar").Infof("info")
+		}).NotTo(Panic())
+	})
+
+})
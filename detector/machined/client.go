@@ -0,0 +1,428 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package machined
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/thediveo/whalewatcher"
+	"github.com/thediveo/whalewatcher/engineclient"
+)
+
+// Type is the type identifier for systemd-machined "container engines" and as
+// returned by Watcher.Type().
+const Type = "systemd.io/machined"
+
+// APIEndpointSuffix is the final element of the path of systemd-machined's
+// Varlink API endpoint, usually “/run/systemd/machine/io.systemd.Machine”.
+const APIEndpointSuffix = "/io.systemd.Machine"
+
+// containerClass is the class of machines that are containers, as opposed to
+// virtual machines and the host itself.
+const containerClass = "container"
+
+// Varlink method and error names.
+const (
+	methodGetInfo    = "org.varlink.service.GetInfo"
+	methodList       = "io.systemd.Machine.List"
+	machineInterface = "io.systemd.Machine"
+	errNoSuchMachine = "io.systemd.Machine.NoSuchMachine"
+)
+
+// defaultPollInterval is the interval for polling systemd-machined for machine
+// lifecycle changes, as systemd-machined doesn't stream any lifecycle events
+// via Varlink.
+const defaultPollInterval = 2 * time.Second
+
+// MachinedClient is a (minimal) systemd-machined client implementing the
+// whalewatcher engineclient.EngineClient interface.
+type MachinedClient struct {
+	api          string        // path of API endpoint unix domain socket.
+	pid          int           // PID of systemd-machined process, if known.
+	pollinterval time.Duration // interval for polling machine lifecycle changes.
+	dialer       *net.Dialer   // dialer for connecting to the API endpoint.
+
+	mu      sync.Mutex // protects the following fields.
+	version string     // systemd version, as reported by the Varlink service.
+}
+
+// Make sure that the EngineClient interface is fully implemented.
+var _ (engineclient.EngineClient) = (*MachinedClient)(nil)
+
+// NewOption represents options to NewMachinedClient when creating new
+// systemd-machined clients.
+type NewOption func(*MachinedClient)
+
+// WithPID sets the PID of the systemd-machined process.
+func WithPID(pid int) NewOption {
+	return func(mc *MachinedClient) {
+		mc.pid = pid
+	}
+}
+
+// WithDialer sets the dialer to use for connecting to systemd-machined's API
+// endpoint, instead of a zero-value dialer.
+func WithDialer(d *net.Dialer) NewOption {
+	return func(mc *MachinedClient) {
+		if d != nil {
+			mc.dialer = d
+		}
+	}
+}
+
+// NewMachinedClient returns a new systemd-machined client talking to the
+// Varlink API at the specified unix domain socket path.
+func NewMachinedClient(api string, opts ...NewOption) *MachinedClient {
+	mc := &MachinedClient{
+		api:          api,
+		pollinterval: defaultPollInterval,
+		dialer:       &net.Dialer{},
+	}
+	for _, opt := range opts {
+		opt(mc)
+	}
+	return mc
+}
+
+// varlinkCall is a Varlink method call message.
+type varlinkCall struct {
+	Method     string `json:"method"`
+	Parameters any    `json:"parameters,omitempty"`
+	More       bool   `json:"more,omitempty"`
+}
+
+// varlinkReply is a Varlink method reply message.
+type varlinkReply struct {
+	Parameters json.RawMessage `json:"parameters"`
+	Continues  bool            `json:"continues"`
+	Error      string          `json:"error"`
+}
+
+// varlinkError is an error reply to a Varlink method call.
+type varlinkError struct {
+	method string
+	name   string
+}
+
+func (e *varlinkError) Error() string {
+	return fmt.Sprintf("varlink method %s failed: %s", e.method, e.name)
+}
+
+// isVarlinkError returns true if err is a Varlink error reply with the
+// specified error name.
+func isVarlinkError(err error, name string) bool {
+	var verr *varlinkError
+	return errors.As(err, &verr) && verr.name == name
+}
+
+// call the specified Varlink method with the specified parameters on a fresh
+// connection to the API endpoint, passing the parameters of each reply to fn.
+// If more is true, then multiple replies might be received.
+func (mc *MachinedClient) call(
+	ctx context.Context,
+	method string,
+	params any,
+	more bool,
+	fn func(params json.RawMessage) error,
+) error {
+	conn, err := mc.dialer.DialContext(ctx, "unix", mc.api)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// Make sure to unblock any pending reads and writes when the context gets
+	// cancelled or hits its deadline.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+	msg, err := json.Marshal(varlinkCall{Method: method, Parameters: params, More: more})
+	if err != nil {
+		return err
+	}
+	// Varlink messages are terminated by a NUL byte.
+	if _, err := conn.Write(append(msg, 0)); err != nil {
+		return ctxErrOr(ctx, err)
+	}
+	r := bufio.NewReader(conn)
+	for {
+		msg, err := r.ReadBytes(0)
+		if err != nil {
+			return ctxErrOr(ctx, err)
+		}
+		var reply varlinkReply
+		if err := json.Unmarshal(msg[:len(msg)-1], &reply); err != nil {
+			return err
+		}
+		if reply.Error != "" {
+			return &varlinkError{method: method, name: reply.Error}
+		}
+		if err := fn(reply.Parameters); err != nil {
+			return err
+		}
+		if !reply.Continues {
+			return nil
+		}
+	}
+}
+
+// ctxErrOr returns the context's error if the context is done, otherwise the
+// specified error.
+func ctxErrOr(ctx context.Context, err error) error {
+	if ctxerr := ctx.Err(); ctxerr != nil {
+		return ctxerr
+	}
+	return err
+}
+
+// Ping checks that systemd-machined is responsive and actually serves the
+// machine interface, picking up the systemd version on the fly.
+func (mc *MachinedClient) Ping(ctx context.Context) error {
+	var info struct {
+		Version    string   `json:"version"`
+		Interfaces []string `json:"interfaces"`
+	}
+	if err := mc.call(ctx, methodGetInfo, nil, false, func(params json.RawMessage) error {
+		return json.Unmarshal(params, &info)
+	}); err != nil {
+		return err
+	}
+	for _, iface := range info.Interfaces {
+		if iface == machineInterface {
+			mc.mu.Lock()
+			mc.version = info.Version
+			mc.mu.Unlock()
+			return nil
+		}
+	}
+	return fmt.Errorf("Varlink API endpoint %s doesn't serve %s", mc.api, machineInterface)
+}
+
+// machine represents the (few) details we're interested in from
+// systemd-machined's machine information.
+type machine struct {
+	Name   string    `json:"name"`
+	Class  string    `json:"class"`
+	Leader processID `json:"leader"`
+}
+
+// processID represents the PID of a machine's leader process. Depending on the
+// systemd version, the leader is either a plain PID number or a ProcessId
+// object with a PID field.
+type processID int
+
+// UnmarshalJSON accepts a plain PID number as well as a ProcessId object.
+func (p *processID) UnmarshalJSON(b []byte) error {
+	var pid int
+	if err := json.Unmarshal(b, &pid); err == nil {
+		*p = processID(pid)
+		return nil
+	}
+	var procid struct {
+		PID int `json:"pid"`
+	}
+	if err := json.Unmarshal(b, &procid); err != nil {
+		return err
+	}
+	*p = processID(procid.PID)
+	return nil
+}
+
+// machines returns the machines currently registered with systemd-machined,
+// optionally only the machine with the specified name.
+func (mc *MachinedClient) machines(ctx context.Context, name string) ([]machine, error) {
+	var params any
+	if name != "" {
+		params = map[string]string{"name": name}
+	}
+	machines := []machine{}
+	err := mc.call(ctx, methodList, params, name == "", func(params json.RawMessage) error {
+		var m machine
+		if err := json.Unmarshal(params, &m); err != nil {
+			return err
+		}
+		machines = append(machines, m)
+		return nil
+	})
+	if err != nil {
+		if isVarlinkError(err, errNoSuchMachine) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return machines, nil
+}
+
+// names returns the names of all container machines.
+func (mc *MachinedClient) names(ctx context.Context) ([]string, error) {
+	machines, err := mc.machines(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(machines))
+	for _, m := range machines {
+		if m.Class != containerClass {
+			continue
+		}
+		names = append(names, m.Name)
+	}
+	return names, nil
+}
+
+// List all the currently alive and kicking container machines.
+func (mc *MachinedClient) List(ctx context.Context) ([]*whalewatcher.Container, error) {
+	machines, err := mc.machines(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	containers := make([]*whalewatcher.Container, 0, len(machines))
+	for _, m := range machines {
+		if container := container(m); container != nil {
+			containers = append(containers, container)
+		}
+	}
+	return containers, nil
+}
+
+// Inspect (only) those container details of interest to us, given the name of
+// a container machine.
+func (mc *MachinedClient) Inspect(ctx context.Context, name string) (*whalewatcher.Container, error) {
+	machines, err := mc.machines(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range machines {
+		if container := container(m); container != nil && m.Name == name {
+			return container, nil
+		}
+	}
+	return nil, engineclient.NewProcesslessContainerError(name, "systemd-machined")
+}
+
+// container returns the whalewatcher container for the specified machine, or
+// nil if the machine isn't a container or has no leader process.
+func container(m machine) *whalewatcher.Container {
+	if m.Class != containerClass || m.Leader == 0 {
+		return nil
+	}
+	return &whalewatcher.Container{
+		ID:   m.Name,
+		Name: m.Name,
+		PID:  int(m.Leader),
+	}
+}
+
+// LifecycleEvents streams container lifecycle events. As systemd-machined
+// doesn't offer any event streaming via Varlink, LifecycleEvents periodically
+// polls the container machines and reports newly appeared and vanished
+// containers.
+func (mc *MachinedClient) LifecycleEvents(ctx context.Context) (<-chan engineclient.ContainerEvent, <-chan error) {
+	evs := make(chan engineclient.ContainerEvent)
+	errs := make(chan error, 1)
+	go func() {
+		known, err := mc.names(ctx)
+		if err != nil {
+			errs <- err
+			return
+		}
+		seen := map[string]struct{}{}
+		for _, name := range known {
+			seen[name] = struct{}{}
+		}
+		ticker := time.NewTicker(mc.pollinterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			case <-ticker.C:
+			}
+			names, err := mc.names(ctx)
+			if err != nil {
+				errs <- err
+				return
+			}
+			current := make(map[string]struct{}, len(names))
+			for _, name := range names {
+				current[name] = struct{}{}
+				if _, ok := seen[name]; ok {
+					continue
+				}
+				if !send(ctx, evs, engineclient.ContainerStarted, name) {
+					return
+				}
+			}
+			for name := range seen {
+				if _, ok := current[name]; ok {
+					continue
+				}
+				if !send(ctx, evs, engineclient.ContainerExited, name) {
+					return
+				}
+			}
+			seen = current
+		}
+	}()
+	return evs, errs
+}
+
+// send the specified container lifecycle event, returning false if the context
+// got cancelled in the meantime.
+func send(
+	ctx context.Context,
+	evs chan<- engineclient.ContainerEvent,
+	typ engineclient.ContainerEventType,
+	name string,
+) bool {
+	select {
+	case evs <- engineclient.ContainerEvent{Type: typ, ID: name}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// ID returns an identifier for this systemd-machined instance. As
+// systemd-machined doesn't have any engine ID, we use its API endpoint path
+// instead.
+func (mc *MachinedClient) ID(ctx context.Context) string { return mc.api }
+
+// Type returns the type identifier for this engine client.
+func (mc *MachinedClient) Type() string { return Type }
+
+// Version returns the systemd version as reported when pinging
+// systemd-machined; otherwise, the version is empty.
+func (mc *MachinedClient) Version(ctx context.Context) string {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.version
+}
+
+// API returns the systemd-machined API endpoint path.
+func (mc *MachinedClient) API() string { return mc.api }
+
+// PID returns the PID of the systemd-machined process, if known; otherwise
+// zero.
+func (mc *MachinedClient) PID() int { return mc.pid }
+
+// Client returns nil, as there is no underlying client object.
+func (mc *MachinedClient) Client() interface{} { return nil }
+
+// Close cleans up and releases any engine client resources. As each Varlink
+// call uses its own connection, there's nothing to release.
+func (mc *MachinedClient) Close() {}
@@ -0,0 +1,19 @@
+/*
+Package machined implements the engine detector for containers registered with
+systemd's machine manager “systemd-machined”, such as containers started by
+systemd-nspawn and managed using machinectl.
+
+As the upstream whalewatcher module doesn't offer an engine client for
+systemd-machined, this package brings its own (minimal) engine client. Instead
+of talking D-Bus, the engine client talks to systemd-machined via its
+[Varlink] API on the “/run/systemd/machine/io.systemd.Machine” unix domain
+socket, which is available since systemd 256. systemd-machined doesn't stream
+machine lifecycle events via Varlink, so the engine client instead
+periodically polls the list of machines.
+
+Only machines of class “container” are reported, using the PIDs of their
+leader processes; virtual machines as well as the host itself are skipped.
+
+[Varlink]: https://varlink.org
+*/
+package machined
@@ -0,0 +1,75 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package machined
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	detect "github.com/siemens/turtlefinder/detector"
+
+	"github.com/thediveo/go-plugger/v3"
+	"github.com/thediveo/lxkns/model"
+	"github.com/thediveo/whalewatcher/watcher"
+)
+
+// Register this systemd-machined container (engine) discovery plugin. This
+// statically ensures that the Detector interface is fully implemented.
+func init() {
+	plugger.Group[detect.Detector]().Register(
+		&Detector{}, plugger.WithPlugin("machined"))
+}
+
+// Detector implements the detect.Detector interface. This is automatically
+// type-checked by the previous plugin registration (Generics can be sweet,
+// sometimes *snicker*).
+type Detector struct{}
+
+// Make sure that the DefaultAPIPathsDetector interface is fully implemented.
+var _ (detect.DefaultAPIPathsDetector) = (*Detector)(nil)
+
+// EngineNames returns the process names of the systemd-machined process. As
+// process names are limited to 15 characters, “systemd-machined” shows up as
+// “systemd-machine”.
+func (d *Detector) EngineNames() []string {
+	return []string{"systemd-machined", "systemd-machine"}
+}
+
+// DefaultAPIPaths returns the canonical Varlink API endpoint path of
+// systemd-machined.
+func (d *Detector) DefaultAPIPaths() []string {
+	return []string{"/run/systemd/machine/io.systemd.Machine"}
+}
+
+// NewWatchers returns a watcher for tracking alive systemd-machined
+// containers.
+func (d *Detector) NewWatchers(ctx context.Context, pid model.PIDType, apis []string) []watcher.Watcher {
+	lg := detect.LoggerFrom(ctx)
+	sort.Strings(apis) // in-place
+	for _, apipathname := range apis {
+		// systemd-machined listens on multiple Varlink sockets, such as also
+		// on a userdb socket, so we skip those not looking like the machine
+		// API right away.
+		if !strings.HasSuffix(apipathname, APIEndpointSuffix) {
+			continue
+		}
+		lg.Debugf("dialing systemd-machined API endpoint '%s'", apipathname)
+		mc := NewMachinedClient(apipathname,
+			WithPID(int(pid)), WithDialer(detect.CustomDialer(ctx)))
+		pingctx, cancel := context.WithTimeout(ctx, detect.ClientTimeout(ctx, 5*time.Second))
+		err := mc.Ping(pingctx)
+		cancel()
+		if err != nil {
+			lg.Debugf("systemd-machined API endpoint '%s' failed: %s", apipathname, err.Error())
+			mc.Close()
+			continue
+		}
+		return []watcher.Watcher{watcher.New(mc, nil)}
+	}
+	lg.Errorf("no working systemd-machined API endpoint found.")
+	return nil
+}
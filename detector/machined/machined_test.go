@@ -0,0 +1,204 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package machined
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"sync"
+	"time"
+
+	detect "github.com/siemens/turtlefinder/detector"
+	"github.com/thediveo/go-plugger/v3"
+	"github.com/thediveo/whalewatcher/engineclient"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeMachined serves a minimal fake systemd-machined Varlink API on a unix
+// domain socket.
+type fakeMachined struct {
+	mu       sync.Mutex
+	machines map[string]map[string]any
+}
+
+func (m *fakeMachined) set(name string, class string, leader any) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if class == "" {
+		delete(m.machines, name)
+		return
+	}
+	m.machines[name] = map[string]any{"name": name, "class": class, "leader": leader}
+}
+
+// start serving the fake Varlink API, returning the API socket path.
+func (m *fakeMachined) start() string {
+	GinkgoHelper()
+	api := filepath.Join(GinkgoT().TempDir(), "io.systemd.Machine")
+	l, err := net.Listen("unix", api)
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go m.serve(conn)
+		}
+	}()
+	return api
+}
+
+// serve a single Varlink method call on the specified connection.
+func (m *fakeMachined) serve(conn net.Conn) {
+	defer conn.Close()
+	msg, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil {
+		return
+	}
+	var call struct {
+		Method     string            `json:"method"`
+		Parameters map[string]string `json:"parameters"`
+		More       bool              `json:"more"`
+	}
+	if json.Unmarshal(msg[:len(msg)-1], &call) != nil {
+		return
+	}
+	reply := func(r map[string]any) {
+		b, _ := json.Marshal(r)
+		_, _ = conn.Write(append(b, 0))
+	}
+	switch call.Method {
+	case methodGetInfo:
+		reply(map[string]any{"parameters": map[string]any{
+			"vendor":     "The systemd Project",
+			"product":    "systemd (systemd-machined)",
+			"version":    "256 (256.4-1)",
+			"interfaces": []string{"io.systemd", "io.systemd.Machine", "org.varlink.service"},
+		}})
+	case methodList:
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		machines := []map[string]any{}
+		for name, machine := range m.machines {
+			if call.Parameters["name"] != "" && call.Parameters["name"] != name {
+				continue
+			}
+			machines = append(machines, machine)
+		}
+		if len(machines) == 0 {
+			reply(map[string]any{"error": errNoSuchMachine, "parameters": map[string]any{}})
+			return
+		}
+		for idx, machine := range machines {
+			reply(map[string]any{"parameters": machine, "continues": call.More && idx < len(machines)-1})
+			if !call.More {
+				return
+			}
+		}
+	default:
+		reply(map[string]any{"error": "org.varlink.service.MethodNotFound"})
+	}
+}
+
+var _ = Describe("systemd-machined detector", func() {
+
+	var machined *fakeMachined
+	var api string
+
+	BeforeEach(func() {
+		machined = &fakeMachined{machines: map[string]map[string]any{}}
+		machined.set(".host", "host", map[string]any{"pid": 1})
+		api = machined.start()
+	})
+
+	newClient := func() *MachinedClient {
+		mc := NewMachinedClient(api, WithPID(42))
+		mc.pollinterval = 50 * time.Millisecond
+		DeferCleanup(mc.Close)
+		return mc
+	}
+
+	It("registers correctly", func() {
+		Expect(plugger.Group[detect.Detector]().Plugins()).To(
+			ContainElement("machined"))
+	})
+
+	It("tries unsuccessfully", NodeTimeout(30*time.Second), func(ctx context.Context) {
+		d := &Detector{}
+		Expect(d.NewWatchers(ctx, 0, []string{"/etc/rumpelpumpel"})).To(BeEmpty())
+		Expect(d.NewWatchers(ctx, 0, []string{"/run/io.systemd.Machine"})).To(BeEmpty())
+	})
+
+	It("returns a watcher", NodeTimeout(30*time.Second), func(ctx context.Context) {
+		d := &Detector{}
+		ws := d.NewWatchers(ctx, 42, []string{"/run/docker.sock", api})
+		Expect(ws).To(HaveLen(1))
+		defer ws[0].Close()
+		Expect(ws[0].Type()).To(Equal(Type))
+		Expect(ws[0].PID()).To(Equal(42))
+		Expect(ws[0].Version(ctx)).To(Equal("256 (256.4-1)"))
+	})
+
+	It("lists and inspects container machines", func(ctx context.Context) {
+		machined.set("nspawned", "container", map[string]any{"pid": 1234, "pidfdId": 666})
+		machined.set("oldspawned", "container", 2345)
+		machined.set("vm", "vm", 3456)
+		machined.set("leaderless", "container", nil)
+
+		mc := newClient()
+		containers, err := mc.List(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(containers).To(ConsistOf(
+			And(HaveField("ID", "nspawned"), HaveField("Name", "nspawned"), HaveField("PID", 1234)),
+			And(HaveField("ID", "oldspawned"), HaveField("PID", 2345)),
+		))
+
+		container, err := mc.Inspect(ctx, "nspawned")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(container.PID).To(Equal(1234))
+
+		_, err = mc.Inspect(ctx, "vm")
+		Expect(engineclient.IsProcesslessContainer(err)).To(BeTrue())
+		_, err = mc.Inspect(ctx, "nonexisting")
+		Expect(engineclient.IsProcesslessContainer(err)).To(BeTrue())
+	})
+
+	It("reports failing method calls", func(ctx context.Context) {
+		mc := newClient()
+		err := mc.call(ctx, "io.systemd.Machine.Rumpelpumpel", nil, false,
+			func(json.RawMessage) error { return nil })
+		Expect(isVarlinkError(err, "org.varlink.service.MethodNotFound")).To(BeTrue())
+	})
+
+	It("polls for lifecycle events", func(ctx context.Context) {
+		machined.set("old", "container", 1234)
+
+		mc := newClient()
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		evs, errs := mc.LifecycleEvents(ctx)
+
+		time.Sleep(100 * time.Millisecond)
+		machined.set("new", "container", 2345)
+		machined.set("newvm", "vm", 3456)
+		Eventually(evs).Should(Receive(Equal(engineclient.ContainerEvent{
+			Type: engineclient.ContainerStarted, ID: "new"})))
+
+		machined.set("old", "", nil)
+		Eventually(evs).Should(Receive(Equal(engineclient.ContainerEvent{
+			Type: engineclient.ContainerExited, ID: "old"})))
+
+		cancel()
+		Eventually(errs).Should(Receive(MatchError(context.Canceled)))
+	})
+
+})
@@ -0,0 +1,43 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package moby
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+
+	detect "github.com/siemens/turtlefinder/detector"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("Docker engine dialer", func() {
+
+	It("connects using a custom dialer", func(ctx context.Context) {
+		sockpath := GinkgoT().TempDir() + "/docker.sock"
+		srv := httptest.NewUnstartedServer(fakeEngineHandler(""))
+		srv.Listener = Successful(net.Listen("unix", sockpath))
+		srv.Start()
+		defer srv.Close()
+
+		var controlled atomic.Int32
+		dialctx := detect.WithDialer(ctx, &net.Dialer{
+			Control: func(network, address string, c syscall.RawConn) error {
+				controlled.Add(1)
+				return nil
+			},
+		})
+		ws := (&Detector{}).NewWatchers(dialctx, 0, []string{sockpath})
+		Expect(ws).To(HaveLen(1))
+		ws[0].Close()
+		Expect(controlled.Load()).To(BeNumerically(">", 0))
+	})
+
+})
@@ -1,4 +1,14 @@
 /*
 Package moby implements the engine detector for Docker “dockerd” processes.
+
+As podman services might also be found behind a Docker API endpoint, such as
+when started under a “dockerd” name, the detector checks the engine's version
+details after connecting and reports podman engines with the “podman.io” type
+instead of Docker's “docker.com” type.
+
+Docker engines launched under a generic process name are detected by their
+“docker.service” cgroup instead, where the topmost process of this cgroup is
+the engine process. Docker engines with changed process names are detected by
+their “dockerd” executable.
 */
 package moby
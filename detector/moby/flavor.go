@@ -0,0 +1,50 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package moby
+
+import (
+	"context"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// podmanType identifies podman engines serving a Docker-compatible API. It is
+// the same type as used by the socket-activated podman engine finder plugin,
+// but we must not import the podman activator package as this would register
+// the podman plugin as a side effect.
+const podmanType = "podman.io"
+
+// engineFlavor returns the definitive type of the container engine behind the
+// specified Docker client, as it might actually be a podman service that has
+// been started under a “dockerd” name, or that is reachable only via the
+// Docker API endpoint path. It returns "" if the engine is a genuine
+// Docker/moby engine or if the engine doesn't tell us.
+//
+// As podman's Docker-compatible information doesn't reliably tell apart podman
+// from moby, engineFlavor queries the engine's version details instead, where
+// podman reports a “Podman Engine” component, whereas moby reports an “Engine”
+// component.
+func engineFlavor(ctx context.Context, cl *client.Client) string {
+	version, err := cl.ServerVersion(ctx)
+	if err != nil {
+		return ""
+	}
+	if isPodman(version) {
+		return podmanType
+	}
+	return ""
+}
+
+// isPodman returns true if the specified engine version details are podman's.
+func isPodman(version types.Version) bool {
+	for _, component := range version.Components {
+		if strings.Contains(strings.ToLower(component.Name), "podman") {
+			return true
+		}
+	}
+	return strings.Contains(strings.ToLower(version.Platform.Name), "podman")
+}
@@ -0,0 +1,73 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package moby
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeEngine returns a fake Docker API server reporting the specified version
+// details.
+func fakeEngine(version string) *httptest.Server {
+	return httptest.NewServer(fakeEngineHandler(version))
+}
+
+// fakeEngineHandler returns the handler of a fake Docker API server reporting
+// the specified version details.
+func fakeEngineHandler(version string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Api-Version", "1.41")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_ping"):
+			_, _ = w.Write([]byte("OK"))
+		case strings.HasSuffix(r.URL.Path, "/info"):
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"ID":"fake","Name":"fake","ServerVersion":"4.9.3"}`))
+		case strings.HasSuffix(r.URL.Path, "/version") && version != "":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(version))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+var _ = Describe("engine flavors", func() {
+
+	It("tells podman from moby", func() {
+		Expect(isPodman(types.Version{})).To(BeFalse())
+		Expect(isPodman(types.Version{
+			Components: []types.ComponentVersion{{Name: "Engine"}},
+		})).To(BeFalse())
+		Expect(isPodman(types.Version{
+			Components: []types.ComponentVersion{{Name: "Podman Engine"}},
+		})).To(BeTrue())
+	})
+
+	DescribeTable("classifies the engine behind a Docker API endpoint",
+		func(ctx context.Context, version string, expectedType string) {
+			srv := fakeEngine(version)
+			defer srv.Close()
+			endpoint := "tcp://" + strings.TrimPrefix(srv.URL, "http://")
+
+			ws := (&Detector{}).NewWatchers(ctx, 0, []string{endpoint})
+			Expect(ws).To(HaveLen(1))
+			defer ws[0].Close()
+			Expect(ws[0].Type()).To(Equal(expectedType))
+		},
+		Entry("podman", `{"Components":[{"Name":"Podman Engine","Version":"4.9.3"}]}`, podmanType),
+		Entry("moby", `{"Components":[{"Name":"Engine","Version":"26.1.0"}]}`, "docker.com"),
+		Entry("unknown", "", "docker.com"),
+	)
+
+})
@@ -6,14 +6,18 @@ package moby
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"net/http"
 	"sort"
+	"strings"
 	"time"
 
 	detect "github.com/siemens/turtlefinder/detector"
 
+	"github.com/docker/docker/api/types/system"
 	"github.com/docker/docker/client"
 	"github.com/thediveo/go-plugger/v3"
-	"github.com/thediveo/lxkns/log"
 	"github.com/thediveo/lxkns/model"
 	mobyengine "github.com/thediveo/whalewatcher/engineclient/moby"
 	"github.com/thediveo/whalewatcher/watcher"
@@ -32,14 +36,52 @@ func init() {
 // sometimes *snicker*).
 type Detector struct{}
 
+// Make sure that the ErrorReportingDetector, DefaultAPIPathsDetector,
+// CgroupDetector, and ExeDetector interfaces are fully implemented.
+var (
+	_ (detect.ErrorReportingDetector)  = (*Detector)(nil)
+	_ (detect.DefaultAPIPathsDetector) = (*Detector)(nil)
+	_ (detect.CgroupDetector)          = (*Detector)(nil)
+	_ (detect.ExeDetector)             = (*Detector)(nil)
+)
+
 // EngineNames returns the process name of the Docker/moby engine process.
 func (d *Detector) EngineNames() []string {
 	return []string{"dockerd"}
 }
 
+// DefaultAPIPaths returns the canonical API endpoint path of the Docker/moby
+// engine.
+func (d *Detector) DefaultAPIPaths() []string {
+	return []string{"/run/docker.sock"}
+}
+
+// CgroupPatterns returns the cgroup of the systemd service for the Docker/moby
+// engine, so that the engine gets detected even if launched using a generic
+// executable name.
+func (d *Detector) CgroupPatterns() []string {
+	return []string{"docker.service"}
+}
+
+// EngineExePaths returns the executable basename of the Docker/moby engine, so
+// that the engine gets detected even if its process name has been changed.
+func (d *Detector) EngineExePaths() []string {
+	return []string{"dockerd"}
+}
+
 // NewWatchers returns a single watcher for tracking alive Docker containers.
 func (d *Detector) NewWatchers(ctx context.Context, pid model.PIDType, apis []string) []watcher.Watcher {
+	watchers, _ := d.NewWatchersWithError(ctx, pid, apis)
+	return watchers
+}
+
+// NewWatchersWithError returns a single watcher for tracking alive Docker
+// containers or otherwise the error encountered when talking to the last of
+// the API endpoints tried.
+func (d *Detector) NewWatchersWithError(ctx context.Context, pid model.PIDType, apis []string) ([]watcher.Watcher, error) {
+	lg := detect.LoggerFrom(ctx)
 	sort.Strings(apis) // in-place
+	var lasterr error
 	for _, apipathname := range apis {
 		// As Docker's go client will accept any API pathname we throw at it and
 		// throw up only when actually trying to communicate with the engine,
@@ -47,22 +89,102 @@ func (d *Detector) NewWatchers(ctx context.Context, pid model.PIDType, apis []st
 		// that we actually can successfully talk with the daemon. Querying the
 		// daemon's info sufficies and ensures that a partiular API path is
 		// useful.
-		log.Debugf("dialing Docker endpoint 'unix://%s'", apipathname)
-		w, err := moby.New("unix://"+apipathname, nil, mobyengine.WithPID(int(pid)))
+		endpoint := apiEndpoint(apipathname)
+		lg.Debugf("dialing Docker endpoint '%s'", endpoint)
+		w, err := newWatcher(ctx, endpoint, pid)
 		if err == nil {
-			ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-			_, err = w.Client().(*client.Client).Info(ctx)
+			ctx, cancel := context.WithTimeout(ctx, detect.ClientTimeout(ctx, 10*time.Second))
+			cl := w.Client().(*client.Client)
+			var info system.Info
+			info, err = cl.Info(ctx)
 			if ctxerr := ctx.Err(); ctxerr != nil {
-				log.Debugf("Docker API Info call context hit deadline: %s", ctxerr.Error())
+				lg.Debugf("Docker API Info call context hit deadline: %s", ctxerr.Error())
+			}
+			var flavor string
+			if err == nil {
+				// There might be a podman service behind this Docker API
+				// endpoint, so make sure to report the correct engine type.
+				flavor = engineFlavor(ctx, cl)
 			}
 			cancel()
 			if err == nil {
-				return []watcher.Watcher{w}
+				if flavor != "" {
+					lg.Infof("Docker API endpoint '%s' is served by '%s'", endpoint, flavor)
+				}
+				// After the Info call the client has negotiated the API
+				// version with the daemon, so stash it with the watcher.
+				// And while we're at it, also stash the storage information
+				// the daemon told us about, as well as the engine's flavor.
+				return []watcher.Watcher{
+					detect.WithEngineType(
+						detect.WithStorageInfo(
+							detect.WithAPIVersion(w, cl.ClientVersion()),
+							info.Driver, info.DockerRootDir),
+						flavor),
+				}, nil
 			}
 			w.Close()
 		}
-		log.Debugf("Docker API endpoint 'unix://%s' failed: %s", apipathname, err.Error())
+		lg.Debugf("Docker API endpoint '%s' failed: %s", endpoint, err.Error())
+		lasterr = fmt.Errorf("Docker API endpoint '%s' failed: %w", endpoint, err)
+	}
+	lg.Errorf("no working Docker API endpoint found.")
+	return nil, lasterr
+}
+
+// apiEndpoint returns the Docker endpoint for the specified API path, which
+// is either a unix domain socket path, a TCP API endpoint, or a vsock API
+// endpoint.
+func apiEndpoint(apipathname string) string {
+	if strings.HasPrefix(apipathname, detect.TCPScheme) ||
+		strings.HasPrefix(apipathname, detect.VsockScheme) {
+		return apipathname
+	}
+	return "unix://" + apipathname
+}
+
+// newWatcher returns a new Docker watcher for the specified endpoint. For TCP
+// endpoints with a TLS client configuration passed in the specified context,
+// the watcher's Docker client uses TLS. For vsock endpoints, the watcher's
+// Docker client dials the VM socket itself. For other endpoints, the watcher's
+// Docker client uses the custom dialer passed in the specified context, if
+// any.
+func newWatcher(ctx context.Context, endpoint string, pid model.PIDType) (watcher.Watcher, error) {
+	if strings.HasPrefix(endpoint, detect.VsockScheme) {
+		cl, err := client.NewClientWithOpts(
+			// As with Docker's own connection helpers, the HTTP host is just
+			// a placeholder, as the dialer below decides where to connect to.
+			client.WithHost("http://docker.vsock"),
+			client.WithDialContext(func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return detect.DialVsock(ctx, endpoint)
+			}),
+			client.WithAPIVersionNegotiation(),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return watcher.New(mobyengine.NewMobyWatcher(cl, mobyengine.WithPID(int(pid))), nil), nil
+	}
+	tlsconfig := detect.EngineTLS(ctx, endpoint)
+	dial := detect.DialContextFunc(ctx, endpoint)
+	if tlsconfig == nil && dial == nil {
+		return moby.New(endpoint, nil, mobyengine.WithPID(int(pid)))
+	}
+	var opts []client.Opt
+	if tlsconfig != nil {
+		opts = append(opts, client.WithHTTPClient(&http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsconfig},
+		}))
+	}
+	opts = append(opts, client.WithHost(endpoint), client.WithAPIVersionNegotiation())
+	if dial != nil {
+		// must come after setting the host, as otherwise the Docker client
+		// would replace our dialer with its own unix domain socket dialer.
+		opts = append(opts, client.WithDialContext(dial))
+	}
+	cl, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, err
 	}
-	log.Errorf("no working Docker API endpoint found.")
-	return nil
+	return watcher.New(mobyengine.NewMobyWatcher(cl, mobyengine.WithPID(int(pid))), nil), nil
 }
@@ -0,0 +1,22 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package moby
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Docker engine process patterns", func() {
+
+	It("matches the cgroup of the Docker service", func() {
+		Expect((&Detector{}).CgroupPatterns()).To(ConsistOf("docker.service"))
+	})
+
+	It("matches the executable of the Docker engine", func() {
+		Expect((&Detector{}).EngineExePaths()).To(ConsistOf("dockerd"))
+	})
+
+})
@@ -0,0 +1,54 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package moby
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	detect "github.com/siemens/turtlefinder/detector"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Docker TCP API endpoints", func() {
+
+	It("returns endpoints", func() {
+		Expect(apiEndpoint("/run/docker.sock")).To(Equal("unix:///run/docker.sock"))
+		Expect(apiEndpoint("tcp://localhost:2376")).To(Equal("tcp://localhost:2376"))
+	})
+
+	It("talks TLS to a TCP API endpoint", func(ctx context.Context) {
+		srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Api-Version", "1.41")
+			switch {
+			case strings.HasSuffix(r.URL.Path, "/_ping"):
+				_, _ = w.Write([]byte("OK"))
+			case strings.HasSuffix(r.URL.Path, "/info"):
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"ID":"fake","Name":"fake"}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer srv.Close()
+		endpoint := "tcp://" + strings.TrimPrefix(srv.URL, "https://")
+
+		d := &Detector{}
+		By("failing without a TLS client configuration")
+		Expect(d.NewWatchers(ctx, 0, []string{endpoint})).To(BeEmpty())
+
+		By("succeeding with a TLS client configuration")
+		tlsctx := detect.WithEngineTLS(ctx, "tcp://",
+			srv.Client().Transport.(*http.Transport).TLSClientConfig)
+		ws := d.NewWatchers(tlsctx, 0, []string{endpoint})
+		Expect(ws).To(HaveLen(1))
+		ws[0].Close()
+	})
+
+})
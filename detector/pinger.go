@@ -0,0 +1,42 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package detector
+
+import (
+	"context"
+	"errors"
+
+	"github.com/thediveo/whalewatcher/watcher"
+)
+
+// Pinger is optionally implemented by watchers that can check that their
+// container engine is alive and responsive. This is useful for container
+// engines that don't report any version information, so that a failing
+// version query doesn't tell whether such an engine is reachable.
+type Pinger interface {
+	// Ping checks that the container engine is alive and responsive,
+	// returning nil if it is. If the watcher has no means to ping its engine,
+	// Ping returns [ErrPingUnsupported].
+	Ping(ctx context.Context) error
+}
+
+// ErrPingUnsupported indicates that a watcher has no means to ping its
+// container engine.
+var ErrPingUnsupported = errors.New("ping not supported")
+
+// WithPing returns the specified watcher wrapped so that it additionally
+// implements the [Pinger] interface, using the specified ping function.
+// Detector plugins use this for container engines that don't report any
+// version information. If the ping function is nil, the watcher is returned
+// unwrapped. The API version and storage information of an already wrapped
+// watcher (see [WithAPIVersion] and [WithStorageInfo]) are kept.
+func WithPing(w watcher.Watcher, ping func(ctx context.Context) error) watcher.Watcher {
+	if w == nil || ping == nil {
+		return w
+	}
+	iw := newInfoWatcher(w)
+	iw.ping = ping
+	return iw
+}
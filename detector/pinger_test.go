@@ -0,0 +1,37 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package detector
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("engine ping", func() {
+
+	It("doesn't wrap without ping function", func() {
+		w := &typedWatcher{}
+		Expect(WithPing(w, nil)).To(BeIdenticalTo(w))
+		Expect(WithPing(nil, func(context.Context) error { return nil })).To(BeNil())
+	})
+
+	It("pings using the ping function", func(ctx context.Context) {
+		w := WithPing(&typedWatcher{}, func(context.Context) error { return errors.New("no pong") })
+		Expect(w.(Pinger).Ping(ctx)).To(MatchError("no pong"))
+		Expect(w.Type()).To(Equal("fooengine"))
+	})
+
+	It("keeps other information and reports unsupported pings", func(ctx context.Context) {
+		w := WithAPIVersion(&typedWatcher{}, "1.43")
+		Expect(w.(Pinger).Ping(ctx)).To(MatchError(ErrPingUnsupported))
+		w = WithPing(w, func(context.Context) error { return nil })
+		Expect(w.(Pinger).Ping(ctx)).To(Succeed())
+		Expect(w.(APIVersioner).APIVersion()).To(Equal("1.43"))
+	})
+
+})
@@ -6,6 +6,7 @@ package detector
 
 import (
 	"context"
+	"errors"
 
 	"github.com/thediveo/lxkns/model"
 	"github.com/thediveo/whalewatcher/watcher"
@@ -25,5 +26,103 @@ type Detector interface {
 	// specified API paths. Usually, this will be only a single watcher per
 	// engine, but in case of containerd we want to return multiple watchers,
 	// one for plain containerd and one for its CRI view.
+	//
+	// Besides unix domain socket paths, the API paths might also be TCP API
+	// endpoints in the form of “tcp://host:port” (see [TCPScheme]), as well as
+	// VM socket API endpoints in the form of “vsock://CID:PORT” (see
+	// [VsockScheme]). Detectors not supporting such endpoints should simply
+	// skip them.
 	NewWatchers(ctx context.Context, pid model.PIDType, apis []string) []watcher.Watcher
 }
+
+// EndpointlessDetector is optionally implemented by detector plugins for
+// container “engines” that don't serve any API endpoints at all, such as
+// Apptainer. For such engine processes, the turtlefinder doesn't look for
+// listening unix domain sockets, but instead directly asks the detector for new
+// watchers, passing no API paths.
+type EndpointlessDetector interface {
+	Detector
+	// Endpointless marks a detector as detecting engines without API
+	// endpoints.
+	Endpointless()
+}
+
+// CgroupDetector is optionally implemented by detector plugins for container
+// engines that might not be recognizable by their process names, such as when
+// launched in transient systemd scopes using a generic executable name like
+// “exe”. For processes not matching any engine process name, the turtlefinder
+// then checks the cgroup paths of the process against the cgroup patterns of
+// the detector plugin.
+type CgroupDetector interface {
+	Detector
+	// CgroupPatterns returns one or more cgroup path patterns in the syntax
+	// of [path.Match]. Patterns without any slash match the final element of
+	// a cgroup path, such as “docker.service”, whereas patterns with slashes
+	// match the full cgroup path, such as “/system.slice/docker.service”.
+	CgroupPatterns() []string
+}
+
+// ExeDetector is optionally implemented by detector plugins for container
+// engines that might not be recognizable by their process names, such as on
+// hardened systems renaming the “comm” of processes while keeping the
+// recognizable executable. For processes not matching any engine process name,
+// the turtlefinder then checks the basename of the executable, as read from
+// “/proc/[PID]/exe”, against the executable basename patterns of the detector
+// plugin.
+type ExeDetector interface {
+	Detector
+	// EngineExePaths returns one or more executable basename patterns in the
+	// syntax of [path.Match], such as “dockerd” or “containerd*”.
+	EngineExePaths() []string
+}
+
+// ErrorReportingDetector is optionally implemented by detector plugins that
+// are able to tell why they couldn't create any watchers for a potential
+// container engine process. This allows the turtlefinder to differentiate
+// between processes that turn out not to be engines of the detector's type
+// (no watchers and no error) and processes that are such engines, but cannot
+// be talked to (no watchers with an error), such as due to missing access
+// permissions or unsupported API versions.
+//
+// When a detector plugin implements ErrorReportingDetector, the turtlefinder
+// calls NewWatchersWithError instead of [Detector.NewWatchers].
+type ErrorReportingDetector interface {
+	Detector
+	// NewWatchersWithError returns one or more watchers for tracking the
+	// alive container workload of the container engine accessible by at
+	// least one of the specified API paths, just like [Detector.NewWatchers].
+	// If no watchers can be returned, NewWatchersWithError additionally
+	// returns the reason, unless the process isn't an engine of this type at
+	// all.
+	NewWatchersWithError(ctx context.Context, pid model.PIDType, apis []string) ([]watcher.Watcher, error)
+}
+
+// ErrUnsupportedEngine is returned by error-reporting detector plugins (see
+// [ErrorReportingDetector]) for container engine processes that they
+// recognize, but cannot watch, such as when there is no engine client
+// available. The turtlefinder then neither retries such engines nor reports
+// them as unreachable, but ignores their processes.
+var ErrUnsupportedEngine = errors.New("unsupported container engine")
+
+// DefaultAPIPathsDetector is optionally implemented by detector plugins that
+// know the canonical API endpoint paths their container engines usually serve,
+// such as “/run/docker.sock” for Docker. These default API paths are purely
+// informational, for instance, when documenting or diagnosing what the
+// turtlefinder looks for: the turtlefinder's discovery always uses the API
+// endpoints an engine process is actually listening on.
+type DefaultAPIPathsDetector interface {
+	Detector
+	// DefaultAPIPaths returns the canonical API endpoint path(s) of the
+	// detector's type of container engine.
+	DefaultAPIPaths() []string
+}
+
+// DefaultAPIPaths returns the canonical API endpoint paths of the specified
+// detector plugin, if it implements [DefaultAPIPathsDetector]; otherwise, it
+// returns nil.
+func DefaultAPIPaths(d Detector) []string {
+	if dd, ok := d.(DefaultAPIPathsDetector); ok {
+		return dd.DefaultAPIPaths()
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package detector
+
+import "context"
+
+// DefaultProcRoot is where the proc filesystem is usually mounted.
+const DefaultProcRoot = "/proc"
+
+// procRootKey is the context key for passing the proc filesystem mount point to
+// detector plugins.
+type procRootKey struct{}
+
+// WithProcRoot returns a new context carrying the specified path where the
+// proc filesystem is mounted, for detector plugins that need to look into the
+// proc filesystem themselves, such as when running in a container with the
+// host's proc filesystem bind-mounted somewhere else. An empty path tells
+// detector plugins to use [DefaultProcRoot].
+func WithProcRoot(ctx context.Context, procroot string) context.Context {
+	return context.WithValue(ctx, procRootKey{}, procroot)
+}
+
+// ProcRoot returns the path where the proc filesystem is mounted, as carried by
+// the specified context, if any. Otherwise, it returns [DefaultProcRoot].
+func ProcRoot(ctx context.Context) string {
+	if procroot, ok := ctx.Value(procRootKey{}).(string); ok && procroot != "" {
+		return procroot
+	}
+	return DefaultProcRoot
+}
@@ -0,0 +1,25 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package detector
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("proc filesystem mount point", func() {
+
+	It("defaults", func(ctx context.Context) {
+		Expect(ProcRoot(ctx)).To(Equal("/proc"))
+		Expect(ProcRoot(WithProcRoot(ctx, ""))).To(Equal("/proc"))
+	})
+
+	It("passes on the proc filesystem mount point", func(ctx context.Context) {
+		Expect(ProcRoot(WithProcRoot(ctx, "/host/proc"))).To(Equal("/host/proc"))
+	})
+
+})
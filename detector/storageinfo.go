@@ -0,0 +1,37 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package detector
+
+import "github.com/thediveo/whalewatcher/watcher"
+
+// StorageInfoer is optionally implemented by watchers that know about the
+// storage of their container engine, that is, the storage driver (or
+// snapshotter) in use and the root directory where the engine keeps its
+// persistent data, such as “/var/lib/docker”.
+type StorageInfoer interface {
+	// StorageDriver returns the name of the storage driver used by the
+	// container engine, such as “overlay2”, or "" if unknown.
+	StorageDriver() string
+	// DataRoot returns the root directory of the container engine's
+	// persistent data, or "" if unknown.
+	DataRoot() string
+}
+
+// WithStorageInfo returns the specified watcher wrapped so that it additionally
+// implements the [StorageInfoer] interface, reporting the specified storage
+// driver and data root directory. Detector plugins use this to stash the
+// storage information they learnt when probing a container engine alongside
+// the watcher they create for it. If both the storage driver and data root are
+// empty, the watcher is returned unwrapped. The API version of an already
+// wrapped watcher (see [WithAPIVersion]) is kept.
+func WithStorageInfo(w watcher.Watcher, driver string, dataroot string) watcher.Watcher {
+	if w == nil || (driver == "" && dataroot == "") {
+		return w
+	}
+	iw := newInfoWatcher(w)
+	iw.storagedriver = driver
+	iw.dataroot = dataroot
+	return iw
+}
@@ -0,0 +1,40 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package detector
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("engine storage information", func() {
+
+	It("doesn't wrap without storage information", func() {
+		w := &typedWatcher{}
+		Expect(WithStorageInfo(w, "", "")).To(BeIdenticalTo(w))
+		Expect(WithStorageInfo(nil, "overlay2", "/var/lib/docker")).To(BeNil())
+	})
+
+	It("stashes the storage information with a watcher", func() {
+		w := WithStorageInfo(&typedWatcher{}, "overlay2", "/var/lib/docker")
+		Expect(w.(StorageInfoer).StorageDriver()).To(Equal("overlay2"))
+		Expect(w.(StorageInfoer).DataRoot()).To(Equal("/var/lib/docker"))
+		Expect(w.Type()).To(Equal("fooengine"))
+	})
+
+	It("keeps the API version of a wrapped watcher", func() {
+		apiw := WithAPIVersion(&typedWatcher{}, "1.43")
+		w := WithStorageInfo(apiw, "overlay2", "/var/lib/docker")
+		Expect(w.(APIVersioner).APIVersion()).To(Equal("1.43"))
+		Expect(w.(StorageInfoer).DataRoot()).To(Equal("/var/lib/docker"))
+		Expect(apiw.(StorageInfoer).DataRoot()).To(BeEmpty())
+
+		w = WithAPIVersion(w, "1.44")
+		Expect(w.(APIVersioner).APIVersion()).To(Equal("1.44"))
+		Expect(w.(StorageInfoer).StorageDriver()).To(Equal("overlay2"))
+		Expect(w.(*infoWatcher).Watcher).To(BeAssignableToTypeOf(&typedWatcher{}))
+	})
+
+})
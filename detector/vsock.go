@@ -0,0 +1,164 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package detector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// VsockScheme is the scheme prefix of AF_VSOCK API endpoints in the form of
+// “vsock://CID:PORT”, such as when a container engine inside a micro VM is
+// only reachable from the host via a VM socket.
+const VsockScheme = "vsock://"
+
+// VsockEndpoint returns the vsock API endpoint for the specified context ID
+// (CID) and port.
+func VsockEndpoint(cid uint32, port uint32) string {
+	return VsockScheme + strconv.FormatUint(uint64(cid), 10) + ":" +
+		strconv.FormatUint(uint64(port), 10)
+}
+
+// ParseVsockEndpoint returns the context ID (CID) and port of the specified
+// vsock API endpoint in the form of “vsock://CID:PORT”.
+func ParseVsockEndpoint(api string) (cid uint32, port uint32, err error) {
+	if !strings.HasPrefix(api, VsockScheme) {
+		return 0, 0, fmt.Errorf("not a vsock API endpoint: '%s'", api)
+	}
+	cidtext, porttext, ok := strings.Cut(api[len(VsockScheme):], ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("missing port in vsock API endpoint '%s'", api)
+	}
+	cid64, err := strconv.ParseUint(cidtext, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid CID in vsock API endpoint '%s'", api)
+	}
+	port64, err := strconv.ParseUint(porttext, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port in vsock API endpoint '%s'", api)
+	}
+	return uint32(cid64), uint32(port64), nil
+}
+
+// DialVsock connects to the specified vsock API endpoint in the form of
+// “vsock://CID:PORT”, giving up when the specified context is done. Detector
+// plugins use DialVsock as the dialer of their engine clients when asked to
+// talk to vsock API endpoints.
+func DialVsock(ctx context.Context, api string) (net.Conn, error) {
+	cid, port, err := ParseVsockEndpoint(api)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := unix.Socket(unix.AF_VSOCK, unix.SOCK_STREAM|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: "vsock", Err: os.NewSyscallError("socket", err)}
+	}
+	raddr := &VsockAddr{CID: cid, Port: port}
+	err = unix.Connect(fd, &unix.SockaddrVM{CID: cid, Port: port})
+	if err != nil && !errors.Is(err, unix.EINPROGRESS) {
+		_ = unix.Close(fd)
+		return nil, &net.OpError{Op: "dial", Net: "vsock", Addr: raddr, Err: os.NewSyscallError("connect", err)}
+	}
+	// The socket is non-blocking, so the file gets registered with Go's
+	// runtime poller, allowing us to wait for the connect to finish while
+	// honoring the context.
+	f := os.NewFile(uintptr(fd), api)
+	if err != nil {
+		if err = waitConnected(ctx, f); err != nil {
+			f.Close()
+			return nil, &net.OpError{Op: "dial", Net: "vsock", Addr: raddr, Err: err}
+		}
+	}
+	conn := &vsockConn{File: f, raddr: raddr, laddr: &VsockAddr{}}
+	if sa, err := unix.Getsockname(fd); err == nil {
+		if vm, ok := sa.(*unix.SockaddrVM); ok {
+			conn.laddr = &VsockAddr{CID: vm.CID, Port: vm.Port}
+		}
+	}
+	return conn, nil
+}
+
+// waitConnected waits for the in-progress connect of the specified
+// non-blocking socket to finish, returning the outcome of the connect.
+func waitConnected(ctx context.Context, f *os.File) error {
+	rawconn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = f.SetWriteDeadline(deadline)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = f.SetWriteDeadline(time.Unix(1, 0)) // long ago, so unblock now.
+		case <-stop:
+		}
+	}()
+	var connecterr error
+	err = rawconn.Write(func(fd uintptr) bool {
+		soerr, err := unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_ERROR)
+		if err != nil {
+			connecterr = os.NewSyscallError("getsockopt", err)
+			return true
+		}
+		if soerr != 0 {
+			connecterr = os.NewSyscallError("connect", unix.Errno(soerr))
+			return true
+		}
+		if _, err := unix.Getpeername(int(fd)); errors.Is(err, unix.ENOTCONN) {
+			return false // not yet connected, so wait for writability.
+		}
+		return true
+	})
+	_ = f.SetWriteDeadline(time.Time{})
+	if err != nil {
+		if ctxerr := ctx.Err(); ctxerr != nil {
+			return ctxerr
+		}
+		return err
+	}
+	return connecterr
+}
+
+// VsockAddr is the address of a VM socket endpoint.
+type VsockAddr struct {
+	CID  uint32 // context ID.
+	Port uint32
+}
+
+var _ net.Addr = (*VsockAddr)(nil)
+
+// Network returns the name of the network, that is, “vsock”.
+func (a *VsockAddr) Network() string { return "vsock" }
+
+// String returns the address in the form of “CID:PORT”.
+func (a *VsockAddr) String() string {
+	return strconv.FormatUint(uint64(a.CID), 10) + ":" + strconv.FormatUint(uint64(a.Port), 10)
+}
+
+// vsockConn is a connected VM socket. As Go's net package doesn't know about
+// AF_VSOCK, we use an os.File that is registered with Go's runtime poller for
+// I/O and deadlines.
+type vsockConn struct {
+	*os.File
+	laddr *VsockAddr
+	raddr *VsockAddr
+}
+
+var _ net.Conn = (*vsockConn)(nil)
+
+func (c *vsockConn) LocalAddr() net.Addr  { return c.laddr }
+func (c *vsockConn) RemoteAddr() net.Addr { return c.raddr }
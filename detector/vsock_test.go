@@ -0,0 +1,56 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package detector
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("vsock API endpoints", func() {
+
+	It("formats and parses vsock API endpoints", func() {
+		api := VsockEndpoint(3, 2375)
+		Expect(api).To(Equal("vsock://3:2375"))
+		cid, port, err := ParseVsockEndpoint(api)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cid).To(Equal(uint32(3)))
+		Expect(port).To(Equal(uint32(2375)))
+	})
+
+	DescribeTable("rejects invalid vsock API endpoints",
+		func(api string) {
+			_, _, err := ParseVsockEndpoint(api)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("not vsock", "tcp://localhost:2375"),
+		Entry("no port", "vsock://3"),
+		Entry("invalid CID", "vsock://foo:2375"),
+		Entry("invalid port", "vsock://3:99999999999"),
+	)
+
+	It("fails dialing unreachable vsock API endpoints", func(ctx context.Context) {
+		_, err := DialVsock(ctx, "vsock://3")
+		Expect(err).To(HaveOccurred())
+
+		ctx, cancel := context.WithTimeout(ctx, 250*time.Millisecond)
+		defer cancel()
+		conn, err := DialVsock(ctx, VsockEndpoint(0x7fffffff, 1))
+		if err == nil {
+			conn.Close()
+		}
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("describes vsock addresses", func() {
+		addr := &VsockAddr{CID: 3, Port: 2375}
+		Expect(addr.Network()).To(Equal("vsock"))
+		Expect(addr.String()).To(Equal("3:2375"))
+	})
+
+})
@@ -0,0 +1,123 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/siemens/turtlefinder/detector"
+	"github.com/thediveo/lxkns/model"
+	"golang.org/x/exp/slices"
+)
+
+// defaultDiagnosisTimeout is the default maximum duration of an individual
+// engine probe during a diagnosis, unless a client timeout has been set using
+// [WithClientTimeout].
+const defaultDiagnosisTimeout = 2 * time.Second
+
+// EngineDiagnosis describes the outcome of freshly probing the API of a
+// container engine currently being monitored.
+type EngineDiagnosis struct {
+	*model.ContainerEngine               // the engine diagnosed.
+	Reachable              bool          // engine responded to the probe.
+	Version                string        // engine version reported by the probe; "" if unreachable.
+	Latency                time.Duration // round-trip duration of the probe.
+	Err                    error         // why the engine is unreachable; nil if reachable.
+}
+
+// Diagnose freshly probes the API of each container engine currently being
+// monitored, as returned by [TurtleFinder.Engines], and reports per engine
+// whether it is reachable and the latency of the probe. The probe is a
+// lightweight version query, made in parallel for all engines, that doesn't
+// disturb the ongoing workload watches. Each probe is time-boxed, see also
+// [WithClientTimeout]. The diagnoses are sorted by engine PIDs.
+//
+// Diagnose is intended for diagnostic purposes, such as a “doctor” command
+// checking that the engines discovered can actually be talked to. It never
+// triggers any discovery itself.
+func (f *TurtleFinder) Diagnose(ctx context.Context) []EngineDiagnosis {
+	f.mux.Lock()
+	engines := []*Engine{}
+	for _, pidengines := range f.engines {
+		for _, engine := range pidengines {
+			select {
+			case <-engine.Done:
+				continue
+			default:
+			}
+			engines = append(engines, engine)
+		}
+	}
+	f.mux.Unlock()
+
+	timeout := f.clienttimeout
+	if timeout <= 0 {
+		timeout = defaultDiagnosisTimeout
+	}
+	diagnoses := make([]EngineDiagnosis, len(engines))
+	var wg sync.WaitGroup
+	wg.Add(len(engines))
+	for idx, engine := range engines {
+		go func(diagnosis *EngineDiagnosis, engine *Engine) {
+			defer wg.Done()
+			*diagnosis = diagnoseEngine(ctx, engine, timeout)
+		}(&diagnoses[idx], engine)
+	}
+	wg.Wait()
+	slices.SortFunc(diagnoses, func(a, b EngineDiagnosis) int {
+		return int(a.PID) - int(b.PID)
+	})
+	return diagnoses
+}
+
+// diagnoseEngine probes the specified engine by querying its version,
+// time-boxed to the specified timeout. For engines that don't report any
+// version, but whose watchers can ping them (see [detector.Pinger]), the
+// outcome of the ping decides reachability instead.
+func diagnoseEngine(ctx context.Context, engine *Engine, timeout time.Duration) EngineDiagnosis {
+	diagnosis := EngineDiagnosis{
+		ContainerEngine: engine.details().ContainerEngine,
+	}
+	probectx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	version := engine.Watcher.Version(probectx)
+	if version == "" {
+		if pinger, ok := engine.Watcher.(detector.Pinger); ok {
+			err := pinger.Ping(probectx)
+			if !errors.Is(err, detector.ErrPingUnsupported) {
+				diagnosis.Latency = time.Since(start)
+				if err != nil {
+					if probectx.Err() != nil {
+						diagnosis.Err = probectx.Err()
+					} else {
+						diagnosis.Err = categorize(ErrEngineUnreachable, err)
+					}
+					return diagnosis
+				}
+				diagnosis.Reachable = true
+				return diagnosis
+			}
+		}
+	}
+	diagnosis.Latency = time.Since(start)
+	if version == "" {
+		// The engine watchers don't tell us why they couldn't get the
+		// version, so the best we can do is to tell whether the probe ran out
+		// of time.
+		diagnosis.Err = probectx.Err()
+		if diagnosis.Err == nil {
+			diagnosis.Err = categorize(ErrEngineUnreachable,
+				errors.New("engine didn't respond with its version"))
+		}
+		return diagnosis
+	}
+	diagnosis.Reachable = true
+	diagnosis.Version = version
+	return diagnosis
+}
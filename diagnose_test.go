@@ -0,0 +1,103 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/siemens/turtlefinder/detector"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// versionlessWatcher is an idle watcher for an engine that doesn't report any
+// version information.
+type versionlessWatcher struct {
+	idleWatcher
+	pid int
+}
+
+func (w *versionlessWatcher) Version(context.Context) string { return "" }
+func (w *versionlessWatcher) Type() string                   { return "versionless" }
+func (w *versionlessWatcher) PID() int                       { return w.pid }
+
+var _ = Describe("diagnosing engines", func() {
+
+	It("probes the engines being monitored", func(ctx context.Context) {
+		idle := NewEngine(ctx, &idleWatcher{ready: make(chan struct{})}, 0)
+		mute := NewStaticEngine("docker.com", "moby-1", "/run/docker.sock", 41)
+		tf := New(func() context.Context { return ctx }, WithInjectedEngines(idle, mute))
+		defer tf.Close()
+
+		diagnoses := tf.Diagnose(ctx)
+		Expect(diagnoses).To(HaveExactElements(
+			And(
+				HaveField("ContainerEngine.PID", BeEquivalentTo(41)),
+				HaveField("Reachable", BeFalse()),
+				HaveField("Version", BeEmpty()),
+				HaveField("Err", And(
+					MatchError("engine didn't respond with its version"),
+					MatchError(ErrEngineUnreachable))),
+			),
+			And(
+				HaveField("ContainerEngine.PID", BeEquivalentTo(42)),
+				HaveField("ContainerEngine.Type", "idle"),
+				HaveField("Reachable", BeTrue()),
+				HaveField("Version", "0.0.0"),
+				HaveField("Latency", BeNumerically(">", time.Duration(0))),
+				HaveField("Err", BeNil()),
+			),
+		))
+	})
+
+	It("pings engines that don't report their version", func(ctx context.Context) {
+		alive := NewEngine(ctx, detector.WithPing(
+			&versionlessWatcher{idleWatcher: idleWatcher{ready: make(chan struct{})}, pid: 43},
+			func(context.Context) error { return nil }), 0)
+		gone := NewEngine(ctx, detector.WithPing(
+			&versionlessWatcher{idleWatcher: idleWatcher{ready: make(chan struct{})}, pid: 44},
+			func(context.Context) error { return errors.New("gone fishing") }), 0)
+		unpingable := NewEngine(ctx,
+			&versionlessWatcher{idleWatcher: idleWatcher{ready: make(chan struct{})}, pid: 45}, 0)
+		tf := New(func() context.Context { return ctx }, WithInjectedEngines(alive, gone, unpingable))
+		defer tf.Close()
+
+		diagnoses := tf.Diagnose(ctx)
+		Expect(diagnoses).To(HaveExactElements(
+			And(
+				HaveField("ContainerEngine.PID", BeEquivalentTo(43)),
+				HaveField("Reachable", BeTrue()),
+				HaveField("Version", BeEmpty()),
+				HaveField("Err", BeNil()),
+			),
+			And(
+				HaveField("ContainerEngine.PID", BeEquivalentTo(44)),
+				HaveField("Reachable", BeFalse()),
+				HaveField("Err", And(
+					MatchError("gone fishing"),
+					MatchError(ErrEngineUnreachable))),
+			),
+			And(
+				HaveField("ContainerEngine.PID", BeEquivalentTo(45)),
+				HaveField("Reachable", BeFalse()),
+				HaveField("Err", MatchError(ErrEngineUnreachable)),
+			),
+		))
+	})
+
+	It("doesn't diagnose terminated engines", func(ctx context.Context) {
+		watchctx, cancel := context.WithCancel(ctx)
+		idle := NewEngine(watchctx, &idleWatcher{ready: make(chan struct{})}, 0)
+		tf := New(func() context.Context { return ctx }, WithInjectedEngines(idle))
+		defer tf.Close()
+		cancel()
+		Eventually(idle.Done).Should(BeClosed())
+		Expect(tf.Diagnose(ctx)).To(BeEmpty())
+	})
+
+})
@@ -13,6 +13,12 @@ The following container engines are supported:
   - [containerd]
   - [CRI-O]
   - [podman] (via Docker-compatible API only)
+  - [Garden] (Cloud Foundry's Guardian, polling its HTTP API)
+  - [k3s] (its embedded containerd)
+  - [Apptainer] (formerly Singularity; scanning its starter processes, as there
+    is no API endpoint nor live event stream)
+  - [systemd-machined] containers, such as systemd-nspawn machines (polling its
+    Varlink API, systemd 256+)
 
 # Supported Socket Activators
 
@@ -76,6 +82,14 @@ discoveries. We thus keep some state information about a socket activator's
 socket-related setup and only rediscover upon noticing changes in its socket
 configuration (which rarely if ever occurs).
 
+Rootless engines work in the same way: rootless podman gets socket-activated by
+a user's “systemd --user” instance with its API endpoint in the user's runtime
+directory, such as “/run/user/1000/podman/podman.sock”. As rootless podman
+re-executes itself inside a new user namespace, the process actually serving
+the API endpoint might be a same-named descendant of the activated service
+process, which the turtlefinder takes into account. Rootless Docker is
+discovered by its well-known “dockerd” process name anyway.
+
 # Engines in Engines
 
 A defining feature of the turtlefinder is that it additionally determines the
@@ -90,6 +104,32 @@ Such engine-in-engine configurations are actually not so unknown:
   - [Kubernetes in Docker] (KinD)
   - podman in Docker
 
+# Sidecar Deployment
+
+The turtlefinder can also run inside a (sidecar) container with its own PID
+namespace, instead of the host's PID namespace. Bind-mount the host's proc
+filesystem into the container, such as at “/host/proc”, and tell the
+turtlefinder about it using [WithProcRoot]. As the PIDs reported by container
+engines then might belong to PID namespaces other than the initial PID
+namespace, use [WithPIDTranslation] and pass a
+[github.com/thediveo/lxkns/model.PIDMapper] to
+[TurtleFinder.Containers], such as the one returned by
+[github.com/thediveo/lxkns/discover.NewPIDMap]. The turtlefinder then
+translates the container PIDs into the initial PID namespace.
+
+For liveness and readiness probes, [TurtleFinder.Healthy] tells whether the
+turtlefinder watches at least one engine it successfully synchronized with,
+together with a reason suitable for an HTTP health handler:
+
+	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+	    ok, reason := tf.Healthy()
+	    if !ok {
+	        http.Error(w, reason, http.StatusServiceUnavailable)
+	        return
+	    }
+	    fmt.Fprintln(w, reason)
+	})
+
 # Decoration
 
 Finally, the decoration of the discovered containers uses the usual (extensible)
@@ -100,6 +140,10 @@ overall discovery.
 [containerd]: https://containerd.io
 [CRI-O]: https://cri-o.io
 [podman]: https://podman.io
+[Garden]: https://github.com/cloudfoundry/garden
+[k3s]: https://k3s.io
+[Apptainer]: https://apptainer.org
+[systemd-machined]: https://www.freedesktop.org/software/systemd/man/latest/systemd-machined.service.html
 [Docker Desktop]: https://www.docker.com/products/docker-desktop/
 [Kubernetes in Docker]: https://kind.sigs.k8s.io/
 [systemd]: https://0pointer.de/blog/projects/socket-activation.html
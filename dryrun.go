@@ -0,0 +1,251 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/siemens/turtlefinder/detector"
+	"github.com/thediveo/lxkns/model"
+)
+
+// DryRunReport describes the decisions a discovery would make for a particular
+// process table, as returned by [TurtleFinder.DryRun].
+type DryRunReport struct {
+	Engines    []DryRunEngine    // potential container engine processes, sorted by PID.
+	Activators []DryRunActivator // socket activator processes, sorted by PID.
+}
+
+// DryRunEngine describes a potential container engine process found in a dry
+// run, together with the decision a discovery would make.
+type DryRunEngine struct {
+	PID        model.PIDType // PID of engine process.
+	Name       string        // process name of engine process.
+	Plugin     string        // name of the matching engine detector plugin.
+	APIs       []string      // candidate API endpoints.
+	Unresolved []string      // socket paths that couldn't be resolved.
+	Watch      bool          // discovery would try to create watchers.
+	Reason     string        // why discovery wouldn't try to create watchers; "" if it would.
+}
+
+// DryRunActivator describes a socket activator process found in a dry run,
+// together with its listening unix domain sockets.
+type DryRunActivator struct {
+	PID     model.PIDType  // PID of socket activator process.
+	Name    string         // process name of socket activator.
+	Sockets []DryRunSocket // listening sockets, sorted by path.
+	Err     error          // why the sockets couldn't be scanned; nil otherwise.
+}
+
+// DryRunSocket describes a listening unix domain socket of a socket activator
+// found in a dry run, together with the decision a discovery would make.
+type DryRunSocket struct {
+	Path     string // path of socket in the mount namespace of the socket activator.
+	Ino      uint64 // inode number of socket.
+	Plugin   string // name of the engine finder plugin matching this socket; "" if none.
+	Activate bool   // discovery would activate the engine and create a watcher.
+	Reason   string // why discovery wouldn't activate an engine; "" if it would.
+}
+
+// DryRun runs the matching of engine processes and socket activators as well
+// as the discovery of their API endpoints for the specified process table,
+// stopping short of contacting any engines and creating watchers. It returns a
+// report of the processes found and the decisions a discovery would make, also
+// logging these decisions at info level.
+//
+// DryRun is intended for debugging discoveries in the field and is safe to run
+// on production hosts: it neither activates socket-activated engines, nor does
+// it keep engines alive, nor does it change the state of this TurtleFinder.
+// However, please note that API endpoints of engine processes are scanned
+// only once, without waiting for freshly started engine processes to create
+// their API endpoints.
+func (f *TurtleFinder) DryRun(procs model.ProcessTable) DryRunReport {
+	netunix := newNetUnixCache()
+	report := DryRunReport{
+		Engines:    f.dryRunEngines(procs, netunix),
+		Activators: []DryRunActivator{},
+	}
+	if !f.noactivators {
+		report.Activators = f.dryRunActivators(procs, netunix)
+	}
+	return report
+}
+
+// dryRunEngines returns the dry run decisions about the potential engine
+// processes in the specified process table.
+func (f *TurtleFinder) dryRunEngines(procs model.ProcessTable, netunix *netUnixCache) []DryRunEngine {
+	engineprocs := engineProcesses(procs, f.engineplugins, f.procroot)
+	// Sort out the engine processes already under watch and, just as a
+	// discovery does, hand out the remaining slots for engines under watch,
+	// if limited, to the new engine processes in the order of the process
+	// table, before looking into their API endpoints.
+	watched := make([]bool, len(engineprocs))
+	exceeded := make([]bool, len(engineprocs))
+	f.mux.Lock()
+	slots := f.engineSlots()
+	for idx, engineproc := range engineprocs {
+		if _, ok := f.engines[engineproc.proc.PID]; ok {
+			watched[idx] = true
+			continue
+		}
+		if !f.enginefilter.allowsPlugin(engineproc.engine.pluginname) {
+			continue
+		}
+		if slots == 0 {
+			exceeded[idx] = true
+			continue
+		}
+		slots--
+	}
+	f.mux.Unlock()
+	engines := make([]DryRunEngine, 0, len(engineprocs))
+	for idx, engineproc := range engineprocs {
+		lg := f.logger.With("process", engineproc.proc.Name, "pid", engineproc.proc.PID)
+		engine := DryRunEngine{
+			PID:    engineproc.proc.PID,
+			Name:   engineproc.proc.Name,
+			Plugin: engineproc.engine.pluginname,
+		}
+		_, endpointless := engineproc.engine.detector.(detector.EndpointlessDetector)
+		if !endpointless {
+			engine.APIs, engine.Unresolved = f.apiEndpointsOfEngine(
+				context.Background(), engineproc, procs, netunix, false, lg)
+		}
+		switch {
+		case !f.enginefilter.allowsPlugin(engineproc.engine.pluginname):
+			engine.Reason = "filtered engine type"
+		case watched[idx]:
+			engine.Reason = "already under watch"
+		case exceeded[idx]:
+			engine.Reason = "maximum number of engines reached"
+		case endpointless:
+			engine.Watch = true
+		case engine.APIs == nil && len(engine.Unresolved) > 0:
+			engine.Reason = "unresolvable API endpoints"
+		case engine.APIs == nil:
+			engine.Reason = "no API endpoint"
+		default:
+			engine.Watch = true
+		}
+		engines = append(engines, engine)
+	}
+	sort.Slice(engines, func(i, j int) bool {
+		return engines[i].PID < engines[j].PID
+	})
+	for _, engine := range engines {
+		lg := f.logger.With("process", engine.Name, "pid", engine.PID)
+		if engine.Watch {
+			lg.Infof("dry run: found process %s (PID %d), matched plugin '%s', candidate API endpoints [%s], would create watcher",
+				engine.Name, engine.PID, engine.Plugin, strings.Join(engine.APIs, ", "))
+			continue
+		}
+		lg.Infof("dry run: found process %s (PID %d), matched plugin '%s', candidate API endpoints [%s], would not create watcher: %s",
+			engine.Name, engine.PID, engine.Plugin, strings.Join(engine.APIs, ", "), engine.Reason)
+	}
+	return engines
+}
+
+// dryRunActivators returns the dry run decisions about the socket activator
+// processes in the specified process table and their listening unix domain
+// sockets.
+func (f *TurtleFinder) dryRunActivators(procs model.ProcessTable, netunix *netUnixCache) []DryRunActivator {
+	activators := []DryRunActivator{}
+	for _, proc := range procs {
+		if !f.isActivator(proc) {
+			continue
+		}
+		activators = append(activators, f.dryRunActivator(proc, netunix))
+	}
+	sort.Slice(activators, func(i, j int) bool {
+		return activators[i].PID < activators[j].PID
+	})
+	return activators
+}
+
+// isActivator returns true if the specified process is a socket activator,
+// based on its process name.
+func (f *TurtleFinder) isActivator(proc *model.Process) bool {
+	for actidx := range f.activatorplugins {
+		if proc.Name == f.activatorplugins[actidx].name {
+			return true
+		}
+	}
+	return false
+}
+
+// dryRunActivator returns the dry run decisions about the specified socket
+// activator process and its listening unix domain sockets. In order to not
+// disturb the state of a socket activator already known, dryRunActivator
+// scans the sockets using a throw-away socket activator.
+func (f *TurtleFinder) dryRunActivator(proc *model.Process, netunix *netUnixCache) DryRunActivator {
+	lg := f.logger.With("process", proc.Name, "pid", proc.PID)
+	activator := DryRunActivator{
+		PID:     proc.PID,
+		Name:    proc.Name,
+		Sockets: []DryRunSocket{},
+	}
+	s := newSocketActivator(proc, f.procroot, f.initialsyncwait, f.contexter, f.enginefilter, nil)
+	rawsox, _, _, err := s.rawSocketFdsWithHash()
+	if err != nil {
+		activator.Err = err
+		lg.Infof("dry run: found socket activator %s (PID %d), but cannot scan its sockets: %s",
+			proc.Name, proc.PID, err.Error())
+		return activator
+	}
+	f.mux.Lock()
+	known := f.activators[proc.PID]
+	f.mux.Unlock()
+	sox := listeningUDSPaths(rawsox, netunix.listeningUDSVisibleToProcess(f.procroot, proc.PID))
+	for ino, path := range sox {
+		if f.sockfilter != nil && !f.sockfilter.allows(path) {
+			continue
+		}
+		socket := DryRunSocket{
+			Path:   path,
+			Ino:    ino,
+			Plugin: s.enginePluginName(path),
+		}
+		switch {
+		case socket.Plugin == "":
+			socket.Reason = "no matching engine plugin"
+		case known != nil && known.isObserved(ino):
+			socket.Reason = "already observed"
+		default:
+			socket.Activate = true
+		}
+		activator.Sockets = append(activator.Sockets, socket)
+	}
+	sort.Slice(activator.Sockets, func(i, j int) bool {
+		return activator.Sockets[i].Path < activator.Sockets[j].Path
+	})
+	lg.Infof("dry run: found socket activator %s (PID %d) with %d listening sockets",
+		proc.Name, proc.PID, len(activator.Sockets))
+	for _, socket := range activator.Sockets {
+		if socket.Activate {
+			lg.Infof("dry run: socket activator %s (PID %d), socket %s matched plugin '%s', would activate engine and create watcher",
+				proc.Name, proc.PID, socket.Path, socket.Plugin)
+			continue
+		}
+		if socket.Plugin == "" {
+			lg.Debugf("dry run: socket activator %s (PID %d), socket %s: %s",
+				proc.Name, proc.PID, socket.Path, socket.Reason)
+			continue
+		}
+		lg.Infof("dry run: socket activator %s (PID %d), socket %s matched plugin '%s', would not activate engine: %s",
+			proc.Name, proc.PID, socket.Path, socket.Plugin, socket.Reason)
+	}
+	return activator
+}
+
+// isObserved returns true if the listening socket with the specified inode
+// number has already been observed by this socket activator.
+func (s *socketActivatorProcess) isObserved(ino uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.observed[ino]
+	return ok
+}
@@ -0,0 +1,127 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/thediveo/lxkns/model"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("dry runs", func() {
+
+	var tmpdir string
+
+	BeforeEach(func() {
+		tmpdir = GinkgoT().TempDir()
+		for _, sockpath := range []string{tmpdir + "/engine.sock", tmpdir + "/podman.sock"} {
+			lsock := Successful(net.Listen("unix", sockpath))
+			DeferCleanup(func() { _ = lsock.Close() })
+		}
+	})
+
+	It("reports engine processes without creating watchers", func(ctx context.Context) {
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "recordd"}}
+		d := &apiRecordingDetector{}
+		tf := New(func() context.Context { return ctx },
+			WithoutSocketActivators(),
+			WithSocketPathFilter(func(path string) bool { return strings.HasPrefix(path, tmpdir) }))
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "recordd"}}
+
+		report := tf.DryRun(model.ProcessTable{self.PID: self})
+		Expect(report.Activators).To(BeEmpty())
+		Expect(report.Engines).To(ConsistOf(And(
+			HaveField("PID", self.PID),
+			HaveField("Plugin", "recordd"),
+			HaveField("APIs", ConsistOf(HaveSuffix("/engine.sock"), HaveSuffix("/podman.sock"))),
+			HaveField("Watch", BeTrue()),
+			HaveField("Reason", BeEmpty()),
+		)))
+		Expect(d.apis).To(BeEmpty())
+		Expect(tf.engines).To(BeEmpty())
+
+		By("not watching engines already under watch again")
+		tf.engines[self.PID] = []*Engine{NewStaticEngine("recordd", "recordd", "unix:///recordd.sock", self.PID)}
+		Expect(tf.DryRun(model.ProcessTable{self.PID: self}).Engines).To(ConsistOf(And(
+			HaveField("Watch", BeFalse()),
+			HaveField("Reason", "already under watch"))))
+	})
+
+	It("reports engines exceeding the maximum number of engines", func(ctx context.Context) {
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "recordd"}}
+		d := &apiRecordingDetector{}
+		tf := New(func() context.Context { return ctx },
+			WithoutSocketActivators(),
+			WithMaxEngines(1),
+			WithSocketPathFilter(func(path string) bool { return strings.HasPrefix(path, tmpdir) }))
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "recordd"}}
+		tf.engines[1] = []*Engine{NewStaticEngine("static", "static", "unix:///static.sock", 1)}
+
+		Expect(tf.DryRun(model.ProcessTable{self.PID: self}).Engines).To(ConsistOf(And(
+			HaveField("Watch", BeFalse()),
+			HaveField("Reason", "maximum number of engines reached"))))
+	})
+
+	It("counts new engines without API endpoints against the maximum number of engines", func(ctx context.Context) {
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "recordd"}}
+		endpointless := &model.Process{PID: 0x7ffffff0,
+			ProTaskCommon: model.ProTaskCommon{Name: "recordd"}}
+		d := &apiRecordingDetector{}
+		tf := New(func() context.Context { return ctx },
+			WithoutSocketActivators(),
+			WithMaxEngines(1),
+			WithSocketPathFilter(func(path string) bool { return strings.HasPrefix(path, tmpdir) }))
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "recordd"}}
+
+		// As the process table is a map, we don't know which of both engine
+		// processes gets the only slot, but it must be exactly one of them.
+		Expect(tf.DryRun(model.ProcessTable{self.PID: self, endpointless.PID: endpointless}).Engines).To(ConsistOf(
+			HaveField("Reason", "maximum number of engines reached"),
+			Or(HaveField("Watch", BeTrue()), HaveField("Reason", "no API endpoint"))))
+	})
+
+	It("reports socket activators without activating engines", func(ctx context.Context) {
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "actd"}}
+		tf := New(func() context.Context { return ctx },
+			WithSocketPathFilter(func(path string) bool { return strings.HasPrefix(path, tmpdir) }))
+		defer tf.Close()
+		tf.engineplugins = nil
+		tf.activatorplugins = []activatorPlugin{{name: "actd", pluginname: "actd"}}
+
+		report := tf.DryRun(model.ProcessTable{self.PID: self})
+		Expect(report.Engines).To(BeEmpty())
+		Expect(report.Activators).To(ConsistOf(And(
+			HaveField("PID", self.PID),
+			HaveField("Name", "actd"),
+			HaveField("Err", BeNil()),
+			HaveField("Sockets", ConsistOf(
+				And(HaveField("Path", tmpdir+"/engine.sock"),
+					HaveField("Plugin", BeEmpty()),
+					HaveField("Activate", BeFalse()),
+					HaveField("Reason", "no matching engine plugin")),
+				And(HaveField("Path", tmpdir+"/podman.sock"),
+					HaveField("Plugin", "podman"),
+					HaveField("Activate", BeTrue())),
+			)),
+		)))
+		Expect(tf.activators).To(BeEmpty())
+		Expect(tf.engines).To(BeEmpty())
+	})
+
+})
@@ -0,0 +1,97 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"time"
+
+	"github.com/thediveo/lxkns/model"
+	"github.com/thediveo/whalewatcher/watcher"
+)
+
+// engineIDTimeout limits how long we wait for a newly activated engine to tell
+// us its ID when checking for duplicate engines.
+const engineIDTimeout = 2 * time.Second
+
+// addActivatedEngine adds a new engine for the specified watcher of a
+// socket-activated engine with the specified PID, unless this engine is
+// already under watch. This can happen in nested container scenarios where
+// multiple socket activators, such as the systemd instances of the host and of
+// a container, expose the same bind-mounted engine API socket. As the same
+// engine then gets reached via different activator wormholes, the PIDs might
+// differ, so duplicate engines are instead detected by their engine IDs.
+func (f *TurtleFinder) addActivatedEngine(w watcher.Watcher, pid model.PIDType) {
+	idctx, cancel := context.WithTimeout(f.contexter(), engineIDTimeout)
+	id := w.ID(idctx)
+	cancel()
+	// Serialize adding activated engines, so that the same engine activated
+	// via different wormholes at the same time doesn't slip through. We must
+	// not check for duplicates with f.mux locked, as engines with lazy
+	// metadata might need to be queried for their IDs first.
+	f.activationmu.Lock()
+	defer f.activationmu.Unlock()
+	if dupe := f.engineWithID(w.Type(), id); dupe != nil {
+		f.logger.With("type", w.Type(), "pid", pid).
+			Warnf("'%s' engine (PID %d) with ID '%s' at API endpoint %s already under watch as PID %d at API endpoint %s, ignoring duplicate",
+				w.Type(), pid, id, w.API(), dupe.PID(), dupe.API())
+		w.Close()
+		return
+	}
+	// As this comes in from a different "background" go routine, we need to
+	// make sure that we're not trashing our engine map.
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if _, ok := f.engines[pid]; !ok && f.engineSlots() == 0 {
+		f.warnEngineLimit(1)
+		w.Close()
+		return
+	}
+	// Freshly socket-activated engines won't yet be in the process tree we're
+	// working on. In order to allow downstream users of turtlefinders – lxkns
+	// in particular – to still do correct container PID translation, we get an
+	// engine's parent PID that we assume serves as well for PID translation
+	// between PID namespaces. So pay a quick visit to the proc filesystem and
+	// pick up this engine's PPID.
+	var ppidhint model.PIDType
+	if engproc := model.NewProcessInProcfs(pid, false, f.procroot); engproc != nil {
+		ppidhint = engproc.PPID
+	}
+	eng := f.newEngine(f.contexter(), w, ppidhint, nil)
+	eng.activated = true
+	eng.lastbusy = eng.FirstSeen
+	f.engines[pid] = []*Engine{eng}
+}
+
+// engineWithID returns the engine under watch with the specified type and
+// (non-empty) ID, or nil if there is none. Engines that have stopped watching,
+// such as after an engine restart that kept its ID, don't count. engineWithID
+// must be called with f.mux unlocked.
+func (f *TurtleFinder) engineWithID(enginetype string, id string) *Engine {
+	if id == "" {
+		return nil
+	}
+	f.mux.Lock()
+	candidates := []*Engine{}
+	for _, engines := range f.engines {
+		for _, engine := range engines {
+			if engine.Type() == enginetype {
+				candidates = append(candidates, engine)
+			}
+		}
+	}
+	f.mux.Unlock()
+	for _, engine := range candidates {
+		select {
+		case <-engine.Done:
+			continue
+		default:
+		}
+		if engine.EngineID() == id {
+			return engine
+		}
+	}
+	return nil
+}
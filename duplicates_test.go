@@ -0,0 +1,67 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/thediveo/lxkns/model"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// wormholeWatcher is an idleWatcher for an engine reached via a socket
+// activator wormhole, so with a different PID and API endpoint path.
+type wormholeWatcher struct {
+	idleWatcher
+	pid    int
+	closed atomic.Bool
+}
+
+func (w *wormholeWatcher) PID() int    { return w.pid }
+func (w *wormholeWatcher) API() string { return "unix:///proc/666/root/idle.sock" }
+func (w *wormholeWatcher) Close()      { w.closed.Store(true) }
+
+var _ = Describe("duplicate engines", func() {
+
+	It("doesn't watch the same activated engine twice", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx }, WithoutSocketActivators())
+		defer tf.Close()
+		idle := NewEngine(ctx, &idleWatcher{ready: make(chan struct{})}, 0)
+		tf.engines[42] = []*Engine{idle}
+
+		dupe := &wormholeWatcher{idleWatcher: idleWatcher{ready: make(chan struct{})}, pid: 666}
+		tf.addActivatedEngine(dupe, 666)
+		Expect(dupe.closed.Load()).To(BeTrue())
+		Expect(tf.engines).To(HaveLen(1))
+	})
+
+	It("watches activated engines with the ID of a stopped engine", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx }, WithoutSocketActivators())
+		defer tf.Close()
+		stopped := NewStaticEngine("idle", "idle", "unix:///idle.sock", 42)
+		close(stopped.Done)
+		other := NewStaticEngine("other", "idle", "unix:///other.sock", 43)
+		tf.engines[42] = []*Engine{stopped}
+		tf.engines[43] = []*Engine{other}
+
+		w := &wormholeWatcher{idleWatcher: idleWatcher{ready: make(chan struct{})}, pid: 666}
+		tf.addActivatedEngine(w, 666)
+		Expect(w.closed.Load()).To(BeFalse())
+		Expect(tf.Engines()).To(ContainElement(HaveField("PID", model.PIDType(666))))
+	})
+
+	It("finds engines under watch by their IDs", func() {
+		tf := &TurtleFinder{engines: map[model.PIDType][]*Engine{
+			42: {NewStaticEngine("idle", "idle", "unix:///idle.sock", 42)},
+		}}
+		Expect(tf.engineWithID("idle", "idle")).NotTo(BeNil())
+		Expect(tf.engineWithID("other", "idle")).To(BeNil())
+		Expect(tf.engineWithID("idle", "")).To(BeNil())
+	})
+
+})
@@ -6,9 +6,11 @@ package turtlefinder
 
 import (
 	"context"
+	"strconv"
+	"sync"
 	"time"
 
-	"github.com/thediveo/lxkns/log"
+	"github.com/siemens/turtlefinder/detector"
 	"github.com/thediveo/lxkns/model"
 	"github.com/thediveo/whalewatcher/watcher"
 )
@@ -24,12 +26,36 @@ import (
 // channel will be closed.
 type Engine struct {
 	watcher.Watcher               // engine watcher (doubles as engine adapter).
-	ID              string        // engine ID.
-	Version         string        // engine version.
+	ID              string        // engine ID; empty with lazy metadata, see also EngineID.
+	Version         string        // engine version when found; see also CurrentVersion.
 	Done            chan struct{} // closed when watch is done/has terminated.
 	PPIDHint        model.PIDType // PID of engine's process; for container PID translation.
+	FirstSeen       time.Time     // when the engine was found and its watch started.
+	StorageDriver   string        // storage driver or snapshotter, if known.
+	DataRoot        string        // root directory of the engine's persistent data, if known.
+
+	labeler      containerLabeler // optional container labeler; see WithContainerLabeler.
+	procroot     string           // where the proc filesystem is mounted; "" skips shim runtime detection.
+	shimruntimes shimRuntimes     // cached runtimes of containers.
+	candidates   []string         // candidate API endpoint paths considered when discovering this engine.
+	activated    bool             // engine has been socket-activated.
+	lastbusy     time.Time        // when activated engine last had containers; protected by TurtleFinder.mux.
+
+	metactx     context.Context // context for lazily querying ID and version; nil if queried at creation.
+	metaonce    sync.Once       // ensures to lazily query ID and version only once.
+	lazyid      string          // lazily queried engine ID.
+	lazyversion string          // lazily queried engine version.
+
+	versionrefresh time.Duration // interval for refreshing the engine version; zero never refreshes.
+	versionmu      sync.Mutex    // protects the following fields.
+	version        string        // most recently queried engine version; "" if never refreshed.
+	versionqueried time.Time     // when the engine version was most recently queried.
 }
 
+// containerLabeler gets called for each container adapted by an Engine, see
+// also [WithContainerLabeler].
+type containerLabeler func(c *model.Container, e *Engine)
+
 // NewEngine returns a new Engine given the specified watcher. As NewEngine
 // returns, the Engine is already "warming up" and has started watching (using
 // the given context).
@@ -43,20 +69,38 @@ type Engine struct {
 // in the same PID namespace, so we can also use that for correct PID
 // translation.
 func NewEngine(ctx context.Context, w watcher.Watcher, ppidhint model.PIDType) *Engine {
-	idctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	return startEngine(ctx, w, ppidhint, false)
+}
+
+// startEngine returns a new Engine given the specified watcher, which has
+// already started watching. If lazymeta is true, the engine's ID and version
+// aren't queried at creation, but only when first accessed via
+// [Engine.EngineID] or [Engine.CurrentVersion], see also
+// [WithLazyEngineMetadata].
+func startEngine(ctx context.Context, w watcher.Watcher, ppidhint model.PIDType, lazymeta bool) *Engine {
 	e := &Engine{
-		Watcher:  w,
-		ID:       w.ID(idctx),
-		Version:  w.Version(idctx),
-		Done:     make(chan struct{}, 1), // might never be picked up in some situations
-		PPIDHint: ppidhint,
-	}
-	cancel() // ensure to quickly release cancel, silence linter
-	log.Infof("watching %s container engine (PID %d) with ID '%s', version '%s'",
-		w.Type(), w.PID(), e.ID, e.Version)
+		Watcher:   w,
+		Done:      make(chan struct{}, 1), // might never be picked up in some situations
+		PPIDHint:  ppidhint,
+		FirstSeen: time.Now(),
+	}
+	e.versionqueried = e.FirstSeen
+	if si, ok := w.(detector.StorageInfoer); ok {
+		e.StorageDriver = si.StorageDriver()
+		e.DataRoot = si.DataRoot()
+	}
+	lg := detector.LoggerFrom(ctx).With("type", w.Type(), "pid", w.PID())
+	if lazymeta {
+		e.metactx = ctx
+		lg.Infof("watching %s container engine (PID %d)", w.Type(), w.PID())
+	} else {
+		e.ID, e.Version = queryMetadata(ctx, w)
+		lg.Infof("watching %s container engine (PID %d) with ID '%s', version '%s'",
+			w.Type(), w.PID(), e.ID, e.Version)
+	}
 	go func() {
 		err := e.Watcher.Watch(ctx)
-		log.Infof("stopped watching container engine (PID %d), reason: %s",
+		lg.Infof("stopped watching container engine (PID %d), reason: %s",
 			w.PID(), err.Error())
 		close(e.Done)
 		e.Close()
@@ -64,24 +108,100 @@ func NewEngine(ctx context.Context, w watcher.Watcher, ppidhint model.PIDType) *
 	return e
 }
 
+// queryMetadata queries the specified watcher's engine for its ID and version,
+// time-boxed to 2s.
+func queryMetadata(ctx context.Context, w watcher.Watcher) (id string, version string) {
+	metactx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	return w.ID(metactx), w.Version(metactx)
+}
+
+// fetchMetadata lazily queries the engine ID and version on first access, if
+// this engine has been created with lazy metadata. Otherwise, fetchMetadata
+// is a no-op.
+func (e *Engine) fetchMetadata() {
+	if e.metactx == nil {
+		return
+	}
+	e.metaonce.Do(func() {
+		e.lazyid, e.lazyversion = queryMetadata(e.metactx, e.Watcher)
+	})
+}
+
+// EngineID returns the ID of this engine. This is the same as the ID field,
+// unless the engine has been created with lazy metadata (see
+// [WithLazyEngineMetadata]), in which case the engine gets queried for its ID
+// on first access.
+func (e *Engine) EngineID() string {
+	if e.metactx == nil {
+		return e.ID
+	}
+	e.fetchMetadata()
+	return e.lazyid
+}
+
+// initialVersion returns the engine version when found, lazily querying the
+// engine if the engine has been created with lazy metadata.
+func (e *Engine) initialVersion() string {
+	if e.metactx == nil {
+		return e.Version
+	}
+	e.fetchMetadata()
+	return e.lazyversion
+}
+
 // Containers returns the alive containers managed by this engine, using the
 // associated watcher.
 //
 // The containers returned will reference a model.ContainerEngine and thus are
 // decoupled from a turtlefinder's (container) Engine object.
+//
+// Containers running under a containerd runtime shim, such as
+// “containerd-shim-kata-v2”, get labelled with the runtime of their shim using
+// [RuntimeLabel]. This requires the container PIDs to be valid in the PID
+// namespace of the proc filesystem the turtlefinder uses.
+//
+// If a container labeler has been set using [WithContainerLabeler], it gets
+// called for each container after its labels have been cloned.
+//
+// If the engine version is due for a refresh, Containers first queries the
+// engine for its current version, see also [WithEngineVersionRefresh].
 func (e *Engine) Containers(ctx context.Context) []*model.Container {
-	eng := &model.ContainerEngine{
-		ID:       e.ID,
+	return e.containerEngine(ctx).Containers
+}
+
+// modelEngine returns a new model.ContainerEngine for this engine, without
+// any containers yet.
+func (e *Engine) modelEngine() *model.ContainerEngine {
+	return &model.ContainerEngine{
+		ID:       e.EngineID(),
 		Type:     e.Watcher.Type(),
-		Version:  e.Version,
+		Version:  e.CurrentVersion(),
 		API:      e.Watcher.API(),
 		PID:      model.PIDType(e.Watcher.PID()),
 		PPIDHint: e.PPIDHint,
 	}
+}
+
+// containerEngine implements [Engine.Containers], but returns the
+// model.ContainerEngine referenced by the containers instead, so that callers
+// also get hold of the model.ContainerEngine of engines without containers.
+func (e *Engine) containerEngine(ctx context.Context) *model.ContainerEngine {
+	e.refreshVersion(ctx)
+	eng := e.modelEngine()
+	e.addContainers(eng)
+	return eng
+}
+
+// addContainers adds the alive containers as currently known to the watcher of
+// this engine to the specified model.ContainerEngine, without contacting the
+// engine.
+func (e *Engine) addContainers(eng *model.ContainerEngine) {
 	// Adapt the whalewatcher container model to the lxkns container model,
 	// where the latter takes container engines and groups into account of its
 	// information model. We only need to set the container engine, as groups
 	// will be handled separately by the various (lxkns) decorators.
+	cntrs := []*model.Container{}
 	for _, projname := range append(e.Watcher.Portfolio().Names(), "") {
 		project := e.Watcher.Portfolio().Project(projname)
 		if project == nil {
@@ -97,7 +217,7 @@ func (e *Engine) Containers(ctx context.Context) []*model.Container {
 			for k, v := range container.Labels {
 				clonedLabels[k] = v
 			}
-			cntr := &model.Container{
+			cntrs = append(cntrs, &model.Container{
 				ID:     container.ID,
 				Name:   container.Name,
 				Type:   eng.Type,
@@ -106,11 +226,197 @@ func (e *Engine) Containers(ctx context.Context) []*model.Container {
 				Paused: container.Paused,
 				Labels: clonedLabels,
 				Engine: eng,
+			})
+		}
+	}
+	var runtimes map[string]string
+	if e.procroot != "" {
+		runtimes = e.shimruntimes.lookup(e.procroot, cntrs)
+	}
+	for _, cntr := range cntrs {
+		if runtime, ok := runtimes[cntr.ID]; ok {
+			cntr.Labels[RuntimeLabel] = runtime
+		}
+		if e.labeler != nil {
+			e.labeler(cntr, e)
+		}
+		eng.AddContainer(cntr)
+	}
+}
+
+// details returns the details of this engine.
+func (e *Engine) details() *EngineDetails {
+	return &EngineDetails{
+		ContainerEngine: &model.ContainerEngine{
+			ID:      e.EngineID(),
+			Type:    e.Type(),
+			Version: e.CurrentVersion(),
+			API:     e.API(),
+			PID:     model.PIDType(e.PID()),
+		},
+		APIVersion:    e.APIVersion(),
+		SyncState:     e.SyncState(),
+		FirstSeen:     e.FirstSeen,
+		CandidateAPIs: e.CandidateAPIs(),
+		StorageDriver: e.StorageDriver,
+		DataRoot:      e.DataRoot,
+	}
+}
+
+// selectContainers returns only those of the specified containers matching the
+// specified label selector. The non-matching containers are also removed from
+// the container lists of the specified engines. An empty selector selects all
+// containers.
+func selectContainers(
+	containers []*model.Container, engines []*model.ContainerEngine, selector map[string]string,
+) []*model.Container {
+	if len(selector) == 0 {
+		return containers
+	}
+	for _, engine := range engines {
+		selected := engine.Containers[:0]
+		for _, container := range engine.Containers {
+			if matchesLabelSelector(container.Labels, selector) {
+				selected = append(selected, container)
 			}
-			eng.AddContainer(cntr)
 		}
+		engine.Containers = selected
+	}
+	selected := containers[:0]
+	for _, container := range containers {
+		if matchesLabelSelector(container.Labels, selector) {
+			selected = append(selected, container)
+		}
+	}
+	return selected
+}
+
+// matchesLabelSelector returns true if the specified labels contain all labels
+// of the given selector with the same values. An empty selector matches all
+// labels.
+func matchesLabelSelector(labels map[string]string, selector map[string]string) bool {
+	for k, v := range selector {
+		if lv, ok := labels[k]; !ok || lv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// APIVersion returns the API version negotiated with (or reported by) this
+// engine, such as “1.43” for the Docker API, or “v1” for a CRI API. This is
+// distinct from the engine's product version. APIVersion returns "" if the
+// responsible detector plugin didn't tell the API version, such as for
+// containerd's native API.
+func (e *Engine) APIVersion() string {
+	if v, ok := e.Watcher.(detector.APIVersioner); ok {
+		return v.APIVersion()
+	}
+	return ""
+}
+
+// CurrentVersion returns the most recently known version of this engine. This
+// is the same as the Version field, unless the engine version has since been
+// refreshed and found to have changed, such as after an in-place engine
+// upgrade without the engine process changing. See also
+// [WithEngineVersionRefresh]. For engines created with lazy metadata (see
+// [WithLazyEngineMetadata]), the engine gets queried for its version on first
+// access.
+func (e *Engine) CurrentVersion() string {
+	e.versionmu.Lock()
+	version := e.version
+	e.versionmu.Unlock()
+	if version == "" {
+		return e.initialVersion()
+	}
+	return version
+}
+
+// refreshVersion queries the engine for its current version, if engine version
+// refreshes are enabled and the most recent query is older than the refresh
+// interval. The query is time-boxed; if the query fails, the most recently
+// known version is kept.
+func (e *Engine) refreshVersion(ctx context.Context) {
+	if e.versionrefresh <= 0 {
+		return
+	}
+	e.versionmu.Lock()
+	if time.Since(e.versionqueried) < e.versionrefresh {
+		e.versionmu.Unlock()
+		return
+	}
+	e.versionqueried = time.Now() // block concurrent refreshes.
+	e.versionmu.Unlock()
+
+	versionctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	version := e.Watcher.Version(versionctx)
+	if version == "" {
+		return
+	}
+	initial := e.initialVersion()
+	e.versionmu.Lock()
+	previous := e.version
+	if previous == "" {
+		previous = initial
+	}
+	e.version = version
+	e.versionmu.Unlock()
+	if version != previous {
+		detector.LoggerFrom(ctx).With("type", e.Type(), "pid", e.PID()).
+			Infof("%s container engine (PID %d) version changed from '%s' to '%s'",
+				e.Type(), e.PID(), previous, version)
+	}
+}
+
+// CandidateAPIs returns the candidate API endpoint paths that were considered
+// when discovering this engine. The API endpoint finally chosen by the
+// responsible detector plugin is returned by API instead. For socket-activated and
+// injected engines, CandidateAPIs returns nil, as these engines didn't go
+// through any API endpoint selection.
+func (e *Engine) CandidateAPIs() []string {
+	if e.candidates == nil {
+		return nil
+	}
+	return append(e.candidates[:0:0], e.candidates...)
+}
+
+// EngineSyncState indicates whether the workload of a container engine has
+// already been fully synchronized, or whether the initial synchronization is
+// still ongoing in the background.
+type EngineSyncState int
+
+const (
+	// EngineSyncing indicates that the initial workload synchronization with
+	// a container engine is still ongoing, so the workload reported might be
+	// incomplete.
+	EngineSyncing EngineSyncState = iota
+	// EngineSynced indicates that the workload of a container engine has been
+	// fully synchronized.
+	EngineSynced
+)
+
+// String returns the textual representation of an engine synchronization
+// state.
+func (s EngineSyncState) String() string {
+	switch s {
+	case EngineSyncing:
+		return "syncing"
+	case EngineSynced:
+		return "synced"
+	}
+	return "EngineSyncState(" + strconv.Itoa(int(s)) + ")"
+}
+
+// SyncState returns whether the workload of this engine has already been
+// fully synchronized, based on the watcher's Ready channel.
+func (e *Engine) SyncState() EngineSyncState {
+	select {
+	case <-e.Watcher.Ready():
+		return EngineSynced
+	default:
+		return EngineSyncing
 	}
-	return eng.Containers
 }
 
 // IsAlive returns true as long as the engine watcher is operational and hasn't
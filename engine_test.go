@@ -6,15 +6,22 @@ package turtlefinder
 
 import (
 	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/onsi/gomega/types"
+	"github.com/thediveo/lxkns/model"
 	"github.com/thediveo/morbyd"
 	"github.com/thediveo/morbyd/run"
 	"github.com/thediveo/morbyd/session"
 	"github.com/thediveo/morbyd/timestamper"
+	"github.com/thediveo/whalewatcher"
+	"github.com/thediveo/whalewatcher/watcher"
 	"github.com/thediveo/whalewatcher/watcher/moby"
 
+	"github.com/siemens/turtlefinder/detector"
 	"github.com/siemens/turtlefinder/internal/test"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -87,3 +94,397 @@ var _ = Describe("container engine", Serial, Ordered, func() {
 	})
 
 })
+
+// readyWatcher is a stub watcher.Watcher that only knows about becoming
+// Ready().
+type readyWatcher struct {
+	watcher.Watcher
+	ready chan struct{}
+}
+
+func (r *readyWatcher) Ready() <-chan struct{} { return r.ready }
+
+var _ = Describe("engine synchronization state", func() {
+
+	It("reports the synchronization state", func() {
+		w := &readyWatcher{ready: make(chan struct{})}
+		e := &Engine{Watcher: w}
+		Expect(e.SyncState()).To(Equal(EngineSyncing))
+		close(w.ready)
+		Expect(e.SyncState()).To(Equal(EngineSynced))
+	})
+
+	It("stringifies", func() {
+		Expect(EngineSyncing.String()).To(Equal("syncing"))
+		Expect(EngineSynced.String()).To(Equal("synced"))
+		Expect(EngineSyncState(42).String()).To(Equal("EngineSyncState(42)"))
+	})
+
+})
+
+// idleWatcher is a stub watcher.Watcher that doesn't watch anything, but
+// otherwise behaves sufficiently well to be used with NewEngine.
+type idleWatcher struct {
+	watcher.Watcher
+	ready chan struct{}
+}
+
+func (w *idleWatcher) ID(context.Context) string      { return "idle" }
+func (w *idleWatcher) Version(context.Context) string { return "0.0.0" }
+func (w *idleWatcher) Type() string                   { return "idle" }
+func (w *idleWatcher) API() string                    { return "unix:///idle.sock" }
+func (w *idleWatcher) PID() int                       { return 42 }
+func (w *idleWatcher) Ready() <-chan struct{}         { return w.ready }
+func (w *idleWatcher) Close()                         {}
+
+func (w *idleWatcher) Portfolio() *whalewatcher.Portfolio {
+	return whalewatcher.NewPortfolio()
+}
+
+func (w *idleWatcher) Watch(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+var _ = Describe("engine first-seen timestamp", func() {
+
+	It("records when an engine was first seen", func(ctx context.Context) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		before := time.Now()
+		e := NewEngine(ctx, &idleWatcher{ready: make(chan struct{})}, 0)
+		Expect(e.FirstSeen).To(BeTemporally(">=", before))
+		Expect(e.FirstSeen).To(BeTemporally("<=", time.Now()))
+
+		tf := New(func() context.Context { return ctx })
+		defer tf.Close()
+		tf.engines[42] = []*Engine{e}
+		Expect(tf.EngineDetails()).To(ConsistOf(And(
+			HaveField("ID", "idle"),
+			HaveField("FirstSeen", e.FirstSeen),
+		)))
+		cancel()
+		Eventually(e.Done).Should(BeClosed())
+	})
+
+})
+
+// metaCountingWatcher is an idleWatcher counting the queries for its engine's
+// ID and version.
+type metaCountingWatcher struct {
+	idleWatcher
+	idqueries      atomic.Int32
+	versionqueries atomic.Int32
+}
+
+func (w *metaCountingWatcher) ID(ctx context.Context) string {
+	w.idqueries.Add(1)
+	return w.idleWatcher.ID(ctx)
+}
+
+func (w *metaCountingWatcher) Version(ctx context.Context) string {
+	w.versionqueries.Add(1)
+	return w.idleWatcher.Version(ctx)
+}
+
+// blockingMetaWatcher is an idleWatcher whose ID queries block until released.
+type blockingMetaWatcher struct {
+	idleWatcher
+	querying chan struct{}
+	release  chan struct{}
+}
+
+func (w *blockingMetaWatcher) ID(ctx context.Context) string {
+	select {
+	case w.querying <- struct{}{}:
+	default:
+	}
+	<-w.release
+	return w.idleWatcher.ID(ctx)
+}
+
+var _ = Describe("lazy engine metadata", func() {
+
+	It("queries the engine ID and version at creation by default", func(ctx context.Context) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		w := &metaCountingWatcher{idleWatcher: idleWatcher{ready: make(chan struct{})}}
+		e := NewEngine(ctx, w, 0)
+		Expect(w.idqueries.Load()).To(Equal(int32(1)))
+		Expect(e.ID).To(Equal("idle"))
+		Expect(e.EngineID()).To(Equal("idle"))
+		Expect(e.CurrentVersion()).To(Equal("0.0.0"))
+		Expect(w.idqueries.Load()).To(Equal(int32(1)))
+	})
+
+	It("queries the engine ID and version only once on first access", func(ctx context.Context) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		w := &metaCountingWatcher{idleWatcher: idleWatcher{ready: make(chan struct{})}}
+		e := startEngine(ctx, w, 0, true)
+		Expect(w.idqueries.Load()).To(BeZero())
+		Expect(w.versionqueries.Load()).To(BeZero())
+		Expect(e.ID).To(BeEmpty())
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				Expect(e.EngineID()).To(Equal("idle"))
+				Expect(e.CurrentVersion()).To(Equal("0.0.0"))
+				Expect(e.details()).To(HaveField("ID", "idle"))
+			}()
+		}
+		wg.Wait()
+		Expect(w.idqueries.Load()).To(Equal(int32(1)))
+		Expect(w.versionqueries.Load()).To(Equal(int32(1)))
+	})
+
+	It("creates engines with lazy metadata when told so", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx }, WithLazyEngineMetadata())
+		defer tf.Close()
+		Expect(tf.lazymeta).To(BeTrue())
+		w := &metaCountingWatcher{idleWatcher: idleWatcher{ready: make(chan struct{})}}
+		e := tf.newEngine(ctx, w, 0, nil)
+		Expect(w.idqueries.Load()).To(BeZero())
+		Expect(e.Containers(ctx)).To(BeEmpty())
+		Expect(w.idqueries.Load()).To(Equal(int32(1)))
+	})
+
+	It("doesn't query lazy metadata at creation when retaining engines", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx },
+			WithLazyEngineMetadata(), WithEngineRetention(time.Hour))
+		defer tf.Close()
+		w := &metaCountingWatcher{idleWatcher: idleWatcher{ready: make(chan struct{})}}
+		_ = tf.newEngine(ctx, w, 0, nil)
+		Expect(w.idqueries.Load()).To(BeZero())
+		Expect(w.versionqueries.Load()).To(BeZero())
+	})
+
+	DescribeTable("doesn't query lazy metadata while locked",
+		func(ctx context.Context, query func(tf *TurtleFinder)) {
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			tf := New(func() context.Context { return ctx },
+				WithLazyEngineMetadata(), WithEngineRetention(time.Hour))
+			defer tf.Close()
+			w := &blockingMetaWatcher{
+				idleWatcher: idleWatcher{ready: make(chan struct{})},
+				querying:    make(chan struct{}, 1),
+				release:     make(chan struct{}),
+			}
+			tf.engines[42] = []*Engine{tf.newEngine(ctx, w, 0, nil)}
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				query(tf)
+			}()
+			Eventually(w.querying).Should(Receive())
+			Expect(tf.mux.TryLock()).To(BeTrue())
+			tf.mux.Unlock()
+			close(w.release)
+			Eventually(done).Should(BeClosed())
+		},
+		Entry("engine details", func(tf *TurtleFinder) { _ = tf.EngineDetails() }),
+		Entry("snapshot", func(tf *TurtleFinder) { _ = tf.Snapshot() }),
+		Entry("duplicate engines", func(tf *TurtleFinder) { _ = tf.engineWithID("idle", "idle") }),
+	)
+
+})
+
+var _ = Describe("engine API version", func() {
+
+	It("reports the API version stashed by a detector plugin", func(ctx context.Context) {
+		e := &Engine{Watcher: &idleWatcher{}}
+		Expect(e.APIVersion()).To(BeEmpty())
+		Expect(e.details().APIVersion).To(BeEmpty())
+
+		e = &Engine{Watcher: detector.WithAPIVersion(&idleWatcher{}, "1.43")}
+		Expect(e.APIVersion()).To(Equal("1.43"))
+		Expect(e.details().APIVersion).To(Equal("1.43"))
+		Expect(e.details().Type).To(Equal("idle"))
+	})
+
+})
+
+var _ = Describe("engine storage information", func() {
+
+	It("reports the storage information stashed by a detector plugin", func(ctx context.Context) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		e := NewEngine(ctx, &idleWatcher{ready: make(chan struct{})}, 0)
+		Expect(e.StorageDriver).To(BeEmpty())
+		Expect(e.details().DataRoot).To(BeEmpty())
+
+		e = NewEngine(ctx, detector.WithStorageInfo(
+			detector.WithAPIVersion(&idleWatcher{ready: make(chan struct{})}, "1.43"),
+			"overlay2", "/var/lib/docker"), 0)
+		Expect(e.StorageDriver).To(Equal("overlay2"))
+		Expect(e.DataRoot).To(Equal("/var/lib/docker"))
+		Expect(e.details()).To(HaveField("StorageDriver", "overlay2"))
+		Expect(e.details()).To(HaveField("DataRoot", "/var/lib/docker"))
+		Expect(e.details()).To(HaveField("APIVersion", "1.43"))
+	})
+
+})
+
+// versionedWatcher is an idleWatcher with a changeable engine version.
+type versionedWatcher struct {
+	idleWatcher
+	version atomic.Pointer[string]
+}
+
+func (w *versionedWatcher) Version(context.Context) string { return *w.version.Load() }
+
+var _ = Describe("engine version refresh", func() {
+
+	It("refreshes the engine version", func(ctx context.Context) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		w := &versionedWatcher{idleWatcher: idleWatcher{ready: make(chan struct{})}}
+		version := "1.0.0"
+		w.version.Store(&version)
+		e := NewEngine(ctx, w, 0)
+		e.versionrefresh = 50 * time.Millisecond
+		Expect(e.CurrentVersion()).To(Equal("1.0.0"))
+
+		upgraded := "1.1.0"
+		w.version.Store(&upgraded)
+		_ = e.Containers(ctx)
+		Expect(e.CurrentVersion()).To(Equal("1.0.0"), "premature refresh")
+
+		time.Sleep(100 * time.Millisecond)
+		_ = e.Containers(ctx)
+		Expect(e.CurrentVersion()).To(Equal("1.1.0"))
+		Expect(e.Version).To(Equal("1.0.0"))
+		Expect(e.details().Version).To(Equal("1.1.0"))
+
+		empty := ""
+		w.version.Store(&empty)
+		time.Sleep(100 * time.Millisecond)
+		_ = e.Containers(ctx)
+		Expect(e.CurrentVersion()).To(Equal("1.1.0"))
+
+		cancel()
+		Eventually(e.Done).Should(BeClosed())
+	})
+
+	It("doesn't refresh when disabled", func(ctx context.Context) {
+		w := &versionedWatcher{}
+		version := "1.0.0"
+		w.version.Store(&version)
+		e := &Engine{Watcher: w, Version: "0.9.0"}
+		_ = e.Containers(ctx)
+		Expect(e.CurrentVersion()).To(Equal("0.9.0"))
+
+		Expect(New(func() context.Context { return ctx }).versionrefresh).To(Equal(defaultVersionRefresh))
+		Expect(New(func() context.Context { return ctx }, WithEngineVersionRefresh(0)).versionrefresh).To(BeZero())
+	})
+
+})
+
+// portfolioWatcher is an idleWatcher that returns a fixed portfolio.
+type portfolioWatcher struct {
+	idleWatcher
+	portfolio *whalewatcher.Portfolio
+}
+
+func (w *portfolioWatcher) Portfolio() *whalewatcher.Portfolio { return w.portfolio }
+
+var _ = Describe("container labeler", func() {
+
+	It("labels containers without touching the watcher's labels", func(ctx context.Context) {
+		pf := whalewatcher.NewPortfolio()
+		labels := map[string]string{"foo": "bar"}
+		pf.Add(&whalewatcher.Container{ID: "1234", Name: "canary", PID: 666, Labels: labels})
+		e := &Engine{Watcher: &portfolioWatcher{portfolio: pf}}
+		e.labeler = func(c *model.Container, e *Engine) {
+			c.Labels["api"] = e.API()
+			delete(c.Labels, "foo")
+		}
+		Expect(e.Containers(ctx)).To(ConsistOf(And(
+			HaveField("Name", "canary"),
+			HaveField("Labels", And(
+				HaveKeyWithValue("api", "unix:///idle.sock"),
+				Not(HaveKey("foo")))),
+		)))
+		Expect(labels).To(Equal(map[string]string{"foo": "bar"}))
+	})
+
+	It("passes the container labeler on to engines", func(ctx context.Context) {
+		called := false
+		tf := New(func() context.Context { return ctx },
+			WithContainerLabeler(func(*model.Container, *Engine) { called = true }))
+		defer tf.Close()
+		Expect(tf.labeler).NotTo(BeNil())
+		tf.labeler(nil, nil)
+		Expect(called).To(BeTrue())
+	})
+
+})
+
+var _ = Describe("container label selector", func() {
+
+	It("selects only matching containers", func() {
+		eng := &model.ContainerEngine{}
+		for idx, labels := range []model.Labels{
+			{"app": "foo", "tier": "db", "x": "y"},
+			{"app": "foo", "tier": "web"},
+			{"app": "foo"},
+			nil,
+		} {
+			eng.AddContainer(&model.Container{ID: strconv.Itoa(idx), Labels: labels})
+		}
+		containers := append([]*model.Container{}, eng.Containers...)
+		Expect(selectContainers(containers, []*model.ContainerEngine{eng}, nil)).To(HaveLen(4))
+		Expect(selectContainers(containers, []*model.ContainerEngine{eng},
+			map[string]string{"app": "foo", "tier": "db"})).To(ConsistOf(HaveField("ID", "0")))
+		Expect(eng.Containers).To(ConsistOf(HaveField("ID", "0")))
+	})
+
+	It("selects containers only after stacking engines", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx },
+			WithContainerLabelSelector(map[string]string{"app": "foo"}),
+			WithInjectedEngines(
+				NewStaticEngine("docker.com", "outer", "/run/docker.sock", 100,
+					&whalewatcher.Container{ID: "1", Name: "inner", PID: 200}),
+				NewStaticEngine("docker.com", "inner", "/proc/200/root/run/docker.sock", 300,
+					&whalewatcher.Container{ID: "2", Name: "deep", PID: 400,
+						Labels: map[string]string{"app": "foo"}})))
+		defer tf.Close()
+
+		init := &model.Process{PID: 1}
+		outerEngineProc := &model.Process{PID: 100, PPID: 1, Parent: init}
+		innerCntrProc := &model.Process{PID: 200, PPID: 100, Parent: outerEngineProc}
+		innerEngineProc := &model.Process{PID: 300, PPID: 200, Parent: innerCntrProc}
+		procs := model.ProcessTable{}
+		for _, proc := range []*model.Process{init, outerEngineProc, innerCntrProc, innerEngineProc} {
+			procs[proc.PID] = proc
+		}
+		containers, engines := tf.ContainersAndEngines(ctx, procs, nil)
+		Expect(containers).To(ConsistOf(And(
+			HaveField("Name", "deep"),
+			HaveField("Labels", HaveKeyWithValue(TurtlefinderContainerPrefixLabelName, "inner")))))
+		Expect(engines).To(HaveExactElements(
+			HaveField("Containers", BeEmpty()),
+			HaveField("Containers", ConsistOf(HaveField("Name", "deep")))))
+	})
+
+	It("passes a copy of the label selector on to engines", func(ctx context.Context) {
+		selector := map[string]string{"app": "foo"}
+		tf := New(func() context.Context { return ctx },
+			WithContainerLabelSelector(selector))
+		defer tf.Close()
+		selector["app"] = "bar"
+		Expect(tf.labelselector).To(Equal(map[string]string{"app": "foo"}))
+
+		tf = New(func() context.Context { return ctx },
+			WithContainerLabelSelector(map[string]string{}))
+		defer tf.Close()
+		Expect(tf.labelselector).To(BeNil())
+	})
+
+})
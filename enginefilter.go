@@ -0,0 +1,79 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"github.com/siemens/turtlefinder/activator"
+	"github.com/siemens/turtlefinder/detector"
+	"github.com/thediveo/go-plugger/v3"
+	"github.com/thediveo/whalewatcher/watcher"
+)
+
+// engineTypeFilter restricts the container engines watched to those with
+// allowed engine detector plugin names or allowed watcher types. A nil
+// engineTypeFilter allows all container engines.
+type engineTypeFilter struct {
+	allowed map[string]struct{}
+	// bytype is true if the allowed names include names that aren't plugin
+	// names, so these might be watcher types instead. In this case, we
+	// cannot rule out an engine based only on its plugin name, but need to
+	// create its watchers first in order to learn their types.
+	bytype bool
+}
+
+// newEngineTypeFilter returns a new engineTypeFilter allowing only the
+// specified engine detector plugin names and watcher types. If no names are
+// specified, then nil is returned, allowing all engines.
+func newEngineTypeFilter(allow []string) *engineTypeFilter {
+	if len(allow) == 0 {
+		return nil
+	}
+	f := &engineTypeFilter{
+		allowed: make(map[string]struct{}, len(allow)),
+	}
+	for _, name := range allow {
+		f.allowed[name] = struct{}{}
+	}
+	pluginnames := map[string]struct{}{}
+	for _, name := range plugger.Group[detector.Detector]().Plugins() {
+		pluginnames[name] = struct{}{}
+	}
+	for _, name := range plugger.Group[activator.EngineFinder]().Plugins() {
+		pluginnames[name] = struct{}{}
+	}
+	for name := range f.allowed {
+		if _, ok := pluginnames[name]; !ok {
+			f.bytype = true
+			break
+		}
+	}
+	return f
+}
+
+// allowsPlugin returns true if engines detected by the plugin with the
+// specified name might be allowed, so that watchers need to be created for
+// them. Please note that the watchers created then need to be checked in turn
+// using allowsWatcher.
+func (f *engineTypeFilter) allowsPlugin(pluginname string) bool {
+	if f == nil || f.bytype {
+		return true
+	}
+	_, ok := f.allowed[pluginname]
+	return ok
+}
+
+// allowsWatcher returns true if the specified watcher created by the plugin
+// with the specified name is allowed, either based on the plugin name or on
+// the watcher's type.
+func (f *engineTypeFilter) allowsWatcher(pluginname string, w watcher.Watcher) bool {
+	if f == nil {
+		return true
+	}
+	if _, ok := f.allowed[pluginname]; ok {
+		return true
+	}
+	_, ok := f.allowed[w.Type()]
+	return ok
+}
@@ -0,0 +1,72 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/thediveo/lxkns/model"
+	"github.com/thediveo/whalewatcher/watcher"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// typedWatcher is a stub watcher.Watcher that only knows its Type().
+type typedWatcher struct {
+	watcher.Watcher
+	typ string
+}
+
+func (w *typedWatcher) Type() string { return w.typ }
+
+var _ = Describe("engine type filter", func() {
+
+	It("allows everything when unfiltered", func() {
+		f := newEngineTypeFilter(nil)
+		Expect(f).To(BeNil())
+		Expect(f.allowsPlugin("dockerd")).To(BeTrue())
+		Expect(f.allowsWatcher("dockerd", &typedWatcher{typ: "docker.com"})).To(BeTrue())
+	})
+
+	It("filters by plugin name", func() {
+		f := newEngineTypeFilter([]string{"dockerd"})
+		Expect(f.bytype).To(BeFalse())
+		Expect(f.allowsPlugin("dockerd")).To(BeTrue())
+		Expect(f.allowsPlugin("containerd")).To(BeFalse())
+		Expect(f.allowsPlugin("podman")).To(BeFalse())
+		Expect(f.allowsWatcher("dockerd", &typedWatcher{typ: "docker.com"})).To(BeTrue())
+	})
+
+	It("filters by watcher type", func() {
+		f := newEngineTypeFilter([]string{"docker.com"})
+		Expect(f.bytype).To(BeTrue())
+		Expect(f.allowsPlugin("containerd")).To(BeTrue())
+		Expect(f.allowsWatcher("dockerd", &typedWatcher{typ: "docker.com"})).To(BeTrue())
+		Expect(f.allowsWatcher("containerd", &typedWatcher{typ: "containerd.io"})).To(BeFalse())
+	})
+
+	It("doesn't probe engine processes again with all watchers filtered out", func(ctx context.Context) {
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "stopd"}}
+		procs := model.ProcessTable{self.PID: self}
+		d := &stoppableDetector{}
+		tf := New(func() context.Context { return ctx },
+			WithGettingOnlineWait(100*time.Millisecond),
+			WithEngineTypeFilter("docker.com"))
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "stopd"}}
+
+		_ = tf.Containers(ctx, procs, nil)
+		Expect(tf.Engines()).To(BeEmpty())
+		_ = tf.Containers(ctx, procs, nil)
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		Expect(d.watchers).To(HaveLen(1))
+	})
+
+})
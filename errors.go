@@ -0,0 +1,63 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import "errors"
+
+// Categories of discovery failures; use [errors.Is] to check the errors
+// reported by a TurtleFinder, such as [UnreachableEngine.LastError], for these
+// categories.
+var (
+	// ErrNoAPIEndpoint indicates that a potential container engine doesn't
+	// have any API endpoint to talk to.
+	ErrNoAPIEndpoint = errors.New("no API endpoint")
+	// ErrEngineUnreachable indicates that a container engine has API
+	// endpoints, but none of them works, such as due to missing permissions
+	// or unsupported API versions.
+	ErrEngineUnreachable = errors.New("container engine unreachable")
+	// ErrActivatorScanFailed indicates that the sockets of a socket activator
+	// couldn't be scanned, such as when the socket activator process has
+	// terminated in the meantime.
+	ErrActivatorScanFailed = errors.New("socket activator scan failed")
+	// ErrActivatedEngineNotFound indicates that the process of a
+	// socket-activated container engine couldn't be found after activation.
+	ErrActivatedEngineNotFound = errors.New("activated container engine process not found")
+	// ErrStaleAPIEndpoint indicates that an API endpoint of a socket
+	// activator is stale, as the socket activator didn't spawn any container
+	// engine process when connecting to the API endpoint, such as when a
+	// socket unit outlived its stopped engine.
+	ErrStaleAPIEndpoint = errors.New("stale API endpoint")
+	// ErrUnknownActivator indicates that there is no socket activator with a
+	// specific PID.
+	ErrUnknownActivator = errors.New("unknown socket activator")
+)
+
+// categorizedError tags an error with one of the discovery failure
+// categories, such as [ErrEngineUnreachable], while keeping the error's
+// message.
+type categorizedError struct {
+	category error
+	err      error
+}
+
+// categorize returns the specified error tagged with the specified discovery
+// failure category, or nil if err is nil.
+func categorize(category error, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &categorizedError{category: category, err: err}
+}
+
+// Error returns the message of the categorized error.
+func (e *categorizedError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the category as well as the categorized error, so that
+// [errors.Is] and [errors.As] match both.
+func (e *categorizedError) Unwrap() []error {
+	return []error{e.category, e.err}
+}
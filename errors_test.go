@@ -0,0 +1,40 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"errors"
+	"os"
+
+	"github.com/thediveo/lxkns/model"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("discovery errors", func() {
+
+	It("categorizes errors while keeping their messages", func() {
+		Expect(categorize(ErrEngineUnreachable, nil)).To(BeNil())
+
+		errDoh := errors.New("D'oh!")
+		err := categorize(ErrEngineUnreachable, errDoh)
+		Expect(err).To(MatchError("D'oh!"))
+		Expect(err).To(MatchError(ErrEngineUnreachable))
+		Expect(err).To(MatchError(errDoh))
+		Expect(err).NotTo(MatchError(ErrNoAPIEndpoint))
+	})
+
+	It("reports failed socket activator scans", func() {
+		s := &socketActivatorProcess{
+			proc:     &model.Process{PID: 42},
+			procroot: GinkgoT().TempDir(),
+		}
+		_, _, _, err := s.rawSocketFdsWithHash()
+		Expect(err).To(MatchError(ErrActivatorScanFailed))
+		Expect(err).To(MatchError(os.ErrNotExist))
+	})
+
+})
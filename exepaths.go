@@ -0,0 +1,79 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/thediveo/lxkns/model"
+)
+
+// processExeBasename returns the basename of the executable of the process with
+// the specified PID, as read from the “/proc/[PID]/exe” link in the proc
+// filesystem mounted at procroot. processExeBasename returns an empty string if
+// the executable link cannot be read, such as when lacking the necessary
+// privileges or when the process has terminated in the meantime.
+func processExeBasename(procroot string, pid model.PIDType) string {
+	exe, err := os.Readlink(procroot + "/" + strconv.FormatUint(uint64(pid), 10) + "/exe")
+	if err != nil || exe == "" {
+		return ""
+	}
+	// The kernel appends " (deleted)" to the executable path if the executable
+	// has been removed or replaced since the process started, such as after a
+	// package upgrade. As we're only interested in the name, we drop it.
+	const deleted = " (deleted)"
+	if len(exe) > len(deleted) && exe[len(exe)-len(deleted):] == deleted {
+		exe = exe[:len(exe)-len(deleted)]
+	}
+	return path.Base(exe)
+}
+
+// exeMatches returns true if the specified executable basename matches any of
+// the specified executable basename patterns. Malformed patterns never match.
+func exeMatches(basename string, patterns []string) bool {
+	if basename == "" {
+		return false
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, basename); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hasExePatterns returns true if at least one of the specified engine detector
+// plugins has executable basename patterns.
+func hasExePatterns(engineplugins []enginePlugin) bool {
+	for idx := range engineplugins {
+		if len(engineplugins[idx].exepatterns) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// exeEnginePlugin returns the engine detector plugin with executable basename
+// patterns matching the executable of the specified process, or nil if there
+// is none. The process's executable is read from the proc filesystem mounted
+// at procroot, but only if there is at least one plugin with executable
+// basename patterns at all.
+func exeEnginePlugin(procroot string, proc *model.Process, engineplugins []enginePlugin) *enginePlugin {
+	if !hasExePatterns(engineplugins) {
+		return nil
+	}
+	basename := processExeBasename(procroot, proc.PID)
+	if basename == "" {
+		return nil
+	}
+	for idx := range engineplugins {
+		if exeMatches(basename, engineplugins[idx].exepatterns) {
+			return &engineplugins[idx]
+		}
+	}
+	return nil
+}
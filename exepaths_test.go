@@ -0,0 +1,95 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/thediveo/lxkns/model"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// exeDetector is an endpointlessDetector that additionally has executable
+// basename patterns.
+type exeDetector struct {
+	endpointlessDetector
+	patterns []string
+}
+
+func (d *exeDetector) EngineExePaths() []string { return d.patterns }
+
+var _ = Describe("executable-based engine detection", func() {
+
+	It("reads executable basenames", func() {
+		procroot := GinkgoT().TempDir()
+		Expect(processExeBasename(procroot, 42)).To(BeEmpty())
+
+		Expect(os.MkdirAll(filepath.Join(procroot, "42"), 0755)).To(Succeed())
+		Expect(os.Symlink("/usr/bin/dockerd", filepath.Join(procroot, "42", "exe"))).To(Succeed())
+		Expect(processExeBasename(procroot, 42)).To(Equal("dockerd"))
+
+		Expect(os.MkdirAll(filepath.Join(procroot, "666"), 0755)).To(Succeed())
+		Expect(os.Symlink("/usr/bin/containerd (deleted)", filepath.Join(procroot, "666", "exe"))).To(Succeed())
+		Expect(processExeBasename(procroot, 666)).To(Equal("containerd"))
+	})
+
+	DescribeTable("matching executable basename patterns",
+		func(basename string, patterns []string, expected bool) {
+			Expect(exeMatches(basename, patterns)).To(Equal(expected))
+		},
+		Entry(nil, "dockerd", []string{"dockerd"}, true),
+		Entry(nil, "containerd", []string{"dockerd", "container*"}, true),
+		Entry(nil, "dockerd", []string{"containerd"}, false),
+		Entry(nil, "dockerd", []string{"["}, false),
+		Entry(nil, "", []string{"*"}, false),
+	)
+
+	It("detects engine processes by their executables only when names don't match", func(ctx context.Context) {
+		procroot := GinkgoT().TempDir()
+		Expect(os.MkdirAll(filepath.Join(procroot, "42"), 0755)).To(Succeed())
+		Expect(os.Symlink("/usr/bin/idled", filepath.Join(procroot, "42", "exe"))).To(Succeed())
+		renamed := &model.Process{PID: 42,
+			ProTaskCommon: model.ProTaskCommon{Name: "hardened"}}
+		procs := model.ProcessTable{renamed.PID: renamed}
+
+		d := &exeDetector{patterns: []string{"idle*"}}
+		plugins := []enginePlugin{{
+			names:       d.EngineNames(),
+			exepatterns: d.EngineExePaths(),
+			detector:    d,
+			pluginname:  "endlessd",
+		}}
+		engineprocs := engineProcesses(procs, plugins, procroot)
+		Expect(engineprocs).To(HaveLen(1))
+		Expect(engineprocs[0].proc).To(BeIdenticalTo(renamed))
+		Expect(engineprocs[0].engine).To(BeIdenticalTo(&plugins[0]))
+		Expect(engineProcesses(procs, plugins[:0], procroot)).To(BeEmpty())
+
+		d.patterns = []string{"dockerd"}
+		plugins[0].exepatterns = d.EngineExePaths()
+		Expect(engineProcesses(procs, plugins, procroot)).To(BeEmpty())
+
+		d.patterns = []string{"idled"}
+		tf := New(func() context.Context { return ctx },
+			WithGettingOnlineWait(100*time.Millisecond), WithProcRoot(procroot))
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{
+			names:       d.EngineNames(),
+			exepatterns: d.EngineExePaths(),
+			detector:    d,
+			pluginname:  "endlessd",
+		}}
+		Expect(tf.isCandidate(renamed)).To(BeTrue())
+		Expect(tf.isCandidate(&model.Process{PID: 666})).To(BeFalse())
+		_ = tf.Containers(ctx, procs, nil)
+		Expect(tf.Engines()).To(ConsistOf(HaveField("Type", "idle")))
+	})
+
+})
@@ -9,8 +9,12 @@ require (
 	github.com/sirupsen/logrus v1.9.3
 	github.com/thediveo/morbyd v0.9.2
 	github.com/thediveo/procfsroot v1.0.1
+	go.opentelemetry.io/otel v1.22.0
+	go.opentelemetry.io/otel/sdk v1.22.0
+	go.opentelemetry.io/otel/trace v1.22.0
 	golang.org/x/exp v0.0.0-20240119083558-1b970713d09a
 	golang.org/x/sync v0.6.0
+	google.golang.org/grpc v1.61.0
 	k8s.io/cri-api v0.28.6
 )
 
@@ -56,14 +60,11 @@ require (
 	github.com/thediveo/ioctl v0.9.3 // indirect
 	go.opencensus.io v0.24.0 // indirect
 	go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp v0.47.0 // indirect
-	go.opentelemetry.io/otel v1.22.0 // indirect
 	go.opentelemetry.io/otel/metric v1.22.0 // indirect
-	go.opentelemetry.io/otel/trace v1.22.0 // indirect
 	golang.org/x/mod v0.14.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 	google.golang.org/genproto v0.0.0-20240108191215-35c7eff3a6b1 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240108191215-35c7eff3a6b1 // indirect
-	google.golang.org/grpc v1.61.0 // indirect
 	google.golang.org/protobuf v1.32.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -81,6 +82,6 @@ require (
 	github.com/thediveo/success v1.0.2
 	github.com/thediveo/whalewatcher v0.11.1
 	golang.org/x/net v0.20.0 // indirect
-	golang.org/x/sys v0.16.0 // indirect
+	golang.org/x/sys v0.16.0
 	golang.org/x/tools v0.17.0 // indirect
 )
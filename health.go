@@ -0,0 +1,65 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import "fmt"
+
+// Healthy returns true if this turtlefinder is operational and watches at least
+// one container engine whose workload has been fully synchronized, that is,
+// the turtlefinder successfully talked to this engine. Otherwise, Healthy
+// returns false together with a reason for being unhealthy, suitable for
+// logging or reporting by an HTTP health handler. When healthy, the reason
+// instead summarizes the engines being watched.
+//
+// A turtlefinder is unhealthy when:
+//   - it has been closed,
+//   - its initial discovery hasn't completed yet (see also
+//     [TurtleFinder.WaitForInitialDiscovery]),
+//   - no container engines have been found (yet),
+//   - all engine watchers have terminated, such as when the engines have
+//     gone or their watchers failed,
+//   - none of the engines under watch has synchronized its workload yet.
+//
+// Healthy reads only the existing state and thus is cheap to call; it never
+// triggers any discovery itself. Please note that a turtlefinder becomes
+// healthy only after some caller called [TurtleFinder.Containers], which does
+// the discovery.
+func (f *TurtleFinder) Healthy() (bool, string) {
+	select {
+	case <-f.firstpass:
+	default:
+		return false, "initial discovery pending"
+	}
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if f.engines == nil {
+		return false, "closed"
+	}
+	total, alive, synced := 0, 0, 0
+	for _, engines := range f.engines {
+		for _, engine := range engines {
+			total++
+			if !engine.IsAlive() {
+				continue
+			}
+			alive++
+			if engine.SyncState() == EngineSynced {
+				synced++
+			}
+		}
+	}
+	switch {
+	case total == 0:
+		if unreachable := len(f.unreachable.list()); unreachable > 0 {
+			return false, fmt.Sprintf("no container engines found, %d unreachable", unreachable)
+		}
+		return false, "no container engines found"
+	case alive == 0:
+		return false, fmt.Sprintf("all %d container engine watchers have terminated", total)
+	case synced == 0:
+		return false, fmt.Sprintf("none of %d container engines synchronized yet", alive)
+	}
+	return true, fmt.Sprintf("watching %d container engines, %d synchronized", alive, synced)
+}
@@ -0,0 +1,73 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/thediveo/lxkns/model"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("health", func() {
+
+	healthy := func(tf *TurtleFinder) func() []any {
+		return func() []any {
+			ok, reason := tf.Healthy()
+			return []any{ok, reason}
+		}
+	}
+
+	It("is unhealthy before the initial discovery and without engines", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx }, WithoutSocketActivators())
+		defer tf.Close()
+		Expect(healthy(tf)()).To(HaveExactElements(false, "initial discovery pending"))
+
+		_ = tf.Containers(ctx, model.ProcessTable{}, nil)
+		Expect(healthy(tf)()).To(HaveExactElements(false, "no container engines found"))
+
+		tf.unreachable.record(UnreachableEngine{PID: 42})
+		Expect(healthy(tf)()).To(HaveExactElements(false, "no container engines found, 1 unreachable"))
+
+		tf.Close()
+		Expect(healthy(tf)()).To(HaveExactElements(false, "closed"))
+	})
+
+	It("is healthy with a synchronized engine", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx },
+			WithInjectedEngines(NewStaticEngine("docker.com", "moby-1", "/run/docker.sock", 42)))
+		defer tf.Close()
+		_ = tf.Containers(ctx, model.ProcessTable{}, nil)
+		Expect(healthy(tf)()).To(HaveExactElements(true, "watching 1 container engines, 1 synchronized"))
+	})
+
+	It("is unhealthy when engines aren't synchronized or have terminated", func(ctx context.Context) {
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "stopd"}}
+		d := &stoppableDetector{}
+		tf := New(func() context.Context { return ctx },
+			WithGettingOnlineWait(100*time.Millisecond), WithoutSocketActivators())
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "stopd"}}
+
+		_ = tf.Containers(ctx, model.ProcessTable{self.PID: self}, nil)
+		Expect(healthy(tf)()).To(HaveExactElements(false, "none of 1 container engines synchronized yet"))
+
+		d.mu.Lock()
+		close(d.watchers[0].ready)
+		d.mu.Unlock()
+		Expect(healthy(tf)()).To(HaveExactElements(true, "watching 1 container engines, 1 synchronized"))
+
+		d.mu.Lock()
+		close(d.watchers[0].stop)
+		d.mu.Unlock()
+		Eventually(healthy(tf)).Should(HaveExactElements(false, "all 1 container engine watchers have terminated"))
+	})
+
+})
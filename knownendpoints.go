@@ -0,0 +1,273 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siemens/turtlefinder/detector"
+	"github.com/thediveo/lxkns/model"
+	"golang.org/x/exp/slices"
+	"golang.org/x/sys/unix"
+)
+
+// peerDialTimeout limits how long we try to connect to a known API endpoint in
+// order to learn the PID of the process serving it.
+const peerDialTimeout = 2 * time.Second
+
+// updateKnownEndpoints probes the known API endpoints set using
+// [WithKnownEndpoints] that aren't already under watch for container engines,
+// without relying on the process table. As the same API endpoint might have
+// been discovered via a different path, such as via the root of an engine
+// process, API endpoints are identified by their socket file inodes, where
+// possible. Similar to updateDaemons, the
+// referenced wait group count will be increased for each known API endpoint
+// probed, and decreased as soon as the probe has finished, including the
+// initial synchronization of any new watchers up to the “getting online” time
+// box.
+func (f *TurtleFinder) updateKnownEndpoints(ctx context.Context, wg *sync.WaitGroup) {
+	if len(f.knownendpoints) == 0 {
+		return
+	}
+	watched := f.watchedEndpoints()
+	newendpoints := make([]string, 0, len(f.knownendpoints))
+	for _, api := range f.knownendpoints {
+		if watched.contains(api) {
+			continue
+		}
+		newendpoints = append(newendpoints, api)
+	}
+	f.mux.Lock()
+	if slots := f.engineSlots(); slots < len(newendpoints) {
+		f.warnEngineLimit(len(newendpoints) - slots)
+		newendpoints = newendpoints[:slots]
+	}
+	f.mux.Unlock()
+	for _, api := range newendpoints {
+		if err := f.workersem.Acquire(ctx, 1); err != nil {
+			return
+		}
+		wg.Add(1)
+		go func(api string) {
+			defer func() {
+				f.workersem.Release(1)
+				wg.Done()
+			}()
+			f.probeKnownEndpoint(ctx, api)
+		}(api)
+	}
+}
+
+// endpointSet is a set of API endpoints, identified by their socket file
+// inodes where possible and otherwise by their (TCP, vsock) API endpoint URLs.
+type endpointSet struct {
+	inodes map[endpointInode]struct{}
+	apis   map[string]struct{}
+}
+
+// endpointInode identifies an API endpoint by the device and inode number of
+// its socket file.
+type endpointInode struct {
+	dev uint64
+	ino uint64
+}
+
+// add the specified API endpoint to this set.
+func (s endpointSet) add(api string) {
+	s.apis[api] = struct{}{}
+	if inode, ok := socketInode(api); ok {
+		s.inodes[inode] = struct{}{}
+	}
+}
+
+// contains returns true if the specified API endpoint is in this set.
+func (s endpointSet) contains(api string) bool {
+	if _, ok := s.apis[api]; ok {
+		return true
+	}
+	inode, ok := socketInode(api)
+	if !ok {
+		return false
+	}
+	_, ok = s.inodes[inode]
+	return ok
+}
+
+// socketInode returns the device and inode number of the socket file of the
+// specified unix domain socket API endpoint, and true; it returns false for
+// TCP and vsock API endpoints, as well as for inaccessible socket files.
+func socketInode(api string) (endpointInode, bool) {
+	if strings.HasPrefix(api, detector.TCPScheme) || strings.HasPrefix(api, detector.VsockScheme) {
+		return endpointInode{}, false
+	}
+	var stat unix.Stat_t
+	if err := unix.Stat(strings.TrimPrefix(api, "unix://"), &stat); err != nil {
+		return endpointInode{}, false
+	}
+	return endpointInode{dev: uint64(stat.Dev), ino: stat.Ino}, true
+}
+
+// watchedEndpoints returns the API endpoints of the engines currently under
+// watch. watchedEndpoints must be called with f.mux unlocked, as it stats the
+// socket files.
+func (f *TurtleFinder) watchedEndpoints() endpointSet {
+	f.mux.Lock()
+	apis := []string{}
+	for _, engines := range f.engines {
+		for _, engine := range engines {
+			apis = append(apis, engine.API())
+		}
+	}
+	f.mux.Unlock()
+	watched := endpointSet{
+		inodes: map[endpointInode]struct{}{},
+		apis:   map[string]struct{}{},
+	}
+	for _, api := range apis {
+		watched.add(api)
+	}
+	return watched
+}
+
+// probeKnownEndpoint asks the detector plugins one after another to create
+// watchers for the specified known API endpoint, until a plugin succeeds. The
+// engine's PID is taken from the peer credentials of the API endpoint, where
+// possible. If there is already an engine with the same PID under watch, the
+// API endpoint isn't probed any further. As the peer credentials of a
+// socket-activated API endpoint tell the PID of the socket activator instead of
+// the engine, the engine's PID is then considered to be unknown.
+func (f *TurtleFinder) probeKnownEndpoint(ctx context.Context, api string) {
+	pid := peerPID(detector.WithDialer(ctx, f.dialer), api)
+	if pid != 0 && f.isActivatorPID(pid) {
+		f.logger.With("api", api, "pid", pid).
+			Debugf("known API endpoint %s is owned by socket activator process %d", api, pid)
+		pid = 0
+	}
+	lg := f.logger.With("api", api, "pid", pid)
+	if pid != 0 {
+		f.mux.Lock()
+		_, known := f.engines[pid]
+		f.mux.Unlock()
+		if known {
+			lg.Debugf("known API endpoint %s served by engine process %d already under watch", api, pid)
+			return
+		}
+	}
+	enginectx := f.contexter()
+	for _, plugin := range f.knownEndpointPlugins(api) {
+		if !f.enginefilter.allowsPlugin(plugin.pluginname) {
+			continue
+		}
+		if _, endpointless := plugin.detector.(detector.EndpointlessDetector); endpointless {
+			continue
+		}
+		watchers := plugin.detector.NewWatchers(enginectx, pid, []string{api})
+		if len(watchers) == 0 {
+			continue
+		}
+		for _, w := range watchers {
+			if !f.enginefilter.allowsWatcher(plugin.pluginname, w) {
+				lg.Debugf("ignoring filtered '%s' engine (PID %d)", w.Type(), w.PID())
+				w.Close()
+				continue
+			}
+			f.containerchanges.subscribe(w)
+			staggerWatchStart(ctx, f.startjitter)
+			startWatch(enginectx, w, f.initialsyncwait)
+			eng := f.newEngine(enginectx, w, 0, []string{api})
+			f.mux.Lock()
+			f.engines[pid] = append(f.engines[pid], eng)
+			f.mux.Unlock()
+		}
+		return
+	}
+	lg.Debugf("no container engine found at known API endpoint %s", api)
+}
+
+// isActivatorPID returns true if the process with the specified PID is a
+// socket activator.
+func (f *TurtleFinder) isActivatorPID(pid model.PIDType) bool {
+	f.mux.Lock()
+	_, known := f.activators[pid]
+	f.mux.Unlock()
+	if known {
+		return true
+	}
+	proc := model.NewProcessInProcfs(pid, false, f.procroot)
+	return proc != nil && f.isActivator(proc)
+}
+
+// knownEndpointPlugins returns the engine detector plugins to try on the
+// specified known API endpoint, with the plugins advertising a default API path
+// with the same name as the API endpoint coming first.
+func (f *TurtleFinder) knownEndpointPlugins(api string) []*enginePlugin {
+	plugins := make([]*enginePlugin, 0, len(f.engineplugins))
+	for idx := range f.engineplugins {
+		plugins = append(plugins, &f.engineplugins[idx])
+	}
+	base := filepath.Base(api)
+	slices.SortStableFunc(plugins, func(a, b *enginePlugin) int {
+		return advertises(b, base) - advertises(a, base)
+	})
+	return plugins
+}
+
+// advertises returns 1 if the specified engine detector plugin advertises a
+// default API path with the specified base name, otherwise 0.
+func advertises(plugin *enginePlugin, base string) int {
+	for _, path := range detector.DefaultAPIPaths(plugin.detector) {
+		if filepath.Base(path) == base {
+			return 1
+		}
+	}
+	return 0
+}
+
+// peerPID returns the PID of the process serving the specified unix domain
+// socket API endpoint, as told by the peer credentials of the socket. It
+// returns zero if the PID is unknown, such as for TCP and vsock API endpoints.
+// Please note that for socket-activated API endpoints this is the PID of the
+// socket activator that created the listening socket. peerPID connects using
+// the dialer passed in the specified context, if any.
+func peerPID(ctx context.Context, api string) model.PIDType {
+	if strings.HasPrefix(api, detector.TCPScheme) || strings.HasPrefix(api, detector.VsockScheme) {
+		return 0
+	}
+	ctx, cancel := context.WithTimeout(ctx, peerDialTimeout)
+	defer cancel()
+	conn, err := detector.Dialer(ctx).DialContext(ctx, "unix", api)
+	if err != nil {
+		return 0
+	}
+	defer conn.Close()
+	return connPeerPID(conn)
+}
+
+// connPeerPID returns the PID of the process that created the listening unix
+// domain socket the specified connection is connected to, as told by the peer
+// credentials of the connection. It returns zero if the PID is unknown.
+func connPeerPID(conn net.Conn) model.PIDType {
+	unixconn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return 0
+	}
+	rawconn, err := unixconn.SyscallConn()
+	if err != nil {
+		return 0
+	}
+	var cred *unix.Ucred
+	var crederr error
+	if err := rawconn.Control(func(fd uintptr) {
+		cred, crederr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil || crederr != nil {
+		return 0
+	}
+	return model.PIDType(cred.Pid)
+}
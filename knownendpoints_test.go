@@ -0,0 +1,142 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/thediveo/lxkns/model"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+// defaultPathDetector is an endpointDetector advertising default API paths.
+type defaultPathDetector struct {
+	endpointDetector
+	paths []string
+}
+
+func (d *defaultPathDetector) DefaultAPIPaths() []string { return d.paths }
+
+var _ = Describe("known API endpoints", func() {
+
+	var sockpath string
+
+	BeforeEach(func() {
+		sockpath = GinkgoT().TempDir() + "/engine.sock"
+		lsock := Successful(net.Listen("unix", sockpath))
+		DeferCleanup(func() { _ = lsock.Close() })
+	})
+
+	It("learns the PID of a unix domain socket API endpoint", func(ctx context.Context) {
+		Expect(peerPID(ctx, sockpath)).To(Equal(model.PIDType(os.Getpid())))
+		Expect(peerPID(ctx, sockpath+".nada")).To(BeZero())
+		Expect(peerPID(ctx, "tcp://localhost:2375")).To(BeZero())
+	})
+
+	It("discovers engines without scanning processes", func(ctx context.Context) {
+		recorder := &apiRecordingDetector{}
+		d := &defaultPathDetector{paths: []string{"/run/engine.sock"}}
+		tf := New(func() context.Context { return ctx },
+			WithoutSocketActivators(),
+			WithGettingOnlineWait(100*time.Millisecond),
+			WithKnownEndpoints("unix://"+sockpath, "tcp://localhost:2375"))
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{
+			{names: recorder.EngineNames(), detector: recorder, pluginname: "recordd"},
+			{names: d.EngineNames(), detector: d, pluginname: "containerd"},
+		}
+		Expect(tf.knownendpoints).To(ConsistOf(sockpath, "tcp://localhost:2375"))
+
+		_ = tf.Containers(ctx, model.ProcessTable{}, nil)
+		Expect(tf.Engines()).To(ConsistOf(
+			And(HaveField("API", sockpath), HaveField("PID", model.PIDType(os.Getpid()))),
+			And(HaveField("API", "tcp://localhost:2375"), HaveField("PID", model.PIDType(0))),
+		))
+		// the detector advertising a matching default API path is tried
+		// first, so the recorder only sees the TCP endpoint.
+		recorder.mu.Lock()
+		Expect(recorder.apis).To(ConsistOf("tcp://localhost:2375"))
+		recorder.mu.Unlock()
+
+		By("not probing known API endpoints under watch again")
+		engines := tf.EngineDetails()
+		_ = tf.Containers(ctx, model.ProcessTable{}, nil)
+		Expect(tf.EngineDetails()).To(ConsistOf(
+			HaveField("FirstSeen", engines[0].FirstSeen),
+			HaveField("FirstSeen", engines[1].FirstSeen)))
+		recorder.mu.Lock()
+		Expect(recorder.apis).To(HaveLen(1))
+		recorder.mu.Unlock()
+	})
+
+	It("skips known API endpoints of engine processes already under watch", func(ctx context.Context) {
+		d := &endpointDetector{}
+		tf := New(func() context.Context { return ctx },
+			WithoutSocketActivators(),
+			WithKnownEndpoints(sockpath))
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "containerd"}}
+		idle := NewEngine(ctx, &idleWatcher{ready: make(chan struct{})}, 0)
+		tf.engines[model.PIDType(os.Getpid())] = []*Engine{idle}
+
+		_ = tf.Containers(ctx, model.ProcessTable{}, nil)
+		Expect(tf.Engines()).To(ConsistOf(HaveField("API", "unix:///idle.sock")))
+	})
+
+	It("identifies known API endpoints under watch via different paths", func(ctx context.Context) {
+		wormhole := fmt.Sprintf("/proc/%d/root%s", os.Getpid(), sockpath)
+		watched := &endpointWatcher{idleWatcher: idleWatcher{ready: make(chan struct{})}, api: wormhole}
+		tf := &TurtleFinder{engines: map[model.PIDType][]*Engine{
+			42: {{Watcher: watched, Done: make(chan struct{})}},
+		}}
+		Expect(tf.watchedEndpoints().contains(sockpath)).To(BeTrue())
+		Expect(tf.watchedEndpoints().contains(sockpath + ".nada")).To(BeFalse())
+		Expect(tf.watchedEndpoints().contains("tcp://localhost:2375")).To(BeFalse())
+	})
+
+	It("probes known API endpoints only after discovering engine processes", func(ctx context.Context) {
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "containerd"}}
+		d := &endpointDetector{}
+		tf := New(func() context.Context { return ctx },
+			WithoutSocketActivators(),
+			WithGettingOnlineWait(100*time.Millisecond),
+			WithSocketPathFilter(func(path string) bool { return path == sockpath }),
+			WithKnownEndpoints(sockpath))
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "containerd"}}
+
+		_ = tf.Containers(ctx, model.ProcessTable{self.PID: self}, nil)
+		Expect(tf.Engines()).To(ConsistOf(
+			HaveField("API", fmt.Sprintf("/proc/%d/root%s", os.Getpid(), sockpath))))
+	})
+
+	It("doesn't key engines by the PIDs of socket activators", func(ctx context.Context) {
+		self := model.NewProcessInProcfs(model.PIDType(os.Getpid()), false, "/proc")
+		Expect(self).NotTo(BeNil())
+		d := &endpointDetector{}
+		tf := New(func() context.Context { return ctx },
+			WithGettingOnlineWait(100*time.Millisecond),
+			WithKnownEndpoints(sockpath))
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "containerd"}}
+		tf.activatorplugins = []activatorPlugin{{name: self.Name, pluginname: "selfd"}}
+
+		_ = tf.Containers(ctx, model.ProcessTable{}, nil)
+		Expect(tf.Engines()).To(ConsistOf(
+			And(HaveField("API", sockpath), HaveField("PID", model.PIDType(0)))))
+		tf.mux.Lock()
+		defer tf.mux.Unlock()
+		Expect(tf.engines).To(HaveKey(model.PIDType(0)))
+	})
+
+})
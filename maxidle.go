@@ -0,0 +1,148 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"time"
+
+	"github.com/thediveo/lxkns/model"
+	"github.com/thediveo/whalewatcher/watcher"
+)
+
+// idledEngineGracePeriod is how long an idled socket-activated engine process
+// gets to terminate on its own after its watcher has been closed. If the engine
+// process is still alive afterwards, such as when other clients keep it busy,
+// it gets activated and watched again in order to not miss any of its
+// containers.
+const idledEngineGracePeriod = 30 * time.Second
+
+// activation describes a socket-activated engine, as seen by its socket
+// activator.
+type activation struct {
+	w     watcher.Watcher // workload watcher of the activated engine.
+	pid   model.PIDType   // PID of the activated engine process.
+	names []string        // possible process names of the activated engine.
+	since time.Time       // when the activated engine was idled.
+}
+
+// idleActivatedEngines closes the watchers of socket-activated engines that
+// haven't had any containers for longer than the maximum idle time set using
+// [WithActivatedEngineMaxIdle], removing these engines at the same time and
+// returning them, so that they can be retained in the same way as terminated
+// engines. The socket activators of such idled engines are told so, in order
+// to not re-activate them on their own. idleActivatedEngines must be called
+// with f.mux locked.
+func (f *TurtleFinder) idleActivatedEngines(now time.Time) (idled []*Engine) {
+	if f.maxidle <= 0 {
+		return nil
+	}
+	for pid, engines := range f.engines {
+		engines = deleteAndZeroFunc(engines, func(engine *Engine) bool {
+			if !engine.activated {
+				return false
+			}
+			if engine.Portfolio().ContainerTotal() > 0 {
+				engine.lastbusy = now
+				return false
+			}
+			idle := now.Sub(engine.lastbusy)
+			if idle <= f.maxidle {
+				return false
+			}
+			f.logger.With("type", engine.Type(), "pid", engine.PID()).
+				Infof("closing watch of socket-activated '%s' engine (PID %d) without containers for %s",
+					engine.Type(), engine.PID(), idle.Round(time.Second))
+			engine.Close()
+			for _, activator := range f.activators {
+				activator.idle(engine.Watcher, now)
+			}
+			idled = append(idled, engine)
+			return true
+		})
+		if len(engines) == 0 {
+			delete(f.engines, pid)
+			continue
+		}
+		f.engines[pid] = engines
+	}
+	return idled
+}
+
+// activatedEngine records the specified watcher of an engine activated via the
+// listening socket with the specified inode number, so that the engine can
+// later be idled.
+func (s *socketActivatorProcess) activatedEngine(ino uint64, w watcher.Watcher, names []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.activated == nil {
+		s.activated = map[uint64]activation{}
+	}
+	s.activated[ino] = activation{w: w, pid: model.PIDType(w.PID()), names: names}
+}
+
+// idle marks the engine with the specified watcher as idle since the specified
+// time, if it has been activated by this socket activator. The listening socket
+// of an idled engine stays observed, so that it doesn't get activated again in
+// the next update, until the socket activator spawns a new engine process
+// serving it, or the idled engine process fails to terminate.
+func (s *socketActivatorProcess) idle(w watcher.Watcher, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ino, a := range s.activated {
+		if a.w != w {
+			continue
+		}
+		delete(s.activated, ino)
+		if s.idled == nil {
+			s.idled = map[uint64]activation{}
+		}
+		a.since = now
+		s.idled[ino] = a
+		return
+	}
+}
+
+// wakeIdled looks for new engine processes serving the listening sockets of
+// idled engines, such as when the socket activator spawned a new engine process
+// after some other client connected. It also looks for idled engine processes
+// still alive at the specified time after the idledEngineGracePeriod. The
+// listening sockets of such woken up engines are then unobserved and the next
+// update rescans the listening sockets, so that the engine processes get
+// activated and watched again.
+func (s *socketActivatorProcess) wakeIdled(locator daemonLocator, now time.Time) {
+	s.mu.Lock()
+	idled := make(map[uint64]activation, len(s.idled))
+	for ino, a := range s.idled {
+		idled[ino] = a
+	}
+	s.mu.Unlock()
+	for ino, a := range idled {
+		for _, name := range a.names {
+			pid := locator.findDaemon(s.proc.PID, name, ino)
+			if pid == 0 {
+				continue
+			}
+			if pid == a.pid {
+				idle := now.Sub(a.since)
+				if idle <= idledEngineGracePeriod {
+					continue
+				}
+				s.logger.With("process", name, "pid", pid).
+					Infof("idled '%s' engine process (PID %d) of socket activator (PID %d) still alive after %s",
+						name, pid, s.proc.PID, idle.Round(time.Second))
+			} else {
+				s.logger.With("process", name, "pid", pid).
+					Infof("socket activator (PID %d) spawned new '%s' engine process (PID %d) for idled engine (PID %d)",
+						s.proc.PID, name, pid, a.pid)
+			}
+			s.mu.Lock()
+			delete(s.idled, ino)
+			delete(s.observed, ino)
+			s.hash = 0
+			s.mu.Unlock()
+			break
+		}
+	}
+}
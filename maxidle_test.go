@@ -0,0 +1,139 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"time"
+
+	"github.com/siemens/turtlefinder/detector"
+	"github.com/thediveo/lxkns/model"
+	"github.com/thediveo/whalewatcher"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("idle activated engines", func() {
+
+	It("stops watching activated engines without containers for too long", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx },
+			WithoutSocketActivators(),
+			WithActivatedEngineMaxIdle(time.Minute))
+		defer tf.Close()
+		Expect(tf.maxidle).To(Equal(time.Minute))
+
+		idled := &wormholeWatcher{idleWatcher: idleWatcher{ready: make(chan struct{})}, pid: 666}
+		tf.addActivatedEngine(idled, 666)
+		s := &socketActivatorProcess{proc: &model.Process{PID: 1}}
+		s.activatedEngine(123, idled, []string{"idled"})
+		tf.activators[1] = s
+
+		pf := whalewatcher.NewPortfolio()
+		pf.Add(&whalewatcher.Container{ID: "1234", Name: "canary", PID: 1234})
+		busy := NewEngine(ctx, &portfolioWatcher{idleWatcher: idleWatcher{ready: make(chan struct{})}, portfolio: pf}, 0)
+		busy.activated = true
+		tf.engines[42] = []*Engine{busy}
+
+		static := NewStaticEngine("static", "static", "unix:///static.sock", 43)
+		tf.engines[43] = []*Engine{static}
+
+		now := time.Now()
+		tf.mux.Lock()
+		tf.engines[666][0].lastbusy = now.Add(-2 * time.Minute)
+		Expect(tf.idleActivatedEngines(now)).To(ConsistOf(HaveField("Watcher", idled)))
+		tf.mux.Unlock()
+
+		Expect(idled.closed.Load()).To(BeTrue())
+		Expect(tf.engines).To(And(
+			HaveKey(model.PIDType(42)),
+			HaveKey(model.PIDType(43)),
+			Not(HaveKey(model.PIDType(666)))))
+		Expect(busy.lastbusy).To(Equal(now))
+		Expect(s.activated).To(BeEmpty())
+		Expect(s.idled).To(HaveKey(uint64(123)))
+		Expect(s.idled[123].pid).To(Equal(model.PIDType(666)))
+		Expect(s.idled[123].since).To(Equal(now))
+	})
+
+	It("retains idled activated engines", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx },
+			WithoutSocketActivators(),
+			WithActivatedEngineMaxIdle(time.Minute),
+			WithEngineRetention(time.Hour))
+		defer tf.Close()
+
+		idled := &wormholeWatcher{idleWatcher: idleWatcher{ready: make(chan struct{})}, pid: 666}
+		tf.addActivatedEngine(idled, 666)
+		tf.mux.Lock()
+		tf.engines[666][0].lastbusy = time.Now().Add(-2 * time.Minute)
+		tf.mux.Unlock()
+
+		tf.prune(model.ProcessTable{})
+		Expect(tf.engines).To(BeEmpty())
+		Expect(tf.EngineDetails()).To(ConsistOf(And(
+			HaveField("ID", "idle"),
+			HaveField("Inactive", true))))
+	})
+
+	It("keeps watching idle activated engines without a maximum idle time", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx }, WithoutSocketActivators())
+		defer tf.Close()
+		w := &wormholeWatcher{idleWatcher: idleWatcher{ready: make(chan struct{})}, pid: 666}
+		tf.addActivatedEngine(w, 666)
+
+		tf.mux.Lock()
+		tf.idleActivatedEngines(time.Now().Add(time.Hour))
+		tf.mux.Unlock()
+		Expect(w.closed.Load()).To(BeFalse())
+		Expect(tf.engines).To(HaveKey(model.PIDType(666)))
+	})
+
+	It("activates idled engines again when served by new engine processes", func(ctx context.Context) {
+		now := time.Now()
+		s := &socketActivatorProcess{
+			proc:     &model.Process{PID: 1},
+			logger:   detector.LoggerFrom(ctx),
+			observed: map[uint64]string{123: "/run/idled.sock"},
+			hash:     0x1234,
+			idled:    map[uint64]activation{123: {pid: 666, names: []string{"idled"}, since: now}},
+		}
+
+		s.wakeIdled(fixedDaemonLocator(0), now)
+		s.wakeIdled(fixedDaemonLocator(666), now)
+		Expect(s.idled).To(HaveKey(uint64(123)))
+		Expect(s.observed).To(HaveKey(uint64(123)))
+		Expect(s.hash).To(Equal(uint64(0x1234)))
+
+		s.wakeIdled(fixedDaemonLocator(667), now)
+		Expect(s.idled).To(BeEmpty())
+		Expect(s.observed).To(BeEmpty())
+		Expect(s.hash).To(BeZero())
+	})
+
+	It("activates idled engines again when still alive after the grace period", func(ctx context.Context) {
+		now := time.Now()
+		s := &socketActivatorProcess{
+			proc:     &model.Process{PID: 1},
+			logger:   detector.LoggerFrom(ctx),
+			observed: map[uint64]string{123: "/run/idled.sock"},
+			hash:     0x1234,
+			idled:    map[uint64]activation{123: {pid: 666, names: []string{"idled"}, since: now}},
+		}
+
+		s.wakeIdled(fixedDaemonLocator(666), now.Add(idledEngineGracePeriod))
+		Expect(s.idled).To(HaveKey(uint64(123)))
+		Expect(s.observed).To(HaveKey(uint64(123)))
+
+		s.wakeIdled(fixedDaemonLocator(0), now.Add(2*idledEngineGracePeriod))
+		Expect(s.idled).To(HaveKey(uint64(123)))
+
+		s.wakeIdled(fixedDaemonLocator(666), now.Add(2*idledEngineGracePeriod))
+		Expect(s.idled).To(BeEmpty())
+		Expect(s.observed).To(BeEmpty())
+		Expect(s.hash).To(BeZero())
+	})
+
+})
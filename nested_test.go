@@ -0,0 +1,125 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/siemens/turtlefinder/activator/podman"
+	"github.com/siemens/turtlefinder/internal/test"
+	"github.com/siemens/turtlefinder/matcher"
+	"github.com/thediveo/lxkns/discover"
+	"github.com/thediveo/lxkns/model"
+	"github.com/thediveo/morbyd"
+	"github.com/thediveo/morbyd/build"
+	"github.com/thediveo/morbyd/exec"
+	"github.com/thediveo/morbyd/run"
+	"github.com/thediveo/morbyd/session"
+	"github.com/thediveo/morbyd/timestamper"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+const (
+	rpindName      = "turtlefinder-rpind"
+	rpindImageName = "siemens/turtlefinder-rpind"
+
+	rootlessCanaryContainerName = "rootless-canary"
+
+	rootlessSpinupTimeout = 30 * time.Second
+)
+
+var _ = Describe("turtle finder with rootless podman in Docker", Ordered, Serial, func() {
+
+	var rpindCntr *morbyd.Container
+
+	BeforeAll(func(ctx context.Context) {
+		if os.Getuid() != 0 {
+			Skip("needs root")
+		}
+
+		By("creating a new Docker session for testing")
+		sess := Successful(morbyd.NewSession(ctx,
+			session.WithAutoCleaning("test.turtlefinder=turtlefinder-nested")))
+		DeferCleanup(func(ctx context.Context) {
+			By("auto-cleaning the session")
+			sess.Close(ctx)
+		})
+
+		By("spinning up a Docker container with a rootless podman service")
+		Expect(sess.BuildImage(ctx, "./_test/rpind",
+			build.WithTag(rpindImageName),
+			build.WithBuildArg("FEDORA_TAG="+fedoraTag),
+			build.WithOutput(timestamper.New(GinkgoWriter)))).
+			Error().NotTo(HaveOccurred())
+		rpindCntr = Successful(sess.Run(ctx, rpindImageName,
+			run.WithName(rpindName),
+			run.WithAutoRemove(),
+			run.WithPrivileged(),
+			run.WithSecurityOpt("label=disable"),
+			run.WithCgroupnsMode("private"),
+			run.WithVolume("/var"),
+			run.WithTmpfs("/tmp"),
+			run.WithTmpfs("/run"),
+			run.WithDevice("/dev/fuse"),
+			run.WithCombinedOutput(timestamper.New(GinkgoWriter))))
+	})
+
+	BeforeEach(clearCachedDetectorPlugins)
+
+	BeforeEach(test.LogToGinkgo)
+
+	It("finds rootless podman-in-docker and its workload", func(ctx context.Context) {
+		By("creating a new turtle finder")
+		ctx, cancel := context.WithCancel(ctx)
+		tf := New(func() context.Context { return ctx }, WithPIDTranslation())
+		defer cancel()
+		defer tf.Close()
+
+		containers := func() []*model.Container {
+			lxdisco := discover.Namespaces(discover.WithFullDiscovery())
+			return tf.Containers(ctx, lxdisco.Processes, lxdisco.PIDMap)
+		}
+
+		By("discovering the rootless podman engine nested in Docker")
+		Eventually(func() []*model.ContainerEngine {
+			_ = containers()
+			return tf.Engines()
+		}).Within(rootlessSpinupTimeout).ProbeEvery(spinupPolling).
+			Should(ContainElement(
+				HaveEngine(podman.Type, `^unix:///proc/\d+/root/run/user/1000/podman/podman.sock$`),
+			))
+
+		By("creating rootless podman workload")
+		pmCmd := Successful(rpindCntr.Exec(ctx,
+			exec.Command("podman", "run", "-d", "-it", "--rm",
+				"--name", rootlessCanaryContainerName, canaryImageRef),
+			exec.WithUser("turtle"),
+			exec.WithEnvVars("XDG_RUNTIME_DIR=/run/user/1000"),
+			exec.WithCombinedOutput(timestamper.New(GinkgoWriter))))
+		Expect(pmCmd.Wait(ctx)).To(BeZero())
+
+		By("discovering the rootless podman workload with host PIDs")
+		Eventually(containers).Within(rootlessSpinupTimeout).ProbeEvery(spinupPolling).
+			Should(ContainElement(And(
+				matcher.HaveContainerNameID(rootlessCanaryContainerName),
+				HaveField("Type", podman.Type),
+				HaveField("Labels", HaveKeyWithValue(
+					TurtlefinderContainerPrefixLabelName, rpindName)),
+			)))
+		for _, cntr := range containers() {
+			if cntr.Name != rootlessCanaryContainerName {
+				continue
+			}
+			Expect(model.NewProcess(cntr.PID, false)).NotTo(BeNil(),
+				"container PID %d isn't valid in the initial PID namespace", cntr.PID)
+		}
+	})
+
+})
@@ -0,0 +1,135 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/thediveo/lxkns/model"
+)
+
+// netUnixCache caches the listening unix domain sockets parsed from
+// “/proc/[PID]/net/unix” for the duration of a single update pass, so that
+// engine processes and socket activators sharing the same namespaces don't
+// cause the same socket list to be parsed over and over again. On hosts with
+// many engines in the same mount namespace this saves reading and parsing
+// (often large) socket lists.
+//
+// As the socket list shown to a process depends on the namespaces the process
+// is attached to, the cache is keyed on both the mount namespace and network
+// namespace identifiers of a process. Processes whose namespace identifiers
+// cannot be read don't use the cache at all.
+//
+// The cached socket maps are shared and thus must never be modified.
+//
+// Additionally, the cache lazily keeps the listening VM sockets for the
+// duration of an update pass, see [WithVsockDiscovery].
+type netUnixCache struct {
+	mu      sync.Mutex
+	entries map[netUnixKey]*netUnixEntry
+
+	vsockonce sync.Once
+	vsox      socketPathsByIno // listening VM sockets; nil if not available.
+}
+
+// vsockLister returns the listening VM sockets; tests might replace it with
+// their own fake lister.
+var vsockLister = listeningVsocks
+
+// netUnixKey identifies a particular combination of mount and network
+// namespaces by the “mnt:[...]” and “net:[...]” links of a process.
+type netUnixKey struct {
+	mntns string
+	netns string
+}
+
+// netUnixEntry is a single cached socket map, parsed only once even when
+// concurrently asked for. Failed reads aren't cached, so that another process
+// sharing the same namespaces gets its chance, such as when the first process
+// asked for has terminated in the meantime.
+type netUnixEntry struct {
+	mu   sync.Mutex
+	sox  socketPathsByIno
+	done bool // socket map successfully read.
+}
+
+// newNetUnixCache returns a new and empty net/unix cache.
+func newNetUnixCache() *netUnixCache {
+	return &netUnixCache{entries: map[netUnixKey]*netUnixEntry{}}
+}
+
+// listeningUDSVisibleToProcess returns the listening unix domain sockets
+// visible to the process with the specified PID, see also
+// [listeningUDSVisibleToProcess]. The socket map gets parsed only once for all
+// processes sharing the same namespaces. On a nil netUnixCache, the socket map
+// is always freshly parsed.
+func (c *netUnixCache) listeningUDSVisibleToProcess(procroot string, pid model.PIDType) socketPathsByIno {
+	sox, _ := c.listeningUDS(procroot, pid)
+	return sox
+}
+
+// listeningUDS works as [netUnixCache.listeningUDSVisibleToProcess], but
+// additionally returns the reason when the socket map cannot be read.
+func (c *netUnixCache) listeningUDS(procroot string, pid model.PIDType) (socketPathsByIno, error) {
+	if c == nil {
+		return readListeningUDS(procroot, pid)
+	}
+	nsbase := procroot + "/" + strconv.FormatUint(uint64(pid), 10) + "/ns/"
+	mntns, err := sockfs.Readlink(nsbase + "mnt")
+	if err != nil {
+		return readListeningUDS(procroot, pid)
+	}
+	netns, err := sockfs.Readlink(nsbase + "net")
+	if err != nil {
+		return readListeningUDS(procroot, pid)
+	}
+	key := netUnixKey{mntns: mntns, netns: netns}
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &netUnixEntry{}
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if !entry.done {
+		sox, err := readListeningUDS(procroot, pid)
+		if err != nil {
+			return sox, err // don't cache, but retry with the next process.
+		}
+		entry.sox, entry.done = sox, true
+	}
+	return entry.sox, nil
+}
+
+// listeningVsocks returns the listening VM sockets, querying the kernel only
+// once for all processes, as VM sockets aren't namespaced. On a nil
+// netUnixCache, the listening VM sockets are always freshly queried. If the
+// kernel cannot be queried, listeningVsocks returns nil.
+func (c *netUnixCache) listeningVsocks() socketPathsByIno {
+	if c == nil {
+		sox, _ := vsockLister()
+		return sox
+	}
+	c.vsockonce.Do(func() {
+		c.vsox, _ = vsockLister()
+	})
+	return c.vsox
+}
+
+// vsockEndpointsOfProcess returns the vsock API endpoints in the form of
+// “vsock://CID:PORT” of the listening VM sockets the process with the
+// specified PID has open.
+func vsockEndpointsOfProcess(procroot string, pid model.PIDType, netunix *netUnixCache) []string {
+	vsox := netunix.listeningVsocks()
+	if len(vsox) == 0 {
+		return nil
+	}
+	// While meant for unix domain sockets, this works equally well with our
+	// map of listening VM sockets.
+	return listeningUDSPathsOfProcess(procroot, pid, vsox)
+}
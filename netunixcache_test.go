@@ -0,0 +1,100 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing/fstest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// openCountingSockFS is a sockFS counting its net/unix opens.
+type openCountingSockFS struct {
+	sockFS
+	netunixopens atomic.Int32
+}
+
+func (c *openCountingSockFS) Open(name string) (io.ReadCloser, error) {
+	if strings.HasSuffix(name, "/net/unix") {
+		c.netunixopens.Add(1)
+	}
+	return c.sockFS.Open(name)
+}
+
+var _ = Describe("net/unix cache", func() {
+
+	var fsys *openCountingSockFS
+
+	BeforeEach(func() {
+		files := fstest.MapFS{}
+		for _, pid := range []string{"42", "43", "44", "45", "47"} {
+			files["proc/"+pid+"/net/unix"] = &fstest.MapFile{Data: []byte(fakeNetUnix)}
+		}
+		fsys = &openCountingSockFS{sockFS: &memSockFS{
+			files: files,
+			links: map[string]string{
+				"/proc/42/ns/mnt": "mnt:[4026531841]",
+				"/proc/42/ns/net": "net:[4026531840]",
+				"/proc/43/ns/mnt": "mnt:[4026531841]",
+				"/proc/43/ns/net": "net:[4026531840]",
+				"/proc/44/ns/mnt": "mnt:[4026531841]",
+				"/proc/44/ns/net": "net:[4026532666]",
+				// PID 45 has no readable namespace links.
+				// PID 46 has no readable net/unix, but shares its namespaces
+				// with PID 47.
+				"/proc/46/ns/mnt": "mnt:[4026532777]",
+				"/proc/46/ns/net": "net:[4026532778]",
+				"/proc/47/ns/mnt": "mnt:[4026532777]",
+				"/proc/47/ns/net": "net:[4026532778]",
+			},
+		}}
+		useSockFS(fsys)
+	})
+
+	It("parses net/unix only once per namespaces", func() {
+		netunix := newNetUnixCache()
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer GinkgoRecover()
+				Expect(netunix.listeningUDSVisibleToProcess("/proc", 42)).To(HaveLen(2))
+				Expect(netunix.listeningUDSVisibleToProcess("/proc", 43)).To(HaveLen(2))
+			}()
+		}
+		wg.Wait()
+		Expect(fsys.netunixopens.Load()).To(Equal(int32(1)))
+
+		Expect(netunix.listeningUDSVisibleToProcess("/proc", 44)).To(HaveLen(2))
+		Expect(fsys.netunixopens.Load()).To(Equal(int32(2)))
+
+		Expect(netunix.listeningUDSVisibleToProcess("/proc", 45)).To(HaveLen(2))
+		Expect(netunix.listeningUDSVisibleToProcess("/proc", 45)).To(HaveLen(2))
+		Expect(fsys.netunixopens.Load()).To(Equal(int32(4)))
+	})
+
+	It("doesn't cache failed reads", func() {
+		netunix := newNetUnixCache()
+		_, err := netunix.listeningUDS("/proc", 46)
+		Expect(err).To(HaveOccurred())
+		Expect(netunix.listeningUDSVisibleToProcess("/proc", 47)).To(HaveLen(2))
+		Expect(netunix.listeningUDSVisibleToProcess("/proc", 46)).To(HaveLen(2))
+		Expect(fsys.netunixopens.Load()).To(Equal(int32(2)))
+	})
+
+	It("doesn't cache when nil", func() {
+		var netunix *netUnixCache
+		Expect(netunix.listeningUDSVisibleToProcess("/proc", 42)).To(HaveLen(2))
+		Expect(netunix.listeningUDSVisibleToProcess("/proc", 42)).To(HaveLen(2))
+		Expect(fsys.netunixopens.Load()).To(Equal(int32(2)))
+	})
+
+})
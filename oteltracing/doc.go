@@ -0,0 +1,11 @@
+/*
+Package oteltracing adapts OpenTelemetry tracers for use with a turtlefinder,
+so that container discoveries get traced.
+
+	tf := turtlefinder.New(func() context.Context { return enginectx },
+		turtlefinder.WithTracer(oteltracing.New(otel.Tracer("turtlefinder"))))
+
+Keeping this adapter in its own package ensures that turtlefinder users not
+interested in tracing don't pull in any OpenTelemetry dependencies.
+*/
+package oteltracing
@@ -0,0 +1,78 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package oteltracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/siemens/turtlefinder"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// New returns a [turtlefinder.Tracer] creating its spans using the specified
+// OpenTelemetry tracer.
+func New(tracer trace.Tracer) turtlefinder.Tracer {
+	return &otelTracer{tracer: tracer}
+}
+
+// otelTracer adapts an OpenTelemetry tracer to a turtlefinder.Tracer.
+type otelTracer struct {
+	tracer trace.Tracer
+}
+
+var _ turtlefinder.Tracer = (*otelTracer)(nil)
+
+// Start a new span with the specified name and optional attributes in the form
+// of key-value pairs.
+func (t *otelTracer) Start(ctx context.Context, name string, kv ...any) (context.Context, turtlefinder.Span) {
+	ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(attributes(kv)...))
+	return ctx, &otelSpan{span: span}
+}
+
+// otelSpan adapts an OpenTelemetry span to a turtlefinder.Span.
+type otelSpan struct {
+	span trace.Span
+}
+
+var _ turtlefinder.Span = (*otelSpan)(nil)
+
+// SetAttributes sets the specified attributes in the form of key-value pairs.
+func (s *otelSpan) SetAttributes(kv ...any) {
+	s.span.SetAttributes(attributes(kv)...)
+}
+
+// End the span.
+func (s *otelSpan) End() {
+	s.span.End()
+}
+
+// attributes returns the OpenTelemetry attributes for the specified key-value
+// pairs. A trailing key without value is ignored. Values of types without a
+// direct OpenTelemetry attribute type counterpart are formatted as strings.
+func attributes(kv []any) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(kv)/2)
+	for idx := 0; idx+1 < len(kv); idx += 2 {
+		key := fmt.Sprint(kv[idx])
+		switch value := kv[idx+1].(type) {
+		case string:
+			attrs = append(attrs, attribute.String(key, value))
+		case int:
+			attrs = append(attrs, attribute.Int(key, value))
+		case int64:
+			attrs = append(attrs, attribute.Int64(key, value))
+		case bool:
+			attrs = append(attrs, attribute.Bool(key, value))
+		case float64:
+			attrs = append(attrs, attribute.Float64(key, value))
+		case []string:
+			attrs = append(attrs, attribute.StringSlice(key, value))
+		default:
+			attrs = append(attrs, attribute.String(key, fmt.Sprint(value)))
+		}
+	}
+	return attrs
+}
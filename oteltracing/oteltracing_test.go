@@ -0,0 +1,62 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package oteltracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OpenTelemetry tracing", func() {
+
+	It("converts key-value pairs into attributes", func() {
+		Expect(attributes([]any{
+			"s", "foo",
+			"i", 42,
+			"i64", int64(666),
+			"b", true,
+			"f", 1.5,
+			"ss", []string{"a", "b"},
+			"u", uint(7),
+			"dangling",
+		})).To(HaveExactElements(
+			attribute.String("s", "foo"),
+			attribute.Int("i", 42),
+			attribute.Int64("i64", 666),
+			attribute.Bool("b", true),
+			attribute.Float64("f", 1.5),
+			attribute.StringSlice("ss", []string{"a", "b"}),
+			attribute.String("u", "7"),
+		))
+	})
+
+	It("records spans with attributes", func(ctx context.Context) {
+		recorder := tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		defer func() { _ = provider.Shutdown(context.Background()) }()
+
+		tracer := New(provider.Tracer("test"))
+		parentctx, parent := tracer.Start(ctx, "parent", "foo", "bar")
+		_, child := tracer.Start(parentctx, "child")
+		child.SetAttributes("count", 42)
+		child.End()
+		parent.End()
+
+		spans := recorder.Ended()
+		Expect(spans).To(HaveLen(2))
+		Expect(spans[0].Name()).To(Equal("child"))
+		Expect(spans[0].Attributes()).To(ConsistOf(attribute.Int("count", 42)))
+		Expect(spans[0].Parent().SpanID()).To(Equal(spans[1].SpanContext().SpanID()))
+		Expect(spans[1].Name()).To(Equal("parent"))
+		Expect(spans[1].Attributes()).To(ConsistOf(attribute.String("foo", "bar")))
+	})
+
+})
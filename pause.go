@@ -0,0 +1,34 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+// Pause pauses the discovery of new container engines and socket activators,
+// while engines already under watch continue to be queried by
+// [TurtleFinder.Containers] and engines that have terminated still get pruned.
+// As a paused TurtleFinder doesn't create new workload watchers, it doesn't
+// keep socket-activated engines alive, so these can go idle and terminate,
+// such as during maintenance windows. Pause is idempotent.
+func (f *TurtleFinder) Pause() {
+	if f.paused.Swap(true) {
+		return
+	}
+	f.logger.Infof("pausing container engine discovery")
+}
+
+// Resume resumes the discovery of new container engines and socket activators
+// after an earlier [TurtleFinder.Pause], starting with the next update pass.
+// Resume is idempotent.
+func (f *TurtleFinder) Resume() {
+	if !f.paused.Swap(false) {
+		return
+	}
+	f.logger.Infof("resuming container engine discovery")
+}
+
+// Paused returns true if the discovery of new container engines and socket
+// activators is currently paused, see also [TurtleFinder.Pause].
+func (f *TurtleFinder) Paused() bool {
+	return f.paused.Load()
+}
@@ -0,0 +1,53 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"net"
+	"os"
+	"time"
+
+	"github.com/thediveo/lxkns/model"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("pausing discovery", func() {
+
+	It("doesn't discover new engines while paused", func(ctx context.Context) {
+		canarysockpath := GinkgoT().TempDir() + "/canary.sock"
+		lsock := Successful(net.Listen("unix", canarysockpath))
+		defer lsock.Close()
+
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "acceptd"}}
+		procs := model.ProcessTable{self.PID: self}
+		d := &acceptingDetector{}
+		tf := New(func() context.Context { return ctx }, WithGettingOnlineWait(100*time.Millisecond))
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "acceptd"}}
+
+		Expect(tf.Paused()).To(BeFalse())
+		tf.Pause()
+		tf.Pause()
+		Expect(tf.Paused()).To(BeTrue())
+		_ = tf.Containers(ctx, procs, nil)
+		Expect(tf.WaitForInitialDiscovery(ctx)).To(Succeed())
+		Expect(tf.Engines()).To(BeEmpty())
+
+		tf.Resume()
+		Expect(tf.Paused()).To(BeFalse())
+		_ = tf.Containers(ctx, procs, nil)
+		Expect(tf.Engines()).To(HaveLen(1))
+
+		tf.Pause()
+		_ = tf.Containers(ctx, procs, nil)
+		Expect(tf.Engines()).To(HaveLen(1), "paused discovery must keep existing engines")
+	})
+
+})
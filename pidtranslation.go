@@ -0,0 +1,115 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+
+	"github.com/thediveo/lxkns/model"
+)
+
+// translatePIDs translates the PIDs of the specified containers of the
+// specified engine from the engine's PID namespace into the initial PID
+// namespace, using the supplied PID mapper, in the same way as lxkns does. The
+// engine's PID namespace is determined from the engine process in the
+// specified process table or, if not found, from the proc filesystem mounted
+// at procroot, or finally from the engine's parent process hint (in case of
+// recently socket-activated engines). If the engine's PID namespace cannot be
+// determined, nothing gets translated.
+//
+// Please note that the engine's PID already is a PID from the process table,
+// so it must not be translated.
+func translatePIDs(
+	engine *Engine, containers []*model.Container, procs model.ProcessTable, pidmap model.PIDMapper,
+	procroot string,
+) {
+	if pidmap == nil || len(containers) == 0 {
+		return
+	}
+	enginepidns := enginePIDNamespace(engine, procs, procroot)
+	if enginepidns == nil {
+		return
+	}
+	initialpidns := initialPIDNamespace(enginepidns)
+	if enginepidns == initialpidns {
+		return
+	}
+	for _, container := range containers {
+		if pid := pidmap.Translate(container.PID, enginepidns, initialpidns); pid != 0 {
+			container.PID = pid
+		}
+	}
+}
+
+// enginePIDNamespace returns the PID namespace of the specified engine, or nil
+// if unknown. For socket-activated engines not yet present in the process
+// table, enginePIDNamespace looks up the engine's PID namespace in the proc
+// filesystem mounted at procroot, and then finds this PID namespace in the
+// process table. This covers socket-activated engines nested several
+// namespaces deep, such as rootless podman in a container, where the engine's
+// parent process is also too new to be found in the process table. Only as the
+// last resort, enginePIDNamespace falls back to the PID namespace of the
+// engine's parent process, if known.
+func enginePIDNamespace(engine *Engine, procs model.ProcessTable, procroot string) model.Namespace {
+	if proc, ok := procs[model.PIDType(engine.PID())]; ok {
+		return proc.Namespaces[model.PIDNS]
+	}
+	if procroot != "" {
+		if pidns := pidNamespaceOfProcess(procroot, model.PIDType(engine.PID()), procs); pidns != nil {
+			return pidns
+		}
+	}
+	if engine.PPIDHint != 0 {
+		if proc, ok := procs[engine.PPIDHint]; ok {
+			return proc.Namespaces[model.PIDNS]
+		}
+	}
+	return nil
+}
+
+// pidNamespaceOfProcess returns the PID namespace of the process with the
+// specified PID, as determined from the proc filesystem mounted at procroot,
+// or nil if unknown. As we need to return a PID namespace object from the
+// discovery, the PID namespace is looked up using the processes in the
+// specified process table.
+func pidNamespaceOfProcess(procroot string, pid model.PIDType, procs model.ProcessTable) model.Namespace {
+	if pid <= 0 {
+		return nil
+	}
+	info, err := os.Stat(procroot + "/" + strconv.FormatUint(uint64(pid), 10) + "/ns/pid")
+	if err != nil {
+		return nil
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	for _, proc := range procs {
+		if pidns := proc.Namespaces[model.PIDNS]; pidns != nil && pidns.ID().Ino == stat.Ino {
+			return pidns
+		}
+	}
+	return nil
+}
+
+// initialPIDNamespace returns the initial PID namespace, that is, the root of
+// the PID namespace hierarchy the specified PID namespace belongs to. If the
+// parents of the specified PID namespace are inaccessible, the topmost
+// accessible PID namespace is returned instead.
+func initialPIDNamespace(pidns model.Namespace) model.Namespace {
+	for {
+		hierarchy, ok := pidns.(model.Hierarchy)
+		if !ok {
+			return pidns
+		}
+		parent, ok := hierarchy.Parent().(model.Namespace)
+		if !ok || parent == nil {
+			return pidns
+		}
+		pidns = parent
+	}
+}
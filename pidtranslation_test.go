@@ -0,0 +1,155 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/thediveo/lxkns/model"
+	"github.com/thediveo/lxkns/species"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+// fakePIDNamespace is a stub PID namespace that only knows about its parent PID
+// namespace.
+type fakePIDNamespace struct {
+	model.Namespace
+	parent *fakePIDNamespace
+}
+
+func (ns *fakePIDNamespace) Parent() model.Hierarchy {
+	if ns.parent == nil {
+		return nil
+	}
+	return ns.parent
+}
+
+func (ns *fakePIDNamespace) Children() []model.Hierarchy { return nil }
+
+// identifiedPIDNamespace is a stub PID namespace with an ID.
+type identifiedPIDNamespace struct {
+	*fakePIDNamespace
+	id species.NamespaceID
+}
+
+func (ns *identifiedPIDNamespace) ID() species.NamespaceID { return ns.id }
+
+// fakePIDMap is a stub PID mapper translating PIDs from a single child PID
+// namespace into its parent PID namespace.
+type fakePIDMap struct {
+	from, to model.Namespace
+	pids     map[model.PIDType]model.PIDType
+}
+
+func (m *fakePIDMap) Translate(pid model.PIDType, from model.Namespace, to model.Namespace) model.PIDType {
+	if from != m.from || to != m.to {
+		return 0
+	}
+	return m.pids[pid]
+}
+
+func (m *fakePIDMap) NamespacedPIDs(pid model.PIDType, from model.Namespace) model.NamespacedPIDs {
+	return nil
+}
+
+var _ = Describe("PID translation", func() {
+
+	initialpidns := &fakePIDNamespace{}
+	sidecarpidns := &fakePIDNamespace{parent: initialpidns}
+	pidmap := &fakePIDMap{
+		from: sidecarpidns,
+		to:   initialpidns,
+		pids: map[model.PIDType]model.PIDType{7: 42, 666: 1666},
+	}
+
+	newContainers := func(engine *Engine) []*model.Container {
+		eng := &model.ContainerEngine{
+			PID:      model.PIDType(engine.PID()),
+			PPIDHint: engine.PPIDHint,
+		}
+		eng.AddContainer(&model.Container{Name: "foo", PID: 666})
+		eng.AddContainer(&model.Container{Name: "bar", PID: 777})
+		return eng.Containers
+	}
+
+	It("finds the initial PID namespace", func() {
+		Expect(initialPIDNamespace(initialpidns)).To(BeIdenticalTo(initialpidns))
+		Expect(initialPIDNamespace(sidecarpidns)).To(BeIdenticalTo(initialpidns))
+	})
+
+	It("translates only container PIDs", func() {
+		engine := &Engine{Watcher: &pidWatcher{pid: 42}}
+		procs := model.ProcessTable{
+			42: &model.Process{PID: 42, ProTaskCommon: model.ProTaskCommon{Namespaces: model.NamespacesSet{model.PIDNS: sidecarpidns}}},
+		}
+		containers := newContainers(engine)
+		translatePIDs(engine, containers, procs, pidmap, "")
+		Expect(containers).To(ConsistOf(
+			And(HaveField("Name", "foo"), HaveField("PID", model.PIDType(1666))),
+			And(HaveField("Name", "bar"), HaveField("PID", model.PIDType(777))),
+		))
+		Expect(containers[0].Engine.PID).To(Equal(model.PIDType(42)))
+	})
+
+	It("translates using the parent process hint", func() {
+		engine := &Engine{Watcher: &pidWatcher{pid: 42}, PPIDHint: 1}
+		procs := model.ProcessTable{
+			1: &model.Process{PID: 1, ProTaskCommon: model.ProTaskCommon{Namespaces: model.NamespacesSet{model.PIDNS: sidecarpidns}}},
+		}
+		containers := newContainers(engine)
+		translatePIDs(engine, containers, procs, pidmap, "")
+		Expect(containers[0].Engine.PID).To(Equal(model.PIDType(42)))
+		Expect(containers[0].Engine.PPIDHint).To(Equal(model.PIDType(1)))
+		Expect(containers).To(ContainElement(HaveField("PID", model.PIDType(1666))))
+	})
+
+	It("translates using the proc filesystem for engines missing from the process table", func() {
+		info := Successful(os.Stat("/proc/self/ns/pid"))
+		nestedpidns := &identifiedPIDNamespace{
+			fakePIDNamespace: &fakePIDNamespace{parent: initialpidns},
+			id:               species.NamespaceIDfromInode(info.Sys().(*syscall.Stat_t).Ino),
+		}
+		self := model.PIDType(os.Getpid())
+		nestedpidmap := &fakePIDMap{
+			from: nestedpidns,
+			to:   initialpidns,
+			pids: map[model.PIDType]model.PIDType{666: 1666},
+		}
+		engine := &Engine{Watcher: &pidWatcher{pid: int(self)}}
+		procs := model.ProcessTable{
+			1: &model.Process{PID: 1, ProTaskCommon: model.ProTaskCommon{Namespaces: model.NamespacesSet{model.PIDNS: nestedpidns}}},
+		}
+		containers := newContainers(engine)
+		translatePIDs(engine, containers, procs, nestedpidmap, "")
+		Expect(containers).To(ContainElement(HaveField("PID", model.PIDType(666))))
+
+		translatePIDs(engine, containers, procs, nestedpidmap, defaultProcRoot)
+		Expect(containers).To(ContainElement(HaveField("PID", model.PIDType(1666))))
+		Expect(containers[0].Engine.PID).To(Equal(self))
+	})
+
+	It("doesn't translate PIDs already in the initial PID namespace", func() {
+		engine := &Engine{Watcher: &pidWatcher{pid: 42}}
+		procs := model.ProcessTable{
+			42: &model.Process{PID: 42, ProTaskCommon: model.ProTaskCommon{Namespaces: model.NamespacesSet{model.PIDNS: initialpidns}}},
+		}
+		containers := newContainers(engine)
+		translatePIDs(engine, containers, procs, pidmap, "")
+		Expect(containers).To(ContainElement(HaveField("PID", model.PIDType(666))))
+	})
+
+	It("leaves PIDs alone when the engine's PID namespace is unknown", func() {
+		engine := &Engine{Watcher: &pidWatcher{pid: 42}}
+		containers := newContainers(engine)
+		translatePIDs(engine, containers, model.ProcessTable{}, pidmap, "")
+		translatePIDs(engine, containers, nil, nil, "")
+		Expect(containers).To(ContainElement(HaveField("PID", model.PIDType(666))))
+	})
+
+})
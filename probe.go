@@ -0,0 +1,44 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"github.com/siemens/turtlefinder/detector"
+	"github.com/thediveo/lxkns/model"
+)
+
+// DiscoveredEngine describes a potential container engine process together
+// with the API endpoints it might be reached at.
+type DiscoveredEngine struct {
+	Type string        // name of the engine detector plugin responsible, such as "dockerd".
+	PID  model.PIDType // PID of the container engine process.
+	APIs []string      // candidate API endpoint paths, accessible via procfs wormholes.
+}
+
+// ProbeEngines returns an inventory of the container engines present in the
+// specified process table, based on the process names known to the engine
+// detector plugins and the listening unix domain sockets of the matching
+// processes. In contrast to [TurtleFinder.Containers], ProbeEngines neither
+// contacts the container engines nor creates any workload watchers, so it is a
+// cheap and side-effect free snapshot suitable for diagnostic purposes.
+//
+// Please note that the engines returned are only candidates, as ProbeEngines
+// doesn't check that the API endpoints found actually work.
+func ProbeEngines(procs model.ProcessTable) []DiscoveredEngine {
+	engineprocs := engineProcesses(procs, newEnginePlugins(), defaultProcRoot)
+	engines := make([]DiscoveredEngine, 0, len(engineprocs))
+	for _, engineproc := range engineprocs {
+		apisox, _ := apiEndpointsOfProcess(defaultProcRoot, engineproc.proc.PID, nil, nil, detector.NewLogger(nil))
+		if apisox == nil {
+			continue
+		}
+		engines = append(engines, DiscoveredEngine{
+			Type: engineproc.engine.pluginname,
+			PID:  engineproc.proc.PID,
+			APIs: apisox,
+		})
+	}
+	return engines
+}
@@ -0,0 +1,45 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/thediveo/lxkns/model"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("probing engines", func() {
+
+	It("returns candidate engines and their API endpoints", func() {
+		fakesockdir := Successful(os.MkdirTemp("", "fakesock-*"))
+		defer os.RemoveAll(fakesockdir)
+		canarysockpath := fakesockdir + "/canary.sock"
+		lsock := Successful(net.Listen("unix", canarysockpath))
+		defer lsock.Close()
+
+		By("pretending to be a Docker demon")
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "dockerd"}}
+		other := &model.Process{PID: model.PIDType(os.Getppid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "duhkr"}}
+		engines := ProbeEngines(model.ProcessTable{
+			self.PID:  self,
+			other.PID: other,
+		})
+		Expect(engines).To(ConsistOf(And(
+			HaveField("Type", "dockerd"),
+			HaveField("PID", self.PID),
+			HaveField("APIs", ContainElement(
+				"/proc/"+strconv.Itoa(os.Getpid())+"/root"+canarysockpath)),
+		)))
+	})
+
+})
@@ -0,0 +1,92 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"sync"
+
+	"github.com/thediveo/lxkns/model"
+)
+
+// rejectedProcess identifies a process that has already been found to be
+// neither a container engine nor a socket activator. As PIDs get reused, we
+// additionally need the process start time to tell apart different processes
+// with the same PID. The process name is needed as a process might well
+// execute a container engine binary later, such as a container entry point
+// script that finally execs into the engine (keeping its PID and start time).
+type rejectedProcess struct {
+	starttime uint64
+	name      string
+}
+
+// rejectedProcessCache caches the processes already found not to be of any
+// interest to us, so that we don't need to examine them over and over again in
+// each discovery, as long as they don't change.
+type rejectedProcessCache struct {
+	mu       sync.Mutex
+	rejected map[model.PIDType]rejectedProcess
+}
+
+// candidates returns those processes from the specified process table that are
+// potential container engines or socket activators, as decided by the
+// specified candidate function. Processes rejected by the candidate function
+// are cached so that they won't be examined again as long as they don't exit
+// or change.
+func (c *rejectedProcessCache) candidates(
+	procs model.ProcessTable,
+	candidate func(proc *model.Process) bool,
+) model.ProcessTable {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rejected == nil {
+		c.rejected = map[model.PIDType]rejectedProcess{}
+	}
+	candidates := model.ProcessTable{}
+	for pid, proc := range procs {
+		if rejected, ok := c.rejected[pid]; ok &&
+			rejected.starttime == proc.Starttime && rejected.name == proc.Name {
+			continue
+		}
+		if candidate(proc) {
+			delete(c.rejected, pid)
+			candidates[pid] = proc
+			continue
+		}
+		c.rejected[pid] = rejectedProcess{
+			starttime: proc.Starttime,
+			name:      proc.Name,
+		}
+	}
+	return candidates
+}
+
+// reject caches the specified process as not being of any interest to us, even
+// if it is a potential container engine or socket activator, such as when all
+// watchers for a container engine process have been filtered out. As long as
+// the process doesn't change, it won't be examined again.
+func (c *rejectedProcessCache) reject(proc *model.Process) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rejected == nil {
+		c.rejected = map[model.PIDType]rejectedProcess{}
+	}
+	c.rejected[proc.PID] = rejectedProcess{
+		starttime: proc.Starttime,
+		name:      proc.Name,
+	}
+}
+
+// prune removes cached processes that either have vanished or where their PIDs
+// have been reused in the meantime.
+func (c *rejectedProcessCache) prune(procs model.ProcessTable) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for pid, rejected := range c.rejected {
+		if proc := procs[pid]; proc != nil && proc.Starttime == rejected.starttime {
+			continue
+		}
+		delete(c.rejected, pid)
+	}
+}
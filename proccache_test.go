@@ -0,0 +1,78 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"github.com/thediveo/lxkns/model"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func newProc(pid model.PIDType, name string, starttime uint64) *model.Process {
+	return &model.Process{
+		PID:           pid,
+		ProTaskCommon: model.ProTaskCommon{Name: name, Starttime: starttime},
+	}
+}
+
+var _ = Describe("rejected process cache", func() {
+
+	var examined []model.PIDType
+	isDockerd := func(proc *model.Process) bool {
+		examined = append(examined, proc.PID)
+		return proc.Name == "dockerd"
+	}
+
+	BeforeEach(func() {
+		examined = nil
+	})
+
+	It("examines rejected processes only once", func() {
+		var c rejectedProcessCache
+		procs := model.ProcessTable{
+			1:  newProc(1, "init", 1),
+			42: newProc(42, "dockerd", 100),
+		}
+		Expect(c.candidates(procs, isDockerd)).To(ConsistOf(procs[42]))
+		Expect(examined).To(ConsistOf(model.PIDType(1), model.PIDType(42)))
+
+		examined = nil
+		Expect(c.candidates(procs, isDockerd)).To(ConsistOf(procs[42]))
+		Expect(examined).To(ConsistOf(model.PIDType(42)))
+	})
+
+	It("re-examines reused PIDs and exec'ed processes", func() {
+		var c rejectedProcessCache
+		procs := model.ProcessTable{
+			42:  newProc(42, "sh", 100),
+			666: newProc(666, "sh", 100),
+		}
+		Expect(c.candidates(procs, isDockerd)).To(BeEmpty())
+
+		examined = nil
+		procs[42] = newProc(42, "sh", 200)
+		procs[666] = newProc(666, "dockerd", 100)
+		Expect(c.candidates(procs, isDockerd)).To(ConsistOf(procs[666]))
+		Expect(examined).To(ConsistOf(model.PIDType(42), model.PIDType(666)))
+	})
+
+	It("prunes vanished and reused processes", func() {
+		var c rejectedProcessCache
+		procs := model.ProcessTable{
+			1:  newProc(1, "init", 1),
+			42: newProc(42, "sh", 100),
+			43: newProc(43, "sh", 100),
+		}
+		Expect(c.candidates(procs, isDockerd)).To(BeEmpty())
+		Expect(c.rejected).To(HaveLen(3))
+		delete(procs, 42)
+		procs[43] = newProc(43, "sh", 200)
+		c.prune(procs)
+		Expect(c.rejected).To(HaveLen(1))
+		Expect(c.rejected).To(HaveKey(model.PIDType(1)))
+	})
+
+})
@@ -0,0 +1,76 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"sync"
+	"time"
+)
+
+// retainedEngines keeps track of recently terminated engines for a grace
+// period, see also [WithEngineRetention].
+type retainedEngines struct {
+	mu      sync.Mutex
+	engines map[string]*EngineDetails // by engine identity.
+}
+
+// engineIdentity returns the identity of the specified engine details in terms
+// of the engine type and ID, so that a restarted engine can be recognized. For
+// engines without an ID, the API endpoint is used instead.
+func engineIdentity(details *EngineDetails) string {
+	if details.ID == "" {
+		return details.Type + "\x00\x00" + details.API
+	}
+	return details.Type + "\x00" + details.ID
+}
+
+// retain the specified terminated engine, flagging it as inactive. If the
+// engine is already being retained, its original gone timestamp is kept, unless
+// the specified engine has been seen only after the retained one was gone, that
+// is, it has been restarted in the meantime.
+func (r *retainedEngines) retain(details *EngineDetails, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.engines == nil {
+		r.engines = map[string]*EngineDetails{}
+	}
+	identity := engineIdentity(details)
+	if retained, ok := r.engines[identity]; ok && !retained.GoneSince.Before(details.FirstSeen) {
+		return
+	}
+	details.Inactive = true
+	details.GoneSince = now
+	r.engines[identity] = details
+}
+
+// revive removes the retained engine with the same identity as the specified
+// engine, as the engine has reappeared.
+func (r *retainedEngines) revive(details *EngineDetails) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.engines, engineIdentity(details))
+}
+
+// list returns the retained engines that haven't yet expired at the specified
+// time, given the specified retention. Expired engines get removed. Engines
+// with identities in the specified set of active engine identities are
+// skipped.
+func (r *retainedEngines) list(now time.Time, retention time.Duration, active map[string]struct{}) []*EngineDetails {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	engines := make([]*EngineDetails, 0, len(r.engines))
+	for identity, details := range r.engines {
+		if now.Sub(details.GoneSince) > retention {
+			delete(r.engines, identity)
+			continue
+		}
+		if _, ok := active[identity]; ok {
+			continue
+		}
+		clone := *details
+		engines = append(engines, &clone)
+	}
+	return engines
+}
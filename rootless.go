@@ -0,0 +1,93 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/thediveo/lxkns/model"
+	"github.com/thediveo/procfsroot"
+)
+
+// rootlesskitProcessName is the process name of RootlessKit, which rootless
+// Docker uses to run the dockerd engine process inside its own user, mount,
+// and network namespaces.
+const rootlesskitProcessName = "rootlesskit"
+
+// maxRootlesskitHops is the maximum number of generations between a rootless
+// engine process and its RootlessKit process. Rootless Docker's process tree
+// is “rootlesskit” → RootlessKit's child “exe” → “dockerd”. We deliberately
+// don't climb further, as otherwise an engine running in a container of a
+// rootless engine would be mistaken as being rootless itself.
+const maxRootlesskitHops = 2
+
+// rootlesskitOf returns the RootlessKit process the specified engine process
+// runs under, or nil if the engine process isn't a rootless engine. If the
+// process objects aren't linked to their parents, rootlesskitOf falls back to
+// looking up parents in the specified process table.
+func rootlesskitOf(proc *model.Process, procs model.ProcessTable) *model.Process {
+	for hop := 0; proc != nil && hop < maxRootlesskitHops; hop++ {
+		parent := proc.Parent
+		if parent == nil {
+			parent = procs[proc.PPID]
+		}
+		if parent == nil || parent == proc {
+			return nil
+		}
+		if parent.Name == rootlesskitProcessName {
+			return parent
+		}
+		proc = parent
+	}
+	return nil
+}
+
+// rootlessAPIEndpoints translates the API endpoints of a rootless engine
+// process with PID enginepid so that they are accessed via the procfs wormhole
+// of its RootlessKit process with PID kitpid instead. The API endpoints apis
+// have already been resolved via the engine's procfs wormhole, while the
+// socket paths in unresolved couldn't be resolved in the engine's context.
+//
+// Rootless Docker's dockerd creates its API socket, such as
+// “/run/user/1000/docker.sock”, inside RootlessKit's mount namespace, while
+// the socket is visible to the host side at the same path via RootlessKit.
+// API endpoints not reachable via RootlessKit are kept as they are and socket
+// paths that cannot be resolved via RootlessKit either are returned in
+// unresolved.
+func rootlessAPIEndpoints(
+	procroot string, enginepid model.PIDType, kitpid model.PIDType,
+	apis []string, unresolved []string,
+) ([]string, []string) {
+	enginewormhole := procroot + "/" + strconv.FormatUint(uint64(enginepid), 10) + "/root"
+	kitwormhole := procroot + "/" + strconv.FormatUint(uint64(kitpid), 10) + "/root"
+	translated := make([]string, 0, len(apis)+len(unresolved))
+	for _, api := range apis {
+		apipath, ok := strings.CutPrefix(api, enginewormhole)
+		if !ok {
+			translated = append(translated, api)
+			continue
+		}
+		evalpath, err := procfsroot.EvalSymlinks(apipath, kitwormhole, procfsroot.EvalFullPath)
+		if err != nil {
+			translated = append(translated, api)
+			continue
+		}
+		translated = append(translated, kitwormhole+evalpath)
+	}
+	var stillunresolved []string
+	for _, apipath := range unresolved {
+		evalpath, err := procfsroot.EvalSymlinks(apipath, kitwormhole, procfsroot.EvalFullPath)
+		if err != nil {
+			stillunresolved = append(stillunresolved, apipath)
+			continue
+		}
+		translated = append(translated, kitwormhole+evalpath)
+	}
+	if len(translated) == 0 {
+		return nil, stillunresolved
+	}
+	return uniqueSocketPaths(translated), stillunresolved
+}
@@ -0,0 +1,74 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/thediveo/lxkns/model"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("rootless engines", func() {
+
+	It("finds the rootlesskit process of a rootless engine", func() {
+		kit := &model.Process{PID: 100, PPID: 1, ProTaskCommon: model.ProTaskCommon{Name: "rootlesskit"}}
+		kitchild := &model.Process{PID: 101, PPID: 100, ProTaskCommon: model.ProTaskCommon{Name: "exe"}}
+		dockerd := &model.Process{PID: 102, PPID: 101, ProTaskCommon: model.ProTaskCommon{Name: "dockerd"}}
+		container := &model.Process{PID: 103, PPID: 102, ProTaskCommon: model.ProTaskCommon{Name: "containerd-shim"}}
+		nested := &model.Process{PID: 104, PPID: 103, ProTaskCommon: model.ProTaskCommon{Name: "dockerd"}}
+		procs := model.ProcessTable{}
+		for _, proc := range []*model.Process{kit, kitchild, dockerd, container, nested} {
+			procs[proc.PID] = proc
+		}
+
+		Expect(rootlesskitOf(dockerd, procs)).To(BeIdenticalTo(kit))
+		Expect(rootlesskitOf(kitchild, procs)).To(BeIdenticalTo(kit))
+		Expect(rootlesskitOf(kit, procs)).To(BeNil())
+		Expect(rootlesskitOf(nested, procs)).To(BeNil())
+		Expect(rootlesskitOf(nil, procs)).To(BeNil())
+
+		dockerd.Parent = kitchild
+		kitchild.Parent = kit
+		Expect(rootlesskitOf(dockerd, model.ProcessTable{})).To(BeIdenticalTo(kit))
+	})
+
+	It("resolves API endpoints via the rootlesskit procfs wormhole", func() {
+		procroot := GinkgoT().TempDir()
+		touch := func(path string) {
+			GinkgoHelper()
+			Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+			Expect(os.WriteFile(path, nil, 0644)).To(Succeed())
+		}
+		enginewormhole := filepath.Join(procroot, "42", "root")
+		kitwormhole := filepath.Join(procroot, "41", "root")
+		touch(filepath.Join(enginewormhole, "run/user/1000/docker.sock"))
+		touch(filepath.Join(enginewormhole, "run/docker/inner.sock"))
+		touch(filepath.Join(kitwormhole, "run/user/1000/docker.sock"))
+		touch(filepath.Join(kitwormhole, "run/user/1000/other.sock"))
+
+		apis, unresolved := rootlessAPIEndpoints(procroot, 42, 41,
+			[]string{
+				enginewormhole + "/run/user/1000/docker.sock",
+				enginewormhole + "/run/docker/inner.sock",
+			},
+			[]string{"/run/user/1000/other.sock", "/run/user/1000/gone.sock"})
+		Expect(apis).To(ConsistOf(
+			kitwormhole+"/run/user/1000/docker.sock",
+			enginewormhole+"/run/docker/inner.sock",
+			kitwormhole+"/run/user/1000/other.sock",
+		))
+		Expect(unresolved).To(ConsistOf("/run/user/1000/gone.sock"))
+
+		apis, unresolved = rootlessAPIEndpoints(procroot, 42, 41,
+			nil, []string{"/run/user/1000/gone.sock"})
+		Expect(apis).To(BeNil())
+		Expect(unresolved).To(ConsistOf("/run/user/1000/gone.sock"))
+	})
+
+})
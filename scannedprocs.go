@@ -0,0 +1,94 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/siemens/turtlefinder/detector"
+	"github.com/thediveo/lxkns/model"
+)
+
+// Default number of and delay between quick re-reads of the listening unix
+// domain sockets of a newly seen engine process that doesn't show any
+// listening sockets yet.
+const (
+	defaultSocketRetries    = 3
+	defaultSocketRetryDelay = 50 * time.Millisecond
+)
+
+// scannedProcessCache remembers the engine processes that have already been
+// scanned for their listening unix domain sockets, so that only newly seen
+// engine processes get their listening sockets quickly re-read when they don't
+// show any yet. As PIDs get reused, we additionally need the process start
+// time to tell apart different processes with the same PID.
+type scannedProcessCache struct {
+	mu      sync.Mutex
+	scanned map[model.PIDType]uint64 // start times by PID
+}
+
+// firstScan records the specified process as scanned, returning true if the
+// process hasn't been scanned before.
+func (c *scannedProcessCache) firstScan(proc *model.Process) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.scanned == nil {
+		c.scanned = map[model.PIDType]uint64{}
+	}
+	if starttime, ok := c.scanned[proc.PID]; ok && starttime == proc.Starttime {
+		return false
+	}
+	c.scanned[proc.PID] = proc.Starttime
+	return true
+}
+
+// prune removes cached processes that either have vanished or where their PIDs
+// have been reused in the meantime.
+func (c *scannedProcessCache) prune(procs model.ProcessTable) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for pid, starttime := range c.scanned {
+		if proc := procs[pid]; proc != nil && proc.Starttime == starttime {
+			continue
+		}
+		delete(c.scanned, pid)
+	}
+}
+
+// awaitAPIEndpoints quickly re-reads the listening unix domain sockets of the
+// specified (just started) engine process a few times, in order to close the
+// gap between an engine process becoming visible and it creating its API
+// endpoint(s). It returns as soon as it finds potential API endpoints, after
+// the final retry, when the process is gone, or when the context gets
+// cancelled. As the listening unix domain sockets might have been cached in the
+// meantime, awaitAPIEndpoints always reads them freshly.
+func (f *TurtleFinder) awaitAPIEndpoints(
+	ctx context.Context, pid model.PIDType, lg detector.Logger,
+) (apis []string, unresolved []string) {
+	procpid := f.procroot + "/" + strconv.FormatUint(uint64(pid), 10)
+	for retry := 1; retry <= f.sockretries; retry++ {
+		if _, err := os.Stat(procpid); err != nil {
+			return nil, nil
+		}
+		delay := time.NewTimer(f.sockretrydelay)
+		select {
+		case <-ctx.Done():
+			delay.Stop()
+			return nil, nil
+		case <-delay.C:
+		}
+		lg.Debugf("re-reading listening unix domain sockets of new engine process %d, attempt %d of %d",
+			pid, retry, f.sockretries)
+		apis, unresolved = apiEndpointsOfProcess(f.procroot, pid, f.sockfilter, nil, lg)
+		if apis != nil || len(unresolved) > 0 {
+			return apis, unresolved
+		}
+	}
+	return nil, nil
+}
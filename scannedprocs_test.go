@@ -0,0 +1,98 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/thediveo/lxkns/model"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("newly seen engine processes", func() {
+
+	It("remembers scanned engine processes", func() {
+		var c scannedProcessCache
+		proc := &model.Process{PID: 42, ProTaskCommon: model.ProTaskCommon{Starttime: 666}}
+		Expect(c.firstScan(proc)).To(BeTrue())
+		Expect(c.firstScan(proc)).To(BeFalse())
+
+		reused := &model.Process{PID: 42, ProTaskCommon: model.ProTaskCommon{Starttime: 667}}
+		Expect(c.firstScan(reused)).To(BeTrue())
+
+		c.prune(model.ProcessTable{42: reused})
+		Expect(c.scanned).To(HaveKey(model.PIDType(42)))
+		c.prune(model.ProcessTable{})
+		Expect(c.scanned).To(BeEmpty())
+	})
+
+	It("picks up API endpoints created shortly after first seeing an engine process", func(ctx context.Context) {
+		tmpdir := GinkgoT().TempDir()
+		sockpath := tmpdir + "/late.sock"
+		listening := make(chan net.Listener, 1)
+		go func() {
+			defer GinkgoRecover()
+			time.Sleep(150 * time.Millisecond)
+			listening <- Successful(net.Listen("unix", sockpath))
+		}()
+		DeferCleanup(func() { (<-listening).Close() })
+
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "acceptd"}}
+		d := &acceptingDetector{}
+		tf := New(func() context.Context { return ctx },
+			WithoutSocketActivators(),
+			WithGettingOnlineWait(100*time.Millisecond),
+			WithSocketPathFilter(func(path string) bool { return strings.HasPrefix(path, tmpdir) }))
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "acceptd"}}
+		tf.sockretries = 5
+		tf.sockretrydelay = 100 * time.Millisecond
+
+		_ = tf.Containers(ctx, model.ProcessTable{self.PID: self}, nil)
+		Expect(tf.EngineDetails()).To(ConsistOf(
+			HaveField("CandidateAPIs", ConsistOf(HaveSuffix("/late.sock")))))
+	})
+
+	It("doesn't re-read the sockets of engine processes seen before", func(ctx context.Context) {
+		tmpdir := GinkgoT().TempDir()
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "acceptd"}}
+		d := &acceptingDetector{}
+		tf := New(func() context.Context { return ctx },
+			WithoutSocketActivators(),
+			WithSocketPathFilter(func(path string) bool { return strings.HasPrefix(path, tmpdir) }))
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "acceptd"}}
+		tf.sockretries = 2
+		tf.sockretrydelay = 250 * time.Millisecond
+
+		start := time.Now()
+		_ = tf.Containers(ctx, model.ProcessTable{self.PID: self}, nil)
+		Expect(time.Since(start)).To(BeNumerically(">=", 500*time.Millisecond))
+		Expect(tf.Engines()).To(BeEmpty())
+
+		start = time.Now()
+		_ = tf.Containers(ctx, model.ProcessTable{self.PID: self}, nil)
+		Expect(time.Since(start)).To(BeNumerically("<", 250*time.Millisecond))
+	})
+
+	It("doesn't re-read the sockets of vanished processes", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx }, WithProcRoot(GinkgoT().TempDir()))
+		defer tf.Close()
+		tf.sockretrydelay = time.Hour
+		apis, unresolved := tf.awaitAPIEndpoints(ctx, 42, tf.logger)
+		Expect(apis).To(BeNil())
+		Expect(unresolved).To(BeNil())
+	})
+
+})
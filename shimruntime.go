@@ -0,0 +1,114 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/thediveo/lxkns/model"
+)
+
+// RuntimeLabel is the label added to containers running under a containerd
+// runtime shim, such as “containerd-shim-kata-v2”, specifying the runtime
+// (class) of the shim, such as “kata”, “runc”, or “firecracker”.
+const RuntimeLabel = "turtlefinder/runtime"
+
+// shimPrefix is the executable name prefix of containerd runtime shims.
+const shimPrefix = "containerd-shim-"
+
+// shimRuntimeAliases maps runtime names derived from shim names that are
+// somewhat unwieldy onto their well-known runtime names.
+var shimRuntimeAliases = map[string]string{
+	"aws-firecracker": "firecracker",
+}
+
+// shimRuntime returns the runtime name derived from the specified executable
+// basename of a containerd runtime shim, or "" if the basename isn't that of a
+// containerd runtime shim. For instance, shimRuntime returns “kata” for
+// “containerd-shim-kata-v2” and “runc” for “containerd-shim-runc-v2”.
+func shimRuntime(basename string) string {
+	if !strings.HasPrefix(basename, shimPrefix) {
+		return ""
+	}
+	runtime := basename[len(shimPrefix):]
+	// Drop a shim API version suffix, such as "-v2".
+	if idx := strings.LastIndex(runtime, "-v"); idx > 0 && isDecimal(runtime[idx+2:]) {
+		runtime = runtime[:idx]
+	}
+	if alias, ok := shimRuntimeAliases[runtime]; ok {
+		return alias
+	}
+	return runtime
+}
+
+// shimRuntimes caches the runtimes of the containers of an engine, so that
+// adapting the containers of an engine doesn't need to pay the proc
+// filesystem a visit for each and every container each time.
+type shimRuntimes struct {
+	mu       sync.Mutex
+	runtimes map[string]shimRuntimeEntry // by container ID.
+}
+
+// shimRuntimeEntry is the cached runtime of a container with a particular PID.
+type shimRuntimeEntry struct {
+	pid     model.PIDType
+	runtime string // "" if not running under a containerd runtime shim.
+}
+
+// lookup returns the runtimes of the specified containers, keyed by container
+// ID, looking up the shim processes of containers not already known in the
+// proc filesystem mounted at procroot. Only containers with a non-zero PID are
+// looked up. lookup forgets about all containers not specified anymore.
+func (s *shimRuntimes) lookup(procroot string, containers []*model.Container) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	runtimes := make(map[string]shimRuntimeEntry, len(containers))
+	result := make(map[string]string, len(containers))
+	for _, container := range containers {
+		if container.PID <= 0 {
+			continue
+		}
+		entry, ok := s.runtimes[container.ID]
+		if !ok || entry.pid != container.PID {
+			entry = shimRuntimeEntry{
+				pid:     container.PID,
+				runtime: shimRuntimeOfProcess(procroot, container.PID),
+			}
+		}
+		runtimes[container.ID] = entry
+		if entry.runtime != "" {
+			result[container.ID] = entry.runtime
+		}
+	}
+	s.runtimes = runtimes
+	return result
+}
+
+// shimRuntimeOfProcess returns the runtime of the containerd runtime shim that
+// is the parent of the process with the specified PID, or "" if the parent
+// isn't a containerd runtime shim. As some runtimes, such as Kata Containers,
+// might report the shim process itself as the container process,
+// shimRuntimeOfProcess checks the process itself first.
+//
+// Please note that the kernel truncates process names to 15 characters, so we
+// need to go for the basename of the command line instead.
+func shimRuntimeOfProcess(procroot string, pid model.PIDType) string {
+	proc := model.NewProcessInProcfs(pid, false, procroot)
+	if proc == nil {
+		return ""
+	}
+	if runtime := shimRuntime(proc.Basename()); runtime != "" {
+		return runtime
+	}
+	if proc.PPID <= 0 {
+		return ""
+	}
+	parent := model.NewProcessInProcfs(proc.PPID, false, procroot)
+	if parent == nil {
+		return ""
+	}
+	return shimRuntime(parent.Basename())
+}
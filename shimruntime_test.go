@@ -0,0 +1,92 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/thediveo/lxkns/model"
+	"github.com/thediveo/whalewatcher"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeProcess creates a fake proc filesystem entry for the process with the
+// specified PID, name, parent PID, and command line.
+func fakeProcess(procroot string, pid, ppid model.PIDType, name string, cmdline ...string) {
+	GinkgoHelper()
+	procbase := filepath.Join(procroot, strconv.Itoa(int(pid)))
+	Expect(os.MkdirAll(procbase, 0755)).To(Succeed())
+	statline := strconv.Itoa(int(pid)) + " (" + name + ") S " + strconv.Itoa(int(ppid)) +
+		strings.Repeat(" 0", 48) + "\n"
+	Expect(os.WriteFile(filepath.Join(procbase, "stat"), []byte(statline), 0644)).To(Succeed())
+	Expect(os.WriteFile(filepath.Join(procbase, "cmdline"),
+		[]byte(strings.Join(cmdline, "\x00")+"\x00"), 0644)).To(Succeed())
+}
+
+var _ = Describe("containerd runtime shims", func() {
+
+	DescribeTable("deriving runtimes from shim names",
+		func(basename string, expected string) {
+			Expect(shimRuntime(basename)).To(Equal(expected))
+		},
+		Entry(nil, "containerd-shim-runc-v2", "runc"),
+		Entry(nil, "containerd-shim-kata-v2", "kata"),
+		Entry(nil, "containerd-shim-runsc-v1", "runsc"),
+		Entry(nil, "containerd-shim-aws-firecracker", "firecracker"),
+		Entry(nil, "containerd-shim-foo", "foo"),
+		Entry(nil, "containerd-shim-foo-vx", "foo-vx"),
+		Entry(nil, "containerd-shim", ""),
+		Entry(nil, "containerd", ""),
+		Entry(nil, "conmon", ""),
+	)
+
+	It("labels containers with the runtimes of their shims", func(ctx context.Context) {
+		procroot := GinkgoT().TempDir()
+		fakeProcess(procroot, 100, 1, "containerd-shim", "/usr/bin/containerd-shim-kata-v2", "-namespace", "k8s.io")
+		fakeProcess(procroot, 101, 100, "pause", "/pause")
+		fakeProcess(procroot, 200, 1, "containerd-shim", "/usr/bin/containerd-shim-runc-v2")
+		fakeProcess(procroot, 201, 200, "sleep", "sleep", "1000")
+		fakeProcess(procroot, 300, 1, "bash", "/bin/bash")
+		fakeProcess(procroot, 301, 300, "sleep", "sleep", "1000")
+
+		eng := NewStaticEngine("containerd.io", "ctrd-1", "/run/containerd/containerd.sock", 42,
+			&whalewatcher.Container{ID: "kata", Name: "kata", PID: 101},
+			&whalewatcher.Container{ID: "shim", Name: "shim", PID: 100},
+			&whalewatcher.Container{ID: "runc", Name: "runc", PID: 201},
+			&whalewatcher.Container{ID: "other", Name: "other", PID: 301},
+			&whalewatcher.Container{ID: "gone", Name: "gone", PID: 666},
+			&whalewatcher.Container{ID: "nopid", Name: "nopid"})
+		defer eng.Close()
+
+		By("not detecting runtimes without a proc filesystem")
+		Expect(eng.Containers(ctx)).To(HaveEach(
+			HaveField("Labels", Not(HaveKey(RuntimeLabel)))))
+
+		By("detecting runtimes")
+		eng.procroot = procroot
+		containers := eng.Containers(ctx)
+		Expect(containers).To(ConsistOf(
+			And(HaveField("Name", "kata"), HaveField("Labels", HaveKeyWithValue(RuntimeLabel, "kata"))),
+			And(HaveField("Name", "shim"), HaveField("Labels", HaveKeyWithValue(RuntimeLabel, "kata"))),
+			And(HaveField("Name", "runc"), HaveField("Labels", HaveKeyWithValue(RuntimeLabel, "runc"))),
+			And(HaveField("Name", "other"), HaveField("Labels", Not(HaveKey(RuntimeLabel)))),
+			And(HaveField("Name", "gone"), HaveField("Labels", Not(HaveKey(RuntimeLabel)))),
+			And(HaveField("Name", "nopid"), HaveField("Labels", Not(HaveKey(RuntimeLabel)))),
+		))
+
+		By("using cached runtimes")
+		Expect(os.RemoveAll(filepath.Join(procroot, "200"))).To(Succeed())
+		Expect(eng.Containers(ctx)).To(ContainElement(
+			And(HaveField("Name", "runc"), HaveField("Labels", HaveKeyWithValue(RuntimeLabel, "runc")))))
+		Expect(eng.shimruntimes.runtimes).To(HaveLen(5))
+	})
+
+})
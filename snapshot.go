@@ -0,0 +1,122 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"sort"
+	"time"
+
+	"github.com/thediveo/lxkns/model"
+)
+
+// StateSnapshot is a JSON-serializable snapshot of everything a TurtleFinder
+// currently knows about container engines and socket activators, intended for
+// debugging and diagnosis.
+type StateSnapshot struct {
+	Engines            []EngineSnapshot    `json:"engines"`            // engines currently monitored, sorted by PID.
+	Activators         []ActivatorSnapshot `json:"activators"`         // socket activators currently known, sorted by PID.
+	LastContainerCount int                 `json:"lastContainerCount"` // number of containers found by the most recent discovery.
+}
+
+// EngineSnapshot describes a single container engine currently being monitored.
+type EngineSnapshot struct {
+	ID         string        `json:"id"`         // engine ID.
+	Type       string        `json:"type"`       // engine type, such as "docker.com".
+	Version    string        `json:"version"`    // engine version.
+	APIVersion string        `json:"apiVersion"` // negotiated engine API version, if known.
+	API        string        `json:"api"`        // API endpoint path.
+	PID        model.PIDType `json:"pid"`        // PID of engine process.
+	SyncState  string        `json:"syncState"`  // whether the engine's workload is fully synchronized.
+	FirstSeen  time.Time     `json:"firstSeen"`  // when the engine was found and its watch started.
+}
+
+// ActivatorSnapshot describes a single socket activator currently known.
+type ActivatorSnapshot struct {
+	PID     model.PIDType    `json:"pid"`     // PID of socket activator process.
+	Name    string           `json:"name"`    // process name of socket activator.
+	Hash    uint64           `json:"hash"`    // hash over the socket fds of the activator process.
+	Sockets []SocketSnapshot `json:"sockets"` // observed listening sockets, sorted by inode number.
+}
+
+// SocketSnapshot describes a listening unix domain socket observed at a socket
+// activator.
+type SocketSnapshot struct {
+	Ino  uint64 `json:"ino"`  // inode number of socket.
+	Path string `json:"path"` // path of socket.
+}
+
+// Snapshot returns a snapshot of the current discovery state, consisting of the
+// container engines currently monitored (including engines that are still
+// synchronizing), the socket activators currently known together with their
+// observed listening sockets, as well as the number of containers found by the
+// most recent [TurtleFinder.Containers] call. The snapshot is a plain struct
+// with json tags, so it can be directly serialized into JSON, such as when
+// dumping the turtlefinder's state for debugging.
+func (f *TurtleFinder) Snapshot() StateSnapshot {
+	snapshot := StateSnapshot{
+		Engines:            []EngineSnapshot{},
+		Activators:         []ActivatorSnapshot{},
+		LastContainerCount: int(f.lastcontainers.Load()),
+	}
+	type pidEngine struct {
+		pid    model.PIDType
+		engine *Engine
+	}
+	f.mux.Lock()
+	alive := []pidEngine{}
+	for pid, engines := range f.engines {
+		for _, engine := range engines {
+			if !engine.IsAlive() {
+				continue
+			}
+			alive = append(alive, pidEngine{pid: pid, engine: engine})
+		}
+	}
+	for _, activator := range f.activators {
+		snapshot.Activators = append(snapshot.Activators, activator.snapshot())
+	}
+	f.mux.Unlock()
+	// Only now gather the engine details, as engines with lazy metadata might
+	// need to be queried first.
+	for _, a := range alive {
+		pid, engine := a.pid, a.engine
+		snapshot.Engines = append(snapshot.Engines, EngineSnapshot{
+			ID:         engine.EngineID(),
+			Type:       engine.Type(),
+			Version:    engine.CurrentVersion(),
+			APIVersion: engine.APIVersion(),
+			API:        engine.API(),
+			PID:        pid,
+			SyncState:  engine.SyncState().String(),
+			FirstSeen:  engine.FirstSeen,
+		})
+	}
+	sort.SliceStable(snapshot.Engines, func(i, j int) bool {
+		return snapshot.Engines[i].PID < snapshot.Engines[j].PID
+	})
+	sort.Slice(snapshot.Activators, func(i, j int) bool {
+		return snapshot.Activators[i].PID < snapshot.Activators[j].PID
+	})
+	return snapshot
+}
+
+// snapshot returns a snapshot of this socket activator's state.
+func (s *socketActivatorProcess) snapshot() ActivatorSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sockets := make([]SocketSnapshot, 0, len(s.observed))
+	for ino, path := range s.observed {
+		sockets = append(sockets, SocketSnapshot{Ino: ino, Path: path})
+	}
+	sort.Slice(sockets, func(i, j int) bool {
+		return sockets[i].Ino < sockets[j].Ino
+	})
+	return ActivatorSnapshot{
+		PID:     s.proc.PID,
+		Name:    s.proc.Name,
+		Hash:    s.hash,
+		Sockets: sockets,
+	}
+}
@@ -0,0 +1,77 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/siemens/turtlefinder/detector"
+	"github.com/thediveo/lxkns/model"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("state snapshot", func() {
+
+	It("returns an empty snapshot", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx })
+		defer tf.Close()
+		snapshot := tf.Snapshot()
+		Expect(snapshot.Engines).To(BeEmpty())
+		Expect(snapshot.Activators).To(BeEmpty())
+		Expect(snapshot.LastContainerCount).To(BeZero())
+		Expect(string(Successful(json.Marshal(snapshot)))).To(MatchJSON(
+			`{"engines":[],"activators":[],"lastContainerCount":0}`))
+	})
+
+	It("snapshots engines and socket activators", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx })
+		defer tf.Close()
+		ready := make(chan struct{})
+		close(ready)
+		tf.engines[42] = []*Engine{
+			{Watcher: detector.WithAPIVersion(&idleWatcher{ready: ready}, "1.43"), ID: "idle", Version: "0.0.0", Done: make(chan struct{})},
+			{Watcher: &idleWatcher{}, Done: func() chan struct{} { ch := make(chan struct{}); close(ch); return ch }()},
+		}
+		tf.activators[1] = &socketActivatorProcess{
+			proc: &model.Process{PID: 1, ProTaskCommon: model.ProTaskCommon{Name: "systemd"}},
+			hash: 0xcafe,
+			observed: map[uint64]string{
+				666: "/run/podman/podman.sock",
+				123: "/run/foo.sock",
+			},
+		}
+		tf.lastcontainers.Store(7)
+
+		snapshot := tf.Snapshot()
+		Expect(snapshot.Engines).To(ConsistOf(And(
+			HaveField("ID", "idle"),
+			HaveField("Type", "idle"),
+			HaveField("API", "unix:///idle.sock"),
+			HaveField("APIVersion", "1.43"),
+			HaveField("PID", model.PIDType(42)),
+			HaveField("SyncState", "synced"),
+		)))
+		Expect(snapshot.Activators).To(ConsistOf(And(
+			HaveField("PID", model.PIDType(1)),
+			HaveField("Name", "systemd"),
+			HaveField("Hash", uint64(0xcafe)),
+			HaveField("Sockets", HaveExactElements(
+				SocketSnapshot{Ino: 123, Path: "/run/foo.sock"},
+				SocketSnapshot{Ino: 666, Path: "/run/podman/podman.sock"},
+			)),
+		)))
+		Expect(snapshot.LastContainerCount).To(Equal(7))
+
+		var roundtripped StateSnapshot
+		Expect(json.Unmarshal(Successful(json.Marshal(snapshot)), &roundtripped)).To(Succeed())
+		Expect(roundtripped.Engines).To(HaveLen(1))
+		Expect(roundtripped.Activators[0].Sockets).To(HaveLen(2))
+	})
+
+})
@@ -5,6 +5,7 @@
 package turtlefinder
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 	"sync"
@@ -14,8 +15,8 @@ import (
 
 	"github.com/cespare/xxhash/v2"
 	"github.com/siemens/turtlefinder/activator"
+	"github.com/siemens/turtlefinder/detector"
 	"github.com/thediveo/go-plugger/v3"
-	"github.com/thediveo/lxkns/log"
 	"github.com/thediveo/lxkns/model"
 	"github.com/thediveo/procfsroot"
 	"github.com/thediveo/whalewatcher/watcher"
@@ -35,14 +36,27 @@ import (
 // engine process terminates (which it normally shouldn't).
 type socketActivatorProcess struct {
 	proc                 *model.Process                             // activator process.
+	procroot             string                                     // where the proc filesystem is mounted.
 	demonDetectorPlugins []*demonFinderPlugin                       // static list of socket-activated engine plugins.
 	initialsyncwait      time.Duration                              // max. wait for engine watch coming online (sync) before proceeding.
 	contexter            Contexter                                  // contexts for workload watching.
+	enginefilter         *engineTypeFilter                          // allowed engines; nil allows all.
+	logger               detector.Logger                            // logs either via a LogFunc or lxkns' log.
 	createdWatcherFn     func(w watcher.Watcher, pid model.PIDType) // callback for newly created engine workload watchers
+	subscribeFn          func(w watcher.Watcher)                    // optional callback for new watchers before they start watching.
+	sockfilter           socketPathFilter                           // optional socket path filter; nil allows all.
+	findattempts         int                                        // max. attempts to find activated engine processes; zero for default.
+	findpolling          time.Duration                              // polling interval when finding activated engine processes; zero for default.
 
-	mu       sync.Mutex          // protects the following fields
-	hash     uint64              // xxhash over socket fds to detect reconfigurations.
-	observed map[uint64]struct{} // sockets we processes one way or another and we should thus ignore.
+	mu        sync.Mutex            // protects the following fields
+	hash      uint64                // xxhash over socket fds to detect reconfigurations.
+	observed  map[uint64]string     // paths of sockets we processed one way or another and we should thus ignore.
+	seq       uint64                // sequence number of the most recently started socket fds read.
+	committed uint64                // sequence number of the socket fds read the observed sockets base on.
+	lasthash  uint64                // most recently committed hash; not reset by rediscover.
+	changes   uint64                // number of times the committed hash changed.
+	activated map[uint64]activation // activated engines by listening socket inode number.
+	idled     map[uint64]activation // idled activated engines by listening socket inode number.
 }
 
 // daemonFinderPlugin represents the information for identifying a
@@ -63,8 +77,10 @@ var demonDetectorPlugins []*demonFinderPlugin // cached list of plugins
 // them onto the floor.
 func newSocketActivator(
 	proc *model.Process,
+	procroot string,
 	initialsyncwait time.Duration,
 	contexter Contexter,
+	enginefilter *engineTypeFilter,
 	createdWatcherFn func(w watcher.Watcher, pid model.PIDType),
 ) *socketActivatorProcess {
 	// If not done so yet, build a list of demon detectors for detecting
@@ -78,6 +94,12 @@ func newSocketActivator(
 		detectorPlugins = make([]*demonFinderPlugin, 0, len(demonfinders))
 		for _, demonfinder := range demonfinders {
 			ident := demonfinder.S.Ident()
+			// Matching API endpoint paths against the suffix then covers
+			// system-wide API endpoints, such as “/run/podman/podman.sock”,
+			// as well as the API endpoints of rootless engines in user
+			// runtime directories, such as “/run/user/1000/podman/podman.sock”.
+			// And as the suffix starts with a slash, it never matches only a
+			// part of the final path element, such as in “/run/notpodman.sock”.
 			ident.APIEndpointSuffix = "/" + ident.APIEndpointSuffix
 			detectorPlugins = append(detectorPlugins, &demonFinderPlugin{
 				ident:      ident,
@@ -89,17 +111,21 @@ func newSocketActivator(
 		logPlugins = true
 	}
 	muDaemonDetectorPlugins.Unlock()
+	logger := detector.LoggerFrom(contexter())
 	if logPlugins {
-		log.Infof("available socket-activated engine process detector plugins: %s",
+		logger.Infof("available socket-activated engine process detector plugins: %s",
 			strings.Join(plugger.Group[activator.EngineFinder]().Plugins(), ", "))
 	}
 	s := &socketActivatorProcess{
 		proc:                 proc,
+		procroot:             procroot,
 		demonDetectorPlugins: detectorPlugins,
 		initialsyncwait:      initialsyncwait,
 		contexter:            contexter,
+		enginefilter:         enginefilter,
+		logger:               logger,
 		createdWatcherFn:     createdWatcherFn,
-		observed:             map[uint64]struct{}{},
+		observed:             map[uint64]string{},
 	}
 	return s
 }
@@ -112,19 +138,30 @@ func newSocketActivator(
 // the end of the time box, even if some workload synchronization might still be
 // ongoing in the background. This is on purpose in order to not stall
 // discoveries for too long in face of newly discovered container engines.
-func (s *socketActivatorProcess) update(wg *sync.WaitGroup) {
-	rawsox, hash, err := s.rawSocketFdsWithHash()
+//
+// If procs is non-nil, then this recently discovered process table is first
+// consulted when trying to locate activated container engine processes, before
+// walking the proc filesystem. If netunix is non-nil, the listening unix domain
+// sockets visible to this socket activator are taken from this cache.
+func (s *socketActivatorProcess) update(wg *sync.WaitGroup, procs model.ProcessTable, netunix *netUnixCache) {
+	rawsox, hash, seq, err := s.rawSocketFdsWithHash()
 	if err != nil {
-		log.Errorf("cannot update socket activator state, reason: %s", err.Error())
+		s.logger.Errorf("cannot update socket activator state, reason: %s", err.Error())
 		return
 	}
-	newapis := s.discoverAPIPaths(rawsox, hash)
+	var locator daemonLocator = procfsDaemonLocator{procroot: s.procroot}
+	if procs != nil {
+		locator = proctableDaemonLocator{procroot: s.procroot, procs: procs}
+	}
+	s.wakeIdled(locator, time.Now())
+	newapis := s.discoverAPIPaths(rawsox, hash, seq, netunix)
 	if newapis == nil {
 		return
 	}
 	s.activateAndWatch(
 		newapis,
 		wg,
+		locator,
 		func(w watcher.Watcher, err error) {
 			if err != nil || s.createdWatcherFn == nil {
 				return
@@ -137,11 +174,18 @@ func (s *socketActivatorProcess) update(wg *sync.WaitGroup) {
 // rawSocketFdsWithHash returns a list of sockets this socket activator process
 // currently has open, together with a hash value calculated from the socket fd
 // and socket inode numbers. The hash can be used to detect changes in the
-// fd-socket configuration.
-func (s *socketActivatorProcess) rawSocketFdsWithHash() (rawsocketfds []rawSocketFd, hash uint64, err error) {
-	rawsocketfds, err = rawSocketFdsOfProcess("", s.proc.PID)
+// fd-socket configuration. Additionally, rawSocketFdsWithHash returns the
+// sequence number of this read, so that [socketActivatorProcess.discoverAPIPaths]
+// can later tell apart outdated reads from more recent ones.
+func (s *socketActivatorProcess) rawSocketFdsWithHash() (rawsocketfds []rawSocketFd, hash uint64, seq uint64, err error) {
+	s.mu.Lock()
+	s.seq++
+	seq = s.seq
+	s.mu.Unlock()
+
+	rawsocketfds, err = rawSocketFdsOfProcess(s.procroot, s.proc.PID)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, 0, categorize(ErrActivatorScanFailed, err)
 	}
 
 	d := xxhash.New()
@@ -149,12 +193,44 @@ func (s *socketActivatorProcess) rawSocketFdsWithHash() (rawsocketfds []rawSocke
 		_, _ = d.WriteString(rawsocketfd.fd)
 		_, _ = d.WriteString(rawsocketfd.socketino)
 	}
-	return rawsocketfds, d.Sum64(), nil
+	return rawsocketfds, d.Sum64(), seq, nil
+}
+
+// rediscover resets the hash over the socket fds, so that the next update
+// rescans the listening sockets of this socket activator.
+func (s *socketActivatorProcess) rediscover() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hash = 0
+}
+
+// configHash returns the current hash over the socket fds of this socket
+// activator, as well as how many times this hash has changed since the socket
+// activator was first found. The hash is zero if the socket fds haven't been
+// successfully read yet.
+func (s *socketActivatorProcess) configHash() (hash uint64, changes uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lasthash, s.changes
 }
 
 // discoverAPIPaths prunes and updates the known activator socket map, returning
 // a map of newly found API endpoint paths and their inode numbers.
-func (s *socketActivatorProcess) discoverAPIPaths(rawsocketfds []rawSocketFd, hash uint64) socketPathsByIno {
+//
+// Concurrent discoveries might race each other, so that the sockets of an
+// older read (as indicated by its sequence number) arrive here only after the
+// sockets of a more recent read. In this case, discoverAPIPaths doesn't prune
+// the known sockets based on the outdated read, as this would drop sockets
+// from the more recent read and later rediscover them as new, so they would
+// get activated and watched twice. However, discoverAPIPaths still returns any
+// sockets of the outdated read that haven't been observed yet, so transient
+// sockets don't get lost, except for sockets whose paths have meanwhile been
+// observed with a different inode number, as these sockets have been
+// recreated, such as after an engine restart.
+//
+// If netunix is non-nil, the listening unix domain sockets visible to this
+// socket activator are taken from this cache.
+func (s *socketActivatorProcess) discoverAPIPaths(rawsocketfds []rawSocketFd, hash uint64, seq uint64, netunix *netUnixCache) socketPathsByIno {
 	s.mu.Lock()
 	if hash == s.hash {
 		s.mu.Unlock()
@@ -162,29 +238,67 @@ func (s *socketActivatorProcess) discoverAPIPaths(rawsocketfds []rawSocketFd, ha
 	}
 	s.mu.Unlock()
 
-	sox := listeningUDSPaths(rawsocketfds, listeningUDSVisibleToProcess(s.proc.PID))
+	sox := listeningUDSPaths(rawsocketfds, netunix.listeningUDSVisibleToProcess(s.procroot, s.proc.PID))
+	if s.sockfilter != nil {
+		for ino, soxpath := range sox {
+			if !s.sockfilter.allows(soxpath) {
+				delete(sox, ino)
+			}
+		}
+	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if hash == s.hash { // bad luck: someone else was faster...
 		return nil
 	}
-	s.hash = hash
-	// prune our map of "observed" listening sockets...
-	for ino := range s.observed {
-		if _, ok := sox[ino]; ok {
-			continue
+	recent := seq > s.committed
+	if recent {
+		// This is the most recent read so far, so prune our map of "observed"
+		// listening sockets...
+		s.committed = seq
+		s.hash = hash
+		// Count reconfigurations of this socket activator, but neither the
+		// first discovery nor forced rediscoveries without any change.
+		if s.lasthash != 0 && hash != s.lasthash {
+			s.changes++
+		}
+		s.lasthash = hash
+		for ino := range s.observed {
+			if _, ok := sox[ino]; ok {
+				continue
+			}
+			delete(s.observed, ino)
+			delete(s.activated, ino)
+			delete(s.idled, ino)
 		}
-		delete(s.observed, ino)
 	}
 
-	// ...and get only the newly discovered listening socket paths.
+	// ...and get only the newly discovered listening socket paths. When an
+	// engine gets restarted, the socket activator might recreate its listening
+	// socket at the same path, but with a new inode number; the most recent
+	// read then has already pruned the old socket and observed the recreated
+	// one. An outdated read still seeing the old socket must thus not observe
+	// it again, as otherwise the engine behind the recreated socket would get
+	// activated and watched twice.
+	var observedpaths map[string]struct{}
+	if !recent {
+		observedpaths = make(map[string]struct{}, len(s.observed))
+		for _, soxpath := range s.observed {
+			if soxpath != "" {
+				observedpaths[soxpath] = struct{}{}
+			}
+		}
+	}
 	newpaths := socketPathsByIno{}
 	for ino, soxpath := range sox {
 		if _, ok := s.observed[ino]; ok {
 			continue
 		}
-		s.observed[ino] = struct{}{} // immediately block so no double watcher creation
+		if _, ok := observedpaths[soxpath]; ok {
+			continue // stale socket meanwhile recreated at the same path.
+		}
+		s.observed[ino] = soxpath // immediately block so no double watcher creation
 		newpaths[ino] = soxpath
 	}
 	return newpaths
@@ -205,13 +319,17 @@ func (s *socketActivatorProcess) discoverAPIPaths(rawsocketfds []rawSocketFd, ha
 func (s *socketActivatorProcess) activateAndWatch(
 	apis socketPathsByIno,
 	wg *sync.WaitGroup,
+	locator daemonLocator,
 	outcomefn func(w watcher.Watcher, err error),
 ) {
 	// Note: the API endpoint paths are relative to the mount namespace of this
 	// socket activator. In order to always correctly access them even when
 	// we're in a different mount namespace (that is, container), we need to go
 	// through the proc filesystem "root" element "wormholes".
-	wormhole := "/proc/" + strconv.FormatUint(uint64(s.proc.PID), 10) + "/root"
+	if locator == nil {
+		locator = procfsDaemonLocator{procroot: s.procroot}
+	}
+	wormhole := s.procroot + "/" + strconv.FormatUint(uint64(s.proc.PID), 10) + "/root"
 	for ino, api := range apis {
 		if api == "" {
 			continue
@@ -222,31 +340,51 @@ func (s *socketActivatorProcess) activateAndWatch(
 		if idx < 0 {
 			continue
 		}
+		plugin := s.demonDetectorPlugins[idx]
+		if !s.enginefilter.allowsPlugin(plugin.pluginname) {
+			continue
+		}
 		apieval, err := procfsroot.EvalSymlinks(api, wormhole, procfsroot.EvalFullPath)
 		if err != nil {
-			log.Errorf("invalid API endpoint path '%s' in context of '%s'",
+			s.logger.Errorf("invalid API endpoint path '%s' in context of '%s'",
 				api, wormhole)
 			continue
 		}
 		api = wormhole + apieval
 		wg.Add(1)
 		ctx := s.contexter()
-		go func(ino uint64, api string, enginename string, creatorfn func(apipath string, pid model.PIDType) (watcher.Watcher, error)) {
+		go func(ino uint64, api string, enginenames []string, creatorfn func(apipath string, pid model.PIDType) (watcher.Watcher, error)) {
 			defer wg.Done()
 			activateAndStartWatch(
 				ctx,
 				api,
 				ino,
 				s.proc.PID,
-				enginename,
+				enginenames,
+				locator,
+				s.findattempts,
+				s.findpolling,
 				creatorfn,
-				outcomefn,
+				func(w watcher.Watcher, err error) {
+					if err == nil && w != nil {
+						s.activatedEngine(ino, w, enginenames)
+					}
+					outcomefn(w, err)
+				},
 				s.initialsyncwait,
 			)
 		}(ino, api,
-			s.demonDetectorPlugins[idx].ident.ProcessName,
+			plugin.ident.ProcessNames(),
 			func(apipath string, pid model.PIDType) (watcher.Watcher, error) {
-				return s.demonDetectorPlugins[idx].finder.NewWatcher(ctx, pid, apipath), nil
+				w := plugin.finder.NewWatcher(ctx, pid, apipath)
+				if w != nil && !s.enginefilter.allowsWatcher(plugin.pluginname, w) {
+					w.Close()
+					return nil, fmt.Errorf("ignoring filtered '%s' engine (PID %d)", w.Type(), pid)
+				}
+				if w != nil && s.subscribeFn != nil {
+					s.subscribeFn(w)
+				}
+				return w, nil
 			})
 	}
 }
@@ -6,10 +6,16 @@ package turtlefinder
 
 import (
 	"context"
+	"net"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"golang.org/x/exp/slices"
+
+	"github.com/siemens/turtlefinder/activator"
 	"github.com/siemens/turtlefinder/internal/test"
 	"github.com/thediveo/lxkns/model"
 	"github.com/thediveo/whalewatcher/watcher"
@@ -54,24 +60,27 @@ var _ = Describe("socket activator", Serial, Ordered, func() {
 		defer cancel()
 		s := newSocketActivator(
 			&model.Process{PID: 1},
+			defaultProcRoot,
 			sockactivatorSyncWait,
 			func() context.Context { return ctx },
 			nil,
+			nil,
 		)
 
 		By("discovering potential API paths")
-		rawsox, hash := Successful2R(s.rawSocketFdsWithHash())
+		rawsox, hash, seq, err := s.rawSocketFdsWithHash()
+		Expect(err).NotTo(HaveOccurred())
 		Expect(hash).NotTo(BeZero())
-		newapis := s.discoverAPIPaths(rawsox, hash)
+		newapis := s.discoverAPIPaths(rawsox, hash, seq, nil)
 		Expect(s.hash).To(Equal(hash))
 		Expect(newapis).To(ContainElement("/run/docker.sock"))
 
-		Expect(s.discoverAPIPaths(rawsox, hash)).To(BeNil(), "unexpected/invalid state change")
+		Expect(s.discoverAPIPaths(rawsox, hash, seq, nil)).To(BeNil(), "unexpected/invalid state change")
 
 		By("spinning off a Docker watcher and waiting for it to become ready")
 		var wg sync.WaitGroup
 		wch := make(chan watcher.Watcher, 1)
-		s.activateAndWatch(newapis, &wg, func(w watcher.Watcher, err error) {
+		s.activateAndWatch(newapis, &wg, nil, func(w watcher.Watcher, err error) {
 			defer GinkgoRecover()
 			defer close(wch)
 			Expect(err).NotTo(HaveOccurred())
@@ -106,8 +115,10 @@ var _ = Describe("socket activator", Serial, Ordered, func() {
 		wch := make(chan watcher.Watcher, 1)
 		s := newSocketActivator(
 			&model.Process{PID: 1},
+			defaultProcRoot,
 			sockactivatorSyncWait,
 			func() context.Context { return ctx },
+			nil,
 			func(w watcher.Watcher, pid model.PIDType) {
 				defer GinkgoRecover()
 				defer close(wch)
@@ -119,7 +130,7 @@ var _ = Describe("socket activator", Serial, Ordered, func() {
 
 		By("discovering and updating")
 		var wg sync.WaitGroup
-		s.update(&wg)
+		s.update(&wg, nil, nil)
 		done := make(chan struct{})
 		go func() {
 			defer close(done)
@@ -138,3 +149,235 @@ var _ = Describe("socket activator", Serial, Ordered, func() {
 	})
 
 })
+
+var _ = Describe("socket activator API endpoint matching", func() {
+
+	DescribeTable("matching API endpoint paths",
+		func(api string, expected string) {
+			s := &socketActivatorProcess{
+				demonDetectorPlugins: []*demonFinderPlugin{{
+					ident:      activator.EngineIdentification{APIEndpointSuffix: "/podman.sock"},
+					pluginname: "podman",
+				}},
+			}
+			Expect(s.enginePluginName(api)).To(Equal(expected))
+		},
+		Entry("system-wide podman", "/run/podman/podman.sock", "podman"),
+		Entry("rootless podman", "/run/user/1000/podman/podman.sock", "podman"),
+		Entry("rootless podman in container", "/proc/42/root/run/user/1000/podman/podman.sock", "podman"),
+		Entry("partial name", "/run/user/1000/notpodman.sock", ""),
+		Entry("other engine", "/run/user/1000/docker.sock", ""),
+	)
+
+})
+
+var _ = Describe("socket activator socket churn", func() {
+
+	var s *socketActivatorProcess
+	var sockdir string
+
+	BeforeEach(func(ctx context.Context) {
+		s = newSocketActivator(
+			&model.Process{PID: model.PIDType(os.Getpid())},
+			defaultProcRoot,
+			sockactivatorSyncWait,
+			func() context.Context { return ctx },
+			nil,
+			nil,
+		)
+		sockdir = GinkgoT().TempDir()
+	})
+
+	listen := func(name string) net.Listener {
+		GinkgoHelper()
+		l := Successful(net.Listen("unix", sockdir+"/"+name))
+		DeferCleanup(func() { _ = l.Close() })
+		return l
+	}
+
+	read := func() (rawsox []rawSocketFd, hash uint64, seq uint64) {
+		GinkgoHelper()
+		rawsox, hash, seq, err := s.rawSocketFdsWithHash()
+		Expect(err).NotTo(HaveOccurred())
+		return rawsox, hash, seq
+	}
+
+	sockInoOf := func(path string) uint64 {
+		GinkgoHelper()
+		return netunixInoOf(newNetUnixCache(), s.proc.PID, path)
+	}
+
+	It("doesn't let an outdated read drop more recent sockets", func() {
+		listen("first.sock")
+		rawsoxA, hashA, seqA := read()
+		listen("second.sock")
+		rawsoxB, hashB, seqB := read()
+
+		// the more recent read wins the race...
+		Expect(s.discoverAPIPaths(rawsoxB, hashB, seqB, nil)).To(ConsistOf(
+			sockdir+"/first.sock", sockdir+"/second.sock"))
+		// ...and the outdated read must neither report anything new, nor
+		// forget about the second socket.
+		Expect(s.discoverAPIPaths(rawsoxA, hashA, seqA, nil)).To(BeEmpty())
+		Expect(s.hash).To(Equal(hashB))
+
+		rawsoxC, hashC, seqC := read()
+		Expect(s.discoverAPIPaths(rawsoxC, hashC, seqC, nil)).To(BeEmpty())
+	})
+
+	It("doesn't lose sockets of outdated reads", func() {
+		first := listen("first.sock")
+		rawsoxA, hashA, seqA := read()
+		// the first socket is still listening, but not open anymore in the
+		// socket activator.
+		rawsoxB, hashB, seqB := read()
+		rawsoxB = slices.DeleteFunc(rawsoxB, func(rawsox rawSocketFd) bool {
+			return rawsox.fd == strconv.Itoa(fdOf(first))
+		})
+		hashB++
+
+		Expect(s.discoverAPIPaths(rawsoxB, hashB, seqB, nil)).NotTo(ContainElement(sockdir + "/first.sock"))
+		Expect(s.discoverAPIPaths(rawsoxA, hashA, seqA, nil)).To(ConsistOf(sockdir + "/first.sock"))
+	})
+
+	It("discovers sockets in order", func() {
+		listen("first.sock")
+		rawsoxA, hashA, seqA := read()
+		listen("second.sock")
+		rawsoxB, hashB, seqB := read()
+
+		Expect(s.discoverAPIPaths(rawsoxA, hashA, seqA, nil)).To(ConsistOf(sockdir + "/first.sock"))
+		Expect(s.discoverAPIPaths(rawsoxB, hashB, seqB, nil)).To(ConsistOf(sockdir + "/second.sock"))
+		Expect(s.hash).To(Equal(hashB))
+	})
+
+	It("ignores filtered sockets", func() {
+		listen("first.sock")
+		listen("second.sock")
+		s.sockfilter = func(path string) bool { return strings.HasSuffix(path, "/second.sock") }
+		rawsox, hash, seq := read()
+		Expect(s.discoverAPIPaths(rawsox, hash, seq, nil)).To(ConsistOf(sockdir + "/second.sock"))
+	})
+
+	It("watches a socket recreated at the same path after an engine restart", func(ctx context.Context) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		s.contexter = func() context.Context { return ctx }
+		s.demonDetectorPlugins = []*demonFinderPlugin{{
+			ident:      activator.EngineIdentification{APIEndpointSuffix: "/fake.sock", ProcessName: "faked"},
+			finder:     &restartedEngineFinder{},
+			pluginname: "faked",
+		}}
+		activate := func(apis socketPathsByIno, pid model.PIDType) watcher.Watcher {
+			GinkgoHelper()
+			var wg sync.WaitGroup
+			ws := make(chan watcher.Watcher, 1)
+			s.activateAndWatch(apis, &wg, fixedDaemonLocator(pid), func(w watcher.Watcher, err error) {
+				if err == nil {
+					ws <- w
+				}
+			})
+			wg.Wait()
+			var w watcher.Watcher
+			Eventually(ws).Should(Receive(&w))
+			return w
+		}
+
+		first := listen("fake.sock")
+		rawsox, hash, seq := read()
+		apis := s.discoverAPIPaths(rawsox, hash, seq, nil)
+		Expect(apis).To(HaveKeyWithValue(sockInoOf(sockdir+"/fake.sock"), sockdir+"/fake.sock"))
+		Expect(activate(apis, 42).PID()).To(Equal(42))
+
+		By("restarting the engine and recreating the socket with a new inode")
+		Expect(first.Close()).To(Succeed())
+		listen("fake.sock")
+		rawsox, hash, seq = read()
+		apis = s.discoverAPIPaths(rawsox, hash, seq, nil)
+		Expect(apis).To(HaveKeyWithValue(sockInoOf(sockdir+"/fake.sock"), sockdir+"/fake.sock"))
+		Expect(activate(apis, 43).PID()).To(Equal(43))
+		Expect(s.observed).To(HaveLen(1))
+	})
+
+	It("doesn't resurrect a recreated socket from an outdated read", func() {
+		first := listen("fake.sock")
+		rawsoxA, hashA, seqA := read()
+		netunixA := newNetUnixCache()
+		Expect(netunixA.listeningUDSVisibleToProcess(defaultProcRoot, s.proc.PID)).To(
+			ContainElement(sockdir + "/fake.sock"))
+
+		Expect(first.Close()).To(Succeed())
+		listen("fake.sock")
+		rawsoxB, hashB, seqB := read()
+		Expect(s.discoverAPIPaths(rawsoxB, hashB, seqB, nil)).To(
+			HaveKeyWithValue(sockInoOf(sockdir+"/fake.sock"), sockdir+"/fake.sock"))
+
+		// The outdated read still sees the old socket at the same path...
+		rawsoxA = append(rawsoxA, rawSocketFd{fd: "666", socketino: strconv.FormatUint(
+			netunixInoOf(netunixA, s.proc.PID, sockdir+"/fake.sock"), 10)})
+		Expect(s.discoverAPIPaths(rawsoxA, hashA, seqA, netunixA)).To(BeEmpty())
+		Expect(s.observed).To(ConsistOf(sockdir + "/fake.sock"))
+		Expect(s.observed).To(HaveKey(sockInoOf(sockdir + "/fake.sock")))
+	})
+
+	It("rescans unchanged sockets when told to rediscover", func() {
+		listen("first.sock")
+		rawsox, hash, seq := read()
+		Expect(s.discoverAPIPaths(rawsox, hash, seq, nil)).To(ConsistOf(sockdir + "/first.sock"))
+
+		rawsox, hash, seq = read()
+		Expect(s.discoverAPIPaths(rawsox, hash, seq, nil)).To(BeNil())
+
+		s.rediscover()
+		rawsox, hash, seq = read()
+		newapis := s.discoverAPIPaths(rawsox, hash, seq, nil)
+		Expect(newapis).NotTo(BeNil())
+		Expect(newapis).To(BeEmpty())
+		Expect(s.hash).To(Equal(hash))
+	})
+
+})
+
+// restartedEngineFinder is an activator.EngineFinder returning synchronized
+// idle watchers for the engine PIDs passed to it.
+type restartedEngineFinder struct{}
+
+func (f *restartedEngineFinder) Ident() activator.EngineIdentification {
+	return activator.EngineIdentification{APIEndpointSuffix: "/fake.sock", ProcessName: "faked"}
+}
+
+func (f *restartedEngineFinder) NewWatcher(ctx context.Context, pid model.PIDType, api string) watcher.Watcher {
+	ready := make(chan struct{})
+	close(ready)
+	return &endpointWatcher{idleWatcher: idleWatcher{ready: ready}, api: api, pid: pid}
+}
+
+// fixedDaemonLocator is a daemonLocator always finding the same engine PID.
+type fixedDaemonLocator model.PIDType
+
+func (l fixedDaemonLocator) findDaemon(model.PIDType, string, uint64) model.PIDType {
+	return model.PIDType(l)
+}
+
+// netunixInoOf returns the inode number of the listening unix domain socket
+// with the specified path, as cached in the specified net/unix cache.
+func netunixInoOf(netunix *netUnixCache, pid model.PIDType, path string) uint64 {
+	GinkgoHelper()
+	for ino, soxpath := range netunix.listeningUDSVisibleToProcess(defaultProcRoot, pid) {
+		if soxpath == path {
+			return ino
+		}
+	}
+	Fail("socket " + path + " not found")
+	return 0
+}
+
+// fdOf returns the file descriptor number of the specified unix domain socket
+// listener.
+func fdOf(l net.Listener) int {
+	GinkgoHelper()
+	rawconn := Successful(l.(*net.UnixListener).SyscallConn())
+	var fd int
+	Expect(rawconn.Control(func(sysfd uintptr) { fd = int(sysfd) })).To(Succeed())
+	return fd
+}
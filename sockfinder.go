@@ -6,13 +6,14 @@ package turtlefinder
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
-	"os"
+	"io/fs"
 	"strconv"
 	"strings"
-	"unsafe"
+	"syscall"
 
-	"github.com/siemens/turtlefinder/unsorted"
+	"github.com/siemens/turtlefinder/detector"
 	"github.com/thediveo/lxkns/model"
 )
 
@@ -51,16 +52,77 @@ const (
 const socketFdPrefix = "socket:["
 const socketFdPrefixLen = len(socketFdPrefix)
 
+// defaultProcRoot is the path where the proc filesystem is usually mounted.
+const defaultProcRoot = "/proc"
+
 // discoverAPISocketsOfProcess returns a list of listening unix domain sockets
 // for a specific process that might be API endpoints. The PID of the process
-// must be valid in the current mount namespace and a correct proc filesystem
-// must have been (re)mounted in this mount namespace, otherwise only an empty
-// list will be returned. The easiest way is to do this with a PID valid in the
-// initial PID namespace and with a correct proc in the current mount namespace
-// that has full "host:pid" view.
-func discoverAPISocketsOfProcess(pid model.PIDType) []string {
-	var listeningUDS = listeningUDSVisibleToProcess(pid)
-	return listeningUDSPathsOfProcess(pid, listeningUDS)
+// must be valid for the proc filesystem mounted at procroot, otherwise only an
+// empty list will be returned. The easiest way is to do this with a PID valid in
+// the initial PID namespace and with a correct proc in the current mount
+// namespace that has full "host:pid" view, or alternatively a host proc
+// filesystem bind-mounted elsewhere, such as “/host/proc”.
+//
+// If filter is non-nil, only socket paths allowed by the filter are returned.
+// If netunix is non-nil, the listening unix domain sockets visible to the
+// process are taken from this cache.
+//
+// If the listening unix domain sockets visible to the process cannot be read at
+// all, discoverAPISocketsOfProcess logs the reason at debug level, such as the
+// process having terminated in the meantime or permission being denied, so that
+// engine processes skipped because of permission issues can be told apart from
+// engine processes that genuinely don't have any listening sockets.
+func discoverAPISocketsOfProcess(procroot string, pid model.PIDType, filter socketPathFilter, netunix *netUnixCache, lg detector.Logger) []string {
+	listeningUDS, err := netunix.listeningUDS(procroot, pid)
+	if err != nil {
+		lg.Debugf("cannot read listening unix domain sockets of process %d: %s",
+			pid, unreadableReason(err))
+		return nil
+	}
+	return filter.paths(listeningUDSPathsOfProcess(procroot, pid, listeningUDS))
+}
+
+// unreadableReason returns a short description of why some proc filesystem
+// element of a process couldn't be read.
+func unreadableReason(err error) string {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return "process is gone"
+	case errors.Is(err, fs.ErrPermission):
+		return "permission denied"
+	default:
+		return err.Error()
+	}
+}
+
+// socketPathFilter decides whether a listening unix domain socket path should
+// be considered to be a potential API endpoint, see also
+// [WithSocketPathFilter]. The socket paths are in the context of the mount
+// namespace of the process having the socket open.
+type socketPathFilter func(path string) bool
+
+// allows returns true if the specified socket path passes this filter; a nil
+// filter allows all socket paths.
+func (f socketPathFilter) allows(path string) bool {
+	return f == nil || f(path)
+}
+
+// paths returns only the specified socket paths that pass this filter,
+// reusing the specified slice.
+func (f socketPathFilter) paths(paths []string) []string {
+	if f == nil {
+		return paths
+	}
+	allowed := paths[:0]
+	for _, path := range paths {
+		if f(path) {
+			allowed = append(allowed, path)
+		}
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+	return allowed
 }
 
 // rawSocketFd represents a particular fd and the socket inode it references,
@@ -83,7 +145,10 @@ type rawSocketFd struct {
 // first want to find out as quickly as possible which sockets an activator
 // currently has open (unfortunately, regardless of their type and mode). Thus,
 // we don't do any string-to-number conversions, just raw string processing.
-func rawSocketFdsOfProcess(procfs string, pid model.PIDType) ([]rawSocketFd, error) {
+//
+// The PID specified must be correct for the proc filesystem mounted at
+// procroot.
+func rawSocketFdsOfProcess(procroot string, pid model.PIDType) ([]rawSocketFd, error) {
 	// We're going for the file descriptor pseudo symlink entries in the proc
 	// filesystem of a particular process; see also
 	// https://man7.org/linux/man-pages/man5/proc.5.html. In case of sockets
@@ -91,15 +156,15 @@ func rawSocketFdsOfProcess(procfs string, pid model.PIDType) ([]rawSocketFd, err
 	// reveal the type of thing referenced by an fd entry and its inode number.
 	// Unfortunately, they don't reveal whether a particular socket is in
 	// listening state or not.
-	fdbase := procfs + "/proc/" + strconv.FormatUint(uint64(pid), 10) + "/fd"
-	fds, err := unsorted.ReadDir(fdbase)
+	fdbase := procroot + "/" + strconv.FormatUint(uint64(pid), 10) + "/fd"
+	fds, err := sockfs.ReadDir(fdbase)
 	if err != nil {
 		return nil, fmt.Errorf("cannot determine fds for process with PID %d, reason: %w", pid, err)
 	}
 	sockets := make([]rawSocketFd, 0, len(fds))
 	fdbase += "/"
 	for _, fd := range fds {
-		linksto, err := os.Readlink(fdbase + fd.Name())
+		linksto, err := sockfs.Readlink(fdbase + fd.Name())
 		if err != nil {
 			continue
 		}
@@ -126,16 +191,16 @@ type socketPathsByIno map[uint64]string
 // unix domain sockets in the map of inode numbers to socket paths, as passed in
 // listeningUDS.
 //
-// The PID specified must be correct for the procfs instance mounted for the
-// calling process (or task).
-func listeningUDSPathsOfProcess(pid model.PIDType, listeningUDS socketPathsByIno) (socketpaths []string) {
+// The PID specified must be correct for the proc filesystem mounted at
+// procroot.
+func listeningUDSPathsOfProcess(procroot string, pid model.PIDType, listeningUDS socketPathsByIno) (socketpaths []string) {
 	// We're going for the file descriptor pseudo symlink entries in the proc
 	// filesystem of a particular process; see also
 	// https://man7.org/linux/man-pages/man5/proc.5.html. In case of sockets
 	// these pseudo symlinks won't reference anything in the VFS, but instead
 	// reveal the type of thing referenced by an fd entry and its inode number.
-	fdbase := "/proc/" + strconv.FormatUint(uint64(pid), 10) + "/fd"
-	fdentries, err := unsorted.ReadDir(fdbase)
+	fdbase := procroot + "/" + strconv.FormatUint(uint64(pid), 10) + "/fd"
+	fdentries, err := sockfs.ReadDir(fdbase)
 	if err != nil {
 		return
 	}
@@ -149,8 +214,8 @@ func listeningUDSPathsOfProcess(pid model.PIDType, listeningUDS socketPathsByIno
 	// something of interest to us and the filesystem path it points to (as
 	// usual, subject to the current mount namespace).
 	for _, fdentry := range fdentries {
-		fdlink, err := os.Readlink(fdbase + fdentry.Name())
-		if err != nil || !strings.HasPrefix(fdlink, socketFdPrefix) {
+		fdlink, err := sockfs.Readlink(fdbase + fdentry.Name())
+		if err != nil || !strings.HasPrefix(fdlink, socketFdPrefix) || len(fdlink) == socketFdPrefixLen {
 			continue
 		}
 		ino, err := strconv.ParseUint(fdlink[socketFdPrefixLen:len(fdlink)-1], 10, 64)
@@ -196,8 +261,17 @@ func listeningUDSPaths(rawfds []rawSocketFd, listeningUDS socketPathsByIno) sock
 // listeningUDSVisibleToProcess returns a map of (named) unix domain sockets in
 // listening state in the mount namespace to which the specified process is
 // attached to. The map specifies for each listening unix domain socket both its
-// inode number as the key and its path as value.
-func listeningUDSVisibleToProcess(pid model.PIDType) socketPathsByIno {
+// inode number as the key and its path as value. The PID specified must be
+// correct for the proc filesystem mounted at procroot.
+func listeningUDSVisibleToProcess(procroot string, pid model.PIDType) socketPathsByIno {
+	sox, _ := readListeningUDS(procroot, pid)
+	return sox
+}
+
+// readListeningUDS works as [listeningUDSVisibleToProcess], but additionally
+// returns the error encountered when the list of unix domain sockets cannot be
+// opened, such as when the process is gone or access is denied.
+func readListeningUDS(procroot string, pid model.PIDType) (socketPathsByIno, error) {
 	sox := socketPathsByIno{}
 	// Try to open the list of unix domain sockets currently present in the
 	// system.
@@ -220,10 +294,10 @@ func listeningUDSVisibleToProcess(pid model.PIDType) socketPathsByIno {
 	// aggressively parallelize talking to engines.
 	//
 	// It's "incontinentainers", after all.
-	netunixf, err := os.Open("/proc/" + strconv.FormatUint(uint64(pid), 10) +
+	netunixf, err := sockfs.Open(procroot + "/" + strconv.FormatUint(uint64(pid), 10) +
 		"/net/unix")
 	if err != nil {
-		return nil
+		return nil, err
 	}
 	defer netunixf.Close()
 	// Each line from /proc/[PID]/net/unix lists one socket with its state
@@ -251,7 +325,8 @@ func listeningUDSVisibleToProcess(pid model.PIDType) socketPathsByIno {
 		// line contents. The string is basically aliasing the byte slice and we
 		// thus must not keep any substrings around that survive a single loop.
 		// For this reason we clone the unix domain socket path and only return
-		// this deep copy.
+		// this deep copy. Builds using the “turtlefinder_safe” build tag
+		// forgo this optimization in order to not use unsafe.
 		//
 		// For more background information, please see also:
 		//  - using non-allocating Scanner.Bytes(): https://stackoverflow.com/a/64643397
@@ -290,16 +365,34 @@ func listeningUDSVisibleToProcess(pid model.PIDType) socketPathsByIno {
 		}
 		sox[ino] = path // finally map the socket's inode number to its path.
 	}
-	return sox
+	return sox, nil
 }
 
-// asString returns a string for the specified byte slice, without allocating
-// memory and without copying the contents. In consequence, the underlying byte
-// slice must not be changed while the returned string is alive. Moreover, this
-// variant of alloc-free byte slice to string conversion expects the caller to
-// always pass non-nil byte slices (which is easily guaranteed in our specific
-// contexts).
-//
-// As for the correct usage of unsafe.String please also see
-// https://go101.org/article/unsafe.html.
-func asString(b []byte) string { return unsafe.String(unsafe.SliceData(b), len(b)) }
+// uniqueSocketPaths returns the specified socket paths with any duplicates
+// removed that refer to the same socket, based on the (device and) inode number
+// the paths resolve to. For instance, the same socket might be reachable via
+// multiple paths when bind-mounted or hard-linked. The order of the paths is
+// preserved, keeping only the first path of any duplicates. Paths that cannot
+// be stat'ed are passed through unchanged.
+func uniqueSocketPaths(paths []string) []string {
+	type devino struct {
+		dev uint64
+		ino uint64
+	}
+	seen := map[devino]struct{}{}
+	unique := paths[:0]
+	for _, path := range paths {
+		var stat syscall.Stat_t
+		if path == "" || syscall.Stat(path, &stat) != nil {
+			unique = append(unique, path)
+			continue
+		}
+		key := devino{dev: uint64(stat.Dev), ino: stat.Ino}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		unique = append(unique, path)
+	}
+	return unique
+}
@@ -0,0 +1,96 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/thediveo/lxkns/model"
+)
+
+// numSyntheticUDS is the number of synthetic unix domain sockets listed in the
+// in-memory net/unix fixture of the socket finder benchmarks.
+const numSyntheticUDS = 1000
+
+// numSyntheticEngines is the number of synthetic engine processes sharing the
+// same namespaces in the net/unix cache benchmark.
+const numSyntheticEngines = 50
+
+// syntheticNetUnix returns a synthetic net/unix socket list with
+// numSyntheticUDS sockets, every tenth of them listening.
+func syntheticNetUnix() []byte {
+	var netunix strings.Builder
+	netunix.WriteString("Num       RefCount Protocol Flags    Type St Inode Path\n")
+	for ino := 1; ino <= numSyntheticUDS; ino++ {
+		flags := "00000000"
+		if ino%10 == 0 {
+			flags = "00010000"
+		}
+		fmt.Fprintf(&netunix, "0000000000000000: 00000002 00000000 %s 0001 01 %5d /run/synthetic-%d.sock\n",
+			flags, ino, ino)
+	}
+	return []byte(netunix.String())
+}
+
+// BenchmarkListeningUDSVisibleToProcess benchmarks parsing a synthetic net/unix
+// socket list from an in-memory proc filesystem, so that the benchmark
+// measures only the parsing, but not any real proc filesystem access.
+func BenchmarkListeningUDSVisibleToProcess(b *testing.B) {
+	oldsockfs := sockfs
+	defer func() { sockfs = oldsockfs }()
+	sockfs = &memSockFS{
+		files: fstest.MapFS{
+			"proc/42/net/unix": &fstest.MapFile{Data: syntheticNetUnix()},
+		},
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if sox := listeningUDSVisibleToProcess("/proc", 42); len(sox) != numSyntheticUDS/10 {
+			b.Fatalf("expected %d listening sockets, got %d", numSyntheticUDS/10, len(sox))
+		}
+	}
+}
+
+// BenchmarkNetUnixCache benchmarks getting the listening unix domain sockets
+// of many synthetic engine processes all sharing the same namespaces, once
+// without and once with a net/unix cache for the update pass.
+func BenchmarkNetUnixCache(b *testing.B) {
+	netunix := syntheticNetUnix()
+	files := fstest.MapFS{}
+	links := map[string]string{}
+	for pid := 1; pid <= numSyntheticEngines; pid++ {
+		base := "/proc/" + strconv.Itoa(pid)
+		files[base[1:]+"/net/unix"] = &fstest.MapFile{Data: netunix}
+		links[base+"/ns/mnt"] = "mnt:[4026531841]"
+		links[base+"/ns/net"] = "net:[4026531840]"
+	}
+	oldsockfs := sockfs
+	defer func() { sockfs = oldsockfs }()
+	sockfs = &memSockFS{files: files, links: links}
+
+	for _, cached := range []bool{false, true} {
+		name := "uncached"
+		if cached {
+			name = "cached"
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var cache *netUnixCache
+				if cached {
+					cache = newNetUnixCache()
+				}
+				for pid := 1; pid <= numSyntheticEngines; pid++ {
+					if sox := cache.listeningUDSVisibleToProcess("/proc", model.PIDType(pid)); len(sox) != numSyntheticUDS/10 {
+						b.Fatalf("expected %d listening sockets, got %d", numSyntheticUDS/10, len(sox))
+					}
+				}
+			}
+		})
+	}
+}
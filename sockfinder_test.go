@@ -5,9 +5,14 @@
 package turtlefinder
 
 import (
+	"io"
+	"io/fs"
 	"net"
 	"os"
+	"strings"
+	"testing/fstest"
 
+	"github.com/siemens/turtlefinder/detector"
 	"github.com/thediveo/lxkns/model"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -17,6 +22,55 @@ import (
 	. "github.com/thediveo/success"
 )
 
+// memSockFS is an in-memory sockFS fixture: the fd directories and net/unix
+// files live in a MapFS, while the fd pseudo symlinks live in a separate map.
+// All paths must be absolute.
+type memSockFS struct {
+	files fstest.MapFS
+	links map[string]string
+}
+
+var _ sockFS = (*memSockFS)(nil)
+
+func (m *memSockFS) ReadDir(name string) ([]os.DirEntry, error) {
+	return fs.ReadDir(m.files, strings.TrimPrefix(name, "/"))
+}
+
+func (m *memSockFS) Readlink(name string) (string, error) {
+	if link, ok := m.links[name]; ok {
+		return link, nil
+	}
+	return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+}
+
+func (m *memSockFS) Open(name string) (io.ReadCloser, error) {
+	return m.files.Open(strings.TrimPrefix(name, "/"))
+}
+
+// useSockFS temporarily replaces the socket finder's proc filesystem access
+// with the specified fixture for the duration of the current spec.
+func useSockFS(fixture sockFS) {
+	oldsockfs := sockfs
+	sockfs = fixture
+	DeferCleanup(func() { sockfs = oldsockfs })
+}
+
+// fakeNetUnix is crafted /proc/[PID]/net/unix content, including narrow
+// fields padded with multiple whitespaces, abstract and unnamed sockets,
+// non-listening and non-streaming sockets, as well as malformed lines.
+const fakeNetUnix = `Num       RefCount Protocol Flags    Type St Inode Path
+0000000000000000: 00000002 00000000 00010000 0001 01  1234 /run/padded.sock
+0000000000000000: 00000002 00000000 00010000 0001 01 2345678 /run/docker.sock
+0000000000000000: 00000002 00000000 00010000 0001 01 3456789 @/abstract.sock
+0000000000000000: 00000002 00000000 00010000 0001 01 4567890
+0000000000000000: 00000003 00000000 00000000 0001 03 5678901 /run/connected.sock
+0000000000000000: 00000002 00000000 00010000 0002 01 6789012 /run/dgram.sock
+0000000000000000: 00000002 00000000 00010000 0005 01 7890123 /run/seqpacket.sock
+0000000000000000: 00000002 00000000 0001000Z 0001 01 8901234 /run/badflags.sock
+0000000000000000: 00000002 00000000 00010000 0001 01 notanino /run/badino.sock
+0000000000000000: 00000002
+`
+
 var _ = Describe("socket finder", func() {
 
 	BeforeEach(func() {
@@ -32,7 +86,7 @@ var _ = Describe("socket finder", func() {
 	When("reading socket file descriptors of a process", func() {
 
 		It("reports a non-existing PID", func() {
-			Expect(rawSocketFdsOfProcess("", 0)).Error().To(MatchError(ContainSubstring(
+			Expect(rawSocketFdsOfProcess(defaultProcRoot, 0)).Error().To(MatchError(ContainSubstring(
 				"cannot determine fds for process with PID 0, reason")))
 		})
 
@@ -40,7 +94,7 @@ var _ = Describe("socket finder", func() {
 			if os.Getegid() == 0 {
 				Skip("must be run as non-root")
 			}
-			Expect(rawSocketFdsOfProcess("", 1)).Error().To(MatchError(ContainSubstring(
+			Expect(rawSocketFdsOfProcess(defaultProcRoot, 1)).Error().To(MatchError(ContainSubstring(
 				"permission denied")))
 		})
 
@@ -54,15 +108,103 @@ var _ = Describe("socket finder", func() {
 			Expect(os.WriteFile(fakefds+"/3", []byte("foobar"), 0644)).To(Succeed())
 			Expect(os.Symlink("socket:[", fakefds+"/666")).To(Succeed())
 
-			Expect(rawSocketFdsOfProcess(fakeproc, 123456)).To(ConsistOf(
+			Expect(rawSocketFdsOfProcess(fakeproc+"/proc", 123456)).To(ConsistOf(
 				rawSocketFd{fd: "2", socketino: "2345678"},
 			))
 		})
 
 	})
 
+	When("using an in-memory proc filesystem", func() {
+
+		BeforeEach(func() {
+			useSockFS(&memSockFS{
+				files: fstest.MapFS{
+					"proc/42/net/unix": &fstest.MapFile{Data: []byte(fakeNetUnix)},
+					"proc/42/fd/0":     &fstest.MapFile{},
+					"proc/42/fd/1":     &fstest.MapFile{},
+					"proc/42/fd/3":     &fstest.MapFile{},
+					"proc/42/fd/4":     &fstest.MapFile{},
+					"proc/42/fd/5":     &fstest.MapFile{},
+					"proc/42/fd/6":     &fstest.MapFile{},
+					"proc/42/fd/7":     &fstest.MapFile{},
+				},
+				links: map[string]string{
+					"/proc/42/fd/0": "/dev/null",
+					"/proc/42/fd/1": "pipe:[666]",
+					"/proc/42/fd/3": "socket:[1234]",
+					"/proc/42/fd/4": "socket:[2345678]",
+					"/proc/42/fd/5": "socket:[5678901]",
+					"/proc/42/fd/6": "socket:[",
+					// fd 7 vanished in the meantime, so its link cannot be read.
+				},
+			})
+		})
+
+		It("parses only named listening stream sockets from net/unix", func() {
+			Expect(listeningUDSVisibleToProcess("/proc", 42)).To(Equal(socketPathsByIno{
+				1234:    "/run/padded.sock",
+				2345678: "/run/docker.sock",
+			}))
+			Expect(listeningUDSVisibleToProcess("/proc", 666)).To(BeNil())
+		})
+
+		It("reads only socket fds", func() {
+			Expect(rawSocketFdsOfProcess("/proc", 42)).To(ConsistOf(
+				rawSocketFd{fd: "3", socketino: "1234"},
+				rawSocketFd{fd: "4", socketino: "2345678"},
+				rawSocketFd{fd: "5", socketino: "5678901"},
+			))
+			Expect(rawSocketFdsOfProcess("/proc", 666)).Error().To(HaveOccurred())
+		})
+
+		It("returns the paths of listening sockets of a process", func() {
+			listening := listeningUDSVisibleToProcess("/proc", 42)
+			Expect(listeningUDSPathsOfProcess("/proc", 42, listening)).To(ConsistOf(
+				"/run/padded.sock", "/run/docker.sock"))
+			Expect(listeningUDSPaths(
+				Successful(rawSocketFdsOfProcess("/proc", 42)), listening)).To(Equal(socketPathsByIno{
+				1234:    "/run/padded.sock",
+				2345678: "/run/docker.sock",
+			}))
+			Expect(discoverAPISocketsOfProcess("/proc", 42,
+				func(path string) bool { return path != "/run/docker.sock" }, nil, detector.NewLogger(nil))).To(ConsistOf("/run/padded.sock"))
+		})
+
+		It("logs when a process is gone", func() {
+			var msgs []string
+			lg := detector.NewLogger(func(_ string, msg string, _ ...any) {
+				msgs = append(msgs, msg)
+			})
+			Expect(discoverAPISocketsOfProcess("/proc", 666, nil, nil, lg)).To(BeNil())
+			Expect(msgs).To(ConsistOf(
+				"cannot read listening unix domain sockets of process 666: process is gone"))
+		})
+
+	})
+
+	It("logs when access to net/unix is denied", func() {
+		if os.Geteuid() == 0 {
+			Skip("must be run as non-root")
+		}
+		fakeproc := Successful(os.MkdirTemp("", "fakeproc-*"))
+		defer os.RemoveAll(fakeproc)
+		Expect(os.MkdirAll(fakeproc+"/42/net", 0770)).To(Succeed())
+		Expect(os.WriteFile(fakeproc+"/42/net/unix", []byte(fakeNetUnix), 0000)).To(Succeed())
+
+		var levels, msgs []string
+		lg := detector.NewLogger(func(level, msg string, _ ...any) {
+			levels = append(levels, level)
+			msgs = append(msgs, msg)
+		})
+		Expect(discoverAPISocketsOfProcess(fakeproc, 42, nil, newNetUnixCache(), lg)).To(BeNil())
+		Expect(levels).To(ConsistOf(detector.LevelDebug))
+		Expect(msgs).To(ConsistOf(
+			"cannot read listening unix domain sockets of process 42: permission denied"))
+	})
+
 	It("finds Docker API unix socket", func() {
-		sox := listeningUDSVisibleToProcess(model.PIDType(os.Getpid()))
+		sox := listeningUDSVisibleToProcess(defaultProcRoot, model.PIDType(os.Getpid()))
 		Expect(sox).To(ContainElement("/run/docker.sock"))
 	})
 
@@ -74,14 +216,54 @@ var _ = Describe("socket finder", func() {
 		lsock := Successful(net.Listen("unix", canarysockpath))
 		defer lsock.Close()
 
-		soxpaths := listeningUDSPathsOfProcess(
+		soxpaths := listeningUDSPathsOfProcess(defaultProcRoot,
 			model.PIDType(os.Getpid()),
-			listeningUDSVisibleToProcess(model.PIDType(os.Getpid())))
+			listeningUDSVisibleToProcess(defaultProcRoot, model.PIDType(os.Getpid())))
 		Expect(soxpaths).To(ContainElement(canarysockpath))
 
-		rawfds := Successful(rawSocketFdsOfProcess("", model.PIDType(os.Getpid())))
-		lsox := listeningUDSPaths(rawfds, listeningUDSVisibleToProcess(model.PIDType(os.Getpid())))
+		rawfds := Successful(rawSocketFdsOfProcess(defaultProcRoot, model.PIDType(os.Getpid())))
+		lsox := listeningUDSPaths(rawfds, listeningUDSVisibleToProcess(defaultProcRoot, model.PIDType(os.Getpid())))
 		Expect(lsox).To(ContainElement(canarysockpath))
 	})
 
+	It("filters socket paths", func() {
+		fakesockdir := Successful(os.MkdirTemp("", "fakesock-*"))
+		defer os.RemoveAll(fakesockdir)
+
+		canarysockpath := fakesockdir + "/canary.sock"
+		lsock := Successful(net.Listen("unix", canarysockpath))
+		defer lsock.Close()
+		othersockpath := fakesockdir + "/other.sock"
+		osock := Successful(net.Listen("unix", othersockpath))
+		defer osock.Close()
+
+		Expect(discoverAPISocketsOfProcess(defaultProcRoot, model.PIDType(os.Getpid()), nil, nil, detector.NewLogger(nil))).To(
+			ContainElements(canarysockpath, othersockpath))
+		Expect(discoverAPISocketsOfProcess(defaultProcRoot, model.PIDType(os.Getpid()),
+			func(path string) bool { return path == canarysockpath }, nil, detector.NewLogger(nil))).To(
+			ConsistOf(canarysockpath))
+		Expect(discoverAPISocketsOfProcess(defaultProcRoot, model.PIDType(os.Getpid()),
+			func(string) bool { return false }, nil, detector.NewLogger(nil))).To(BeNil())
+	})
+
+	It("deduplicates socket paths referencing the same socket", func() {
+		fakesockdir := Successful(os.MkdirTemp("", "fakesock-*"))
+		defer os.RemoveAll(fakesockdir)
+
+		canarysockpath := fakesockdir + "/canary.sock"
+		lsock := Successful(net.Listen("unix", canarysockpath))
+		defer lsock.Close()
+		aliassockpath := fakesockdir + "/alias.sock"
+		Expect(os.Link(canarysockpath, aliassockpath)).To(Succeed())
+		othersockpath := fakesockdir + "/other.sock"
+		osock := Successful(net.Listen("unix", othersockpath))
+		defer osock.Close()
+
+		Expect(uniqueSocketPaths([]string{
+			canarysockpath, "", aliassockpath, othersockpath, "/etc/rumpelpumpel",
+		})).To(HaveExactElements(
+			canarysockpath, "", othersockpath, "/etc/rumpelpumpel",
+		))
+	})
+
 })
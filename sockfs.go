@@ -0,0 +1,46 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"io"
+	"os"
+
+	"github.com/siemens/turtlefinder/unsorted"
+)
+
+// sockFS abstracts the proc filesystem reads the socket finder needs for
+// discovering listening unix domain sockets: reading the fd directory of a
+// process, reading its fd pseudo symlinks, and reading its “net/unix” socket
+// list. This allows unit testing the socket finder against in-memory proc
+// filesystem fixtures, including crafted “net/unix” contents.
+type sockFS interface {
+	// ReadDir reads the named directory, returning its entries in no
+	// particular order.
+	ReadDir(name string) ([]os.DirEntry, error)
+	// Readlink returns the destination of the named (pseudo) symbolic link.
+	Readlink(name string) (string, error)
+	// Open opens the named file for reading.
+	Open(name string) (io.ReadCloser, error)
+}
+
+// osSockFS is the sockFS accessing the real proc filesystem.
+type osSockFS struct{}
+
+var _ sockFS = (*osSockFS)(nil)
+
+// ReadDir reads the named directory unsorted, so we don't waste CPU cycles on
+// sorting directory entries that we don't need to be sorted.
+func (osSockFS) ReadDir(name string) ([]os.DirEntry, error) { return unsorted.ReadDir(name) }
+
+// Readlink returns the destination of the named (pseudo) symbolic link.
+func (osSockFS) Readlink(name string) (string, error) { return os.Readlink(name) }
+
+// Open opens the named file for reading.
+func (osSockFS) Open(name string) (io.ReadCloser, error) { return os.Open(name) }
+
+// sockfs is the proc filesystem access used by the socket finder; unit tests
+// might temporarily replace it with in-memory fixtures.
+var sockfs sockFS = osSockFS{}
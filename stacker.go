@@ -5,20 +5,53 @@
 package turtlefinder
 
 import (
+	"strings"
+
 	"github.com/thediveo/lxkns/model"
 	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 )
 
 // TurtlefinderContainerPrefixLabelName defines the label name for attaching
 // prefix information about the engine-hierarchy to containers. Discovery client
 // can use these container labels to find out the hierarchy of containers. For
 // instance, if container "A" is managed by a container engine hosted inside
-// container "B", then container "A" is labelled with prefix "B".
+// container "B", then container "A" is labelled with prefix "B". The label
+// name used by a TurtleFinder can be changed using [WithPrefixLabelName].
 const TurtlefinderContainerPrefixLabelName = "turtlefinder/container/prefix"
 
 // PrefixSeparator is the separator used in hierarchical prefixes.
 const PrefixSeparator = "/"
 
+// EngineRelation describes a container engine running inside a container that
+// is managed by another (parent) container engine.
+type EngineRelation struct {
+	Parent    *Engine          // engine managing the container enclosing the child engine.
+	Container *model.Container // container enclosing the child engine.
+	Child     *Engine          // engine running inside the container.
+}
+
+// EngineHierarchy returns the relations between container engines running
+// inside containers and the (parent) container engines managing these
+// containers, as found by the most recent [TurtleFinder.Containers] call. Top-
+// level engines not running inside any container have no relations. Engines
+// excluded from stacking using [WithStackingExclusion] are considered to be
+// top-level engines. The relations are sorted by the PIDs of the child
+// engines.
+func (f *TurtleFinder) EngineHierarchy() []EngineRelation {
+	f.hierarchymu.Lock()
+	defer f.hierarchymu.Unlock()
+	return slices.Clone(f.hierarchy)
+}
+
+// setEngineHierarchy sets the engine relations found by the most recent
+// [TurtleFinder.Containers] call.
+func (f *TurtleFinder) setEngineHierarchy(relations []EngineRelation) {
+	f.hierarchymu.Lock()
+	defer f.hierarchymu.Unlock()
+	f.hierarchy = relations
+}
+
 // stackedEngine temporarily stores additional details about a container engine
 // while we figure out if and how engines have been stacked, or rather, put into
 // each other.
@@ -37,10 +70,57 @@ func (e *stackedEngine) Add(child *stackedEngine) {
 	e.Children = append(e.Children, child)
 }
 
-// stackEngines discovers the hierarchical relationships (if any) between
+// StackEngines discovers the hierarchical relationships (if any) between
 // container engines, that is, when one engine is running inside a container
-// managed by another container engine.
-func stackEngines(containers []*model.Container, engines []*Engine, proctable model.ProcessTable) {
+// managed by another container engine. The resulting engine hierarchy prefixes
+// are then attached to the specified containers, using the
+// [TurtlefinderContainerPrefixLabelName] label. Paused containers are taken into
+// account the same as running containers.
+//
+// [TurtleFinder.Containers] already calls StackEngines as part of its
+// discovery, so callers need to call StackEngines only when they want to
+// compute the engine hierarchy for some set of containers and engines they
+// already have. The process table must contain the processes of the engines
+// as well as their ancestors; otherwise, StackEngines needs to fetch the
+// missing engine process details from the proc filesystem.
+func StackEngines(containers []*model.Container, engines []*Engine, proctable model.ProcessTable) {
+	stackEngines(containers, engines, proctable, defaultProcRoot, nil, TurtlefinderContainerPrefixLabelName)
+}
+
+// insidePausedContainer returns true if the process of the specified engine is
+// inside one of the specified containers and this container is paused. The
+// process table must contain the engine process as well as its ancestors.
+func insidePausedContainer(engine *Engine, containers []*model.Container, proctable model.ProcessTable) bool {
+	containersByPID := make(map[model.PIDType]*model.Container, len(containers))
+	for _, container := range containers {
+		containersByPID[container.PID] = container
+	}
+	for proc := proctable[model.PIDType(engine.PID())]; proc != nil; proc = proc.Parent {
+		if container, ok := containersByPID[proc.PID]; ok {
+			return container.Paused
+		}
+	}
+	return false
+}
+
+// stackEngines works as [StackEngines], but additionally treats the engines
+// for which the specified exclusion function returns true as top-level engines,
+// even if they're running inside a container. A nil exclusion function excludes
+// no engines. The prefixes are attached using the specified label name.
+// Engine processes missing from the process table are fetched from the proc
+// filesystem mounted at the specified procroot.
+//
+// stackEngines returns the relations between child engines and the parent
+// engines managing the containers the child engines are running in, sorted by
+// the PIDs of the child engines.
+func stackEngines(
+	containers []*model.Container,
+	engines []*Engine,
+	proctable model.ProcessTable,
+	procroot string,
+	exclude func(e *Engine) bool,
+	labelname string,
+) []EngineRelation {
 	// Let's build an index for mapping the PIDs of the containers' initial
 	// processes to their containers.
 	containersByPID := map[model.PIDType]*model.Container{}
@@ -54,6 +134,8 @@ func stackEngines(containers []*model.Container, engines []*Engine, proctable mo
 	// We also use this chance to see if an engine is inside a container and in
 	// which one in particular.
 	stackedEngines := map[model.PIDType]*stackedEngine{}
+	enginesByPID := map[model.PIDType][]*Engine{}
+	relations := []EngineRelation{}
 	// The hierarchy is formed by engines inside containers, and these
 	// containers then again belonging to engines, and so on. Now in case of
 	// engines that have been socket-activated in this run, we lack the
@@ -66,7 +148,7 @@ func stackEngines(containers []*model.Container, engines []*Engine, proctable mo
 		if proc != nil {
 			continue
 		}
-		proc = model.NewProcess(model.PIDType(engine.PID()), false)
+		proc = model.NewProcessInProcfs(model.PIDType(engine.PID()), false, procroot)
 		if proc == nil {
 			continue // we've lost this engine already, anyway.
 		}
@@ -91,6 +173,9 @@ func stackEngines(containers []*model.Container, engines []*Engine, proctable mo
 			container      *model.Container
 		)
 		proc := proctable[model.PIDType(engine.PID())]
+		if exclude != nil && exclude(engine) {
+			proc = nil // don't climb, so this engine becomes a top-level engine.
+		}
 		for proc != nil {
 			var ok bool
 			if container, ok = containersByPID[proc.PID]; ok {
@@ -101,10 +186,15 @@ func stackEngines(containers []*model.Container, engines []*Engine, proctable mo
 			// rinse and repeat until container PID hit or falling off root.
 			proc = proc.Parent
 		}
-		stackedEngines[model.PIDType(engine.PID())] = &stackedEngine{
+		if container != nil {
+			relations = append(relations, EngineRelation{Container: container, Child: engine})
+		}
+		enginesByPID[model.PIDType(engine.PID())] = append(enginesByPID[model.PIDType(engine.PID())], engine)
+		steng := &stackedEngine{
 			EncloserName:      name,
 			EncloserEnginePID: outerEnginePID,
 		}
+		stackedEngines[model.PIDType(engine.PID())] = steng
 	}
 	// Now that we know which engines are containerized, set these engines to be
 	// children of the container engines managing the engine-enclosing
@@ -115,7 +205,7 @@ func stackEngines(containers []*model.Container, engines []*Engine, proctable mo
 	var nullEngine = &stackedEngine{} // acts as "fake" root
 	for _, engine := range stackedEngines {
 		if pid := engine.EncloserEnginePID; pid != 0 {
-			if parentEngine := stackedEngines[pid]; parentEngine != nil {
+			if parentEngine, ok := stackedEngines[pid]; ok {
 				parentEngine.Add(engine)
 				continue
 			}
@@ -152,6 +242,42 @@ func stackEngines(containers []*model.Container, engines []*Engine, proctable mo
 				cachedEnginePrefix = ""
 			}
 		}
-		container.Labels[TurtlefinderContainerPrefixLabelName] = cachedEnginePrefix
+		if container.Labels == nil {
+			container.Labels = model.Labels{}
+		}
+		container.Labels[labelname] = cachedEnginePrefix
+	}
+	// And finally, finally: tell which engines are parents of which child
+	// engines. As a single engine process might be home to multiple engines,
+	// such as containerd with its native and CRI APIs, we need to pick the
+	// parent engine actually managing the enclosing container.
+	parentOf := func(cntrengine *model.ContainerEngine) *Engine {
+		candidates := enginesByPID[cntrengine.PID]
+		switch len(candidates) {
+		case 0:
+			return nil
+		case 1:
+			return candidates[0]
+		}
+		for _, candidate := range candidates {
+			if candidate.Type() == cntrengine.Type && candidate.API() == cntrengine.API {
+				return candidate
+			}
+		}
+		return candidates[0]
 	}
+	related := relations[:0]
+	for _, rel := range relations {
+		if rel.Parent = parentOf(rel.Container.Engine); rel.Parent == nil {
+			continue
+		}
+		related = append(related, rel)
+	}
+	slices.SortFunc(related, func(a, b EngineRelation) int {
+		if a.Child.PID() != b.Child.PID() {
+			return a.Child.PID() - b.Child.PID()
+		}
+		return strings.Compare(a.Child.API(), b.Child.API())
+	})
+	return related
 }
@@ -19,9 +19,11 @@ import (
 	"github.com/thediveo/morbyd/run"
 	"github.com/thediveo/morbyd/session"
 	"github.com/thediveo/morbyd/timestamper"
+	"github.com/thediveo/whalewatcher"
 	"github.com/thediveo/whalewatcher/engineclient/cri"
 	"github.com/thediveo/whalewatcher/engineclient/cri/test/img"
 	"github.com/thediveo/whalewatcher/test"
+	"github.com/thediveo/whalewatcher/watcher"
 	"github.com/thediveo/whalewatcher/watcher/containerd"
 	"github.com/thediveo/whalewatcher/watcher/moby"
 	"golang.org/x/exp/slices"
@@ -222,3 +224,405 @@ func isStackerTestEngineTyp(e *model.ContainerEngine) bool {
 		return true
 	}
 }
+
+// pidWatcher is a stub watcher.Watcher that only knows the PID of its engine.
+type pidWatcher struct {
+	watcher.Watcher
+	pid int
+}
+
+func (w *pidWatcher) PID() int { return w.pid }
+
+// frozenWatcher is a watcher.Watcher of an engine that doesn't answer any
+// queries until thawed, such as when the engine is inside a paused container.
+type frozenWatcher struct {
+	watcher.Watcher
+	thaw chan struct{}
+}
+
+func (w *frozenWatcher) Version(ctx context.Context) string {
+	<-w.thaw
+	return ""
+}
+
+// freeze the specified engine until the current spec ends.
+func freeze(engine *Engine) {
+	w := &frozenWatcher{Watcher: engine.Watcher, thaw: make(chan struct{})}
+	DeferCleanup(func() { close(w.thaw) })
+	engine.Watcher = w
+	engine.versionrefresh = time.Nanosecond
+}
+
+var _ = Describe("stacking engines", func() {
+
+	It("stacks engines from given containers and engines", func() {
+		init := &model.Process{PID: 1}
+		outerEngineProc := &model.Process{PID: 100, PPID: 1, Parent: init}
+		innerCntrProc := &model.Process{PID: 200, PPID: 100, Parent: outerEngineProc}
+		innerEngineProc := &model.Process{PID: 300, PPID: 200, Parent: innerCntrProc}
+		procs := model.ProcessTable{}
+		for _, proc := range []*model.Process{init, outerEngineProc, innerCntrProc, innerEngineProc} {
+			procs[proc.PID] = proc
+		}
+
+		outerEngine := &model.ContainerEngine{PID: 100}
+		innerEngine := &model.ContainerEngine{PID: 300}
+		innerCntr := &model.Container{Name: "inner", PID: 200, Engine: outerEngine}
+		deepCntr := &model.Container{Name: "deep", PID: 400, Engine: innerEngine,
+			Labels: model.Labels{"foo": "bar"}}
+
+		StackEngines(
+			[]*model.Container{innerCntr, deepCntr},
+			[]*Engine{
+				{Watcher: &pidWatcher{pid: 100}},
+				{Watcher: &pidWatcher{pid: 300}},
+			},
+			procs)
+		Expect(innerCntr.Labels).To(HaveKeyWithValue(TurtlefinderContainerPrefixLabelName, ""))
+		Expect(deepCntr.Labels).To(And(
+			HaveKeyWithValue(TurtlefinderContainerPrefixLabelName, "inner"),
+			HaveKeyWithValue("foo", "bar")))
+	})
+
+	It("stacks engines inside paused containers", func() {
+		init := &model.Process{PID: 1}
+		outerEngineProc := &model.Process{PID: 100, PPID: 1, Parent: init}
+		pausedCntrProc := &model.Process{PID: 200, PPID: 100, Parent: outerEngineProc}
+		innerEngineProc := &model.Process{PID: 300, PPID: 200, Parent: pausedCntrProc}
+		deepCntrProc := &model.Process{PID: 400, PPID: 300, Parent: innerEngineProc}
+		nestedEngineProc := &model.Process{PID: 500, PPID: 400, Parent: deepCntrProc}
+		procs := model.ProcessTable{}
+		for _, proc := range []*model.Process{
+			init, outerEngineProc, pausedCntrProc, innerEngineProc, deepCntrProc, nestedEngineProc,
+		} {
+			procs[proc.PID] = proc
+		}
+
+		outerEngine := &model.ContainerEngine{PID: 100}
+		innerEngine := &model.ContainerEngine{PID: 300}
+		nestedEngine := &model.ContainerEngine{PID: 500}
+		pausedCntr := &model.Container{Name: "paused", PID: 200, Paused: true, Engine: outerEngine}
+		deepCntr := &model.Container{Name: "deep", PID: 400, Paused: true, Engine: innerEngine}
+		deeperCntr := &model.Container{Name: "deeper", PID: 600, Engine: nestedEngine}
+
+		StackEngines(
+			[]*model.Container{pausedCntr, deepCntr, deeperCntr},
+			[]*Engine{
+				{Watcher: &pidWatcher{pid: 100}},
+				{Watcher: &pidWatcher{pid: 300}},
+				{Watcher: &pidWatcher{pid: 500}},
+			},
+			procs)
+		Expect(pausedCntr.Labels).To(HaveKeyWithValue(TurtlefinderContainerPrefixLabelName, ""))
+		Expect(deepCntr.Labels).To(HaveKeyWithValue(TurtlefinderContainerPrefixLabelName, "paused"))
+		Expect(deeperCntr.Labels).To(HaveKeyWithValue(TurtlefinderContainerPrefixLabelName, "paused/deep"))
+	})
+
+	It("returns the engine hierarchy", func() {
+		init := &model.Process{PID: 1}
+		outerEngineProc := &model.Process{PID: 100, PPID: 1, Parent: init}
+		innerCntrProc := &model.Process{PID: 200, PPID: 100, Parent: outerEngineProc}
+		innerEngineProc := &model.Process{PID: 300, PPID: 200, Parent: innerCntrProc}
+		deepCntrProc := &model.Process{PID: 400, PPID: 300, Parent: innerEngineProc}
+		nestedEngineProc := &model.Process{PID: 500, PPID: 400, Parent: deepCntrProc}
+		procs := model.ProcessTable{}
+		for _, proc := range []*model.Process{
+			init, outerEngineProc, innerCntrProc, innerEngineProc, deepCntrProc, nestedEngineProc,
+		} {
+			procs[proc.PID] = proc
+		}
+
+		outerEngine := &model.ContainerEngine{PID: 100}
+		innerEngine := &model.ContainerEngine{PID: 300}
+		nestedEngine := &model.ContainerEngine{PID: 500}
+		innerCntr := &model.Container{Name: "inner", PID: 200, Engine: outerEngine}
+		deepCntr := &model.Container{Name: "deep", PID: 400, Engine: innerEngine}
+		deeperCntr := &model.Container{Name: "deeper", PID: 600, Engine: nestedEngine}
+
+		outer := &Engine{Watcher: &pidWatcher{pid: 100}}
+		inner := &Engine{Watcher: &pidWatcher{pid: 300}}
+		nested := &Engine{Watcher: &pidWatcher{pid: 500}}
+		relations := stackEngines(
+			[]*model.Container{innerCntr, deepCntr, deeperCntr},
+			[]*Engine{nested, outer, inner},
+			procs,
+			defaultProcRoot,
+			nil,
+			TurtlefinderContainerPrefixLabelName)
+		Expect(relations).To(HaveExactElements(
+			EngineRelation{Parent: outer, Container: innerCntr, Child: inner},
+			EngineRelation{Parent: inner, Container: deepCntr, Child: nested},
+		))
+
+		By("treating excluded engines as top-level engines")
+		Expect(stackEngines(
+			[]*model.Container{innerCntr, deepCntr, deeperCntr},
+			[]*Engine{nested, outer, inner},
+			procs,
+			defaultProcRoot,
+			func(e *Engine) bool { return e.PID() == 300 },
+			TurtlefinderContainerPrefixLabelName)).To(HaveExactElements(
+			EngineRelation{Parent: inner, Container: deepCntr, Child: nested},
+		))
+	})
+
+	It("fetches missing engine processes from the proc filesystem passed", func() {
+		init := &model.Process{PID: 1}
+		cntrProc := &model.Process{PID: model.PIDType(os.Getppid()), PPID: 1, Parent: init}
+		procs := model.ProcessTable{init.PID: init, cntrProc.PID: cntrProc}
+
+		cntr := &model.Container{Name: "cntr", PID: cntrProc.PID,
+			Engine: &model.ContainerEngine{PID: 1}}
+		outer := &Engine{Watcher: &pidWatcher{pid: 1}}
+		inner := &Engine{Watcher: &pidWatcher{pid: os.Getpid()}}
+
+		Expect(stackEngines(
+			[]*model.Container{cntr},
+			[]*Engine{outer, inner},
+			procs,
+			GinkgoT().TempDir(),
+			nil,
+			TurtlefinderContainerPrefixLabelName)).To(BeEmpty())
+		Expect(stackEngines(
+			[]*model.Container{cntr},
+			[]*Engine{outer, inner},
+			procs,
+			defaultProcRoot,
+			nil,
+			TurtlefinderContainerPrefixLabelName)).To(HaveExactElements(
+			EngineRelation{Parent: outer, Container: cntr, Child: inner},
+		))
+	})
+
+	It("picks the parent engine managing the enclosing container", func() {
+		init := &model.Process{PID: 1}
+		outerEngineProc := &model.Process{PID: 100, PPID: 1, Parent: init}
+		innerCntrProc := &model.Process{PID: 200, PPID: 100, Parent: outerEngineProc}
+		innerEngineProc := &model.Process{PID: 300, PPID: 200, Parent: innerCntrProc}
+		procs := model.ProcessTable{}
+		for _, proc := range []*model.Process{init, outerEngineProc, innerCntrProc, innerEngineProc} {
+			procs[proc.PID] = proc
+		}
+
+		native := NewStaticEngine("containerd.io", "1", "/run/containerd/containerd.sock", 100)
+		cri := NewStaticEngine("cri-api.k8s.io", "1", "/run/containerd/containerd.sock", 100)
+		inner := NewStaticEngine("docker.com", "2", "/run/docker.sock", 300)
+		innerCntr := &model.Container{Name: "inner", PID: 200,
+			Engine: &model.ContainerEngine{PID: 100, Type: "cri-api.k8s.io", API: "/run/containerd/containerd.sock"}}
+
+		Expect(stackEngines(
+			[]*model.Container{innerCntr},
+			[]*Engine{native, cri, inner},
+			procs,
+			defaultProcRoot,
+			nil,
+			TurtlefinderContainerPrefixLabelName)).To(HaveExactElements(
+			EngineRelation{Parent: cri, Container: innerCntr, Child: inner},
+		))
+	})
+
+	It("remembers the engine hierarchy of the most recent discovery", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx },
+			WithInjectedEngines(
+				NewStaticEngine("docker.com", "outer", "/run/docker.sock", 100,
+					&whalewatcher.Container{ID: "1", Name: "inner", PID: 200}),
+				NewStaticEngine("docker.com", "inner", "/proc/200/root/run/docker.sock", 300)))
+		defer tf.Close()
+		Expect(tf.EngineHierarchy()).To(BeEmpty())
+
+		init := &model.Process{PID: 1}
+		outerEngineProc := &model.Process{PID: 100, PPID: 1, Parent: init}
+		innerCntrProc := &model.Process{PID: 200, PPID: 100, Parent: outerEngineProc}
+		innerEngineProc := &model.Process{PID: 300, PPID: 200, Parent: innerCntrProc}
+		procs := model.ProcessTable{}
+		for _, proc := range []*model.Process{init, outerEngineProc, innerCntrProc, innerEngineProc} {
+			procs[proc.PID] = proc
+		}
+		_ = tf.Containers(ctx, procs, nil)
+		Expect(tf.EngineHierarchy()).To(ConsistOf(And(
+			HaveField("Parent.ID", "outer"),
+			HaveField("Container.Name", "inner"),
+			HaveField("Child.ID", "inner"),
+		)))
+	})
+
+	It("stacks the last seen containers of frozen engines inside paused containers", func(ctx context.Context) {
+		frozen := NewStaticEngine("docker.com", "frozen", "/proc/200/root/run/docker.sock", 300,
+			&whalewatcher.Container{ID: "2", Name: "deep", PID: 400})
+		freeze(frozen)
+		tf := New(func() context.Context { return ctx },
+			WithEngineQueryTimeout(100*time.Millisecond),
+			WithInjectedEngines(
+				NewStaticEngine("docker.com", "outer", "/run/docker.sock", 100,
+					&whalewatcher.Container{ID: "1", Name: "paused", PID: 200, Paused: true}),
+				frozen))
+		defer tf.Close()
+
+		init := &model.Process{PID: 1}
+		outerEngineProc := &model.Process{PID: 100, PPID: 1, Parent: init}
+		pausedCntrProc := &model.Process{PID: 200, PPID: 100, Parent: outerEngineProc}
+		frozenEngineProc := &model.Process{PID: 300, PPID: 200, Parent: pausedCntrProc}
+		procs := model.ProcessTable{}
+		for _, proc := range []*model.Process{init, outerEngineProc, pausedCntrProc, frozenEngineProc} {
+			procs[proc.PID] = proc
+		}
+		Expect(tf.Containers(ctx, procs, nil)).To(ConsistOf(
+			HaveField("Name", "paused"),
+			And(HaveField("Name", "deep"),
+				HaveField("Labels", HaveKeyWithValue(TurtlefinderContainerPrefixLabelName, "paused")))))
+	})
+
+	It("doesn't fall back to the last seen containers of frozen engines elsewhere", func(ctx context.Context) {
+		frozen := NewStaticEngine("docker.com", "frozen", "/run/docker.sock", 100,
+			&whalewatcher.Container{ID: "1", Name: "lost", PID: 200})
+		freeze(frozen)
+		tf := New(func() context.Context { return ctx },
+			WithEngineQueryTimeout(100*time.Millisecond),
+			WithInjectedEngines(frozen))
+		defer tf.Close()
+		Expect(tf.Containers(ctx, model.ProcessTable{}, nil)).To(BeEmpty())
+	})
+
+	It("treats excluded engines as top-level engines", func() {
+		init := &model.Process{PID: 1}
+		outerEngineProc := &model.Process{PID: 100, PPID: 1, Parent: init}
+		innerCntrProc := &model.Process{PID: 200, PPID: 100, Parent: outerEngineProc}
+		innerEngineProc := &model.Process{PID: 300, PPID: 200, Parent: innerCntrProc}
+		deepCntrProc := &model.Process{PID: 400, PPID: 300, Parent: innerEngineProc}
+		nestedEngineProc := &model.Process{PID: 500, PPID: 400, Parent: deepCntrProc}
+		procs := model.ProcessTable{}
+		for _, proc := range []*model.Process{
+			init, outerEngineProc, innerCntrProc, innerEngineProc, deepCntrProc, nestedEngineProc,
+		} {
+			procs[proc.PID] = proc
+		}
+
+		outerEngine := &model.ContainerEngine{PID: 100}
+		innerEngine := &model.ContainerEngine{PID: 300}
+		nestedEngine := &model.ContainerEngine{PID: 500}
+		innerCntr := &model.Container{Name: "inner", PID: 200, Engine: outerEngine}
+		deepCntr := &model.Container{Name: "deep", PID: 400, Engine: innerEngine}
+		deeperCntr := &model.Container{Name: "deeper", PID: 600, Engine: nestedEngine}
+
+		stackEngines(
+			[]*model.Container{innerCntr, deepCntr, deeperCntr},
+			[]*Engine{
+				{Watcher: &pidWatcher{pid: 100}},
+				{Watcher: &pidWatcher{pid: 300}},
+				{Watcher: &pidWatcher{pid: 500}},
+			},
+			procs,
+			defaultProcRoot,
+			func(e *Engine) bool { return e.PID() == 300 },
+			TurtlefinderContainerPrefixLabelName)
+		Expect(innerCntr.Labels).To(HaveKeyWithValue(TurtlefinderContainerPrefixLabelName, ""))
+		Expect(deepCntr.Labels).To(HaveKeyWithValue(TurtlefinderContainerPrefixLabelName, ""))
+		Expect(deeperCntr.Labels).To(HaveKeyWithValue(TurtlefinderContainerPrefixLabelName, "deep"))
+	})
+
+	It("configures the stacking exclusion", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx })
+		defer tf.Close()
+		Expect(tf.stackexclusion).To(BeNil())
+
+		tf = New(func() context.Context { return ctx },
+			WithStackingExclusion(func(e *Engine) bool { return true }))
+		defer tf.Close()
+		Expect(tf.stackexclusion).NotTo(BeNil())
+	})
+
+	It("attaches prefixes using a custom label name", func() {
+		init := &model.Process{PID: 1}
+		outerEngineProc := &model.Process{PID: 100, PPID: 1, Parent: init}
+		innerCntrProc := &model.Process{PID: 200, PPID: 100, Parent: outerEngineProc}
+		innerEngineProc := &model.Process{PID: 300, PPID: 200, Parent: innerCntrProc}
+		procs := model.ProcessTable{}
+		for _, proc := range []*model.Process{init, outerEngineProc, innerCntrProc, innerEngineProc} {
+			procs[proc.PID] = proc
+		}
+
+		outerEngine := &model.ContainerEngine{PID: 100}
+		innerEngine := &model.ContainerEngine{PID: 300}
+		innerCntr := &model.Container{Name: "inner", PID: 200, Engine: outerEngine}
+		deepCntr := &model.Container{Name: "deep", PID: 400, Engine: innerEngine}
+
+		stackEngines(
+			[]*model.Container{innerCntr, deepCntr},
+			[]*Engine{
+				{Watcher: &pidWatcher{pid: 100}},
+				{Watcher: &pidWatcher{pid: 300}},
+			},
+			procs,
+			defaultProcRoot,
+			nil,
+			"example.org/prefix")
+		Expect(deepCntr.Labels).To(And(
+			HaveKeyWithValue("example.org/prefix", "inner"),
+			Not(HaveKey(TurtlefinderContainerPrefixLabelName))))
+		Expect(innerCntr.Labels).To(HaveKeyWithValue("example.org/prefix", ""))
+	})
+
+	It("configures the prefix label name", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx })
+		defer tf.Close()
+		Expect(tf.prefixlabelname).To(Equal(TurtlefinderContainerPrefixLabelName))
+
+		tf = New(func() context.Context { return ctx }, WithPrefixLabelName("example.org/prefix"))
+		defer tf.Close()
+		Expect(tf.prefixlabelname).To(Equal("example.org/prefix"))
+
+		tf = New(func() context.Context { return ctx }, WithPrefixLabelName(""))
+		defer tf.Close()
+		Expect(tf.prefixlabelname).To(Equal(TurtlefinderContainerPrefixLabelName))
+	})
+
+	It("stacks Docker-in-Docker engines with renamed API sockets and translated container PIDs", func(ctx context.Context) {
+		initialpidns := &fakePIDNamespace{}
+		dindpidns := &fakePIDNamespace{parent: initialpidns}
+		init := &model.Process{PID: 1,
+			ProTaskCommon: model.ProTaskCommon{Name: "systemd", Namespaces: model.NamespacesSet{model.PIDNS: initialpidns}}}
+		outerEngineProc := &model.Process{PID: 100, PPID: 1, Parent: init,
+			ProTaskCommon: model.ProTaskCommon{Name: "dockerd", Namespaces: model.NamespacesSet{model.PIDNS: initialpidns}}}
+		dindCntrProc := &model.Process{PID: 200, PPID: 100, Parent: outerEngineProc,
+			ProTaskCommon: model.ProTaskCommon{Name: "docker-init", Namespaces: model.NamespacesSet{model.PIDNS: dindpidns}}}
+		dindEngineProc := &model.Process{PID: 202, PPID: 200, Parent: dindCntrProc,
+			ProTaskCommon: model.ProTaskCommon{Name: "dockerd", Namespaces: model.NamespacesSet{model.PIDNS: dindpidns}}}
+		procs := model.ProcessTable{}
+		for _, proc := range []*model.Process{init, outerEngineProc, dindCntrProc, dindEngineProc} {
+			procs[proc.PID] = proc
+		}
+		// The dind engine sees itself as PID 7 inside its container's PID
+		// namespace and reports its canary container with PID 42 in this
+		// namespace, whereas the process table lists the dind engine with its
+		// PID 202 in the initial PID namespace.
+		pidmap := &fakePIDMap{
+			from: dindpidns,
+			to:   initialpidns,
+			pids: map[model.PIDType]model.PIDType{7: 202, 42: 1042},
+		}
+
+		outer := NewStaticEngine("docker.com", "outer", "unix:///run/docker.sock", 100,
+			&whalewatcher.Container{ID: "dind-id", Name: "dind", PID: 200})
+		dind := NewStaticEngine("docker.com", "dind", "unix:///proc/202/root/var/run/docker-dind.sock", 202,
+			&whalewatcher.Container{ID: "canary-id", Name: "canary", PID: 42})
+		tf := New(func() context.Context { return ctx },
+			WithInjectedEngines(outer, dind), WithPIDTranslation())
+		defer tf.Close()
+
+		containers := tf.Containers(ctx, procs, pidmap)
+		Expect(containers).To(ConsistOf(
+			And(
+				HaveField("Name", "dind"),
+				HaveField("Labels", HaveKeyWithValue(TurtlefinderContainerPrefixLabelName, "")),
+			),
+			And(
+				HaveField("Name", "canary"),
+				HaveField("PID", model.PIDType(1042)),
+				HaveField("Engine.PID", model.PIDType(202)),
+				HaveField("Engine.API", "unix:///proc/202/root/var/run/docker-dind.sock"),
+				HaveField("Labels", HaveKeyWithValue(TurtlefinderContainerPrefixLabelName, "dind")),
+			),
+		))
+	})
+
+})
@@ -0,0 +1,76 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+
+	"github.com/thediveo/lxkns/model"
+	"github.com/thediveo/whalewatcher"
+	"github.com/thediveo/whalewatcher/watcher"
+)
+
+// NewStaticEngine returns a new in-memory Engine of the specified type, ID, API
+// endpoint path, and PID, with a fixed list of containers. Static engines don't
+// talk to any container engine; they are intended for injecting fake engines
+// using [WithInjectedEngines] when unit testing code using a TurtleFinder as
+// its [github.com/thediveo/lxkns/containerizer.Containerizer] or [Overseer],
+// without the need for any real container engines.
+func NewStaticEngine(
+	typ string, id string, api string, pid model.PIDType, containers ...*whalewatcher.Container,
+) *Engine {
+	portfolio := whalewatcher.NewPortfolio()
+	for _, container := range containers {
+		portfolio.Add(container)
+	}
+	ready := make(chan struct{})
+	close(ready)
+	events := make(chan watcher.ContainerEvent)
+	close(events)
+	return &Engine{
+		Watcher: &staticWatcher{
+			typ:       typ,
+			id:        id,
+			api:       api,
+			pid:       int(pid),
+			portfolio: portfolio,
+			ready:     ready,
+			events:    events,
+		},
+		ID:   id,
+		Done: make(chan struct{}),
+	}
+}
+
+// staticWatcher is a watcher.Watcher with a fixed container portfolio that
+// doesn't watch anything.
+type staticWatcher struct {
+	typ       string
+	id        string
+	api       string
+	pid       int
+	portfolio *whalewatcher.Portfolio
+	ready     chan struct{}
+	events    chan watcher.ContainerEvent
+}
+
+var _ watcher.Watcher = (*staticWatcher)(nil)
+
+func (w *staticWatcher) Portfolio() *whalewatcher.Portfolio    { return w.portfolio }
+func (w *staticWatcher) Ready() <-chan struct{}                { return w.ready }
+func (w *staticWatcher) Events() <-chan watcher.ContainerEvent { return w.events }
+func (w *staticWatcher) ID(context.Context) string             { return w.id }
+func (w *staticWatcher) Type() string                          { return w.typ }
+func (w *staticWatcher) Version(context.Context) string        { return "" }
+func (w *staticWatcher) API() string                           { return w.api }
+func (w *staticWatcher) PID() int                              { return w.pid }
+func (w *staticWatcher) Client() interface{}                   { return nil }
+func (w *staticWatcher) Close()                                {}
+
+// Watch does nothing except waiting for the specified context to be done.
+func (w *staticWatcher) Watch(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
@@ -0,0 +1,98 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"os"
+
+	"github.com/thediveo/lxkns/containerizer"
+	"github.com/thediveo/lxkns/model"
+	"github.com/thediveo/whalewatcher"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("injected engines", func() {
+
+	It("returns the containers of injected static engines", func(ctx context.Context) {
+		moby := NewStaticEngine("docker.com", "moby-1", "/run/docker.sock", 42,
+			&whalewatcher.Container{ID: "1234", Name: "foo", PID: 666, Labels: map[string]string{"bar": "baz"}},
+			&whalewatcher.Container{ID: "5678", Name: "bar", PID: 667})
+		ctrd := NewStaticEngine("containerd.io", "ctrd-1", "/run/containerd/containerd.sock", 43)
+
+		var c containerizer.Containerizer = New(
+			func() context.Context { return ctx },
+			WithInjectedEngines(moby), WithInjectedEngines(ctrd))
+		defer c.Close()
+
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "dockerd"}}
+		containers := c.Containers(ctx, model.ProcessTable{self.PID: self}, nil)
+		Expect(containers).To(ConsistOf(
+			And(HaveField("Name", "foo"),
+				HaveField("PID", model.PIDType(666)),
+				HaveField("Labels", HaveKeyWithValue("bar", "baz")),
+				HaveField("Engine.Type", "docker.com")),
+			And(HaveField("Name", "bar"), HaveField("Engine.ID", "moby-1")),
+		))
+		Expect(c.(Overseer).Engines()).To(ConsistOf(
+			And(HaveField("ID", "moby-1"), HaveField("PID", model.PIDType(42))),
+			And(HaveField("ID", "ctrd-1"), HaveField("API", "/run/containerd/containerd.sock")),
+		))
+
+		tf := c.(*TurtleFinder)
+		Expect(tf.WaitForInitialDiscovery(ctx)).To(Succeed())
+		Expect(tf.EngineDetails()).To(HaveEach(HaveField("SyncState", EngineSynced)))
+		Expect(tf.UnreachableEngines()).To(BeEmpty())
+	})
+
+})
+
+var _ = Describe("summary", func() {
+
+	It("counts containers by engine type without discovery", func(ctx context.Context) {
+		moby1 := NewStaticEngine("docker.com", "moby-1", "/run/docker.sock", 42,
+			&whalewatcher.Container{ID: "1234", Name: "foo", PID: 666},
+			&whalewatcher.Container{ID: "5678", Name: "bar", PID: 667})
+		moby2 := NewStaticEngine("docker.com", "moby-2", "/run/user/1000/docker.sock", 44,
+			&whalewatcher.Container{ID: "abcd", Name: "baz", PID: 668})
+		ctrd := NewStaticEngine("containerd.io", "ctrd-1", "/run/containerd/containerd.sock", 43)
+
+		tf := New(func() context.Context { return ctx },
+			WithInjectedEngines(moby1, moby2, ctrd))
+		defer tf.Close()
+
+		Expect(tf.Summary()).To(Equal(map[string]int{
+			"docker.com":    3,
+			"containerd.io": 0,
+		}))
+	})
+
+})
+
+var _ = Describe("watchers", func() {
+
+	It("returns the live watchers", func(ctx context.Context) {
+		moby := NewStaticEngine("docker.com", "moby-1", "/run/docker.sock", 42,
+			&whalewatcher.Container{ID: "1234", Name: "foo", PID: 666})
+		ctrd := NewStaticEngine("containerd.io", "ctrd-1", "/run/containerd/containerd.sock", 41)
+		gone := NewStaticEngine("containerd.io", "ctrd-2", "/run/containerd/gone.sock", 43)
+		close(gone.Done)
+
+		tf := New(func() context.Context { return ctx },
+			WithInjectedEngines(moby, ctrd, gone))
+		defer tf.Close()
+
+		watchers := tf.Watchers()
+		Expect(watchers).To(HaveExactElements(
+			BeIdenticalTo(ctrd.Watcher),
+			BeIdenticalTo(moby.Watcher),
+		))
+		Expect(watchers[1].Portfolio().ContainerTotal()).To(Equal(1))
+	})
+
+})
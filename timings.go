@@ -0,0 +1,66 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"time"
+
+	"github.com/thediveo/lxkns/model"
+)
+
+// DiscoveryTimings tells how long the individual phases of the most recent
+// discovery took, in order to find out where a slow discovery spends its time,
+// such as when tuning [WithGettingOnlineWait].
+type DiscoveryTimings struct {
+	Started          time.Time     // when the most recent discovery started; zero if none yet.
+	Prune            time.Duration // pruning vanished engines and socket activators.
+	UpdateDaemons    time.Duration // looking for new engine processes and dispatching their probes.
+	UpdateActivators time.Duration // looking for new and changed socket activators.
+	OnlineWait       time.Duration // waiting for new engines to come online (synchronize).
+	Containers       time.Duration // querying all engines for their containers (fan-in).
+	Total            time.Duration // the whole discovery, including all of the above phases.
+}
+
+// LastDiscoveryTimings returns the timings of the individual phases of the most
+// recent [TurtleFinder.Containers] call. When a discovery shares the prune and
+// update pass of a concurrent discovery or skips it altogether (see
+// [WithDiscoveryCoalesceWindow]), the pruning and updating timings are those
+// of the most recent pass actually run.
+func (f *TurtleFinder) LastDiscoveryTimings() DiscoveryTimings {
+	f.timingsmu.Lock()
+	defer f.timingsmu.Unlock()
+	return f.timings
+}
+
+// pruneAndUpdate prunes vanished engines and socket activators and then looks
+// for new ones, recording the timings of the individual phases.
+func (f *TurtleFinder) pruneAndUpdate(ctx context.Context, procs model.ProcessTable) {
+	var timings DiscoveryTimings
+	start := time.Now()
+	// Remove engines (watchers) whose processes have vanished. Also remove
+	// vanished socket activators like "systemd" in containers.
+	f.prune(procs)
+	timings.Prune = time.Since(start)
+	// Then look for new engine processes and/or socket activators.
+	f.update(ctx, procs, &timings)
+
+	f.timingsmu.Lock()
+	defer f.timingsmu.Unlock()
+	f.timings.Prune = timings.Prune
+	f.timings.UpdateDaemons = timings.UpdateDaemons
+	f.timings.UpdateActivators = timings.UpdateActivators
+	f.timings.OnlineWait = timings.OnlineWait
+}
+
+// recordContainersTimings records the start, engine query fan-in duration, and
+// total duration of a [TurtleFinder.Containers] call.
+func (f *TurtleFinder) recordContainersTimings(started time.Time, containers time.Duration) {
+	f.timingsmu.Lock()
+	defer f.timingsmu.Unlock()
+	f.timings.Started = started
+	f.timings.Containers = containers
+	f.timings.Total = time.Since(started)
+}
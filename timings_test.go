@@ -0,0 +1,51 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/thediveo/lxkns/model"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("discovery timings", func() {
+
+	It("has no timings before the first discovery", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx })
+		defer tf.Close()
+		Expect(tf.LastDiscoveryTimings()).To(BeZero())
+	})
+
+	It("records the timings of the discovery phases", func(ctx context.Context) {
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "endlessd"}}
+		d := &endpointlessDetector{}
+		tf := New(func() context.Context { return ctx },
+			WithGettingOnlineWait(100*time.Millisecond),
+			WithoutSocketActivators())
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "endlessd"}}
+
+		before := time.Now()
+		_ = tf.Containers(ctx, model.ProcessTable{self.PID: self}, nil)
+		timings := tf.LastDiscoveryTimings()
+		Expect(timings.Started).To(BeTemporally(">=", before))
+		Expect(timings.OnlineWait).To(BeNumerically(">=", 100*time.Millisecond))
+		Expect(timings.UpdateActivators).To(BeNumerically("<", 100*time.Millisecond))
+		Expect(timings.Total).To(BeNumerically(">=",
+			timings.Prune+timings.UpdateDaemons+timings.UpdateActivators+timings.OnlineWait+timings.Containers))
+
+		_ = tf.Containers(ctx, model.ProcessTable{self.PID: self}, nil)
+		next := tf.LastDiscoveryTimings()
+		Expect(next.Started).To(BeTemporally(">", timings.Started))
+		Expect(next.OnlineWait).To(BeNumerically("<", 100*time.Millisecond))
+	})
+
+})
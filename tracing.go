@@ -0,0 +1,58 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import "context"
+
+// Tracer creates spans around container engine discovery, see [WithTracer].
+// Tracer deliberately is a minimal interface, so that users not interested in
+// tracing don't need to pull in any tracing dependencies. Package
+// [github.com/siemens/turtlefinder/oteltracing] adapts OpenTelemetry tracers.
+type Tracer interface {
+	// Start a new span with the specified name and optional attributes in the
+	// form of key-value pairs, returning a context carrying the new span.
+	Start(ctx context.Context, name string, kv ...any) (context.Context, Span)
+}
+
+// Span is a single traced operation created by a [Tracer].
+type Span interface {
+	// SetAttributes sets the specified attributes in the form of key-value
+	// pairs.
+	SetAttributes(kv ...any)
+	// End the span.
+	End()
+}
+
+// The names of the spans created by a TurtleFinder.
+const (
+	SpanContainers    = "turtlefinder.Containers"    // fan-in of containers from all engines.
+	SpanUpdateDaemons = "turtlefinder.updateDaemons" // looking for new engine processes.
+	SpanProbeEngine   = "turtlefinder.probeEngine"   // probing an individual engine process.
+)
+
+// The attribute keys of the spans created by a TurtleFinder.
+const (
+	AttrEngineType     = "turtlefinder.engine.type"     // engine detector plugin name.
+	AttrEnginePID      = "turtlefinder.engine.pid"      // engine process PID.
+	AttrEngineAPI      = "turtlefinder.engine.api"      // engine API endpoint path.
+	AttrNewEngines     = "turtlefinder.engines.new"     // number of new engine processes to probe.
+	AttrContainerCount = "turtlefinder.container.count" // number of containers found.
+)
+
+// noopSpan is the span used when no Tracer has been set.
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...any) {}
+func (noopSpan) End()                 {}
+
+// startSpan starts a new span using the Tracer set using [WithTracer], if any.
+// Otherwise, it returns the specified context unchanged together with a span
+// doing nothing.
+func (f *TurtleFinder) startSpan(ctx context.Context, name string, kv ...any) (context.Context, Span) {
+	if f.tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return f.tracer.Start(ctx, name, kv...)
+}
@@ -0,0 +1,110 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/thediveo/lxkns/model"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+	. "github.com/thediveo/success"
+)
+
+// recordedSpan is a span created by a recordingTracer.
+type recordedSpan struct {
+	tracer *recordingTracer
+	name   string
+	attrs  map[string]any
+	ended  bool
+}
+
+func (s *recordedSpan) SetAttributes(kv ...any) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	for idx := 0; idx+1 < len(kv); idx += 2 {
+		s.attrs[kv[idx].(string)] = kv[idx+1]
+	}
+}
+
+func (s *recordedSpan) End() {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.ended = true
+}
+
+// recordingTracer is a Tracer recording all spans created.
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, kv ...any) (context.Context, Span) {
+	span := &recordedSpan{tracer: t, name: name, attrs: map[string]any{}}
+	span.SetAttributes(kv...)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans = append(t.spans, span)
+	return ctx, span
+}
+
+// ended returns the names and attributes of the spans ended so far.
+func (t *recordingTracer) ended() map[string]map[string]any {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ended := map[string]map[string]any{}
+	for _, span := range t.spans {
+		if span.ended {
+			ended[span.name] = span.attrs
+		}
+	}
+	return ended
+}
+
+var _ = Describe("tracing", func() {
+
+	It("doesn't trace by default", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx })
+		defer tf.Close()
+		spanctx, span := tf.startSpan(ctx, SpanContainers)
+		Expect(spanctx).To(BeIdenticalTo(ctx))
+		Expect(span).To(Equal(noopSpan{}))
+	})
+
+	It("traces discoveries", func(ctx context.Context) {
+		canarysockpath := GinkgoT().TempDir() + "/canary.sock"
+		lsock := Successful(net.Listen("unix", canarysockpath))
+		defer lsock.Close()
+
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "acceptd"}}
+		tracer := &recordingTracer{}
+		d := &acceptingDetector{}
+		tf := New(func() context.Context { return ctx },
+			WithGettingOnlineWait(100*time.Millisecond),
+			WithoutSocketActivators(),
+			WithTracer(tracer))
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "acceptd"}}
+		_ = tf.Containers(ctx, model.ProcessTable{self.PID: self}, nil)
+
+		Expect(tracer.ended()).To(MatchAllKeys(Keys{
+			SpanContainers:    HaveKeyWithValue(AttrContainerCount, 0),
+			SpanUpdateDaemons: HaveKeyWithValue(AttrNewEngines, 1),
+			SpanProbeEngine: SatisfyAll(
+				HaveKeyWithValue(AttrEngineType, "acceptd"),
+				HaveKeyWithValue(AttrEnginePID, os.Getpid()),
+				HaveKeyWithValue(AttrEngineAPI, "unix:///idle.sock"),
+			),
+		}))
+	})
+
+})
@@ -6,7 +6,12 @@ package turtlefinder
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -22,7 +27,6 @@ import (
 
 	"github.com/thediveo/go-plugger/v3"
 	"github.com/thediveo/lxkns/containerizer"
-	"github.com/thediveo/lxkns/log"
 	"github.com/thediveo/lxkns/model"
 	"github.com/thediveo/procfsroot"
 	"github.com/thediveo/whalewatcher/watcher"
@@ -44,6 +48,22 @@ type Overseer interface {
 	Engines() []*model.ContainerEngine
 }
 
+// ActivatorOverseer gives access to information about the socket activators
+// currently known, in addition to the container engines currently monitored.
+//
+// [turtlefinder.Turtlefinder] objects implement the ActivatorOverseer
+// interface, in the same way as they implement the [Overseer] interface.
+//
+//		var c containerizer.Containerizer
+//		o, ok := c.(turtlefinder.ActivatorOverseer)
+//	 	if ok {
+//		    activators := o.Activators()
+//	 	}
+type ActivatorOverseer interface {
+	Overseer
+	Activators() []ActivatorInfo
+}
+
 // Contexter supplies a TurtleFinder with a suitable context for long-running
 // container engine workload watching.
 type Contexter func() context.Context
@@ -56,29 +76,98 @@ type Contexter func() context.Context
 // and then tries to contact the potential engines in order to watch their
 // containers.
 type TurtleFinder struct {
-	contexter        Contexter           // contexts for workload watching.
-	engineplugins    []enginePlugin      // static list of engine plugins.
-	activatorplugins []activatorPlugin   // static list of activator plugins.
-	numworkers       int                 // max number of parallel engine queries.
-	workersem        *semaphore.Weighted // bounded pool.
-	initialsyncwait  time.Duration       // max. wait for engine watch coming online (sync) before proceeding.
+	contexter        Contexter            // contexts for workload watching.
+	cancel           context.CancelFunc   // cancels the watch context of one-shot turtle finders.
+	engineplugins    []enginePlugin       // static list of engine plugins.
+	activatorplugins []activatorPlugin    // static list of activator plugins.
+	numworkers       int                  // max number of parallel engine queries and activator updates.
+	workersem        *semaphore.Weighted  // bounded pool.
+	inflight         atomic.Int64         // number of engine queries currently in flight.
+	lastcontainers   atomic.Int64         // number of containers found by the most recent Containers call.
+	paused           atomic.Bool          // skip discovering new engines and activators; see Pause.
+	timingsmu        sync.Mutex           // protects timings.
+	timings          DiscoveryTimings     // phase timings of the most recent discovery.
+	hierarchymu      sync.Mutex           // protects hierarchy.
+	hierarchy        []EngineRelation     // engine relations found by the most recent Containers call.
+	querytimeout     time.Duration        // max. duration of an individual engine query; zero for no limit.
+	initialsyncwait  time.Duration        // max. wait for engine watch coming online (sync) before proceeding.
+	startjitter      time.Duration        // max. random delay before starting a new watcher; zero for none.
+	lazymeta         bool                 // query engine IDs and versions only on first access.
+	reuseproctable   bool                 // reuse process tables when locating activated engines.
+	proberetries     int                  // max. number of retries when engine probes fail.
+	probebackoff     time.Duration        // initial backoff between engine probe retries.
+	clienttimeout    time.Duration        // engine client probe timeout for detectors; zero for their defaults.
+	enginetypes      []string             // allowed engine plugin names and watcher types, if any.
+	enginefilter     *engineTypeFilter    // allowed engines; nil allows all engines.
+	coalescewindow   time.Duration        // window for sharing discovery update passes.
+	logfn            detector.LogFunc     // optional log sink; nil logs via lxkns' log.
+	logger           detector.Logger      // logs either via logfn or lxkns' log.
+	tracer           Tracer               // optional tracer; nil for no tracing.
+	procroot         string               // where the proc filesystem is mounted.
+	translatepids    bool                 // translate container PIDs into the initial PID namespace.
+	labeler          containerLabeler     // optional container labeler.
+	labelselector    map[string]string    // optional container label selector; nil for all containers.
+	stackexclusion   func(e *Engine) bool // optional engines to treat as top-level engines.
+	prefixlabelname  string               // label name for engine hierarchy prefixes.
+	containerchanges *containerChanges    // optional container change forwarder; nil if none.
+	noactivators     bool                 // skip socket activator discovery.
+	vsock            bool                 // additionally discover vsock API endpoints.
+	injected         bool                 // only injected engines, skipping auto-discovery.
+	injectedengines  []*Engine            // engines to inject.
+	maxengines       int                  // max. number of engine processes under watch; zero for no limit.
+	knownendpoints   []string             // API endpoints to directly probe, without scanning processes.
+	dialer           *net.Dialer          // optional dialer for engine connections; nil for a zero-value dialer.
+	maxidle          time.Duration        // max. time activated engines may go without containers; zero for no limit.
+	sockfilter       socketPathFilter     // optional socket path filter; nil allows all.
+	retention        time.Duration        // how long to retain terminated engines; zero for not at all.
+	findattempts     int                  // max. attempts to find socket-activated engine processes.
+	findpolling      time.Duration        // polling interval when finding socket-activated engine processes.
+	sockretries      int                  // quick socket re-reads of new engine processes without sockets.
+	sockretrydelay   time.Duration        // delay between quick socket re-reads.
+	eager            bool                 // run an initial discovery already in New.
+	versionrefresh   time.Duration        // interval for refreshing engine versions; zero for never.
+	eagerprocs       model.ProcessTable   // optional process table for the eager discovery.
+
+	decorators []func(context.Context) context.Context // pass option settings to the detectors via contexts.
+
+	bginterval time.Duration             // interval of background discoveries; zero for none.
+	bgprocs    func() model.ProcessTable // optional process table source for background discoveries.
+	bgcancel   context.CancelFunc        // stops the background discovery, if any.
+	bgdone     chan struct{}             // closed when the background discovery has stopped.
+
+	refreshmu   sync.Mutex    // protects the following fields.
+	refreshing  chan struct{} // closed when the current update pass is done; nil if none.
+	lastrefresh time.Time     // when the most recent update pass finished.
+
+	rejectedprocs rejectedProcessCache // processes known to be neither engines nor activators.
+	scannedprocs  scannedProcessCache  // engine processes already scanned for listening sockets.
+	unreachable   unreachableEngines   // engines without (working) API endpoints.
+	retained      retainedEngines      // recently terminated engines; see WithEngineRetention.
+	activationmu  sync.Mutex           // serializes adding socket-activated engines.
+
+	firstpass     chan struct{} // closed when the first update pass is done.
+	firstpassonce sync.Once     // ensures closing the firstpass channel only once.
 
 	mux        sync.Mutex                                // protects the following fields.
 	engines    map[model.PIDType][]*Engine               // engines by PID; individual engines may have failed.
 	activators map[model.PIDType]*socketActivatorProcess // socket activators we've found.
+	limitwarn  time.Time                                 // when we last warned about hitting the engine limit.
 }
 
 // TurtleFinder implements the lxkns Containerizer interface. And it's also an
-// Overseer.
+// Overseer, as well as an ActivatorOverseer.
 var _ containerizer.Containerizer = (*TurtleFinder)(nil)
 var _ Overseer = (*TurtleFinder)(nil)
+var _ ActivatorOverseer = (*TurtleFinder)(nil)
 
 // enginePlugin represents the process names of a container engine discovery
 // plugin, as well as the plugin's Discover function.
 type enginePlugin struct {
-	names      []string          // process names of interest.
-	detector   detector.Detector // engine process detector plugin interface.
-	pluginname string            // for housekeeping and logging.
+	names          []string          // process names of interest.
+	cgrouppatterns []string          // optional cgroup patterns of interest.
+	exepatterns    []string          // optional executable basename patterns of interest.
+	detector       detector.Detector // engine process detector plugin interface.
+	pluginname     string            // for housekeeping and logging.
 }
 
 // engineProcess represents an individual container engine process and the
@@ -109,56 +198,147 @@ func New(contexter Contexter, opts ...NewOption) *TurtleFinder {
 		engines:         map[model.PIDType][]*Engine{},
 		activators:      map[model.PIDType]*socketActivatorProcess{},
 		initialsyncwait: 2 * time.Second,
+		probebackoff:    100 * time.Millisecond,
+		findattempts:    defaultFindAttempts,
+		findpolling:     defaultFindPolling,
+		sockretries:     defaultSocketRetries,
+		sockretrydelay:  defaultSocketRetryDelay,
+		versionrefresh:  defaultVersionRefresh,
+		procroot:        defaultProcRoot,
+		prefixlabelname: TurtlefinderContainerPrefixLabelName,
+		firstpass:       make(chan struct{}),
 	}
 	for _, opt := range opts {
 		opt(f)
 	}
+	for _, engine := range f.injectedengines {
+		pid := model.PIDType(engine.PID())
+		f.engines[pid] = append(f.engines[pid], engine)
+	}
 	if f.numworkers <= 0 {
 		f.numworkers = runtime.GOMAXPROCS(0)
 	}
 	f.workersem = semaphore.NewWeighted(int64(f.numworkers))
+	f.enginefilter = newEngineTypeFilter(f.enginetypes)
+	f.logger = detector.NewLogger(f.logfn)
+	if decorators := f.decorators; len(decorators) > 0 {
+		// Pass on the settings of the options, such as the log sink and the
+		// engine client timeout, to the watcher-related machinery as well as
+		// to the detector plugins via the contexts we hand out.
+		contexter := f.contexter
+		f.contexter = func() context.Context {
+			ctx := contexter()
+			for _, decorate := range decorators {
+				ctx = decorate(ctx)
+			}
+			return ctx
+		}
+	}
 	// Query the available turtle finder plugins for the names of processes to
 	// look for, in order to later optimize searching the processes; as we're
 	// working only with a static set of plugins we only need to query the basic
 	// information once.
-	namegivers := plugger.Group[detector.Detector]().PluginsSymbols()
-	engineplugins := make([]enginePlugin, 0, len(namegivers))
-	for _, namegiver := range namegivers {
-		engineplugins = append(engineplugins, enginePlugin{
-			names:      namegiver.S.EngineNames(),
-			detector:   namegiver.S,
-			pluginname: namegiver.Plugin,
-		})
-	}
-	f.engineplugins = engineplugins
-	log.Infof("available engine process detector plugins: %s",
+	f.engineplugins = newEnginePlugins()
+	f.logger.Infof("available engine process detector plugins: %s",
 		strings.Join(plugger.Group[detector.Detector]().Plugins(), ", "))
-	// Query the available activator finder plugins.
-	activators := plugger.Group[activator.Detector]().PluginsSymbols()
-	activatorplugins := make([]activatorPlugin, 0, len(activators))
-	for _, activator := range activators {
-		activatorplugins = append(activatorplugins, activatorPlugin{
-			name:       activator.S.Name(),
-			pluginname: activator.Plugin,
-		})
+	// Query the available activator finder plugins, unless socket activator
+	// discovery has been disabled.
+	if f.noactivators {
+		f.logger.Infof("socket activator discovery disabled")
+	} else {
+		activators := plugger.Group[activator.Detector]().PluginsSymbols()
+		activatorplugins := make([]activatorPlugin, 0, len(activators))
+		for _, activator := range activators {
+			activatorplugins = append(activatorplugins, activatorPlugin{
+				name:       activator.S.Name(),
+				pluginname: activator.Plugin,
+			})
+		}
+		f.logger.Infof("available socket activator detector plugins: %s",
+			strings.Join(plugger.Group[activator.Detector]().Plugins(), ", "))
+		f.activatorplugins = activatorplugins
+	}
+	// Optionally warm up by running an initial discovery right now, instead
+	// of waiting for the first Containers call.
+	if f.eager {
+		f.discoverEagerly()
 	}
-	log.Infof("available socket activator detector plugins: %s",
-		strings.Join(plugger.Group[activator.Detector]().Plugins(), ", "))
-	f.activatorplugins = activatorplugins
+	f.startBackgroundDiscovery()
+	return f
+}
+
+// NewOneShot returns a TurtleFinder object for short-lived use, such as in a
+// CLI tool that runs a single discovery and then exits. In contrast to [New],
+// NewOneShot doesn't need a [Contexter] but instead uses (a child of) the
+// supplied context for watching the workload of all container engines found.
+// Closing the returned TurtleFinder cancels this watch context, so the
+// engine watchers get torn down; the same happens when the supplied context
+// gets cancelled.
+//
+// Options ([NewOption]) work the same as with [New].
+func NewOneShot(ctx context.Context, opts ...NewOption) *TurtleFinder {
+	watchctx, cancel := context.WithCancel(ctx)
+	f := New(func() context.Context { return watchctx }, opts...)
+	f.cancel = cancel
 	return f
 }
 
+// discoverEagerly runs an initial prune and update pass, using either the
+// process table passed to [WithEagerDiscoveryProcesses] or otherwise a process
+// table freshly read from the proc filesystem.
+func (f *TurtleFinder) discoverEagerly() {
+	procs := f.eagerprocs
+	f.eagerprocs = nil // don't keep the process table alive any longer.
+	if procs == nil {
+		procs = model.NewProcessTableFromProcfs(false, false, f.procroot)
+	}
+	f.logger.Infof("eagerly discovering container engines")
+	f.refresh(f.contexter(), procs)
+}
+
 // Containers returns the current container state of (alive) containers from all
 // discovered container engines.
 func (f *TurtleFinder) Containers(
 	ctx context.Context, procs model.ProcessTable, pidmap model.PIDMapper,
 ) []*model.Container {
-	// Do some quick housekeeping first: remove engines (watchers) whose
-	// processes have vanished. Also remove vanished socket activators like
-	// "systemd" in containers.
-	f.prune(procs)
-	// Then look for new engine processes and/or socket activators.
-	f.update(ctx, procs)
+	ctx, span := f.startSpan(ctx, SpanContainers)
+	defer span.End()
+	containers, _ := f.containers(ctx, procs, pidmap)
+	span.SetAttributes(AttrContainerCount, len(containers))
+	return containers
+}
+
+// ContainersAndEngines works like [TurtleFinder.Containers], but additionally
+// returns the container engines consulted in the same discovery pass. This
+// avoids the inconsistencies between calling Containers and then
+// [TurtleFinder.Engines], where engines might get pruned or found in between.
+// The containers reference the returned engines, and the engines in turn list
+// their returned containers. Engines that didn't return their containers in
+// time (see [WithEngineQueryTimeout]) are included, but without any
+// containers, unless these engines are inside paused containers: such frozen
+// engines then list the containers as last seen by their watchers. The engines
+// are sorted by their PIDs.
+func (f *TurtleFinder) ContainersAndEngines(
+	ctx context.Context, procs model.ProcessTable, pidmap model.PIDMapper,
+) ([]*model.Container, []*model.ContainerEngine) {
+	ctx, span := f.startSpan(ctx, SpanContainers)
+	defer span.End()
+	containers, engines := f.containers(ctx, procs, pidmap)
+	span.SetAttributes(AttrContainerCount, len(containers))
+	return containers, engines
+}
+
+// containers implements [TurtleFinder.Containers] as well as
+// [TurtleFinder.ContainersAndEngines], but without tracing.
+func (f *TurtleFinder) containers(
+	ctx context.Context, procs model.ProcessTable, pidmap model.PIDMapper,
+) ([]*model.Container, []*model.ContainerEngine) {
+	started := time.Now()
+	// Do some quick housekeeping first and look for new engine processes
+	// and/or socket activators, unless someone else already did so just now.
+	f.refresh(ctx, procs)
+	queried := time.Now()
+	defer func() { f.recordContainersTimings(started, time.Since(queried)) }()
 	// Now query the available engines for containers that are alive...
 	f.mux.Lock()
 	allEngines := make([]*Engine, 0, len(f.engines) /* lucky guess */)
@@ -167,26 +347,39 @@ func (f *TurtleFinder) Containers(
 	}
 	f.mux.Unlock()
 	allcontainers := []*model.Container{}
+	allModelEngines := []*model.ContainerEngine{}
 	if len(allEngines) == 0 {
-		return allcontainers
+		f.lastcontainers.Store(0)
+		f.setEngineHierarchy(nil)
+		return allcontainers, allModelEngines
 	}
 	// Feel the heat and query the engines in parallel; to collect the results
 	// we use a buffered channel of the size equal the number of engines to
 	// query. Please note that the number of parallel engine queries is bounded
 	// over *all parallel calls* to this method, and not just within a single
-	// call.
-	log.Infof("consulting %d container engines ... in parallel", len(allEngines))
-	enginecontainers := make(chan []*model.Container, len(allEngines))
+	// call. Concurrent calls thus get their engine queries interleaved as
+	// slots become free. However, there's no strict ordering between
+	// the engine queries of concurrent calls, as waiting calls might get
+	// cancelled and abandoned engine queries free their slots early.
+	f.logger.Infof("consulting %d container engines ... in parallel", len(allEngines))
+	enginecontainers := make(chan engineResult, len(allEngines))
 	var theendisnear atomic.Int64 // track amount of engine results
 	theendisnear.Add(int64(len(allEngines)))
 	for _, engine := range allEngines {
 		if err := f.workersem.Acquire(ctx, 1); err != nil {
-			return allcontainers
+			return allcontainers, allModelEngines
 		}
+		f.inflight.Add(1)
 		go func(engine *Engine) {
-			defer f.workersem.Release(1)
-			containers := engine.Containers(ctx)
-			enginecontainers <- containers
+			eng := f.queryEngine(ctx, engine)
+			abandoned := eng == nil
+			if abandoned {
+				eng = engine.modelEngine()
+			}
+			if f.translatepids {
+				translatePIDs(engine, eng.Containers, procs, pidmap, f.procroot)
+			}
+			enginecontainers <- engineResult{engine: engine, eng: eng, abandoned: abandoned}
 			if theendisnear.Add(-1) > 0 {
 				return
 			}
@@ -195,20 +388,147 @@ func (f *TurtleFinder) Containers(
 	}
 	// Wait for all engine results to come in one after another and the engine
 	// result channel to finally close for good.
-	for containers := range enginecontainers {
-		allcontainers = append(allcontainers, containers...)
+	abandoned := []engineResult{}
+	for result := range enginecontainers {
+		allcontainers = append(allcontainers, result.eng.Containers...)
+		allModelEngines = append(allModelEngines, result.eng)
+		if result.abandoned {
+			abandoned = append(abandoned, result)
+		}
+	}
+	// Engines inside paused containers are frozen and thus cannot answer our
+	// queries. Instead of losing their containers, fall back to the workload
+	// as last seen by their watchers, so that these containers also get their
+	// engine hierarchy prefixes attached.
+	for _, result := range abandoned {
+		if !insidePausedContainer(result.engine, allcontainers, procs) {
+			continue
+		}
+		result.engine.addContainers(result.eng)
+		if f.translatepids {
+			translatePIDs(result.engine, result.eng.Containers, procs, pidmap, f.procroot)
+		}
+		allcontainers = append(allcontainers, result.eng.Containers...)
 	}
+	sort.SliceStable(allModelEngines, func(i, j int) bool {
+		return allModelEngines[i].PID < allModelEngines[j].PID
+	})
+	// Docker containers might show up a second time when also watching
+	// containerd's "moby" namespace, so weed out such duplicates.
+	allcontainers = dedupMobyContainers(allcontainers)
 	// Fill in the engine hierarchy, if necessary: note that we can't use this
 	// without knowing the containers and especially their names.
-	stackEngines(allcontainers, allEngines, procs)
+	f.setEngineHierarchy(stackEngines(allcontainers, allEngines, procs, f.procroot, f.stackexclusion, f.prefixlabelname))
+	// Only finally apply the container label selector, if any, as engine
+	// stacking needs to see all containers, including those of engines in
+	// containers not matching the selector.
+	allcontainers = selectContainers(allcontainers, allModelEngines, f.labelselector)
+
+	f.lastcontainers.Store(int64(len(allcontainers)))
+	return allcontainers, allModelEngines
+}
 
-	return allcontainers
+// engineResult is the outcome of querying an engine for its containers.
+type engineResult struct {
+	engine    *Engine                // engine queried.
+	eng       *model.ContainerEngine // model of the engine with its containers.
+	abandoned bool                   // engine didn't answer in time.
+}
+
+// queryEngine returns the model.ContainerEngine with the containers of the
+// specified engine, releasing the engine's worker slot when done. If the
+// engine doesn't answer in time, as limited by the caller's context as well as
+// the engine query timeout set using [WithEngineQueryTimeout], queryEngine
+// gives up on the engine, logs a warning, and returns nil. The abandoned
+// engine query then finishes in the background, but without occupying a
+// worker slot any longer, so that wedged engines cannot starve later
+// discoveries.
+func (f *TurtleFinder) queryEngine(ctx context.Context, engine *Engine) *model.ContainerEngine {
+	var releaseOnce sync.Once
+	release := func() {
+		releaseOnce.Do(func() {
+			f.inflight.Add(-1)
+			f.workersem.Release(1)
+		})
+	}
+	defer release()
+	qctx, cancel := ctx, context.CancelFunc(func() {})
+	if f.querytimeout > 0 {
+		qctx, cancel = context.WithTimeout(ctx, f.querytimeout)
+	}
+	defer cancel()
+	result := make(chan *model.ContainerEngine, 1)
+	go func() {
+		defer release()
+		result <- engine.containerEngine(qctx)
+	}()
+	select {
+	case eng := <-result:
+		return eng
+	case <-qctx.Done():
+	}
+	// Don't throw away results that arrived just in time...
+	select {
+	case eng := <-result:
+		return eng
+	default:
+	}
+	f.logger.With("type", engine.Type(), "pid", engine.PID(), "api", engine.API()).
+		Warnf("'%s' container engine (PID %d) at API %s didn't return its containers in time, reason: %s",
+			engine.Type(), engine.PID(), engine.API(), qctx.Err().Error())
+	return nil
+}
+
+// refresh prunes vanished engines and socket activators and then looks for new
+// ones, unless engines have been injected using [WithInjectedEngines]. If a
+// coalesce window has been set using [WithDiscoveryCoalesceWindow], concurrent
+// callers share a single ongoing prune-and-update pass, and callers within the
+// window after the most recent pass skip it altogether.
+func (f *TurtleFinder) refresh(ctx context.Context, procs model.ProcessTable) {
+	if f.injected {
+		f.firstpassonce.Do(func() { close(f.firstpass) })
+		return
+	}
+	if f.coalescewindow <= 0 {
+		f.pruneAndUpdate(ctx, procs)
+		return
+	}
+	f.refreshmu.Lock()
+	if refreshing := f.refreshing; refreshing != nil {
+		// Someone else is currently updating, so simply wait for them to
+		// finish and then use the results of their hard work.
+		f.refreshmu.Unlock()
+		select {
+		case <-refreshing:
+		case <-ctx.Done():
+		}
+		return
+	}
+	if !f.lastrefresh.IsZero() && time.Since(f.lastrefresh) < f.coalescewindow {
+		f.refreshmu.Unlock()
+		return
+	}
+	refreshing := make(chan struct{})
+	f.refreshing = refreshing
+	f.refreshmu.Unlock()
+
+	defer func() {
+		f.refreshmu.Lock()
+		f.refreshing = nil
+		f.lastrefresh = time.Now()
+		f.refreshmu.Unlock()
+		close(refreshing)
+	}()
+	f.pruneAndUpdate(ctx, procs)
 }
 
 // Close closes all resources associated with this turtle finder. This is an
 // asynchronous process. Make sure to also cancel or have already cancelled the
-// context
+// context. For turtle finders created using [NewOneShot], Close cancels the
+// watch context itself. If a background discovery has been set using
+// [WithBackgroundDiscovery], Close first stops it.
 func (f *TurtleFinder) Close() {
+	f.stopBackgroundDiscovery()
 	f.mux.Lock()
 	defer f.mux.Unlock()
 	for _, engines := range f.engines {
@@ -217,35 +537,139 @@ func (f *TurtleFinder) Close() {
 		}
 	}
 	f.engines = nil
+	if f.cancel != nil {
+		f.cancel()
+	}
 }
 
 // Engines returns information about the container engines currently being
-// monitored.
+// monitored. As [model.ContainerEngine] has no notion of API versions and
+// storage, use [TurtleFinder.EngineDetails] to additionally learn the API
+// versions negotiated with the engines, as well as their storage drivers and
+// data root directories.
 func (f *TurtleFinder) Engines() []*model.ContainerEngine {
+	details := f.EngineDetails()
+	allEngines := make([]*model.ContainerEngine, 0, len(details))
+	for _, detail := range details {
+		allEngines = append(allEngines, detail.ContainerEngine)
+	}
+	return allEngines
+}
+
+// EngineDetails describes a container engine currently being monitored,
+// including additional information not covered by [model.ContainerEngine].
+type EngineDetails struct {
+	*model.ContainerEngine
+	APIVersion    string          // negotiated engine API version, distinct from the product version; "" if unknown.
+	SyncState     EngineSyncState // whether the engine's workload is fully synchronized.
+	FirstSeen     time.Time       // when the engine was found and its watch started.
+	CandidateAPIs []string        // API endpoint paths considered when discovering the engine.
+	StorageDriver string          // storage driver or snapshotter of the engine; "" if unknown.
+	DataRoot      string          // root directory of the engine's persistent data; "" if unknown.
+	Inactive      bool            // engine has terminated, but is still retained.
+	GoneSince     time.Time       // when a retained engine was found to have terminated.
+}
+
+// EngineDetails returns detailed information about the container engines
+// currently being monitored, in the same way as [TurtleFinder.Engines] does.
+// Additionally, the details tell whether an engine is still catching up with
+// its workload in the background (for instance, because it took longer than
+// the “getting online wait” to synchronize), so callers can tell apart an
+// engine that has no containers from an engine that isn't ready yet.
+//
+// The details also tell since when an engine is being watched. As engines
+// getting pruned and later found again start over with a new first-seen
+// timestamp, this also allows detecting flapping engines.
+//
+// If a retention has been set using [WithEngineRetention], recently terminated
+// engines are included for the retention period, flagged as inactive.
+func (f *TurtleFinder) EngineDetails() []*EngineDetails {
+	now := time.Now()
 	f.mux.Lock()
-	defer f.mux.Unlock()
-	allEngines := make([]*model.ContainerEngine, 0, len(f.engines))
+	alive := make([]*Engine, 0, len(f.engines))
+	var gone []*Engine
 	for _, engines := range f.engines {
 		for _, engine := range engines {
 			select {
 			case <-engine.Done:
-				continue // already Done, so ignore this engine.
+				// already Done, so ignore this engine, unless we're to retain
+				// it for a while.
+				if f.retention > 0 {
+					gone = append(gone, engine)
+				}
+				continue
 			default:
 				// not Done, so let's move on and add it to the list of available
 				// engines.
 			}
-			allEngines = append(allEngines, &model.ContainerEngine{
-				ID:      engine.ID,
-				Type:    engine.Type(),
-				Version: engine.Version,
-				API:     engine.API(),
-				PID:     model.PIDType(engine.PID()),
-			})
+			alive = append(alive, engine)
 		}
 	}
+	f.mux.Unlock()
+	// Only now gather the engine details, as engines with lazy metadata might
+	// need to be queried first and we must not block other callers meanwhile.
+	for _, engine := range gone {
+		f.retained.retain(engine.details(), now)
+	}
+	allEngines := make([]*EngineDetails, 0, len(alive))
+	active := map[string]struct{}{}
+	for _, engine := range alive {
+		details := engine.details()
+		active[engineIdentity(details)] = struct{}{}
+		allEngines = append(allEngines, details)
+	}
+	if f.retention > 0 {
+		for _, details := range allEngines {
+			f.retained.revive(details)
+		}
+		allEngines = append(allEngines, f.retained.list(now, f.retention, active)...)
+	}
 	return allEngines
 }
 
+// InFlightEngineQueries returns the number of container engine workload
+// queries currently in flight over all concurrent [TurtleFinder.Containers]
+// calls. This number never exceeds the maximum number of parallel engine
+// queries as set using [WithWorkers]; when it is at the maximum, further
+// engine queries wait until in-flight engine queries finish or get abandoned.
+// Abandoned engine queries don't count as in flight, even if they're still
+// running in the background.
+func (f *TurtleFinder) InFlightEngineQueries() int {
+	return int(f.inflight.Load())
+}
+
+// UnreachableEngines returns the potential container engines found to have
+// either no listening API endpoints at all, or where none of these API
+// endpoints worked. The unreachable engines are sorted by their PIDs.
+// Unreachable engines are probed again in subsequent discoveries; they drop off
+// this list as soon as they become reachable or their processes terminate.
+//
+// This information helps in diagnosing why an obviously running container
+// engine isn't discovered, such as due to missing permissions or unsupported
+// API versions.
+func (f *TurtleFinder) UnreachableEngines() []UnreachableEngine {
+	return f.unreachable.list()
+}
+
+// RediscoverActivator forces the next discovery to rescan the listening sockets
+// of the socket activator process with the specified PID, even if its socket
+// fds seem to be unchanged. This is useful after installing a new container
+// engine, such as a podman service, without restarting the socket activator.
+// Sockets already known to the socket activator don't get activated and
+// watched again. RediscoverActivator returns an error if there is no socket
+// activator process with the specified PID.
+func (f *TurtleFinder) RediscoverActivator(pid model.PIDType) error {
+	f.mux.Lock()
+	activator, ok := f.activators[pid]
+	f.mux.Unlock()
+	if !ok {
+		return categorize(ErrUnknownActivator,
+			fmt.Errorf("no socket activator process with PID %d", pid))
+	}
+	activator.rediscover()
+	return nil
+}
+
 // EngineCount returns the number of container engines currently under watch.
 // Callers might want to use the Engines method instead as EngineCount bases on
 // it (because we don't store an explicit engine count anywhere).
@@ -255,39 +679,111 @@ func (f *TurtleFinder) EngineCount() int {
 	return len(f.engines)
 }
 
+// Summary returns the numbers of containers currently known, keyed by the
+// types of the container engines monitored, such as “docker.com” and
+// “containerd.io”. Engine types without any containers are included with a
+// count of zero. Summary works on the workload of the engines already under
+// watch and thus doesn't trigger a new discovery; it is cheap to call. Please
+// note that engines still catching up with their workload might report fewer
+// containers than there actually are.
+func (f *TurtleFinder) Summary() map[string]int {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	summary := map[string]int{}
+	for _, engines := range f.engines {
+		for _, engine := range engines {
+			select {
+			case <-engine.Done:
+				continue // already Done, so ignore this engine.
+			default:
+			}
+			summary[engine.Type()] += engine.Portfolio().ContainerTotal()
+		}
+	}
+	return summary
+}
+
+// Watchers returns the workload watchers of the container engines currently
+// being monitored, sorted by the PIDs of their engine processes. Watchers that
+// have already terminated are skipped. This gives advanced callers direct
+// access to the watchers, such as to an engine's workload portfolio or to
+// subscribe to the workload events of an engine.
+//
+// The watchers returned are still owned by the TurtleFinder: callers must
+// never Close them, as the TurtleFinder is responsible for the life cycle of
+// its watchers. Watchers might terminate any time after being returned, such
+// as when their engine processes terminate.
+func (f *TurtleFinder) Watchers() []watcher.Watcher {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	pids := make([]model.PIDType, 0, len(f.engines))
+	for pid := range f.engines {
+		pids = append(pids, pid)
+	}
+	sort.Slice(pids, func(a, b int) bool { return pids[a] < pids[b] })
+	watchers := make([]watcher.Watcher, 0, len(pids))
+	for _, pid := range pids {
+		for _, engine := range f.engines[pid] {
+			if !engine.IsAlive() {
+				continue
+			}
+			watchers = append(watchers, engine.Watcher)
+		}
+	}
+	return watchers
+}
+
 // prune any terminated watchers, either because the watcher terminated itself
 // or we can't find the associated engine process anymore. This covers both
 // engines once detected by their well-known process names, as well as engines
 // detected to be socket-activated.
 //
+// Terminated watchers get pruned even if their engine process is still alive,
+// such as after an engine has been reconfigured to serve its API at a
+// different socket without restarting. When all watchers of an engine process
+// have been pruned, the next update probes the engine process anew.
+//
 // Also prune any socket activator processes that have gone missing.
 func (f *TurtleFinder) prune(procs model.ProcessTable) {
+	now := time.Now()
+	var retired []*Engine
 	f.mux.Lock()
-	defer f.mux.Unlock()
+	// Let idle socket-activated engines go, retaining them in the same way as
+	// terminated engines...
+	idled := f.idleActivatedEngines(now)
+	if f.retention > 0 {
+		retired = append(retired, idled...)
+	}
 	// Prune engine watchers...
 	for pid, engines := range f.engines {
-		if procs[pid] != nil {
-			continue
-		}
-		// This particular container engine process has gone, so we need to
-		// remove all individual watchers for for it.
+		// Remove all individual watchers that have terminated, regardless of
+		// whether this particular container engine process has gone or is
+		// still alive.
 		engines = deleteAndZeroFunc(engines, func(engine *Engine) bool {
 			if engine.IsAlive() {
 				return false
 			}
 			engine.Close() // ...if not already done so.
+			if f.retention > 0 {
+				retired = append(retired, engine)
+			}
 			return true
 		})
-		// Update the engines (watchers) for this (albeit gone) container engine
-		// process, as long as there are still watchers alive. If all watchers
-		// also have gone, then remove this engine process completely from our
-		// inventory.
+		// Update the engines (watchers) for this container engine process, as
+		// long as there are still watchers alive. If all watchers have gone,
+		// then remove this engine process completely from our inventory, so
+		// that a still alive engine process gets probed again.
 		if len(engines) == 0 {
 			delete(f.engines, pid)
 			continue
 		}
 		f.engines[pid] = engines
 	}
+	// Prune processes known to be of no interest that have gone...
+	f.rejectedprocs.prune(procs)
+	f.scannedprocs.prune(procs)
+	// Prune unreachable engines that have gone...
+	f.unreachable.prune(procs)
 	// Prune socket activators...
 	for pid := range f.activators {
 		if procs[pid] != nil {
@@ -300,19 +796,73 @@ func (f *TurtleFinder) prune(procs model.ProcessTable) {
 		// Note: we don't forcefully delete any activated watchers, but instead
 		// they should be handled through the above engine watcher pruning.
 	}
+	f.mux.Unlock()
+	// Retain terminated engines only after unlocking, as engines with lazy
+	// metadata might need to be queried first.
+	for _, engine := range retired {
+		f.retained.retain(engine.details(), now)
+	}
 }
 
 // update our knowledge about container engines if necessary, given the current
 // process table and by asking engine discovery plugins for any signs of engine
-// life.
-func (f *TurtleFinder) update(ctx context.Context, procs model.ProcessTable) {
+// life. The durations of the individual update phases get recorded in the
+// specified timings.
+func (f *TurtleFinder) update(ctx context.Context, procs model.ProcessTable, timings *DiscoveryTimings) {
+	// While paused, we don't look for new engines and activators at all, but
+	// still count this as an update pass.
+	if f.paused.Load() {
+		f.logger.Debugf("container engine discovery paused, skipping update")
+		f.firstpassonce.Do(func() { close(f.firstpass) })
+		return
+	}
+	// Only look at those processes that might be engines or socket activators
+	// based on their names, skipping processes we already know to be of no
+	// interest to us.
+	candidates := f.rejectedprocs.candidates(procs, f.isCandidate)
+	// Engine processes and socket activators often share the same namespaces,
+	// so make sure to parse their listening unix domain sockets only once
+	// during this update pass.
+	netunix := newNetUnixCache()
 	var wg sync.WaitGroup
-	f.updateDaemons(ctx, procs, &wg)
-	f.updateActivators(procs, &wg)
+	start := time.Now()
+	f.updateDaemons(ctx, candidates, &wg, netunix)
+	daemonsupdated := time.Now()
+	timings.UpdateDaemons = daemonsupdated.Sub(start)
+	if !f.noactivators {
+		f.updateActivators(candidates, procs, &wg, netunix)
+	}
+	activatorsupdated := time.Now()
+	timings.UpdateActivators = activatorsupdated.Sub(daemonsupdated)
 	// Wait for either all engine workload synchronizations to finish within the
 	// time box or the time box to end. In both cases we'll finally proceed with
 	// the discovery.
 	wg.Wait()
+	// Only now probe the known API endpoints, so that the engines found via
+	// the process table are already under watch and thus don't get probed
+	// again via their known API endpoints.
+	f.updateKnownEndpoints(ctx, &wg)
+	wg.Wait()
+	timings.OnlineWait = time.Since(activatorsupdated)
+	f.firstpassonce.Do(func() { close(f.firstpass) })
+}
+
+// WaitForInitialDiscovery blocks until the first update pass as part of
+// [TurtleFinder.Containers] has fully run, that is, all container engines
+// initially found either have synchronized their workloads or hit the
+// “getting online” time box. It returns nil when the initial discovery has
+// completed, or the context's error if the context gets cancelled before.
+//
+// Please note that WaitForInitialDiscovery doesn't trigger any discovery
+// itself, but instead waits for some other caller to call
+// [TurtleFinder.Containers].
+func (f *TurtleFinder) WaitForInitialDiscovery(ctx context.Context) error {
+	select {
+	case <-f.firstpass:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // updateDaemons updates our knowledge about running container engines if
@@ -326,28 +876,14 @@ func (f *TurtleFinder) update(ctx context.Context, procs model.ProcessTable) {
 // synchronization time box, the referenced wait group will be decreased
 // automatically. This ensures that waiting on the wait group will always be
 // time-boxed.
-func (f *TurtleFinder) updateDaemons(ctx context.Context, procs model.ProcessTable, wg *sync.WaitGroup) {
+//
+// New engine processes are probed in parallel, but never more than the
+// maximum number of workers (see WithWorkers) at the same time, including
+// engine queries. updateDaemons thus blocks until all probes have at least been
+// started, or the context gets cancelled.
+func (f *TurtleFinder) updateDaemons(ctx context.Context, procs model.ProcessTable, wg *sync.WaitGroup, netunix *netUnixCache) {
 	// Look for potential signs of engine life, based on process names...
-	engineprocs := []engineProcess{}
-NextProcess:
-	for _, proc := range procs {
-		procname := proc.Name
-		for engidx := range f.engineplugins {
-			// We need to reference the single authoritative engine item, not a
-			// loop var copy.
-			engine := &f.engineplugins[engidx]
-			for _, enginename := range engine.names {
-				if procname != enginename {
-					continue
-				}
-				engineprocs = append(engineprocs, engineProcess{
-					proc:   proc,
-					engine: engine,
-				})
-				continue NextProcess
-			}
-		}
-	}
+	engineprocs := engineProcesses(procs, f.engineplugins, f.procroot)
 	// Next, throw out all engine processes we already know of and keep only the
 	// new ones to look into them further. This way we keep the lock as short as
 	// possible.
@@ -358,45 +894,69 @@ NextProcess:
 		if _, ok := f.engines[engineproc.proc.PID]; ok {
 			continue
 		}
+		// Are we even interested in engines of this type?
+		if !f.enginefilter.allowsPlugin(engineproc.engine.pluginname) {
+			continue
+		}
 		newengineprocs = append(newengineprocs, engineproc)
 	}
+	// Don't exceed the maximum number of engines under watch, if set.
+	if slots := f.engineSlots(); slots < len(newengineprocs) {
+		f.warnEngineLimit(len(newengineprocs) - slots)
+		newengineprocs = newengineprocs[:slots]
+	}
 	f.mux.Unlock()
 	if len(newengineprocs) == 0 {
 		return
 	}
+	ctx, span := f.startSpan(ctx, SpanUpdateDaemons, AttrNewEngines, len(newengineprocs))
+	defer span.End()
 	// Finally look into each new engine process: try to figure out its
 	// potential API socket endpoint pathname and then try to contact the engine
-	// via this (these) pathname(s). Again, we aggressively go parallel in
-	// contacting new engines. This also bases on the probably sane assumptions
-	// that a host isn't "infested" with tens or hundreds of container engine
-	// daemons...
-	wg.Add(len(newengineprocs))
+	// via this (these) pathname(s). We go parallel in contacting new engines,
+	// but in order to keep the peak concurrency predictable on constrained
+	// hosts, the engine probes share the same bounded pool with the engine
+	// queries, see also WithWorkers.
 	for _, engineproc := range newengineprocs {
+		if err := f.workersem.Acquire(ctx, 1); err != nil {
+			return
+		}
+		wg.Add(1)
 		go func(engineproc engineProcess) {
-			defer wg.Done()
-			log.Debugf("scanning new potential engine process %s (%d) for API endpoints...",
+			defer func() {
+				f.workersem.Release(1)
+				wg.Done()
+			}()
+			ctx, span := f.startSpan(ctx, SpanProbeEngine,
+				AttrEngineType, engineproc.engine.pluginname,
+				AttrEnginePID, int(engineproc.proc.PID))
+			defer span.End()
+			lg := f.logger.With("process", engineproc.proc.Name, "pid", engineproc.proc.PID)
+			lg.Debugf("scanning new potential engine process %s (%d) for API endpoints...",
 				engineproc.proc.Name, engineproc.proc.PID)
 			// Does this process have any listening unix sockets that might act as
-			// API endpoints?
-			apisox := discoverAPISocketsOfProcess(engineproc.proc.PID)
-			if apisox == nil {
-				log.Debugf("process %d no API endpoint found", engineproc.proc.PID)
-				return
-			}
-			// Translate the API pathnames so that we can access them from our
-			// namespace via procfs wormholes; to make this reliably work we need to
-			// evaluate paths for symbolic links...
-			for idx, apipath := range apisox {
-				wormhole := "/proc/" + strconv.FormatUint(uint64(engineproc.proc.PID), 10) +
-					"/root"
-				apipath, err := procfsroot.EvalSymlinks(apipath, wormhole, procfsroot.EvalFullPath)
-				if err != nil {
-					log.Warnf("invalid API endpoint at %s in the context of %s",
-						apipath, wormhole)
-					apisox[idx] = ""
-					continue
+			// API endpoints? Unless, that is, the engine doesn't serve any API
+			// endpoints at all...
+			var apisox []string
+			if _, endpointless := engineproc.engine.detector.(detector.EndpointlessDetector); !endpointless {
+				firstscan := f.scannedprocs.firstScan(engineproc.proc)
+				apisox, _ = f.apiEndpointsOfEngine(ctx, engineproc, procs, netunix, firstscan, lg)
+				if apisox == nil {
+					lg.Debugf("process %d no API endpoint found", engineproc.proc.PID)
+					if ctx.Err() != nil {
+						return // aborted, so we don't know better.
+					}
+					f.unreachable.record(UnreachableEngine{
+						PID:  engineproc.proc.PID,
+						Name: engineproc.proc.Name,
+						Type: engineproc.engine.pluginname,
+						LastError: categorize(ErrNoAPIEndpoint,
+							fmt.Errorf("no API endpoint found for '%s' engine process (PID %d)",
+								engineproc.engine.pluginname, engineproc.proc.PID)),
+						LastSeen: time.Now(),
+					})
+					return
 				}
-				apisox[idx] = wormhole + apipath
 			}
 			// Ask the contexter to give us a long-living engine workload
 			// watching context; just using the background context (or even a
@@ -404,19 +964,345 @@ NextProcess:
 			// users of a Turtlefinder the means to properly spin down workload
 			// watchers when retiring a Turtlefinder.
 			enginectx := f.contexter()
-			for _, w := range engineproc.engine.detector.NewWatchers(enginectx, engineproc.proc.PID, apisox) {
+			watchers, detecterr := f.newWatchers(ctx, enginectx, engineproc, apisox)
+			if len(watchers) > 0 {
+				span.SetAttributes(AttrEngineAPI, watchers[0].API())
+			} else if len(apisox) > 0 {
+				span.SetAttributes(AttrEngineAPI, strings.Join(apisox, ","))
+			}
+			if len(watchers) == 0 {
+				if len(apisox) == 0 && detecterr == nil {
+					return // not an engine after all, so nothing unreachable to report.
+				}
+				if errors.Is(detecterr, detector.ErrUnsupportedEngine) {
+					lg.Debugf("ignoring unsupported '%s' engine process (PID %d): %s",
+						engineproc.engine.pluginname, engineproc.proc.PID, detecterr.Error())
+					f.rejectedprocs.reject(engineproc.proc)
+					return
+				}
+				if ctx.Err() != nil {
+					lg.Debugf("probing '%s' engine process (PID %d) aborted",
+						engineproc.engine.pluginname, engineproc.proc.PID)
+					return // aborted, so we don't know better.
+				}
+				err := fmt.Errorf("no working API endpoint found for '%s' engine process (PID %d)",
+					engineproc.engine.pluginname, engineproc.proc.PID)
+				if detecterr != nil {
+					err = fmt.Errorf("no working API endpoint found for '%s' engine process (PID %d): %w",
+						engineproc.engine.pluginname, engineproc.proc.PID, detecterr)
+				}
+				if len(apisox) == 0 {
+					err = categorize(ErrNoAPIEndpoint, err)
+				} else {
+					err = categorize(ErrEngineUnreachable, err)
+				}
+				if f.unreachable.record(UnreachableEngine{
+					PID:       engineproc.proc.PID,
+					Name:      engineproc.proc.Name,
+					Type:      engineproc.engine.pluginname,
+					APIs:      apisox,
+					LastError: err,
+					LastSeen:  time.Now(),
+				}) {
+					lg.Warnf("%s, tried: %s", err.Error(), strings.Join(apisox, ", "))
+				}
+				return
+			}
+			f.unreachable.forget(engineproc.proc.PID)
+			filtered := 0
+			for _, w := range watchers {
+				if !f.enginefilter.allowsWatcher(engineproc.engine.pluginname, w) {
+					lg.Debugf("ignoring filtered '%s' engine (PID %d)", w.Type(), w.PID())
+					w.Close()
+					filtered++
+					continue
+				}
 				// We've got a new watcher! Or two... *snicker* ...so many demons!
+				f.containerchanges.subscribe(w)
+				staggerWatchStart(ctx, f.startjitter)
 				startWatch(enginectx, w, f.initialsyncwait)
-				eng := NewEngine(enginectx, w, engineproc.proc.PPID)
+				eng := f.newEngine(enginectx, w, engineproc.proc.PPID, apisox)
 				f.mux.Lock()
 				f.engines[engineproc.proc.PID] = append(f.engines[engineproc.proc.PID], eng)
 				f.mux.Unlock()
 			}
+			// If all watchers have been filtered out, then don't probe this
+			// engine process over and over again in future discoveries.
+			if filtered == len(watchers) {
+				f.rejectedprocs.reject(engineproc.proc)
+			}
 		}(engineproc)
 	}
 }
 
-func (f *TurtleFinder) updateActivators(procs model.ProcessTable, wg *sync.WaitGroup) {
+// apiEndpointsOfEngine returns the potential API endpoints of the specified
+// engine process, as well as the socket paths that couldn't be resolved in the
+// context of the engine process. If firstscan is true, a just started engine
+// process not showing any API endpoints yet gets a few quick chances to create
+// them.
+func (f *TurtleFinder) apiEndpointsOfEngine(
+	ctx context.Context,
+	engineproc engineProcess,
+	procs model.ProcessTable,
+	netunix *netUnixCache,
+	firstscan bool,
+	lg detector.Logger,
+) (apisox []string, unresolved []string) {
+	apisox, unresolved = apiEndpointsOfProcess(f.procroot, engineproc.proc.PID, f.sockfilter, netunix, lg)
+	// A just started engine process might not have created its API
+	// endpoint(s) yet, so give it a few quick chances when we see it for the
+	// first time, instead of skipping it until the next discovery.
+	if apisox == nil && len(unresolved) == 0 && firstscan {
+		apisox, unresolved = f.awaitAPIEndpoints(ctx, engineproc.proc.PID, lg)
+	}
+	// A rootless engine's API endpoints are visible to the host side via its
+	// RootlessKit process, so prefer reaching them via RootlessKit's procfs
+	// wormhole.
+	if kit := rootlesskitOf(engineproc.proc, procs); kit != nil {
+		lg.Debugf("engine process %d runs rootless under rootlesskit process %d",
+			engineproc.proc.PID, kit.PID)
+		apisox, unresolved = rootlessAPIEndpoints(f.procroot, engineproc.proc.PID, kit.PID,
+			apisox, unresolved)
+	}
+	if f.vsock {
+		apisox = append(apisox, vsockEndpointsOfProcess(f.procroot, engineproc.proc.PID, netunix)...)
+	}
+	if len(unresolved) > 0 {
+		lg.Warnf("cannot resolve API endpoint(s) of '%s' engine process (PID %d) in the context of %s: %s",
+			engineproc.engine.pluginname, engineproc.proc.PID,
+			f.procroot+"/"+strconv.FormatUint(uint64(engineproc.proc.PID), 10)+"/root",
+			strings.Join(unresolved, ", "))
+	}
+	return apisox, unresolved
+}
+
+// newEngine returns a new Engine for the specified (already watching) watcher,
+// configured according to the options of this turtle finder. The candidate API
+// endpoint paths are those that were considered when discovering the engine.
+func (f *TurtleFinder) newEngine(
+	enginectx context.Context, w watcher.Watcher, ppidhint model.PIDType, candidates []string,
+) *Engine {
+	eng := startEngine(enginectx, w, ppidhint, f.lazymeta)
+	f.containerchanges.bind(eng)
+	eng.labeler = f.labeler
+	eng.procroot = f.procroot
+	eng.versionrefresh = f.versionrefresh
+	eng.candidates = candidates
+	return eng
+}
+
+// engineLimitWarnInterval is the minimum interval between warnings about
+// ignoring new engines because of the maximum number of engines under watch.
+const engineLimitWarnInterval = time.Minute
+
+// engineSlots returns the number of further engine processes that can be put
+// under watch without exceeding the maximum number of engines set using
+// [WithMaxEngines]. engineSlots must be called with f.mux locked.
+func (f *TurtleFinder) engineSlots() int {
+	if f.maxengines <= 0 {
+		return math.MaxInt
+	}
+	if slots := f.maxengines - len(f.engines); slots > 0 {
+		return slots
+	}
+	return 0
+}
+
+// warnEngineLimit warns about the specified number of new engine candidates
+// getting ignored due to the maximum number of engines under watch. In order
+// to not flood the logs, warnEngineLimit warns at most once per
+// engineLimitWarnInterval. warnEngineLimit must be called with f.mux locked.
+func (f *TurtleFinder) warnEngineLimit(ignored int) {
+	now := time.Now()
+	if now.Sub(f.limitwarn) < engineLimitWarnInterval {
+		return
+	}
+	f.limitwarn = now
+	f.logger.Warnf("ignoring %d new container engine candidate(s), as %d engines are already under watch (limit %d)",
+		ignored, len(f.engines), f.maxengines)
+}
+
+// newWatchers asks the detector plugin responsible for the specified engine
+// process to create new workload watchers for the specified API endpoints. If
+// the plugin doesn't return any watchers, such as when a freshly started
+// engine isn't yet accepting connections, newWatchers retries with an
+// exponential backoff as configured using [WithEngineProbeRetries], until it
+// either gets some watchers, runs out of retries, or the specified context
+// gets cancelled.
+//
+// For detector plugins implementing [detector.ErrorReportingDetector],
+// newWatchers additionally returns the error reported by the plugin in its
+// final attempt, if any.
+func (f *TurtleFinder) newWatchers(
+	ctx context.Context,
+	enginectx context.Context,
+	engineproc engineProcess,
+	apisox []string,
+) ([]watcher.Watcher, error) {
+	backoff := f.probebackoff
+	for attempt := 0; ; attempt++ {
+		var watchers []watcher.Watcher
+		var err error
+		if d, ok := engineproc.engine.detector.(detector.ErrorReportingDetector); ok {
+			watchers, err = d.NewWatchersWithError(enginectx, engineproc.proc.PID, apisox)
+		} else {
+			watchers = engineproc.engine.detector.NewWatchers(enginectx, engineproc.proc.PID, apisox)
+		}
+		if len(watchers) > 0 {
+			return watchers, nil
+		}
+		if attempt >= f.proberetries || errors.Is(err, detector.ErrUnsupportedEngine) {
+			return nil, err
+		}
+		f.logger.With("pid", engineproc.proc.PID).
+			Debugf("engine process %d not yet responding, retrying in %s",
+				engineproc.proc.PID, backoff)
+		wecker := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			if !wecker.Stop() { // drain the timer, if necessary.
+				<-wecker.C
+			}
+			return nil, err
+		case <-wecker.C:
+		}
+		backoff *= 2
+	}
+}
+
+// isCandidate returns true if the specified process might be a container engine
+// or socket activator, based on its process name, or alternatively its
+// executable or cgroups matching the executable basename patterns or cgroup
+// patterns of an engine detector plugin.
+func (f *TurtleFinder) isCandidate(proc *model.Process) bool {
+	for engidx := range f.engineplugins {
+		for _, enginename := range f.engineplugins[engidx].names {
+			if proc.Name == enginename {
+				return true
+			}
+		}
+	}
+	if f.isActivator(proc) {
+		return true
+	}
+	return exeEnginePlugin(f.procroot, proc, f.engineplugins) != nil ||
+		cgroupEnginePlugin(f.procroot, proc, f.engineplugins) != nil
+}
+
+// newEnginePlugins returns the list of currently registered engine detector
+// plugins together with the process names they are interested in.
+func newEnginePlugins() []enginePlugin {
+	namegivers := plugger.Group[detector.Detector]().PluginsSymbols()
+	engineplugins := make([]enginePlugin, 0, len(namegivers))
+	for _, namegiver := range namegivers {
+		var cgrouppatterns []string
+		if cgroupdetector, ok := namegiver.S.(detector.CgroupDetector); ok {
+			cgrouppatterns = cgroupdetector.CgroupPatterns()
+		}
+		var exepatterns []string
+		if exedetector, ok := namegiver.S.(detector.ExeDetector); ok {
+			exepatterns = exedetector.EngineExePaths()
+		}
+		engineplugins = append(engineplugins, enginePlugin{
+			names:          namegiver.S.EngineNames(),
+			cgrouppatterns: cgrouppatterns,
+			exepatterns:    exepatterns,
+			detector:       namegiver.S,
+			pluginname:     namegiver.Plugin,
+		})
+	}
+	return engineplugins
+}
+
+// engineProcesses returns the processes from the specified process table that
+// are potential container engine processes, based on their process names
+// matching the process names of the specified engine detector plugins. For
+// processes not matching any process name, engineProcesses additionally checks
+// their executables against the executable basename patterns and then their
+// cgroups against the cgroup patterns of the engine detector plugins, reading
+// the executable and cgroup information from the proc filesystem mounted at
+// procroot.
+func engineProcesses(procs model.ProcessTable, engineplugins []enginePlugin, procroot string) []engineProcess {
+	engineprocs := []engineProcess{}
+NextProcess:
+	for _, proc := range procs {
+		procname := proc.Name
+		for engidx := range engineplugins {
+			// We need to reference the single authoritative engine item, not a
+			// loop var copy.
+			engine := &engineplugins[engidx]
+			for _, enginename := range engine.names {
+				if procname != enginename {
+					continue
+				}
+				engineprocs = append(engineprocs, engineProcess{
+					proc:   proc,
+					engine: engine,
+				})
+				continue NextProcess
+			}
+		}
+		if engine := exeEnginePlugin(procroot, proc, engineplugins); engine != nil {
+			engineprocs = append(engineprocs, engineProcess{
+				proc:   proc,
+				engine: engine,
+			})
+			continue
+		}
+		if engine := cgroupEnginePlugin(procroot, proc, engineplugins); engine != nil {
+			engineprocs = append(engineprocs, engineProcess{
+				proc:   proc,
+				engine: engine,
+			})
+		}
+	}
+	return engineprocs
+}
+
+// apiEndpointsOfProcess returns the paths of the listening unix domain sockets
+// of the specified process that might act as API endpoints, or nil if there
+// are none. The paths returned are translated so that we can access them from
+// our mount namespace via the procfs wormhole of the process, using the proc
+// filesystem mounted at procroot. If filter is non-nil, only socket paths
+// allowed by the filter are considered. If netunix is non-nil, the listening
+// unix domain sockets are taken from this cache. Reasons for not being able to
+// read the listening unix domain sockets of the process at all are logged to
+// lg at debug level.
+//
+// Socket paths that cannot be resolved in the context of the process are
+// skipped and instead returned in unresolved, so that callers can report them.
+// If none of the socket paths can be resolved, apis is nil.
+func apiEndpointsOfProcess(procroot string, pid model.PIDType, filter socketPathFilter, netunix *netUnixCache, lg detector.Logger) (apis []string, unresolved []string) {
+	apisox := discoverAPISocketsOfProcess(procroot, pid, filter, netunix, lg)
+	if apisox == nil {
+		return nil, nil
+	}
+	// Translate the API pathnames so that we can access them from our
+	// namespace via procfs wormholes; to make this reliably work we need to
+	// evaluate paths for symbolic links...
+	wormhole := procroot + "/" + strconv.FormatUint(uint64(pid), 10) + "/root"
+	for _, apipath := range apisox {
+		evalpath, err := procfsroot.EvalSymlinks(apipath, wormhole, procfsroot.EvalFullPath)
+		if err != nil {
+			unresolved = append(unresolved, apipath)
+			continue
+		}
+		apis = append(apis, wormhole+evalpath)
+	}
+	if apis == nil {
+		return nil, unresolved
+	}
+	// Finally make sure that we don't hand out the same API endpoint multiple
+	// times to the detectors, such as when it is reachable via multiple
+	// paths.
+	return uniqueSocketPaths(apis), unresolved
+}
+
+// updateActivators updates our knowledge about socket activators, looking for
+// them among the specified candidate processes, and then tells all known
+// socket activators to update. The full process table recentprocs is used (if
+// enabled) to locate socket-activated engine processes.
+func (f *TurtleFinder) updateActivators(procs model.ProcessTable, recentprocs model.ProcessTable, wg *sync.WaitGroup, netunix *netUnixCache) {
 	// Look for potential signs of socket activators, based on their process names...
 	activatorprocs := []*model.Process{}
 NextProcess:
@@ -436,32 +1322,23 @@ NextProcess:
 		if _, ok := f.activators[activatorproc.PID]; ok {
 			continue
 		}
-		log.Infof("found new socket activator process '%s' with PID %d",
-			activatorproc.Name, activatorproc.PID)
-		f.activators[activatorproc.PID] = newSocketActivator(activatorproc,
+		f.logger.With("process", activatorproc.Name, "pid", activatorproc.PID).
+			Infof("found new socket activator process '%s' with PID %d",
+				activatorproc.Name, activatorproc.PID)
+		activator := newSocketActivator(activatorproc,
+			f.procroot,
 			f.initialsyncwait,
 			f.contexter,
-			func(w watcher.Watcher, pid model.PIDType) {
-				// As this comes in from a different "background" go routine, we
-				// need to make sure that we're not trashing our engine map.
-				f.mux.Lock()
-				defer f.mux.Unlock()
-				// Freshly socket-activated engines won't yet be in the process
-				// tree we're working on. In order to allow downstream users of
-				// turtlefinders – lxkns in particular – to still do correct
-				// container PID translation, we get an engine's parent PID that
-				// we assume serves as well for PID translation between PID
-				// namespaces. So pay a quick visit to the proc filesystem and
-				// pick up this engine's PPID.
-				var ppidhint model.PIDType
-				if engproc := model.NewProcess(pid, false); engproc != nil {
-					ppidhint = engproc.PPID
-				}
-				f.engines[pid] = []*Engine{
-					NewEngine(f.contexter(), w, ppidhint),
-				}
-			},
+			f.enginefilter,
+			f.addActivatedEngine,
 		)
+		activator.sockfilter = f.sockfilter
+		if f.containerchanges != nil {
+			activator.subscribeFn = f.containerchanges.subscribe
+		}
+		activator.findattempts = f.findattempts
+		activator.findpolling = f.findpolling
+		f.activators[activatorproc.PID] = activator
 	}
 	f.mux.Unlock()
 	// Now iterate over all the socket activators currently known and tell them
@@ -470,7 +1347,33 @@ NextProcess:
 	// the more complex activation and discovery mechanism. New watchers are
 	// then reported via the createdWatcherFn callback function registered above
 	// when we created new socket activator (proxy) objects.
+	//
+	// As reading the socket fds of activators adds up on systems with several
+	// socket activators, such as containers each running their own systemd, we
+	// update the activators in parallel using a bounded pool. We need to wait
+	// for all activator updates to return, as only then the wait group will
+	// correctly cover all the workload synchronizations started.
+	if !f.reuseproctable {
+		recentprocs = nil
+	}
+	f.mux.Lock()
+	activators := make([]*socketActivatorProcess, 0, len(f.activators))
 	for _, activator := range f.activators {
-		activator.update(wg)
+		activators = append(activators, activator)
+	}
+	f.mux.Unlock()
+	pool := make(chan struct{}, f.numworkers)
+	var updatewg sync.WaitGroup
+	updatewg.Add(len(activators))
+	for _, activator := range activators {
+		pool <- struct{}{}
+		go func(activator *socketActivatorProcess) {
+			defer func() {
+				<-pool
+				updatewg.Done()
+			}()
+			activator.update(wg, recentprocs, netunix)
+		}(activator)
 	}
+	updatewg.Wait()
 }
@@ -4,16 +4,42 @@
 
 package turtlefinder
 
-import "time"
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/siemens/turtlefinder/activator/podman"
+	"github.com/siemens/turtlefinder/detector"
+	"github.com/siemens/turtlefinder/detector/containerd"
+	"github.com/thediveo/lxkns/model"
+)
 
 // NewOption represents options to New when creating a new turtle finder.
 type NewOption func(*TurtleFinder)
 
+// decorate adds the specified context decorator for passing an option's
+// setting to the detector plugins via the contexts handed out by the
+// contexter. Decorators get applied in the order the options were given, so
+// later options win over earlier ones.
+func (f *TurtleFinder) decorate(decorator func(context.Context) context.Context) {
+	f.decorators = append(f.decorators, decorator)
+}
+
 // WithWorkers sets the maximum number of parallel container engine queries on
 // the same TurtleFinder. A maximum number of zero or less is taken as
 // GOMAXPROCS instead. Please note that this maximum applies to all concurrent
 // [TurtleFinder.Containers] calls, and not to individual
-// [TurtleFinder.Containers] calls separately.
+// [TurtleFinder.Containers] calls separately. Engine queries exceeding this
+// maximum wait for free slots, without any strict ordering guarantee;
+// [TurtleFinder.InFlightEngineQueries] tells the number of engine queries
+// currently in flight. The same maximum
+// additionally bounds the number of socket activators updated in parallel
+// during a discovery. Probing newly found engine processes shares the same
+// bounded pool with the engine queries, so that the overall number of
+// goroutines contacting engines stays predictable on constrained hosts.
 func WithWorkers(num int) NewOption {
 	return func(f *TurtleFinder) {
 		f.numworkers = num
@@ -26,8 +52,600 @@ func WithWorkers(num int) NewOption {
 // takes longer, it won't be aborted. This option instead controls the maximum
 // wait before proceeding with discovering containers from the already known
 // engine workloads.
+//
+// To see how long discoveries actually wait for new engines to come online,
+// use [TurtleFinder.LastDiscoveryTimings].
 func WithGettingOnlineWait(d time.Duration) NewOption {
 	return func(f *TurtleFinder) {
 		f.initialsyncwait = d
 	}
 }
+
+// WithWatcherStartJitter staggers starting the watchers of container engines
+// newly discovered in the same discovery, by delaying each watcher start for a
+// random duration of up to the specified maximum. This avoids all new watchers
+// synchronizing with their container engines in lockstep, briefly hammering
+// the engines as well as the CPU. Please note that the jitter adds to the time
+// a discovery waits for new engines getting online, see also
+// [WithGettingOnlineWait]. A maximum of zero, the default, starts all watchers
+// immediately.
+func WithWatcherStartJitter(max time.Duration) NewOption {
+	return func(f *TurtleFinder) {
+		f.startjitter = max
+	}
+}
+
+// WithLazyEngineMetadata tells a TurtleFinder to not query newly discovered
+// container engines for their IDs and versions when creating their Engine
+// objects, but instead only on first access via [Engine.EngineID] and
+// [Engine.CurrentVersion]. This cuts the latency of discoveries finding many
+// new engines at once, as otherwise each engine gets queried synchronously,
+// taking up to 2s for unresponsive engines. Please note that the ID and
+// Version fields of lazy Engine objects stay empty; the engine's ID and
+// version are queried at the latest when the engine's containers are
+// retrieved, as these reference their engine's ID and version.
+func WithLazyEngineMetadata() NewOption {
+	return func(f *TurtleFinder) {
+		f.lazymeta = true
+	}
+}
+
+// WithProcessTableReuse tells a TurtleFinder to first consult the process table
+// passed to [TurtleFinder.Containers] when trying to locate the processes of
+// socket-activated container engines, instead of always walking the proc
+// filesystem from scratch. Only when a container engine process is too new to
+// appear in the process table, the proc filesystem gets walked as before.
+func WithProcessTableReuse() NewOption {
+	return func(f *TurtleFinder) {
+		f.reuseproctable = true
+	}
+}
+
+// WithEngineProbeRetries sets the maximum number of retries when a newly
+// discovered container engine process doesn't respond yet to the initial probe
+// of its API endpoint(s), such as a freshly started engine not yet accepting
+// connections. Between retries, a TurtleFinder backs off exponentially,
+// starting with the specified backoff duration; a backoff of zero or less is
+// taken as the default of 100ms. The retries happen as part of the same
+// discovery, so that engines becoming ready shortly after being started are
+// still picked up. By default, there are no retries.
+func WithEngineProbeRetries(retries int, backoff time.Duration) NewOption {
+	return func(f *TurtleFinder) {
+		f.proberetries = retries
+		if backoff > 0 {
+			f.probebackoff = backoff
+		}
+	}
+}
+
+// WithDaemonFindAttempts sets the maximum number of attempts to find the
+// process of a freshly socket-activated container engine, after connecting to
+// its API endpoint in order to activate it. On slow systems, socket-activated
+// engines might take longer to appear as child processes of their socket
+// activators than the default of 10 attempts every 100ms allows for. A
+// maximum number of zero or less is taken as the default instead. If the
+// socket activator hasn't spawned any engine process within the first half of
+// the attempts, the API endpoint is considered to be stale. See also
+// [WithDaemonFindPolling].
+func WithDaemonFindAttempts(attempts int) NewOption {
+	return func(f *TurtleFinder) {
+		if attempts <= 0 {
+			attempts = defaultFindAttempts
+		}
+		f.findattempts = attempts
+	}
+}
+
+// WithDaemonFindPolling sets the polling interval between attempts to find
+// the process of a freshly socket-activated container engine, defaulting to
+// 100ms. An interval of zero or less is taken as the default instead. See
+// also [WithDaemonFindAttempts].
+func WithDaemonFindPolling(d time.Duration) NewOption {
+	return func(f *TurtleFinder) {
+		if d <= 0 {
+			d = defaultFindPolling
+		}
+		f.findpolling = d
+	}
+}
+
+// WithActivatedEngineMaxIdle tells a TurtleFinder to stop watching a
+// socket-activated container engine after the engine didn't have any
+// containers for longer than the specified duration. As the workload watch
+// otherwise keeps a socket-activated engine busy, stopping the watch lets the
+// engine's service go idle, such as podman's API service terminating after
+// its own idle timeout. The TurtleFinder then doesn't activate the engine on
+// its own again, but only after the socket activator has spawned a new engine
+// process, such as when another client connects to the engine's API endpoint,
+// or when the socket activator creates a new listening socket. If the engine
+// process doesn't terminate within a grace period, the TurtleFinder activates
+// and watches it again, so as to not miss any containers. Engines no longer
+// watched because of being idle get retained in the same way as terminated
+// engines, see [WithEngineRetention]. Idle engines are checked for as part of
+// each discovery, so the duration is only as precise as the discoveries are
+// frequent. A duration of zero or less (default) never stops watching idle
+// socket-activated engines.
+func WithActivatedEngineMaxIdle(d time.Duration) NewOption {
+	return func(f *TurtleFinder) {
+		f.maxidle = d
+	}
+}
+
+// WithEngineTypeFilter restricts the container engines a TurtleFinder watches
+// to only those with the specified engine detector plugin names (such as
+// “dockerd”, “containerd”, or “podman”) or watcher types (such as
+// “docker.com”). Container engines not allowed won't get any watchers and
+// thus also won't appear in [TurtleFinder.Engines]. Filtering by plugin names
+// avoids contacting unwanted engines at all, whereas filtering by watcher
+// types needs to create watchers first in order to learn their types. When
+// not specifying any plugin names or watcher types, all engines are watched,
+// which is the default.
+func WithEngineTypeFilter(allow ...string) NewOption {
+	return func(f *TurtleFinder) {
+		f.enginetypes = append(f.enginetypes[:0:0], allow...)
+	}
+}
+
+// WithDiscoveryCoalesceWindow sets the window for sharing the housekeeping and
+// discovery of container engines between concurrent [TurtleFinder.Containers]
+// calls. Callers arriving while such a pass is ongoing wait for it to finish
+// instead of starting their own pass, and callers arriving within the window
+// after the most recent pass reuse its outcome. In any case, each call still
+// returns the current set of containers from the engines known. A window of
+// zero or less disables coalescing, which is the default.
+func WithDiscoveryCoalesceWindow(d time.Duration) NewOption {
+	return func(f *TurtleFinder) {
+		f.coalescewindow = d
+	}
+}
+
+// WithLogger routes the informational, warning, debug, and error messages
+// emitted while discovering and watching container engines to the specified
+// log function, instead of logging them via lxkns' log package. The log
+// function additionally receives structured key-value pairs, such as the engine
+// type and PID, allowing to easily route the messages to, say, a [log/slog]
+// logger. The log function is also passed on to the detector plugins.
+func WithLogger(fn func(level, msg string, kv ...any)) NewOption {
+	return func(f *TurtleFinder) {
+		f.logfn = fn
+		f.decorate(func(ctx context.Context) context.Context {
+			return detector.WithLogFunc(ctx, fn)
+		})
+	}
+}
+
+// WithProcRoot sets the path where the proc filesystem is mounted that is to be
+// used for reading the sockets and status information of processes, as well as
+// for accessing the API endpoints of container engines via procfs wormholes.
+// This allows running the turtlefinder inside a container with the host's proc
+// filesystem bind-mounted somewhere else, such as “/host/proc”. Please note that
+// the process tables passed to [TurtleFinder.Containers] must then have been
+// discovered from the same proc filesystem. Defaults to “/proc”; an empty path
+// keeps the default.
+func WithProcRoot(path string) NewOption {
+	return func(f *TurtleFinder) {
+		if path = strings.TrimSuffix(path, "/"); path != "" {
+			f.procroot = path
+			f.decorate(func(ctx context.Context) context.Context {
+				return detector.WithProcRoot(ctx, path)
+			})
+		}
+	}
+}
+
+// WithEngineQueryTimeout sets the maximum duration for querying an individual
+// container engine for its containers as part of [TurtleFinder.Containers].
+// When a (wedged) engine doesn't answer in time, the turtlefinder logs a
+// warning identifying the slow engine and proceeds without its containers, so
+// a single engine can't stall the whole discovery. Engines frozen inside
+// paused containers instead contribute the containers as last seen by their
+// watchers. Please note that the abandoned engine query then continues in the
+// background until it finally returns, but it doesn't occupy a worker (see
+// also [WithWorkers]) any longer. A timeout of zero or less limits engine
+// queries only by the context passed to [TurtleFinder.Containers], which is
+// the default.
+func WithEngineQueryTimeout(d time.Duration) NewOption {
+	return func(f *TurtleFinder) {
+		f.querytimeout = d
+	}
+}
+
+// WithEngineClientTimeout sets the timeout the detector plugins use when
+// probing potential container engine API endpoints, such as when checking that
+// an engine is alive by querying its version information. Increasing this
+// timeout helps on slow storage or heavily loaded systems where engines might
+// take longer to answer. A timeout of zero or less keeps the default timeouts
+// of the individual detector plugins (5s or 10s), which is the default.
+func WithEngineClientTimeout(d time.Duration) NewOption {
+	return func(f *TurtleFinder) {
+		f.clienttimeout = d
+		f.decorate(func(ctx context.Context) context.Context {
+			return detector.WithClientTimeout(ctx, d)
+		})
+	}
+}
+
+// WithEngineTLS sets the TLS client configuration to use when talking to
+// container engines via TCP API endpoints (“tcp://host:port”) starting with
+// the specified endpointMatch prefix, such as a remote Docker daemon
+// protected by mutual TLS. WithEngineTLS can be used multiple times in order
+// to configure different TCP endpoints; the first matching configuration wins.
+// Unix domain socket API endpoints are unaffected by this option.
+//
+// Please note that the turtlefinder automatically discovers only unix domain
+// socket API endpoints, so TCP API endpoints need to be passed explicitly to
+// the detector plugins.
+func WithEngineTLS(endpointMatch string, tlsConfig *tls.Config) NewOption {
+	return func(f *TurtleFinder) {
+		f.decorate(func(ctx context.Context) context.Context {
+			return detector.WithEngineTLS(ctx, endpointMatch, tlsConfig)
+		})
+	}
+}
+
+// WithDialer sets the dialer to use when connecting to container engine API
+// endpoints, such as for connecting via a proxy or with custom socket options
+// like SO_MARK for policy routing (see [net.Dialer.Control]). The dialer is
+// used when activating socket-activated container engines, as well as passed
+// to the detector plugins for their engine clients, where supported. Please
+// note that the CRI-based engine clients (CRI-O and containerd's CRI API)
+// don't support custom dialers. A nil dialer, the default, keeps using a
+// zero-value dialer.
+func WithDialer(d *net.Dialer) NewOption {
+	return func(f *TurtleFinder) {
+		f.dialer = d
+		f.decorate(func(ctx context.Context) context.Context {
+			return detector.WithDialer(ctx, d)
+		})
+	}
+}
+
+// WithSocketPathFilter sets a filter function deciding which listening unix
+// domain socket paths to consider as potential container engine API endpoints,
+// both for container engine processes as well as for socket activators. This
+// allows operators to restrict API endpoints for security as well as
+// performance reasons, such as to only sockets below “/run” and “/var/run”.
+// The filter function gets passed the socket paths as seen in the mount
+// namespace of the process having the socket open, and returns true for socket
+// paths to be considered. By default, all socket paths are considered.
+func WithSocketPathFilter(fn func(path string) bool) NewOption {
+	return func(f *TurtleFinder) {
+		f.sockfilter = fn
+	}
+}
+
+// WithEngineRetention sets the grace period for which terminated container
+// engines are still reported by [TurtleFinder.Engines] and
+// [TurtleFinder.EngineDetails], where the latter flags them as inactive. This
+// avoids engines briefly disappearing and then reappearing, such as when a
+// Docker daemon gets restarted. When the same engine (in terms of its type and
+// ID) reappears within the grace period, it gets reported as active again
+// instead. A grace period of zero or less removes terminated engines
+// immediately, which is the default.
+func WithEngineRetention(d time.Duration) NewOption {
+	return func(f *TurtleFinder) {
+		f.retention = d
+	}
+}
+
+// WithPIDTranslation enables translating the PIDs of containers from their
+// engines' PID namespaces into the initial PID namespace, using the PID mapper
+// passed to [TurtleFinder.Containers]. This supports deploying the
+// turtlefinder as a sidecar in its own PID namespace, where the PIDs reported
+// by container engines might belong to different PID namespaces than the
+// process table PIDs. The engine PIDs already are process table PIDs, so they
+// are left untouched. Please note that lxkns' discovery
+// already translates container PIDs on its own, so don't enable PID
+// translation when passing the turtlefinder as the containerizer to an lxkns
+// discovery; instead, use it when calling [TurtleFinder.Containers] directly.
+func WithPIDTranslation() NewOption {
+	return func(f *TurtleFinder) {
+		f.translatepids = true
+	}
+}
+
+// WithContainerLabeler sets a function that gets called for each container
+// adapted from the workload of a container engine, allowing to add, change, or
+// remove container labels, such as for tagging containers with engine-derived
+// metadata like the engine's API endpoint path. The labeler is called after the
+// container's labels have been cloned from the engine watcher's labels, so it
+// can freely modify the container's labels. It gets called from multiple
+// goroutines concurrently, so it must be safe for concurrent use. Compared to
+// lxkns decorators, a labeler has direct access to the turtlefinder [Engine]
+// managing the container.
+func WithContainerLabeler(fn func(c *model.Container, e *Engine)) NewOption {
+	return func(f *TurtleFinder) {
+		f.labeler = fn
+	}
+}
+
+// WithContainerLabelSelector restricts the containers returned from container
+// engines to only those containers having all the labels in the specified
+// selector, with exactly the same values. The selector is applied to the
+// final list of containers after engine stacking and deduplication, so that
+// containers not matching the selector still contribute to determining the
+// engine hierarchy, such as the container of a Docker-in-Docker engine. The
+// engines returned from [TurtleFinder.ContainersAndEngines] also list only
+// the matching containers. Please note that lxkns decorators get to see only
+// the retained containers, whereas container labelers (see
+// [WithContainerLabeler]) see all containers; the selector thus also matches
+// labels added by container labelers. An empty or nil selector returns all
+// containers.
+func WithContainerLabelSelector(selector map[string]string) NewOption {
+	return func(f *TurtleFinder) {
+		if len(selector) == 0 {
+			f.labelselector = nil
+			return
+		}
+		f.labelselector = make(map[string]string, len(selector))
+		for k, v := range selector {
+			f.labelselector[k] = v
+		}
+	}
+}
+
+// WithStackingExclusion sets a function that tells which container engines to
+// treat as top-level engines when determining the engine hierarchy, even if
+// these engines are running inside a container. The containers of excluded
+// engines thus never receive a prefix derived from the container the engine is
+// running in (see [TurtlefinderContainerPrefixLabelName]), such as when the
+// nesting is an implementation detail that should stay hidden. Engines nested
+// inside containers of an excluded engine still get prefixed with the names of
+// these containers. By default, no engines are excluded.
+func WithStackingExclusion(fn func(e *Engine) bool) NewOption {
+	return func(f *TurtleFinder) {
+		f.stackexclusion = fn
+	}
+}
+
+// WithPrefixLabelName sets the name of the container label for attaching the
+// engine hierarchy prefixes to containers, such as when the default label name
+// [TurtlefinderContainerPrefixLabelName] collides with a label used by some
+// other tool. An empty name keeps the default label name.
+func WithPrefixLabelName(name string) NewOption {
+	return func(f *TurtleFinder) {
+		if name == "" {
+			return
+		}
+		f.prefixlabelname = name
+	}
+}
+
+// WithVsockDiscovery additionally discovers API endpoints of container engines
+// listening on AF_VSOCK VM sockets, such as engines inside micro VMs (Kata,
+// Firecracker, ...) that are reachable only via VM sockets. These API endpoints
+// get passed to the detector plugins in the form of “vsock://CID:PORT”; VM
+// sockets listening on any CID are passed with the local CID instead. The
+// moby and containerd detector plugins support vsock API endpoints.
+//
+// As the proc filesystem doesn't list VM sockets, discovering vsock API
+// endpoints needs the kernel's “vsock_diag” module. If not available, no vsock
+// API endpoints will be discovered.
+func WithVsockDiscovery() NewOption {
+	return func(f *TurtleFinder) {
+		f.vsock = true
+	}
+}
+
+// WithPodmanNativeAPI tells the podman engine finder to prefer podman's native
+// “libpod” API when available, in order to additionally label podman
+// containers with the ID and name of the pod they belong to, using the
+// PodIDLabel and PodNameLabel labels of the podman activator package. If
+// podman's native API cannot be reached, the podman engine finder falls back
+// to podman's Docker-compatible API.
+func WithPodmanNativeAPI() NewOption {
+	return func(f *TurtleFinder) {
+		f.decorate(podman.WithPreferNativeAPI)
+	}
+}
+
+// WithContainerdCRIMode sets which of containerd's APIs to watch: by default
+// ([containerd.CRIBonus]), containerd's native API and additionally its CRI
+// API, if enabled. [containerd.CRIOnly] watches only the CRI API, such as on
+// Kubernetes nodes, falling back to the native API if CRI isn't enabled.
+// [containerd.CRINone] watches only the native API without even probing for
+// the CRI API, avoiding twice the watchers and engine queries per containerd
+// engine where Kubernetes workloads are of no interest. The CRI mode also
+// applies to the containerd embedded in k3s.
+func WithContainerdCRIMode(mode containerd.CRIMode) NewOption {
+	return func(f *TurtleFinder) {
+		f.decorate(func(ctx context.Context) context.Context {
+			return containerd.WithCRIMode(ctx, mode)
+		})
+	}
+}
+
+// WithContainerdNamespaces sets the containerd namespaces to watch via
+// containerd's native API. Without any namespaces, all namespaces except for
+// the “moby” and “k8s.io” namespaces are watched, which is the default.
+// [containerd.AllNamespaces] watches all namespaces, including “moby” and
+// “k8s.io”. See also [containerd.WithWatchedNamespaces] for details.
+func WithContainerdNamespaces(namespaces ...string) NewOption {
+	namespaces = append([]string(nil), namespaces...)
+	return func(f *TurtleFinder) {
+		f.decorate(func(ctx context.Context) context.Context {
+			return containerd.WithWatchedNamespaces(ctx, namespaces...)
+		})
+	}
+}
+
+// WithContainerChangeHandler sets a function that gets called whenever a
+// container managed by any of the container engines being monitored gets
+// started, exits, gets paused, or gets unpaused, together with the [Engine]
+// managing the container. This turns a TurtleFinder into a push source for
+// container changes, such as for real-time UIs, without the need to diff the
+// results of consecutive [TurtleFinder.Containers] calls.
+//
+// The handler also gets called for the containers already present when
+// initially synchronizing with a newly found engine. The handler gets called from
+// multiple goroutines concurrently, one per engine, so it must be safe for
+// concurrent use. As the handler runs on the event path of an engine's
+// watcher, it should return swiftly, as otherwise it holds up tracking the
+// engine's workload. Engines injected using [WithInjectedEngines] are not
+// covered.
+func WithContainerChangeHandler(fn func(change ContainerChange)) NewOption {
+	return func(f *TurtleFinder) {
+		f.containerchanges = newContainerChanges(fn)
+	}
+}
+
+// WithoutSocketActivators disables the discovery of socket activators, such as
+// “systemd”, and thus also of socket-activated container engines, such as
+// podman. On systems without socket activation, or where socket-activated
+// engines are known not to be used, this avoids the overhead of scanning socket
+// activators for changes in their listening sockets on every discovery.
+// Container engines detected by their well-known process names are still
+// discovered as usual.
+func WithoutSocketActivators() NewOption {
+	return func(f *TurtleFinder) {
+		f.noactivators = true
+	}
+}
+
+// defaultVersionRefresh is the default interval for refreshing the versions of
+// container engines; see [WithEngineVersionRefresh].
+const defaultVersionRefresh = 5 * time.Minute
+
+// WithEngineVersionRefresh sets the interval for refreshing the versions of
+// the container engines being watched, defaulting to 5 minutes. Engine
+// versions are otherwise only queried once when finding a container engine,
+// so after an in-place engine upgrade without the engine process changing,
+// the version reported would go stale. Refreshing an engine's version happens
+// as part of querying the engine's workload in [TurtleFinder.Containers], when
+// the most recent version query is older than the specified interval. An
+// interval of zero or less disables refreshing engine versions.
+//
+// The refreshed version is reported by [Engine.CurrentVersion], as well as by
+// [TurtleFinder.Engines] and [TurtleFinder.EngineDetails].
+func WithEngineVersionRefresh(d time.Duration) NewOption {
+	return func(f *TurtleFinder) {
+		f.versionrefresh = d
+	}
+}
+
+// WithEagerDiscovery tells New to already run an initial discovery of
+// container engines and socket activators before returning the new
+// TurtleFinder, instead of waiting for the first [TurtleFinder.Containers]
+// call. This way, [TurtleFinder.Engines] is already populated right after
+// New, such as for tools that want their engines warmed up before serving.
+// New takes up to the “getting online wait” longer to return (see
+// [WithGettingOnlineWait]).
+//
+// The initial discovery uses a process table freshly read from the proc
+// filesystem (see also [WithProcRoot]), unless a process table has been
+// passed using [WithEagerDiscoveryProcesses].
+func WithEagerDiscovery() NewOption {
+	return func(f *TurtleFinder) {
+		f.eager = true
+	}
+}
+
+// WithTracer sets a tracer for creating spans around container discoveries,
+// namely around [TurtleFinder.Containers] (recording the number of containers
+// found), around looking for new engine processes, and around probing each
+// new engine process (recording the engine type and API endpoint path). Use
+// [github.com/siemens/turtlefinder/oteltracing.New] to trace using an
+// OpenTelemetry tracer. A nil tracer disables tracing, which is the default.
+func WithTracer(tracer Tracer) NewOption {
+	return func(f *TurtleFinder) {
+		f.tracer = tracer
+	}
+}
+
+// WithBackgroundDiscovery tells New to start a background goroutine that
+// periodically prunes vanished container engines and socket activators and
+// looks for new ones at the specified interval, instead of relying solely on
+// callers of [TurtleFinder.Containers] to trigger discoveries. This keeps
+// [TurtleFinder.Engines] fresh for observability purposes even when nobody is
+// asking for containers. The first background discovery happens only after
+// the first interval has passed; use [WithEagerDiscovery] to additionally
+// discover right in New. [TurtleFinder.Close] stops the background discovery.
+//
+// Each background discovery uses a process table freshly read from the proc
+// filesystem (see also [WithProcRoot]), unless a process table source has
+// been set using [WithBackgroundDiscoveryProcesses]. A zero or negative
+// interval disables background discovery, which is the default.
+func WithBackgroundDiscovery(interval time.Duration) NewOption {
+	return func(f *TurtleFinder) {
+		f.bginterval = interval
+	}
+}
+
+// WithBackgroundDiscoveryProcesses sets the source of process tables for the
+// background discoveries enabled using [WithBackgroundDiscovery], such as
+// returning the process table from an lxkns discovery. If the source is nil
+// or returns a nil process table, a process table gets read from the proc
+// filesystem instead.
+func WithBackgroundDiscoveryProcesses(source func() model.ProcessTable) NewOption {
+	return func(f *TurtleFinder) {
+		f.bgprocs = source
+	}
+}
+
+// WithEagerDiscoveryProcesses tells New to already run an initial discovery
+// of container engines and socket activators using the specified process
+// table, such as from an lxkns discovery. Passing a nil process table is the
+// same as [WithEagerDiscovery], that is, a process table gets read from the
+// proc filesystem.
+func WithEagerDiscoveryProcesses(procs model.ProcessTable) NewOption {
+	return func(f *TurtleFinder) {
+		f.eager = true
+		f.eagerprocs = procs
+	}
+}
+
+// WithInjectedEngines injects the specified (fake) engines, such as those
+// created using [NewStaticEngine], and disables the automatic discovery of
+// container engines and socket activators; this also disables pruning the
+// injected engines. This allows unit testing code using a TurtleFinder as its
+// [github.com/thediveo/lxkns/containerizer.Containerizer] or [Overseer] without
+// the need for any real container engines. Multiple WithInjectedEngines
+// options add up.
+func WithInjectedEngines(engines ...*Engine) NewOption {
+	return func(f *TurtleFinder) {
+		f.injected = true
+		f.injectedengines = append(f.injectedengines, engines...)
+	}
+}
+
+// WithKnownEndpoints directly probes the specified API endpoints for container
+// engines in every discovery, in addition to scanning the process table for
+// container engine processes. This supports locked-down environments where
+// scanning the proc filesystem isn't allowed, but where the API endpoint paths
+// of container engines are known in advance, such as “/run/docker.sock” (an
+// optional “unix://” scheme gets dropped). The endpoints might also be TCP or
+// vsock API endpoints in the form of “tcp://host:port” and “vsock://CID:PORT”.
+//
+// The known API endpoints are passed to the detector plugins one after
+// another until a plugin returns watchers, trying plugins advertising a
+// matching default API path first. The PID of an engine found this way is
+// taken from the peer credentials of its unix domain socket API endpoint; it
+// is zero when unknown. Engines already under watch with the same PID are
+// never probed twice.
+//
+// For a completely scan-free mode, pass an empty process table to
+// [TurtleFinder.Containers] and additionally disable the socket activator
+// discovery using [WithoutSocketActivators]. Multiple WithKnownEndpoints
+// options add up.
+func WithKnownEndpoints(paths ...string) NewOption {
+	return func(f *TurtleFinder) {
+		for _, path := range paths {
+			f.knownendpoints = append(f.knownendpoints, strings.TrimPrefix(path, "unix://"))
+		}
+	}
+}
+
+// WithMaxEngines limits the number of container engine processes under watch
+// at any time, as a defensive measure against hosts with lots of processes
+// having the well-known names of container engine processes, such as
+// “dockerd”. Otherwise, the turtlefinder would try to probe all of them in
+// parallel, exhausting file descriptors and goroutines. When the limit has
+// been reached, new engine candidates are ignored until existing engines get
+// pruned; the turtlefinder then logs a warning, but at most once per minute.
+// This limit also applies to socket-activated engines. A limit of zero or less
+// means no limit, which is the default.
+func WithMaxEngines(n int) NewOption {
+	return func(f *TurtleFinder) {
+		f.maxengines = n
+	}
+}
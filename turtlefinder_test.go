@@ -6,12 +6,21 @@ package turtlefinder
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"testing/fstest"
 	"time"
 
 	"github.com/siemens/turtlefinder/activator/podman"
+	"github.com/siemens/turtlefinder/detector"
+	containerddetector "github.com/siemens/turtlefinder/detector/containerd"
 	"github.com/siemens/turtlefinder/internal/test"
 	"github.com/siemens/turtlefinder/matcher"
 	"github.com/thediveo/lxkns/discover"
@@ -22,6 +31,8 @@ import (
 	"github.com/thediveo/morbyd/run"
 	"github.com/thediveo/morbyd/session"
 	"github.com/thediveo/morbyd/timestamper"
+	"github.com/thediveo/whalewatcher"
+	"github.com/thediveo/whalewatcher/watcher"
 	"github.com/thediveo/whalewatcher/watcher/containerd"
 	"github.com/thediveo/whalewatcher/watcher/moby"
 
@@ -133,7 +144,7 @@ var _ = Describe("turtle finder", Ordered, Serial, func() {
 			WithGettingOnlineWait(5*time.Second))
 		pidmap := model.NewProcessTable(false)
 		var wg sync.WaitGroup
-		tf.updateActivators(pidmap, &wg)
+		tf.updateActivators(pidmap, pidmap, &wg, nil)
 		done := make(chan struct{})
 		go func() {
 			defer close(done)
@@ -189,6 +200,13 @@ var _ = Describe("turtle finder", Ordered, Serial, func() {
 			HaveEngine(podman.Type, fmt.Sprintf(`^unix:///proc/%d/root/run/podman/podman.sock$`, pid)),
 		), "missing podman-in-Docker engine")
 
+		By("reporting the engines' workload synchronization")
+		Eventually(tf.EngineDetails).Within(spinupTimeout).ProbeEvery(spinupPolling).
+			Should(ContainElement(And(
+				HaveEngine(moby.Type, `^unix:///proc/\d+/root/run/docker.sock$`),
+				HaveField("SyncState", EngineSynced),
+			)))
+
 		By("creating podman workload")
 		pmCmd := Successful(pindCntr.Exec(ctx,
 			exec.Command("podman", "run", "-d", "-it", "--rm",
@@ -210,3 +228,1056 @@ var _ = Describe("turtle finder", Ordered, Serial, func() {
 	})
 
 })
+
+// flakyDetector is a detector.Detector that fails to return watchers for the
+// first few calls of NewWatchers.
+type flakyDetector struct {
+	failures int
+	calls    int
+}
+
+func (d *flakyDetector) EngineNames() []string { return []string{"flakyd"} }
+
+func (d *flakyDetector) NewWatchers(ctx context.Context, pid model.PIDType, apis []string) []watcher.Watcher {
+	d.calls++
+	if d.calls <= d.failures {
+		return nil
+	}
+	return []watcher.Watcher{&readyWatcher{}}
+}
+
+var _ = Describe("engine probe retries", func() {
+
+	var engineproc engineProcess
+	var flaky *flakyDetector
+
+	BeforeEach(func() {
+		flaky = &flakyDetector{failures: 2}
+		engineproc = engineProcess{
+			proc:   &model.Process{PID: 42},
+			engine: &enginePlugin{detector: flaky},
+		}
+	})
+
+	It("doesn't retry by default", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx })
+		Expect(tf.newWatchers(ctx, ctx, engineproc, []string{"/foo.sock"})).To(BeEmpty())
+		Expect(flaky.calls).To(Equal(1))
+	})
+
+	It("retries with backoff", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx },
+			WithEngineProbeRetries(3, 10*time.Millisecond))
+		start := time.Now()
+		Expect(tf.newWatchers(ctx, ctx, engineproc, []string{"/foo.sock"})).To(HaveLen(1))
+		Expect(flaky.calls).To(Equal(3))
+		Expect(time.Since(start)).To(BeNumerically(">=", 30*time.Millisecond))
+	})
+
+	It("gives up after the final retry", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx },
+			WithEngineProbeRetries(1, 10*time.Millisecond))
+		Expect(tf.newWatchers(ctx, ctx, engineproc, []string{"/foo.sock"})).To(BeEmpty())
+		Expect(flaky.calls).To(Equal(2))
+	})
+
+	It("stops retrying when the context gets cancelled", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx },
+			WithEngineProbeRetries(10, time.Hour))
+		ctx, cancel := context.WithCancel(ctx)
+		time.AfterFunc(50*time.Millisecond, cancel)
+		Expect(tf.newWatchers(ctx, ctx, engineproc, []string{"/foo.sock"})).To(BeEmpty())
+		Expect(flaky.calls).To(Equal(1))
+	})
+
+})
+
+// countingDetector is a detector.Detector that counts and slows down its
+// NewWatchers calls, without ever returning any watchers.
+type countingDetector struct {
+	calls atomic.Int32
+}
+
+func (d *countingDetector) EngineNames() []string { return []string{"countd"} }
+
+func (d *countingDetector) NewWatchers(ctx context.Context, pid model.PIDType, apis []string) []watcher.Watcher {
+	d.calls.Add(1)
+	time.Sleep(100 * time.Millisecond)
+	return nil
+}
+
+var _ = Describe("coalescing discoveries", func() {
+
+	var procs model.ProcessTable
+
+	BeforeEach(func() {
+		fakesockdir := Successful(os.MkdirTemp("", "fakesock-*"))
+		DeferCleanup(func() { _ = os.RemoveAll(fakesockdir) })
+		lsock := Successful(net.Listen("unix", fakesockdir+"/canary.sock"))
+		DeferCleanup(func() { _ = lsock.Close() })
+
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "countd"}}
+		procs = model.ProcessTable{self.PID: self}
+	})
+
+	discoverConcurrently := func(ctx context.Context, tf *TurtleFinder) {
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_ = tf.Containers(ctx, procs, nil)
+			}()
+		}
+		wg.Wait()
+	}
+
+	It("doesn't coalesce by default", func(ctx context.Context) {
+		d := &countingDetector{}
+		tf := New(func() context.Context { return ctx })
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "countd"}}
+		discoverConcurrently(ctx, tf)
+		Expect(d.calls.Load()).To(BeEquivalentTo(5))
+	})
+
+	It("coalesces concurrent discoveries", func(ctx context.Context) {
+		d := &countingDetector{}
+		tf := New(func() context.Context { return ctx },
+			WithDiscoveryCoalesceWindow(time.Minute))
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "countd"}}
+		discoverConcurrently(ctx, tf)
+		Expect(d.calls.Load()).To(BeEquivalentTo(1))
+		_ = tf.Containers(ctx, procs, nil)
+		Expect(d.calls.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("runs a new discovery after the window", func(ctx context.Context) {
+		d := &countingDetector{}
+		tf := New(func() context.Context { return ctx },
+			WithDiscoveryCoalesceWindow(10*time.Millisecond))
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "countd"}}
+		_ = tf.Containers(ctx, procs, nil)
+		time.Sleep(20 * time.Millisecond)
+		_ = tf.Containers(ctx, procs, nil)
+		Expect(d.calls.Load()).To(BeEquivalentTo(2))
+	})
+
+})
+
+var _ = Describe("logging", func() {
+
+	It("logs through a custom logger", func(ctx context.Context) {
+		fakesockdir := Successful(os.MkdirTemp("", "fakesock-*"))
+		defer os.RemoveAll(fakesockdir)
+		lsock := Successful(net.Listen("unix", fakesockdir+"/canary.sock"))
+		defer lsock.Close()
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "countd"}}
+
+		var mu sync.Mutex
+		msgs := []string{}
+		pids := []any{}
+		tf := New(func() context.Context { return ctx },
+			WithLogger(func(level, msg string, kv ...any) {
+				mu.Lock()
+				defer mu.Unlock()
+				msgs = append(msgs, level+": "+msg)
+				for idx := 0; idx+1 < len(kv); idx += 2 {
+					if kv[idx] == "pid" {
+						pids = append(pids, kv[idx+1])
+					}
+				}
+			}))
+		defer tf.Close()
+		d := &countingDetector{}
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "countd"}}
+		_ = tf.Containers(ctx, model.ProcessTable{self.PID: self}, nil)
+
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(msgs).To(ContainElements(
+			HavePrefix("info: available engine process detector plugins: "),
+			MatchRegexp(`^debug: scanning new potential engine process countd \(\d+\)`),
+		))
+		Expect(pids).To(ContainElement(self.PID))
+	})
+
+})
+
+var _ = Describe("initial discovery", func() {
+
+	It("waits for the initial discovery to complete", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx })
+		defer tf.Close()
+
+		waitctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		Expect(tf.WaitForInitialDiscovery(waitctx)).To(MatchError(context.DeadlineExceeded))
+
+		done := make(chan error)
+		go func() { done <- tf.WaitForInitialDiscovery(ctx) }()
+		Consistently(done).ShouldNot(Receive())
+		_ = tf.Containers(ctx, model.ProcessTable{}, nil)
+		Eventually(done).Should(Receive(BeNil()))
+
+		_ = tf.Containers(ctx, model.ProcessTable{}, nil)
+		Expect(tf.WaitForInitialDiscovery(ctx)).To(Succeed())
+	})
+
+	It("eagerly discovers already in New", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx }, WithEagerDiscovery())
+		defer tf.Close()
+		Expect(tf.eagerprocs).To(BeNil())
+		waitctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		Expect(tf.WaitForInitialDiscovery(waitctx)).To(Succeed())
+	})
+
+	It("eagerly discovers using the specified process table", func(ctx context.Context) {
+		fakesockdir := Successful(os.MkdirTemp("", "fakesock-*"))
+		defer os.RemoveAll(fakesockdir)
+		lsock := Successful(net.Listen("unix", fakesockdir+"/canary.sock"))
+		defer lsock.Close()
+
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "dockerd"}}
+		tf := New(func() context.Context { return ctx },
+			WithEngineTypeFilter("dockerd"),
+			WithEngineClientTimeout(100*time.Millisecond),
+			WithoutSocketActivators(),
+			WithEagerDiscoveryProcesses(model.ProcessTable{self.PID: self}))
+		defer tf.Close()
+		Expect(tf.WaitForInitialDiscovery(ctx)).To(Succeed())
+		Expect(tf.UnreachableEngines()).To(ConsistOf(HaveField("PID", self.PID)))
+	})
+
+})
+
+var _ = Describe("one-shot turtle finder", func() {
+
+	It("tears down engine watchers when closed", func(ctx context.Context) {
+		tf := NewOneShot(ctx, WithoutSocketActivators())
+		Expect(tf.noactivators).To(BeTrue(), "options not applied")
+		watchctx := tf.contexter()
+		e := NewEngine(watchctx, &idleWatcher{ready: make(chan struct{})}, 0)
+		tf.engines[42] = []*Engine{e}
+		Consistently(watchctx.Done()).WithTimeout(100 * time.Millisecond).ShouldNot(BeClosed())
+		tf.Close()
+		Eventually(watchctx.Done()).Should(BeClosed())
+		Eventually(e.Done).Should(BeClosed())
+	})
+
+	It("tears down engine watchers when the context gets cancelled", func(ctx context.Context) {
+		ctx, cancel := context.WithCancel(ctx)
+		tf := NewOneShot(ctx)
+		defer tf.Close()
+		watchctx := tf.contexter()
+		cancel()
+		Eventually(watchctx.Done()).Should(BeClosed())
+	})
+
+})
+
+// apiRecordingDetector is a detector.Detector that records the API endpoints
+// passed to its NewWatchers calls, without ever returning any watchers.
+type apiRecordingDetector struct {
+	mu   sync.Mutex
+	apis []string
+}
+
+func (d *apiRecordingDetector) EngineNames() []string { return []string{"recordd"} }
+
+func (d *apiRecordingDetector) NewWatchers(ctx context.Context, pid model.PIDType, apis []string) []watcher.Watcher {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.apis = append(d.apis, apis...)
+	return nil
+}
+
+var _ = Describe("proc root", func() {
+
+	It("defaults to /proc", func(ctx context.Context) {
+		Expect(New(func() context.Context { return ctx }).procroot).To(Equal("/proc"))
+		Expect(New(func() context.Context { return ctx }, WithProcRoot("")).procroot).To(Equal("/proc"))
+		Expect(New(func() context.Context { return ctx }, WithProcRoot("/host/proc/")).procroot).To(Equal("/host/proc"))
+	})
+
+	It("discovers API endpoints via a relocated proc filesystem", func(ctx context.Context) {
+		tmpdir := Successful(os.MkdirTemp("", "hostproc-*"))
+		defer os.RemoveAll(tmpdir)
+		hostproc := tmpdir + "/proc"
+		Expect(os.Symlink("/proc", hostproc)).To(Succeed())
+		canarysockpath := tmpdir + "/canary.sock"
+		lsock := Successful(net.Listen("unix", canarysockpath))
+		defer lsock.Close()
+
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "recordd"}}
+		d := &apiRecordingDetector{}
+		tf := New(func() context.Context { return ctx }, WithProcRoot(hostproc))
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "recordd"}}
+		_ = tf.Containers(ctx, model.ProcessTable{self.PID: self}, nil)
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		Expect(d.apis).To(ContainElement(
+			hostproc + "/" + strconv.Itoa(os.Getpid()) + "/root" + canarysockpath))
+	})
+
+})
+
+// concurrencyDetector is an endpointless detector.Detector that takes its time
+// to not find any engine, tracking the maximum number of concurrent probes.
+type concurrencyDetector struct {
+	inflight    atomic.Int32
+	maxinflight atomic.Int32
+	probes      atomic.Int32
+}
+
+func (d *concurrencyDetector) EngineNames() []string { return []string{"concd"} }
+func (d *concurrencyDetector) Endpointless()         {}
+
+func (d *concurrencyDetector) NewWatchers(ctx context.Context, pid model.PIDType, apis []string) []watcher.Watcher {
+	d.probes.Add(1)
+	inflight := d.inflight.Add(1)
+	defer d.inflight.Add(-1)
+	for {
+		max := d.maxinflight.Load()
+		if inflight <= max || d.maxinflight.CompareAndSwap(max, inflight) {
+			break
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	return nil
+}
+
+var _ = Describe("bounded engine probing", func() {
+
+	It("probes new engine processes using the bounded pool", func(ctx context.Context) {
+		procs := model.ProcessTable{}
+		for pid := model.PIDType(1001); pid <= 1006; pid++ {
+			procs[pid] = &model.Process{PID: pid, ProTaskCommon: model.ProTaskCommon{Name: "concd"}}
+		}
+		d := &concurrencyDetector{}
+		tf := New(func() context.Context { return ctx }, WithWorkers(2), WithoutSocketActivators())
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "concd"}}
+		_ = tf.Containers(ctx, procs, nil)
+		Expect(d.probes.Load()).To(Equal(int32(6)))
+		Expect(d.maxinflight.Load()).To(Equal(int32(2)))
+	})
+
+})
+
+// slowPortfolioWatcher is an idleWatcher that takes its time to return its portfolio,
+// sampling the number of in-flight engine queries while at it.
+type slowPortfolioWatcher struct {
+	idleWatcher
+	sample func()
+}
+
+func (w *slowPortfolioWatcher) Portfolio() *whalewatcher.Portfolio {
+	w.sample()
+	time.Sleep(50 * time.Millisecond)
+	return whalewatcher.NewPortfolio()
+}
+
+var _ = Describe("in-flight engine queries", func() {
+
+	It("bounds and reports in-flight engine queries", func(ctx context.Context) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		tf := New(func() context.Context { return ctx }, WithWorkers(2))
+		defer tf.Close()
+		Expect(tf.InFlightEngineQueries()).To(BeZero())
+
+		var maxinflight atomic.Int64
+		sample := func() {
+			inflight := int64(tf.InFlightEngineQueries())
+			for {
+				max := maxinflight.Load()
+				if inflight <= max || maxinflight.CompareAndSwap(max, inflight) {
+					return
+				}
+			}
+		}
+		for pid := model.PIDType(1); pid <= 6; pid++ {
+			tf.engines[pid] = []*Engine{{
+				Watcher: &slowPortfolioWatcher{sample: sample},
+				Done:    make(chan struct{}),
+			}}
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer GinkgoRecover()
+				_ = tf.Containers(ctx, model.ProcessTable{}, nil)
+			}()
+		}
+		wg.Wait()
+		Expect(maxinflight.Load()).To(BeEquivalentTo(2))
+		Expect(tf.InFlightEngineQueries()).To(BeZero())
+	})
+
+})
+
+// wedgedWatcher is an idleWatcher that doesn't return its portfolio until
+// released.
+type wedgedWatcher struct {
+	idleWatcher
+	release chan struct{}
+}
+
+func (w *wedgedWatcher) PID() int { return 666 }
+
+func (w *wedgedWatcher) Portfolio() *whalewatcher.Portfolio {
+	<-w.release
+	return whalewatcher.NewPortfolio()
+}
+
+var _ = Describe("containers and engines", func() {
+
+	It("returns containers and engines from the same discovery pass", func(ctx context.Context) {
+		docker := NewStaticEngine("docker.com", "moby-1", "/run/docker.sock", 42,
+			&whalewatcher.Container{ID: "1234", Name: "foo", PID: 666})
+		empty := NewStaticEngine("containerd.io", "ctrd-1", "/run/containerd/containerd.sock", 41)
+		wedged := &wedgedWatcher{release: make(chan struct{})}
+		defer close(wedged.release)
+		tf := New(func() context.Context { return ctx },
+			WithInjectedEngines(docker, empty),
+			WithEngineQueryTimeout(100*time.Millisecond))
+		defer tf.Close()
+		tf.engines[666] = []*Engine{{Watcher: wedged, Done: make(chan struct{})}}
+
+		containers, engines := tf.ContainersAndEngines(ctx, model.ProcessTable{}, nil)
+		Expect(engines).To(HaveExactElements(
+			And(HaveField("ID", "ctrd-1"), HaveField("Containers", BeEmpty())),
+			And(HaveField("ID", "moby-1"), HaveField("Containers", HaveLen(1))),
+			And(HaveField("Type", "idle"), HaveField("PID", model.PIDType(666)), HaveField("Containers", BeEmpty())),
+		))
+		Expect(containers).To(HaveExactElements(And(
+			HaveField("ID", "1234"),
+			HaveField("Engine", BeIdenticalTo(engines[1])),
+		)))
+		Expect(engines[1].Containers[0]).To(BeIdenticalTo(containers[0]))
+	})
+
+	It("returns no engines when there are none", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx }, WithInjectedEngines())
+		defer tf.Close()
+		containers, engines := tf.ContainersAndEngines(ctx, model.ProcessTable{}, nil)
+		Expect(containers).To(BeEmpty())
+		Expect(engines).To(BeEmpty())
+	})
+
+})
+
+var _ = Describe("engine query timeouts", func() {
+
+	It("doesn't let a wedged engine stall discovery", func(ctx context.Context) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		var mu sync.Mutex
+		warnings := []string{}
+		tf := New(func() context.Context { return ctx },
+			WithEngineQueryTimeout(100*time.Millisecond),
+			WithLogger(func(level, msg string, kv ...any) {
+				if level != detector.LevelWarn {
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				warnings = append(warnings, msg)
+			}))
+		defer tf.Close()
+
+		wedged := &wedgedWatcher{release: make(chan struct{})}
+		tf.engines[1] = []*Engine{{Watcher: &idleWatcher{}, Done: make(chan struct{})}}
+		tf.engines[666] = []*Engine{{Watcher: wedged, Done: make(chan struct{})}}
+
+		start := time.Now()
+		_ = tf.Containers(ctx, model.ProcessTable{}, nil)
+		Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+		mu.Lock()
+		Expect(warnings).To(ContainElement(MatchRegexp(
+			`^'idle' container engine \(PID 666\) .* didn't return its containers in time`)))
+		mu.Unlock()
+
+		Expect(tf.InFlightEngineQueries()).To(BeZero())
+		close(wedged.release)
+	})
+
+	It("doesn't let wedged engines occupy workers", func(ctx context.Context) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		tf := New(func() context.Context { return ctx },
+			WithWorkers(1),
+			WithEngineQueryTimeout(50*time.Millisecond))
+		defer tf.Close()
+
+		wedged := &wedgedWatcher{release: make(chan struct{})}
+		defer close(wedged.release)
+		for pid := model.PIDType(1); pid <= 3; pid++ {
+			tf.engines[pid] = []*Engine{{Watcher: wedged, Done: make(chan struct{})}}
+		}
+		tf.engines[42] = []*Engine{{Watcher: &idleWatcher{}, Done: make(chan struct{})}}
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_ = tf.Containers(ctx, model.ProcessTable{}, nil)
+		}()
+		Eventually(done).Within(2 * time.Second).Should(BeClosed())
+	})
+
+})
+
+var _ = Describe("engine client timeout", func() {
+
+	It("passes the engine client timeout to the detectors", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx })
+		Expect(detector.ClientTimeout(tf.contexter(), time.Second)).To(Equal(time.Second))
+
+		tf = New(func() context.Context { return ctx }, WithEngineClientTimeout(42*time.Second))
+		Expect(detector.ClientTimeout(tf.contexter(), time.Second)).To(Equal(42 * time.Second))
+	})
+
+	It("passes the setting of the last option", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx },
+			WithEngineClientTimeout(42*time.Second),
+			WithEngineClientTimeout(666*time.Second))
+		Expect(detector.ClientTimeout(tf.contexter(), time.Second)).To(Equal(666 * time.Second))
+
+		tf = New(func() context.Context { return ctx },
+			WithEngineClientTimeout(42*time.Second),
+			WithEngineClientTimeout(0))
+		Expect(detector.ClientTimeout(tf.contexter(), time.Second)).To(Equal(time.Second))
+	})
+
+})
+
+var _ = Describe("activator rediscovery", func() {
+
+	It("rediscovers only known socket activators", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx })
+		defer tf.Close()
+		Expect(tf.RediscoverActivator(42)).To(And(
+			MatchError(ContainSubstring("PID 42")),
+			MatchError(ErrUnknownActivator)))
+
+		s := &socketActivatorProcess{proc: &model.Process{PID: 42}, hash: 0x1234}
+		tf.mux.Lock()
+		tf.activators[42] = s
+		tf.mux.Unlock()
+		Expect(tf.RediscoverActivator(42)).To(Succeed())
+		Expect(s.hash).To(BeZero())
+	})
+
+})
+
+var _ = Describe("engine TLS", func() {
+
+	It("passes the engine TLS configurations to the detectors", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx })
+		Expect(detector.EngineTLS(tf.contexter(), "tcp://localhost:2376")).To(BeNil())
+
+		foo := &tls.Config{ServerName: "foo"}
+		bar := &tls.Config{ServerName: "bar"}
+		tf = New(func() context.Context { return ctx },
+			WithEngineTLS("tcp://foo:", foo),
+			WithEngineTLS("tcp://", bar))
+		ctx = tf.contexter()
+		Expect(detector.EngineTLS(ctx, "tcp://foo:2376")).To(BeIdenticalTo(foo))
+		Expect(detector.EngineTLS(ctx, "tcp://baz:2376")).To(BeIdenticalTo(bar))
+		Expect(detector.EngineTLS(ctx, "/run/docker.sock")).To(BeNil())
+	})
+
+})
+
+var _ = Describe("engine dialer", func() {
+
+	It("passes the dialer to the detectors", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx })
+		Expect(detector.CustomDialer(tf.contexter())).To(BeNil())
+
+		d := &net.Dialer{Timeout: 42 * time.Second}
+		tf = New(func() context.Context { return ctx }, WithDialer(d))
+		Expect(detector.CustomDialer(tf.contexter())).To(BeIdenticalTo(d))
+	})
+
+})
+
+var _ = Describe("containerd CRI mode", func() {
+
+	It("passes the CRI mode per turtle finder", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx })
+		crionly := New(func() context.Context { return ctx },
+			WithContainerdCRIMode(containerddetector.CRIOnly))
+		Expect(containerddetector.CRIModeFrom(tf.contexter())).To(Equal(containerddetector.CRIBonus))
+		Expect(containerddetector.CRIModeFrom(crionly.contexter())).To(Equal(containerddetector.CRIOnly))
+	})
+
+	It("passes the no-CRI mode", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx },
+			WithContainerdCRIMode(containerddetector.CRIOnly),
+			WithContainerdCRIMode(containerddetector.CRINone))
+		Expect(containerddetector.CRIModeFrom(tf.contexter())).To(Equal(containerddetector.CRINone))
+	})
+
+})
+
+var _ = Describe("containerd namespaces", func() {
+
+	It("passes the namespaces to watch per turtle finder", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx })
+		nerdy := New(func() context.Context { return ctx }, WithContainerdNamespaces("default"))
+		Expect(containerddetector.WatchedNamespaces(tf.contexter())).To(BeNil())
+		Expect(containerddetector.WatchedNamespaces(nerdy.contexter())).To(ConsistOf("default"))
+	})
+
+})
+
+var _ = Describe("podman native API", func() {
+
+	It("passes the podman API preference per turtle finder", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx })
+		native := New(func() context.Context { return ctx }, WithPodmanNativeAPI())
+		Expect(podman.PreferNativeAPI(tf.contexter())).To(BeFalse())
+		Expect(podman.PreferNativeAPI(native.contexter())).To(BeTrue())
+	})
+
+})
+
+var _ = Describe("socket activator discovery", func() {
+
+	It("skips socket activators when disabled", func(ctx context.Context) {
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "systemd"}}
+		procs := model.ProcessTable{self.PID: self}
+
+		tf := New(func() context.Context { return ctx })
+		defer tf.Close()
+		tf.engineplugins = nil
+		Expect(tf.activatorplugins).NotTo(BeEmpty())
+		_ = tf.Containers(ctx, procs, nil)
+		Expect(tf.Snapshot().Activators).To(ConsistOf(HaveField("PID", self.PID)))
+
+		tf = New(func() context.Context { return ctx }, WithoutSocketActivators())
+		defer tf.Close()
+		tf.engineplugins = nil
+		Expect(tf.activatorplugins).To(BeEmpty())
+		_ = tf.Containers(ctx, procs, nil)
+		Expect(tf.Snapshot().Activators).To(BeEmpty())
+	})
+
+})
+
+// endpointlessDetector is a detector.EndpointlessDetector that records the API
+// paths it gets passed and then returns an idle watcher.
+type endpointlessDetector struct {
+	mu   sync.Mutex
+	apis [][]string
+}
+
+func (d *endpointlessDetector) EngineNames() []string { return []string{"endlessd"} }
+func (d *endpointlessDetector) Endpointless()         {}
+
+func (d *endpointlessDetector) NewWatchers(ctx context.Context, pid model.PIDType, apis []string) []watcher.Watcher {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.apis = append(d.apis, apis)
+	return []watcher.Watcher{&idleWatcher{ready: make(chan struct{})}}
+}
+
+var _ = Describe("endpointless engines", func() {
+
+	It("doesn't look for API endpoints of endpointless engines", func(ctx context.Context) {
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "endlessd"}}
+		d := &endpointlessDetector{}
+		tf := New(func() context.Context { return ctx }, WithGettingOnlineWait(100*time.Millisecond))
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "endlessd"}}
+		_ = tf.Containers(ctx, model.ProcessTable{self.PID: self}, nil)
+
+		d.mu.Lock()
+		Expect(d.apis).To(ConsistOf(BeEmpty()))
+		d.mu.Unlock()
+		Expect(tf.Engines()).To(ConsistOf(HaveField("Type", "idle")))
+		Expect(tf.UnreachableEngines()).To(BeEmpty())
+	})
+
+})
+
+// acceptingDetector is a detector.Detector that accepts any API endpoints it
+// gets passed, returning an idle watcher.
+type acceptingDetector struct{}
+
+func (d *acceptingDetector) EngineNames() []string { return []string{"acceptd"} }
+
+func (d *acceptingDetector) NewWatchers(ctx context.Context, pid model.PIDType, apis []string) []watcher.Watcher {
+	return []watcher.Watcher{&idleWatcher{ready: make(chan struct{})}}
+}
+
+var _ = Describe("candidate API endpoints", func() {
+
+	It("tells the API endpoints considered for an engine", func(ctx context.Context) {
+		tmpdir := GinkgoT().TempDir()
+		canarysockpath := tmpdir + "/canary.sock"
+		lsock := Successful(net.Listen("unix", canarysockpath))
+		defer lsock.Close()
+
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "acceptd"}}
+		d := &acceptingDetector{}
+		tf := New(func() context.Context { return ctx }, WithGettingOnlineWait(100*time.Millisecond))
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "acceptd"}}
+		_ = tf.Containers(ctx, model.ProcessTable{self.PID: self}, nil)
+
+		details := tf.EngineDetails()
+		Expect(details).To(ConsistOf(And(
+			HaveField("API", "unix:///idle.sock"),
+			HaveField("CandidateAPIs", ContainElement(
+				"/proc/"+strconv.Itoa(os.Getpid())+"/root"+canarysockpath)),
+		)))
+		details[0].CandidateAPIs[0] = "" // must not affect the engine.
+		Expect(tf.EngineDetails()[0].CandidateAPIs).NotTo(ContainElement(""))
+	})
+
+	It("skips unresolvable API endpoints, reporting them once", func(ctx context.Context) {
+		procroot := GinkgoT().TempDir()
+		Expect(os.MkdirAll(procroot+"/42/root/run", 0755)).To(Succeed())
+		Expect(os.WriteFile(procroot+"/42/root/run/docker.sock", nil, 0644)).To(Succeed())
+		root := strings.TrimPrefix(procroot, "/")
+		useSockFS(&memSockFS{
+			files: fstest.MapFS{
+				root + "/42/net/unix": &fstest.MapFile{Data: []byte(fakeNetUnix)},
+				root + "/42/fd/3":     &fstest.MapFile{},
+				root + "/42/fd/4":     &fstest.MapFile{},
+			},
+			links: map[string]string{
+				procroot + "/42/fd/3": "socket:[1234]",    // /run/padded.sock, missing
+				procroot + "/42/fd/4": "socket:[2345678]", // /run/docker.sock
+			},
+		})
+
+		apis, unresolved := apiEndpointsOfProcess(procroot, 42, nil, nil, detector.NewLogger(nil))
+		Expect(apis).To(ConsistOf(procroot + "/42/root/run/docker.sock"))
+		Expect(unresolved).To(ConsistOf("/run/padded.sock"))
+
+		var mu sync.Mutex
+		var warnings []string
+		proc := &model.Process{PID: 42, ProTaskCommon: model.ProTaskCommon{Name: "acceptd"}}
+		d := &acceptingDetector{}
+		tf := New(func() context.Context { return ctx },
+			WithGettingOnlineWait(100*time.Millisecond),
+			WithProcRoot(procroot),
+			WithLogger(func(level, msg string, kv ...any) {
+				if level != detector.LevelWarn || !strings.Contains(msg, "API endpoint(s)") {
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				warnings = append(warnings, msg)
+			}))
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "acceptd"}}
+		_ = tf.Containers(ctx, model.ProcessTable{proc.PID: proc}, nil)
+
+		Expect(tf.EngineDetails()).To(ConsistOf(
+			HaveField("CandidateAPIs", ConsistOf(procroot+"/42/root/run/docker.sock"))))
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(warnings).To(ConsistOf(And(
+			ContainSubstring("cannot resolve API endpoint(s)"),
+			ContainSubstring("/run/padded.sock"),
+			Not(ContainSubstring("/run/docker.sock")))))
+	})
+
+})
+
+// stoppableWatcher is an idleWatcher whose watch can be stopped.
+type stoppableWatcher struct {
+	idleWatcher
+	stop chan struct{}
+}
+
+func (w *stoppableWatcher) Watch(ctx context.Context) error {
+	select {
+	case <-w.stop:
+		return errors.New("watch stopped")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stoppableDetector is an endpointless detector.Detector that returns
+// stoppable watchers, remembering them.
+type stoppableDetector struct {
+	mu       sync.Mutex
+	watchers []*stoppableWatcher
+}
+
+func (d *stoppableDetector) EngineNames() []string { return []string{"stopd"} }
+func (d *stoppableDetector) Endpointless()         {}
+
+func (d *stoppableDetector) NewWatchers(ctx context.Context, pid model.PIDType, apis []string) []watcher.Watcher {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	w := &stoppableWatcher{
+		idleWatcher: idleWatcher{ready: make(chan struct{})},
+		stop:        make(chan struct{}),
+	}
+	d.watchers = append(d.watchers, w)
+	return []watcher.Watcher{w}
+}
+
+var _ = Describe("pruning engines", func() {
+
+	It("reprobes engines with terminated watchers but alive processes", func(ctx context.Context) {
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "stopd"}}
+		procs := model.ProcessTable{self.PID: self}
+		d := &stoppableDetector{}
+		tf := New(func() context.Context { return ctx }, WithGettingOnlineWait(100*time.Millisecond))
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "stopd"}}
+
+		_ = tf.Containers(ctx, procs, nil)
+		Expect(tf.engines).To(HaveKey(self.PID))
+		tf.mux.Lock()
+		engine := tf.engines[self.PID][0]
+		tf.mux.Unlock()
+
+		By("terminating the watcher while the engine process stays alive")
+		d.mu.Lock()
+		close(d.watchers[0].stop)
+		d.mu.Unlock()
+		Eventually(engine.Done).Should(BeClosed())
+
+		_ = tf.Containers(ctx, procs, nil)
+		d.mu.Lock()
+		Expect(d.watchers).To(HaveLen(2))
+		d.mu.Unlock()
+		tf.mux.Lock()
+		defer tf.mux.Unlock()
+		Expect(tf.engines[self.PID]).To(ConsistOf(
+			And(Not(BeIdenticalTo(engine)), Satisfy((*Engine).IsAlive))))
+	})
+
+})
+
+var _ = Describe("engine retention", func() {
+
+	It("retains terminated engines for a while", func(ctx context.Context) {
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "stopd"}}
+		procs := model.ProcessTable{self.PID: self}
+		d := &stoppableDetector{}
+		tf := New(func() context.Context { return ctx },
+			WithGettingOnlineWait(100*time.Millisecond),
+			WithEngineRetention(time.Hour))
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "stopd"}}
+
+		_ = tf.Containers(ctx, procs, nil)
+		Expect(tf.EngineDetails()).To(ConsistOf(HaveField("Inactive", false)))
+
+		By("terminating the engine")
+		d.mu.Lock()
+		close(d.watchers[0].stop)
+		d.mu.Unlock()
+		tf.mux.Lock()
+		engine := tf.engines[self.PID][0]
+		tf.mux.Unlock()
+		Eventually(engine.Done).Should(BeClosed())
+		Expect(tf.EngineDetails()).To(ConsistOf(And(
+			HaveField("ID", "idle"),
+			HaveField("Inactive", true),
+			HaveField("GoneSince", Not(BeZero())))))
+
+		_ = tf.Containers(ctx, model.ProcessTable{}, nil)
+		Expect(tf.engines).To(BeEmpty())
+		Expect(tf.EngineDetails()).To(ConsistOf(HaveField("Inactive", true)))
+		Expect(tf.Engines()).To(ConsistOf(HaveField("ID", "idle")))
+
+		By("the engine reappearing")
+		_ = tf.Containers(ctx, procs, nil)
+		Expect(tf.EngineDetails()).To(ConsistOf(HaveField("Inactive", false)))
+		Expect(tf.retained.engines).To(BeEmpty())
+	})
+
+	It("expires retained engines", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx }, WithEngineRetention(time.Hour))
+		defer tf.Close()
+		tf.retained.retain(&EngineDetails{ContainerEngine: &model.ContainerEngine{ID: "idle", Type: "idle"}},
+			time.Now().Add(-2*time.Hour))
+		Expect(tf.EngineDetails()).To(BeEmpty())
+		Expect(tf.retained.engines).To(BeEmpty())
+	})
+
+	It("doesn't retain engines by default", func(ctx context.Context) {
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "stopd"}}
+		d := &stoppableDetector{}
+		tf := New(func() context.Context { return ctx }, WithGettingOnlineWait(100*time.Millisecond))
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "stopd"}}
+
+		_ = tf.Containers(ctx, model.ProcessTable{self.PID: self}, nil)
+		d.mu.Lock()
+		close(d.watchers[0].stop)
+		d.mu.Unlock()
+		Eventually(tf.EngineDetails).Should(BeEmpty())
+	})
+
+})
+
+var _ = Describe("maximum engines", func() {
+
+	It("ignores new engines when at the limit", func(ctx context.Context) {
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "endlessd"}}
+		procs := model.ProcessTable{self.PID: self}
+		d := &endpointlessDetector{}
+		tf := New(func() context.Context { return ctx },
+			WithMaxEngines(1), WithGettingOnlineWait(100*time.Millisecond))
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "endlessd"}}
+		tf.engines[1] = []*Engine{{Watcher: &idleWatcher{}, Done: make(chan struct{})}}
+
+		_ = tf.Containers(ctx, procs, nil)
+		d.mu.Lock()
+		Expect(d.apis).To(BeEmpty())
+		d.mu.Unlock()
+		Expect(tf.engines).To(HaveLen(1))
+		Expect(tf.limitwarn).NotTo(BeZero())
+
+		tf.mux.Lock()
+		delete(tf.engines, 1)
+		tf.mux.Unlock()
+		_ = tf.Containers(ctx, procs, nil)
+		d.mu.Lock()
+		Expect(d.apis).To(HaveLen(1))
+		d.mu.Unlock()
+		Expect(tf.engines).To(HaveKey(self.PID))
+	})
+
+	It("rate-limits warnings", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx }, WithMaxEngines(1))
+		defer tf.Close()
+		Expect(tf.engineSlots()).To(Equal(1))
+		tf.warnEngineLimit(1)
+		warned := tf.limitwarn
+		Expect(warned).NotTo(BeZero())
+		tf.warnEngineLimit(1)
+		Expect(tf.limitwarn).To(Equal(warned))
+
+		tf = New(func() context.Context { return ctx })
+		defer tf.Close()
+		Expect(tf.engineSlots()).To(BeNumerically(">", 1000))
+	})
+
+})
+
+// endpointWatcher is an idle watcher reporting the API endpoint and engine PID
+// it was created for.
+type endpointWatcher struct {
+	idleWatcher
+	api string
+	pid model.PIDType
+}
+
+func (w *endpointWatcher) ID(context.Context) string { return "id-" + strconv.Itoa(int(w.pid)) }
+func (w *endpointWatcher) API() string               { return w.api }
+func (w *endpointWatcher) PID() int                  { return int(w.pid) }
+
+// endpointDetector is a detector.Detector for processes named “containerd”
+// that accepts the first API endpoint it gets passed, returning an
+// endpointWatcher.
+type endpointDetector struct{}
+
+func (d *endpointDetector) EngineNames() []string { return []string{"containerd"} }
+
+func (d *endpointDetector) NewWatchers(ctx context.Context, pid model.PIDType, apis []string) []watcher.Watcher {
+	if len(apis) == 0 {
+		return nil
+	}
+	return []watcher.Watcher{&endpointWatcher{
+		idleWatcher: idleWatcher{ready: make(chan struct{})},
+		api:         apis[0],
+		pid:         pid,
+	}}
+}
+
+var _ = Describe("multiple engine instances", func() {
+
+	It("discovers multiple containerd instances with different API endpoints", func(ctx context.Context) {
+		// A system containerd with PID 42 and a k3s-embedded containerd with
+		// PID 43, both named “containerd” and both living in the same mount and
+		// network namespaces, so they see the same list of listening sockets.
+		procroot := GinkgoT().TempDir()
+		Expect(os.MkdirAll(procroot+"/42/root/run/containerd", 0755)).To(Succeed())
+		Expect(os.WriteFile(procroot+"/42/root/run/containerd/containerd.sock", nil, 0644)).To(Succeed())
+		Expect(os.MkdirAll(procroot+"/43/root/run/k3s/containerd", 0755)).To(Succeed())
+		Expect(os.WriteFile(procroot+"/43/root/run/k3s/containerd/containerd.sock", nil, 0644)).To(Succeed())
+		const netunix = `Num       RefCount Protocol Flags    Type St Inode Path
+0000000000000000: 00000002 00000000 00010000 0001 01 1111 /run/containerd/containerd.sock
+0000000000000000: 00000002 00000000 00010000 0001 01 2222 /run/k3s/containerd/containerd.sock
+`
+		root := strings.TrimPrefix(procroot, "/")
+		useSockFS(&memSockFS{
+			files: fstest.MapFS{
+				root + "/42/net/unix": &fstest.MapFile{Data: []byte(netunix)},
+				root + "/42/fd/3":     &fstest.MapFile{},
+				root + "/43/net/unix": &fstest.MapFile{Data: []byte(netunix)},
+				root + "/43/fd/3":     &fstest.MapFile{},
+			},
+			links: map[string]string{
+				procroot + "/42/fd/3":   "socket:[1111]",
+				procroot + "/43/fd/3":   "socket:[2222]",
+				procroot + "/42/ns/mnt": "mnt:[4026531841]",
+				procroot + "/42/ns/net": "net:[4026531840]",
+				procroot + "/43/ns/mnt": "mnt:[4026531841]",
+				procroot + "/43/ns/net": "net:[4026531840]",
+			},
+		})
+
+		system := &model.Process{PID: 42, PPID: 1, ProTaskCommon: model.ProTaskCommon{Name: "containerd"}}
+		k3s := &model.Process{PID: 666, PPID: 1, ProTaskCommon: model.ProTaskCommon{Name: "k3s-server"}}
+		embedded := &model.Process{PID: 43, PPID: 666, ProTaskCommon: model.ProTaskCommon{Name: "containerd"}}
+		d := &endpointDetector{}
+		tf := New(func() context.Context { return ctx },
+			WithGettingOnlineWait(100*time.Millisecond),
+			WithProcRoot(procroot),
+			WithoutSocketActivators())
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "containerd"}}
+		_ = tf.Containers(ctx, model.ProcessTable{
+			system.PID:   system,
+			k3s.PID:      k3s,
+			embedded.PID: embedded,
+		}, nil)
+
+		Expect(tf.Engines()).To(ConsistOf(
+			And(
+				HaveField("PID", model.PIDType(42)),
+				HaveField("ID", "id-42"),
+				HaveField("API", procroot+"/42/root/run/containerd/containerd.sock")),
+			And(
+				HaveField("PID", model.PIDType(43)),
+				HaveField("ID", "id-43"),
+				HaveField("API", procroot+"/43/root/run/k3s/containerd/containerd.sock")),
+		))
+	})
+
+})
@@ -0,0 +1,81 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/thediveo/lxkns/model"
+)
+
+// UnreachableEngine describes a potential container engine process that either
+// has no listening API endpoints at all, or none of its endpoints worked when
+// probed by the responsible detector plugin. Such engines are typically the
+// result of missing permissions or unsupported API versions; use [errors.Is]
+// on LastError with [ErrNoAPIEndpoint] and [ErrEngineUnreachable] to tell them
+// apart.
+type UnreachableEngine struct {
+	PID       model.PIDType // PID of the engine process.
+	Name      string        // process name of the engine process.
+	Type      string        // engine type guess, that is, the name of the responsible detector plugin.
+	APIs      []string      // API endpoint paths tried; nil if there are none.
+	LastError error         // last error encountered when probing the engine.
+	LastSeen  time.Time     // when the engine was last found to be unreachable.
+}
+
+// unreachableEngines keeps track of the potential container engines that have
+// either no API endpoints or none that worked.
+type unreachableEngines struct {
+	mu      sync.Mutex
+	engines map[model.PIDType]UnreachableEngine
+}
+
+// record the specified engine as unreachable, replacing any previous record
+// for the same PID. It returns true if the engine wasn't already known to be
+// unreachable.
+func (u *unreachableEngines) record(engine UnreachableEngine) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.engines == nil {
+		u.engines = map[model.PIDType]UnreachableEngine{}
+	}
+	_, known := u.engines[engine.PID]
+	u.engines[engine.PID] = engine
+	return !known
+}
+
+// forget the engine with the specified PID, such as when it finally became
+// reachable.
+func (u *unreachableEngines) forget(pid model.PIDType) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.engines, pid)
+}
+
+// prune all engines whose processes have gone.
+func (u *unreachableEngines) prune(procs model.ProcessTable) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for pid := range u.engines {
+		if procs[pid] == nil {
+			delete(u.engines, pid)
+		}
+	}
+}
+
+// list returns the unreachable engines, sorted by PID.
+func (u *unreachableEngines) list() []UnreachableEngine {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	engines := make([]UnreachableEngine, 0, len(u.engines))
+	for _, engine := range u.engines {
+		engine.APIs = append(engine.APIs[:0:0], engine.APIs...)
+		engines = append(engines, engine)
+	}
+	sort.Slice(engines, func(a, b int) bool { return engines[a].PID < engines[b].PID })
+	return engines
+}
@@ -0,0 +1,203 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/siemens/turtlefinder/detector"
+	"github.com/thediveo/lxkns/model"
+	"github.com/thediveo/whalewatcher/watcher"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+// erroringDetector is a detector.ErrorReportingDetector that never returns
+// any watchers, but instead always its error.
+type erroringDetector struct {
+	err error
+}
+
+func (d *erroringDetector) EngineNames() []string { return []string{"errd"} }
+
+func (d *erroringDetector) NewWatchers(ctx context.Context, pid model.PIDType, apis []string) []watcher.Watcher {
+	return nil
+}
+
+func (d *erroringDetector) NewWatchersWithError(ctx context.Context, pid model.PIDType, apis []string) ([]watcher.Watcher, error) {
+	return nil, d.err
+}
+
+// erroringEndpointlessDetector is an erroringDetector for engines without any
+// API endpoints.
+type erroringEndpointlessDetector struct {
+	erroringDetector
+}
+
+func (d *erroringEndpointlessDetector) Endpointless() {}
+
+// cancellingDetector is an endpointless detector.ErrorReportingDetector that
+// cancels the discovery while probing its engine.
+type cancellingDetector struct {
+	erroringEndpointlessDetector
+	cancel context.CancelFunc
+}
+
+func (d *cancellingDetector) NewWatchersWithError(ctx context.Context, pid model.PIDType, apis []string) ([]watcher.Watcher, error) {
+	d.cancel()
+	return nil, d.err
+}
+
+var _ = Describe("unreachable engines", func() {
+
+	It("records, forgets, and prunes unreachable engines", func() {
+		var u unreachableEngines
+		Expect(u.list()).To(BeEmpty())
+		Expect(u.record(UnreachableEngine{PID: 42, APIs: []string{"/foo.sock"}})).To(BeTrue())
+		Expect(u.record(UnreachableEngine{PID: 42, APIs: []string{"/bar.sock"}})).To(BeFalse())
+		Expect(u.record(UnreachableEngine{PID: 1})).To(BeTrue())
+		Expect(u.list()).To(HaveExactElements(
+			HaveField("PID", model.PIDType(1)),
+			And(HaveField("PID", model.PIDType(42)), HaveField("APIs", ConsistOf("/bar.sock"))),
+		))
+
+		u.forget(1)
+		Expect(u.list()).To(ConsistOf(HaveField("PID", model.PIDType(42))))
+
+		u.prune(model.ProcessTable{42: &model.Process{PID: 42}})
+		Expect(u.list()).To(HaveLen(1))
+		u.prune(model.ProcessTable{})
+		Expect(u.list()).To(BeEmpty())
+	})
+
+	It("reports engines with API endpoints that don't work", func(ctx context.Context) {
+		fakesockdir := Successful(os.MkdirTemp("", "fakesock-*"))
+		defer os.RemoveAll(fakesockdir)
+		canarysockpath := fakesockdir + "/canary.sock"
+		lsock := Successful(net.Listen("unix", canarysockpath))
+		defer lsock.Close()
+
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "countd"}}
+		procs := model.ProcessTable{self.PID: self}
+		tf := New(func() context.Context { return ctx })
+		defer tf.Close()
+		d := &countingDetector{}
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "countd"}}
+		_ = tf.Containers(ctx, procs, nil)
+
+		Expect(tf.UnreachableEngines()).To(ConsistOf(And(
+			HaveField("PID", self.PID),
+			HaveField("Name", "countd"),
+			HaveField("Type", "countd"),
+			HaveField("APIs", ContainElement(HaveSuffix(canarysockpath))),
+			HaveField("LastError", And(
+				MatchError(ContainSubstring("no working API endpoint found")),
+				MatchError(ErrEngineUnreachable))),
+		)))
+
+		_ = tf.Containers(ctx, model.ProcessTable{}, nil)
+		Expect(tf.UnreachableEngines()).To(BeEmpty())
+	})
+
+	It("reports the errors of error-reporting detectors", func(ctx context.Context) {
+		fakesockdir := Successful(os.MkdirTemp("", "fakesock-*"))
+		defer os.RemoveAll(fakesockdir)
+		lsock := Successful(net.Listen("unix", fakesockdir+"/canary.sock"))
+		defer lsock.Close()
+
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "errd"}}
+		tf := New(func() context.Context { return ctx })
+		defer tf.Close()
+		errPermission := errors.New("permission denied")
+		d := &erroringDetector{err: errPermission}
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "errd"}}
+		_ = tf.Containers(ctx, model.ProcessTable{self.PID: self}, nil)
+
+		Expect(tf.UnreachableEngines()).To(ConsistOf(And(
+			HaveField("PID", self.PID),
+			HaveField("LastError", And(
+				MatchError(errPermission),
+				MatchError(ErrEngineUnreachable),
+				MatchError(ContainSubstring("no working API endpoint found for 'errd'")))),
+		)))
+	})
+
+	It("reports errors of error-reporting endpointless detectors", func(ctx context.Context) {
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "errd"}}
+		tf := New(func() context.Context { return ctx })
+		defer tf.Close()
+		d := &erroringEndpointlessDetector{erroringDetector{err: errors.New("D'oh!")}}
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "errd"}}
+		_ = tf.Containers(ctx, model.ProcessTable{self.PID: self}, nil)
+		Expect(tf.UnreachableEngines()).To(ConsistOf(
+			HaveField("LastError", And(
+				MatchError(ContainSubstring("D'oh!")),
+				MatchError(ErrNoAPIEndpoint)))))
+	})
+
+	It("reports engines without API endpoints", func(ctx context.Context) {
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "countd"}}
+		tf := New(func() context.Context { return ctx })
+		defer tf.Close()
+		d := &countingDetector{}
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "countd"}}
+		_ = tf.Containers(ctx, model.ProcessTable{self.PID: self}, nil)
+
+		Expect(d.calls.Load()).To(BeZero())
+		Expect(tf.UnreachableEngines()).To(ConsistOf(And(
+			HaveField("PID", self.PID),
+			HaveField("APIs", BeNil()),
+			HaveField("LastError", And(
+				MatchError(ErrNoAPIEndpoint),
+				Not(MatchError(ErrEngineUnreachable)))),
+		)))
+	})
+
+	It("neither retries nor reports unsupported engines", func(ctx context.Context) {
+		fakesockdir := Successful(os.MkdirTemp("", "fakesock-*"))
+		defer os.RemoveAll(fakesockdir)
+		lsock := Successful(net.Listen("unix", fakesockdir+"/canary.sock"))
+		defer lsock.Close()
+
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "errd"}}
+		tf := New(func() context.Context { return ctx }, WithEngineProbeRetries(3, time.Hour))
+		defer tf.Close()
+		d := &erroringDetector{err: fmt.Errorf("no errd client, %w", detector.ErrUnsupportedEngine)}
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "errd"}}
+		_ = tf.Containers(ctx, model.ProcessTable{self.PID: self}, nil)
+		Expect(tf.UnreachableEngines()).To(BeEmpty())
+		Expect(tf.rejectedprocs.rejected).To(HaveKey(self.PID))
+	})
+
+	It("doesn't report engines when aborting discovery", func(ctx context.Context) {
+		self := &model.Process{PID: model.PIDType(os.Getpid()),
+			ProTaskCommon: model.ProTaskCommon{Name: "errd"}}
+		tf := New(func() context.Context { return ctx })
+		defer tf.Close()
+		cctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		d := &cancellingDetector{
+			erroringEndpointlessDetector: erroringEndpointlessDetector{erroringDetector{err: errors.New("D'oh!")}},
+			cancel:                       cancel,
+		}
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "errd"}}
+		_ = tf.Containers(cctx, model.ProcessTable{self.PID: self}, nil)
+		Expect(cctx.Err()).To(HaveOccurred())
+		Expect(tf.UnreachableEngines()).To(BeEmpty())
+	})
+
+})
@@ -0,0 +1,124 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/siemens/turtlefinder/detector"
+	"golang.org/x/sys/cpu"
+	"golang.org/x/sys/unix"
+)
+
+// Definitions from linux/sock_diag.h and linux/vm_sockets_diag.h, as well as
+// the TCP socket state used also for listening VM sockets.
+const (
+	sockDiagByFamily   = 20 // SOCK_DIAG_BY_FAMILY
+	tcpListen          = 10 // TCP_LISTEN
+	sizeofVsockDiagReq = 24 // sizeof(struct vsock_diag_req)
+	sizeofVsockDiagMsg = 32 // sizeof(struct vsock_diag_msg)
+)
+
+// nativeEndian is the byte order of netlink messages, which is the host's byte
+// order.
+var nativeEndian binary.ByteOrder = func() binary.ByteOrder {
+	if cpu.IsBigEndian {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}()
+
+// listeningVsocks returns the listening VM sockets, indexed by their inode
+// numbers, with their vsock API endpoints in the form of “vsock://CID:PORT”.
+//
+// Unfortunately, the proc filesystem doesn't list VM sockets in the same way
+// as it does for unix domain sockets in “/proc/[PID]/net/unix”. Instead, we
+// need to ask the kernel's “vsock_diag” module via a NETLINK_SOCK_DIAG netlink
+// socket. If the kernel doesn't support VM socket diagnosis, listeningVsocks
+// returns an error.
+func listeningVsocks() (socketPathsByIno, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_SOCK_DIAG)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	defer unix.Close(fd)
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return nil, os.NewSyscallError("bind", err)
+	}
+	if err := unix.Sendto(fd, vsockDiagRequest(), 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return nil, os.NewSyscallError("sendto", err)
+	}
+	sox := socketPathsByIno{}
+	buf := make([]byte, 32*1024)
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return nil, os.NewSyscallError("recvfrom", err)
+		}
+		done, err := parseVsockDiagMessages(buf[:n], sox)
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			return sox, nil
+		}
+	}
+}
+
+// vsockDiagRequest returns a netlink message dumping all listening VM sockets.
+func vsockDiagRequest() []byte {
+	req := make([]byte, unix.SizeofNlMsghdr+sizeofVsockDiagReq)
+	nativeEndian.PutUint32(req[0:4], uint32(len(req)))                   // nlmsg_len
+	nativeEndian.PutUint16(req[4:6], sockDiagByFamily)                   // nlmsg_type
+	nativeEndian.PutUint16(req[6:8], unix.NLM_F_REQUEST|unix.NLM_F_DUMP) // nlmsg_flags
+	body := req[unix.SizeofNlMsghdr:]
+	body[0] = unix.AF_VSOCK                         // sdiag_family
+	nativeEndian.PutUint32(body[4:8], 1<<tcpListen) // vdiag_states
+	return req
+}
+
+// parseVsockDiagMessages parses the specified netlink messages with VM socket
+// diagnosis information, adding the listening VM sockets found to the
+// specified socket map. It returns true when the final message of a dump has
+// been seen.
+func parseVsockDiagMessages(data []byte, sox socketPathsByIno) (done bool, err error) {
+	msgs, err := syscall.ParseNetlinkMessage(data)
+	if err != nil {
+		return false, err
+	}
+	for _, msg := range msgs {
+		switch msg.Header.Type {
+		case unix.NLMSG_DONE:
+			return true, nil
+		case unix.NLMSG_ERROR:
+			if len(msg.Data) >= 4 {
+				if errno := int32(nativeEndian.Uint32(msg.Data[0:4])); errno != 0 {
+					return false, fmt.Errorf("vsock diagnosis failed: %w", syscall.Errno(-errno))
+				}
+			}
+			return true, nil
+		case sockDiagByFamily:
+			if len(msg.Data) < sizeofVsockDiagMsg {
+				continue
+			}
+			if msg.Data[0] != unix.AF_VSOCK || msg.Data[2] != tcpListen {
+				continue
+			}
+			cid := nativeEndian.Uint32(msg.Data[4:8])
+			port := nativeEndian.Uint32(msg.Data[8:12])
+			ino := nativeEndian.Uint32(msg.Data[20:24])
+			// Sockets listening on any CID can be reached via the local
+			// (loopback) CID from the host side.
+			if cid == unix.VMADDR_CID_ANY {
+				cid = unix.VMADDR_CID_LOCAL
+			}
+			sox[uint64(ino)] = detector.VsockEndpoint(cid, port)
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,130 @@
+// (c) Siemens AG 2024
+//
+// SPDX-License-Identifier: MIT
+
+package turtlefinder
+
+import (
+	"context"
+	"syscall"
+	"testing/fstest"
+	"time"
+
+	"github.com/thediveo/lxkns/model"
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// vsockDiagMessage returns a netlink message with the specified VM socket
+// diagnosis information.
+func vsockDiagMessage(state byte, cid, port, ino uint32) []byte {
+	msg := make([]byte, unix.SizeofNlMsghdr+sizeofVsockDiagMsg)
+	nativeEndian.PutUint32(msg[0:4], uint32(len(msg)))
+	nativeEndian.PutUint16(msg[4:6], sockDiagByFamily)
+	body := msg[unix.SizeofNlMsghdr:]
+	body[0] = unix.AF_VSOCK
+	body[1] = unix.SOCK_STREAM
+	body[2] = state
+	nativeEndian.PutUint32(body[4:8], cid)
+	nativeEndian.PutUint32(body[8:12], port)
+	nativeEndian.PutUint32(body[20:24], ino)
+	return msg
+}
+
+// netlinkMessage returns a netlink message of the specified type with the
+// specified 32bit payload.
+func netlinkMessage(typ uint16, payload int32) []byte {
+	msg := make([]byte, unix.SizeofNlMsghdr+4)
+	nativeEndian.PutUint32(msg[0:4], uint32(len(msg)))
+	nativeEndian.PutUint16(msg[4:6], typ)
+	nativeEndian.PutUint32(msg[unix.SizeofNlMsghdr:], uint32(payload))
+	return msg
+}
+
+var _ = Describe("vsock discovery", func() {
+
+	It("requests listening VM sockets", func() {
+		req := vsockDiagRequest()
+		Expect(req).To(HaveLen(unix.SizeofNlMsghdr + sizeofVsockDiagReq))
+		Expect(nativeEndian.Uint16(req[4:6])).To(Equal(uint16(sockDiagByFamily)))
+		Expect(req[unix.SizeofNlMsghdr]).To(Equal(byte(unix.AF_VSOCK)))
+		Expect(nativeEndian.Uint32(req[unix.SizeofNlMsghdr+4:])).To(Equal(uint32(1 << tcpListen)))
+	})
+
+	It("parses listening VM sockets", func() {
+		sox := socketPathsByIno{}
+		var data []byte
+		data = append(data, vsockDiagMessage(tcpListen, 3, 2375, 666)...)
+		data = append(data, vsockDiagMessage(tcpListen, unix.VMADDR_CID_ANY, 1024, 667)...)
+		data = append(data, vsockDiagMessage(1 /* established */, 3, 4242, 668)...)
+		Expect(parseVsockDiagMessages(data, sox)).To(BeFalse())
+		Expect(parseVsockDiagMessages(netlinkMessage(unix.NLMSG_DONE, 0), sox)).To(BeTrue())
+		Expect(sox).To(Equal(socketPathsByIno{
+			666: "vsock://3:2375",
+			667: "vsock://1:1024",
+		}))
+	})
+
+	It("reports failed VM socket diagnosis", func() {
+		_, err := parseVsockDiagMessages(netlinkMessage(unix.NLMSG_ERROR, -int32(syscall.ENOENT)), socketPathsByIno{})
+		Expect(err).To(MatchError(syscall.ENOENT))
+	})
+
+	It("queries the kernel, if possible", func() {
+		sox, err := listeningVsocks()
+		if err != nil {
+			Skip("no vsock diagnosis available: " + err.Error())
+		}
+		Expect(sox).NotTo(BeNil())
+	})
+
+	It("discovers vsock API endpoints of engine processes", func(ctx context.Context) {
+		oldlister := vsockLister
+		DeferCleanup(func() { vsockLister = oldlister })
+		queries := 0
+		vsockLister = func() (socketPathsByIno, error) {
+			queries++
+			return socketPathsByIno{666: "vsock://3:2375"}, nil
+		}
+		procroot := "/fakeproc"
+		useSockFS(&memSockFS{
+			files: fstest.MapFS{
+				"fakeproc/42/net/unix": &fstest.MapFile{Data: []byte(fakeNetUnix)},
+				"fakeproc/42/fd/3":     &fstest.MapFile{},
+				"fakeproc/42/fd/4":     &fstest.MapFile{},
+			},
+			links: map[string]string{
+				procroot + "/42/fd/3": "socket:[666]",
+				procroot + "/42/fd/4": "socket:[4242]",
+			},
+		})
+
+		netunix := newNetUnixCache()
+		Expect(vsockEndpointsOfProcess(procroot, 42, netunix)).To(ConsistOf("vsock://3:2375"))
+		Expect(vsockEndpointsOfProcess(procroot, 42, netunix)).To(ConsistOf("vsock://3:2375"))
+		Expect(queries).To(Equal(1))
+
+		proc := &model.Process{PID: 42, ProTaskCommon: model.ProTaskCommon{Name: "acceptd"}}
+		d := &acceptingDetector{}
+		tf := New(func() context.Context { return ctx },
+			WithGettingOnlineWait(100*time.Millisecond),
+			WithProcRoot(procroot))
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "acceptd"}}
+		_ = tf.Containers(ctx, model.ProcessTable{proc.PID: proc}, nil)
+		Expect(tf.Engines()).To(BeEmpty())
+
+		tf = New(func() context.Context { return ctx },
+			WithGettingOnlineWait(100*time.Millisecond),
+			WithProcRoot(procroot),
+			WithVsockDiscovery())
+		defer tf.Close()
+		tf.engineplugins = []enginePlugin{{names: d.EngineNames(), detector: d, pluginname: "acceptd"}}
+		_ = tf.Containers(ctx, model.ProcessTable{proc.PID: proc}, nil)
+		Expect(tf.EngineDetails()).To(ConsistOf(
+			HaveField("CandidateAPIs", ConsistOf("vsock://3:2375"))))
+	})
+
+})
@@ -7,19 +7,69 @@ package turtlefinder
 import (
 	"context"
 	"fmt"
-	"net"
+	"math/rand"
 	"time"
 
-	"github.com/thediveo/lxkns/log"
+	"github.com/siemens/turtlefinder/detector"
 	"github.com/thediveo/lxkns/model"
 	"github.com/thediveo/whalewatcher/watcher"
 )
 
+// Default number of attempts and polling interval when trying to find the
+// process of a freshly socket-activated container engine; see also
+// [WithDaemonFindAttempts] and [WithDaemonFindPolling].
 const (
-	findAttempts = 10
-	findPolling  = 100 * time.Millisecond
+	defaultFindAttempts = 10
+	defaultFindPolling  = 100 * time.Millisecond
 )
 
+// minStaleSocketAttempts is the minimum number of attempts to find the process
+// of a freshly socket-activated container engine after which an API endpoint
+// is considered to be stale if the socket activator still hasn't spawned any
+// engine process at all.
+const minStaleSocketAttempts = 2
+
+// staleSocketAttempts returns the number of attempts to find the process of a
+// freshly socket-activated container engine after which an API endpoint is
+// considered to be stale if the socket activator still hasn't spawned any
+// engine process at all. This is half of the configured attempts, so that
+// slowly starting engines get half of the configured find window to show up,
+// but at least minStaleSocketAttempts.
+func staleSocketAttempts(findattempts int) int {
+	if attempts := findattempts / 2; attempts > minStaleSocketAttempts {
+		return attempts
+	}
+	return minStaleSocketAttempts
+}
+
+// hasAnyChild returns true if the specified parent process has a child process
+// with any of the specified names.
+func hasAnyChild(children childLocator, ppid model.PIDType, names []string) bool {
+	for _, name := range names {
+		if children.hasChild(ppid, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// staggerWatchStart waits for a random duration of up to maxjitter before
+// returning, in order to stagger the starts of multiple watchers created at
+// the same time, so that they don't all synchronize in lockstep with their
+// container engines. staggerWatchStart returns early when the specified
+// context gets cancelled. A maxjitter of zero or less doesn't wait at all.
+func staggerWatchStart(ctx context.Context, maxjitter time.Duration) {
+	if maxjitter <= 0 {
+		return
+	}
+	stagger := time.NewTimer(time.Duration(rand.Int63n(int64(maxjitter))))
+	defer stagger.Stop()
+	select {
+	case <-stagger.C:
+	case <-ctx.Done():
+	}
+}
+
 // startWatch starts the watch on the specified watcher, shortly waiting (as
 // specified) for the watcher to synchronize to the workload of the container
 // engine watched. startWatch will always return after at most the specified
@@ -42,16 +92,21 @@ const (
 // startWatch emits informational log messages about the synchronization start
 // and end.
 func startWatch(ctx context.Context, w watcher.Watcher, maxwait time.Duration) {
-	log.Infof("beginning synchronization to '%s' engine (PID %d) at API %s",
+	lg := detector.LoggerFrom(ctx).With("type", w.Type(), "pid", w.PID(), "api", w.API())
+	lg.Infof("beginning synchronization to '%s' engine (PID %d) at API %s",
 		w.Type(), w.PID(), w.API())
 	// Start the watch including the initial synchronization on a separate go
-	// routine and controlled by the context given to us.
+	// routine and controlled by the context given to us. As the watch might
+	// also end because the watcher gets closed while the context still is
+	// alive, we signal the end of the watch separately.
+	watchdone := make(chan struct{})
 	go func() {
+		defer close(watchdone)
 		err := w.Watch(ctx)
 		if err == nil {
 			return
 		}
-		log.Warnf("terminated watch for '%s' container engine (PID %d), reason: %s",
+		lg.Warnf("terminated watch for '%s' container engine (PID %d), reason: %s",
 			w.Type(), w.PID(), err.Error())
 	}()
 	// Wait in the background for the synchronization to complete and then
@@ -64,12 +119,30 @@ func startWatch(ctx context.Context, w watcher.Watcher, maxwait time.Duration) {
 			// fall through
 		case <-ctx.Done():
 			return // avoid leaking this go routine when ctx already done.
+		case <-watchdone:
+			return // watcher closed, so don't bother anymore.
+		}
+		select {
+		case <-watchdone:
+			return // the watch failed, so there's no ID to report.
+		default:
 		}
 		// Getting the engine ID should be carried out swiftly, so we timebox
-		// it.
+		// it. And we don't want to hang around querying the ID when the
+		// watcher gets closed in the meantime, such as when the turtlefinder
+		// is closing.
 		idctx, idcancel := context.WithTimeout(ctx, 2*time.Second)
 		defer idcancel()
-		log.Infof("synchronized to '%s' container engine (PID %d) with ID '%s'",
+		iddone := make(chan struct{})
+		defer close(iddone)
+		go func() {
+			select {
+			case <-watchdone:
+				idcancel()
+			case <-iddone:
+			}
+		}()
+		lg.Infof("synchronized to '%s' container engine (PID %d) with ID '%s'",
 			w.Type(), w.PID(), w.ID(idctx))
 	}()
 	// Give the watcher a (short) chance to get in sync, but do not hang around
@@ -87,7 +160,7 @@ func startWatch(ctx context.Context, w watcher.Watcher, maxwait time.Duration) {
 			<-wecker.C
 		}
 	case <-wecker.C:
-		log.Warnf("'%s' container engine (PID %d) not yet synchronized ... continuing in background",
+		lg.Warnf("'%s' container engine (PID %d) not yet synchronized ... continuing in background",
 			w.Type(), w.PID())
 	}
 }
@@ -98,12 +171,31 @@ func startWatch(ctx context.Context, w watcher.Watcher, maxwait time.Duration) {
 // activateAndStartWatch will always return after at most the specified maxwait
 // duration. If connecting was successful, the watcher will synchronize in the
 // background even after maxwait.
+//
+// The engine process is located using the specified daemonLocator; if nil,
+// the proc filesystem mounted at “/proc” will always be walked. Locating the
+// engine process is attempted up to findattempts times, polling every
+// findpolling; zero or negative values are taken as the defaults of 10
+// attempts and 100ms polling. In each attempt, the specified candidate engine
+// process names are tried in order; the first name is considered to be the
+// engine's primary name, used for logging.
+//
+// If the API endpoint is served by the socket activator itself, but the socket
+// activator hasn't spawned any child process with one of the candidate engine
+// process names within the first half of the attempts, the API endpoint is
+// considered to be stale, such as when a socket unit outlived its stopped
+// engine. Locating the engine process then stops early, reporting an
+// [ErrStaleAPIEndpoint] error. This requires the daemonLocator to also
+// implement childLocator.
 func activateAndStartWatch(
 	ctx context.Context,
 	apipath string, // path(!) within current mount namespace, not an URL.
 	listeningsockino uint64,
 	activatorPID model.PIDType,
-	enginename string,
+	enginenames []string,
+	locator daemonLocator,
+	findattempts int,
+	findpolling time.Duration,
 	creatorfn func(apipath string, pid model.PIDType) (watcher.Watcher, error),
 	outcomefn func(w watcher.Watcher, err error),
 	maxwait time.Duration,
@@ -113,6 +205,21 @@ func activateAndStartWatch(
 	// and connect a watcher to it.
 	synched := make(chan struct{}, 1)
 
+	if locator == nil {
+		locator = procfsDaemonLocator{procroot: defaultProcRoot}
+	}
+	if findattempts <= 0 {
+		findattempts = defaultFindAttempts
+	}
+	if findpolling <= 0 {
+		findpolling = defaultFindPolling
+	}
+	var enginename string
+	if len(enginenames) > 0 {
+		enginename = enginenames[0]
+	}
+	lg := detector.LoggerFrom(ctx).With("engine", enginename, "api", apipath)
+
 	go func() {
 		// Ensure to notify the time-boxed "outer" go routine of any outcome of
 		// our attempt to activate and contact a container engine, including the
@@ -126,37 +233,54 @@ func activateAndStartWatch(
 
 		// attempt a time-boxed connect to the engine's API endpoint in order to
 		// determine the PID of the serving process.
-		log.Infof("activating '%s' container engine at API endpoint %s",
+		lg.Infof("activating '%s' container engine at API endpoint %s",
 			enginename, apipath)
 		started := time.Now()
-		var d net.Dialer
 		connectctx, connectcancel := context.WithTimeout(ctx, maxwait)
 		defer connectcancel()
-		conn, err := d.DialContext(connectctx, "unix", apipath)
+		conn, err := detector.Dialer(ctx).DialContext(connectctx, "unix", apipath)
 		if err != nil {
-			log.Errorf("cannot activate container engine at API %s, reason: %s",
+			lg.Errorf("cannot activate container engine at API %s, reason: %s",
 				apipath, err.Error())
 			return
 		}
 		defer conn.Close()
-		log.Infof("activated '%s' container engine at API endpoint %s",
+		lg.Infof("activated '%s' container engine at API endpoint %s",
 			enginename, apipath)
+		// The listening API socket might have been left behind by a stopped
+		// engine, with only the socket activator still holding on to it, so
+		// we need to know who's serving the API socket.
+		peerpid := connPeerPID(conn)
+		children, _ := locator.(childLocator)
 
 		// next, try to find the newly activated engine process; unfortunately,
 		// the API socket's peer credential won't give us the engine's PID, but
 		// instead the PID of the activator (as the activator created the
 		// listening API socket).
 		var pid model.PIDType
+		foundname := enginename
+		staleattempts := staleSocketAttempts(findattempts)
 	NextAttempt:
-		for attempt := 1; attempt <= findAttempts; attempt++ {
-			pid = findDaemon(activatorPID, enginename, listeningsockino)
-			if pid != 0 {
-				break
+		for attempt := 1; attempt <= findattempts; attempt++ {
+			for _, name := range enginenames {
+				pid = locator.findDaemon(activatorPID, name, listeningsockino)
+				if pid != 0 {
+					foundname = name
+					break NextAttempt
+				}
+			}
+			if attempt >= staleattempts && peerpid == activatorPID && children != nil &&
+				!hasAnyChild(children, activatorPID, enginenames) {
+				err = categorize(ErrStaleAPIEndpoint,
+					fmt.Errorf("stale API endpoint %s: socket activator (PID %d) didn't spawn any '%s' container engine process",
+						apipath, activatorPID, enginename))
+				lg.Warnf("%s", err.Error())
+				return
 			}
-			sleep := time.NewTimer(findPolling)
+			sleep := time.NewTimer(findpolling)
 			select {
 			case <-sleep.C:
-				log.Infof("retrying to find activated '%s' container engine process for API endpoint %s",
+				lg.Infof("retrying to find activated '%s' container engine process for API endpoint %s",
 					enginename, apipath)
 			case <-ctx.Done():
 				if !sleep.Stop() {
@@ -166,13 +290,14 @@ func activateAndStartWatch(
 			}
 		}
 		if pid == 0 {
-			err = fmt.Errorf("cannot find activated container engine process '%s' for API endpoint %s",
-				enginename, apipath)
-			log.Errorf(err.Error())
+			err = categorize(ErrActivatedEngineNotFound,
+				fmt.Errorf("cannot find activated container engine process '%s' for API endpoint %s",
+					enginename, apipath))
+			lg.Errorf("%s", err.Error())
 			return
 		}
-		log.Infof("activated container engine process '%s' with API endpoint %s has PID %d",
-			enginename, apipath, pid)
+		lg.Infof("activated container engine process '%s' with API endpoint %s has PID %d",
+			foundname, apipath, pid)
 
 		// now attempt to create and start the watcher, also connected to the
 		// API endpoint.
@@ -181,7 +306,8 @@ func activateAndStartWatch(
 			return
 		}
 		if w == nil {
-			err = fmt.Errorf("no '%s' watcher for API endpoint %s", enginename, apipath)
+			err = categorize(ErrEngineUnreachable,
+				fmt.Errorf("no '%s' watcher for API endpoint %s", enginename, apipath))
 			return
 		}
 		remmaxwait := maxwait - time.Since(started)
@@ -203,6 +329,6 @@ func activateAndStartWatch(
 			<-wecker.C
 		}
 	case <-wecker.C:
-		log.Warnf("engine endpoint %s still in activation ... continuing in background", apipath)
+		lg.Warnf("engine endpoint %s still in activation ... continuing in background", apipath)
 	}
 }
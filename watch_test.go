@@ -7,12 +7,18 @@ package turtlefinder
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"os"
+	"os/exec"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/siemens/turtlefinder/activator"
 	"github.com/siemens/turtlefinder/internal/test"
 	"github.com/thediveo/lxkns/model"
 	engineclient "github.com/thediveo/whalewatcher/engineclient/moby"
@@ -28,6 +34,113 @@ import (
 const watchSyncMaxWait = 5 * time.Second
 const watchSlowSyncWait = watchSyncMaxWait + 2*time.Second
 
+// countingDaemonLocator is a daemonLocator that counts its findDaemon calls,
+// never finding any daemon.
+type countingDaemonLocator struct {
+	calls atomic.Int32
+}
+
+func (l *countingDaemonLocator) findDaemon(ppid model.PIDType, name string, udsino uint64) model.PIDType {
+	l.calls.Add(1)
+	return 0
+}
+
+// namedDaemonLocator is a daemonLocator that records the process names it has
+// been asked to find, finding a daemon only for a specific process name.
+type namedDaemonLocator struct {
+	mu    sync.Mutex
+	names []string
+	name  string
+}
+
+func (l *namedDaemonLocator) findDaemon(ppid model.PIDType, name string, udsino uint64) model.PIDType {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.names = append(l.names, name)
+	if name == l.name {
+		return 42
+	}
+	return 0
+}
+
+// closableWatcher is an immediately synchronized idleWatcher that watches until
+// it gets closed, and that blocks engine ID queries until their contexts are
+// done.
+type closableWatcher struct {
+	idleWatcher
+	closed    chan struct{}
+	closeonce sync.Once
+	queried   chan struct{}
+	queryonce sync.Once
+}
+
+func newClosableWatcher() *closableWatcher {
+	ready := make(chan struct{})
+	close(ready)
+	return &closableWatcher{
+		idleWatcher: idleWatcher{ready: ready},
+		closed:      make(chan struct{}),
+		queried:     make(chan struct{}),
+	}
+}
+
+func (w *closableWatcher) Watch(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-w.closed:
+		return errors.New("watcher closed")
+	}
+}
+
+func (w *closableWatcher) Close() { w.closeonce.Do(func() { close(w.closed) }) }
+
+func (w *closableWatcher) ID(ctx context.Context) string {
+	w.queryonce.Do(func() { close(w.queried) })
+	<-ctx.Done()
+	return ""
+}
+
+var _ = Describe("staggered watch starts", func() {
+
+	It("doesn't stagger without jitter", func(ctx context.Context) {
+		start := time.Now()
+		staggerWatchStart(ctx, 0)
+		Expect(time.Since(start)).To(BeNumerically("<", 10*time.Millisecond))
+	})
+
+	It("staggers watch starts", func(ctx context.Context) {
+		const jitter = 100 * time.Millisecond
+		delays := map[time.Duration]struct{}{}
+		for i := 0; i < 5; i++ {
+			start := time.Now()
+			staggerWatchStart(ctx, jitter)
+			delay := time.Since(start)
+			Expect(delay).To(BeNumerically("<", jitter+50*time.Millisecond))
+			delays[delay] = struct{}{}
+		}
+		Expect(len(delays)).To(BeNumerically(">", 1))
+	})
+
+	It("stops staggering when the context gets cancelled", func(ctx context.Context) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		start := time.Now()
+		staggerWatchStart(ctx, time.Hour)
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+	})
+
+	It("sets the watcher start jitter", func(ctx context.Context) {
+		tf := New(func() context.Context { return ctx })
+		defer tf.Close()
+		Expect(tf.startjitter).To(BeZero())
+		tf = New(func() context.Context { return ctx }, WithWatcherStartJitter(42*time.Millisecond))
+		defer tf.Close()
+		Expect(tf.startjitter).To(Equal(42 * time.Millisecond))
+	})
+
+})
+
 var _ = Describe("watch", Serial, func() {
 
 	BeforeEach(test.LogToGinkgo)
@@ -96,6 +209,25 @@ var _ = Describe("watch", Serial, func() {
 
 	})
 
+	Context("closing a watcher", func() {
+
+		It("doesn't hold on to the engine ID query", func(ctx context.Context) {
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			goodgos := Goroutines()
+			w := newClosableWatcher()
+			startWatch(ctx, w, watchSyncMaxWait)
+			Eventually(w.queried).Should(BeClosed())
+			w.Close()
+			// the ID query is timeboxed to 2s, so make sure to check well
+			// before that.
+			Eventually(Goroutines).Within(1 * time.Second).ProbeEvery(50 * time.Millisecond).
+				ShouldNot(HaveLeaked(goodgos))
+			Expect(ctx.Err()).NotTo(HaveOccurred())
+		})
+
+	})
+
 	Context("socket-activating a container engine process and watching it", func() {
 
 		It("activates Docker first (sort of) and then watches", func(ctx context.Context) {
@@ -131,7 +263,9 @@ var _ = Describe("watch", Serial, func() {
 				"/run/docker.sock",
 				udsino,
 				1,
-				"dockerd",
+				[]string{"dockerd"},
+				nil,
+				0, 0,
 				func(apipath string, pid model.PIDType) (watcher.Watcher, error) {
 					return moby.New("unix://"+apipath, nil, engineclient.WithPID(int(pid)))
 				},
@@ -159,4 +293,209 @@ var _ = Describe("watch", Serial, func() {
 
 	})
 
+	Context("locating socket-activated engine processes", func() {
+
+		It("honors the number of attempts and polling interval", func(ctx context.Context) {
+			sockdir := Successful(os.MkdirTemp("", "activated-*"))
+			defer os.RemoveAll(sockdir)
+			lsock := Successful(net.Listen("unix", sockdir+"/api.sock"))
+			defer lsock.Close()
+
+			locator := &countingDaemonLocator{}
+			outcome := make(chan error, 1)
+			start := time.Now()
+			activateAndStartWatch(ctx,
+				sockdir+"/api.sock",
+				0,
+				1,
+				[]string{"lazyd"},
+				locator,
+				3, 50*time.Millisecond,
+				func(apipath string, pid model.PIDType) (watcher.Watcher, error) {
+					return nil, nil
+				},
+				func(nw watcher.Watcher, err error) {
+					outcome <- err
+				},
+				watchSyncMaxWait)
+			var err error
+			Eventually(outcome).Within(2 * time.Second).Should(Receive(&err))
+			Expect(err).To(MatchError(ContainSubstring("cannot find activated container engine process 'lazyd'")))
+			Expect(locator.calls.Load()).To(Equal(int32(3)))
+			Expect(time.Since(start)).To(BeNumerically(">=", 150*time.Millisecond))
+		})
+
+		It("stops early on stale API endpoints", func(ctx context.Context) {
+			sockdir := GinkgoT().TempDir()
+			lsock := Successful(net.Listen("unix", sockdir+"/api.sock"))
+			defer lsock.Close()
+
+			outcome := make(chan error, 1)
+			start := time.Now()
+			activateAndStartWatch(ctx,
+				sockdir+"/api.sock",
+				0,
+				model.PIDType(os.Getpid()), // ...as we're serving the API endpoint.
+				[]string{"staled"},
+				procfsDaemonLocator{procroot: defaultProcRoot},
+				10, 100*time.Millisecond,
+				func(apipath string, pid model.PIDType) (watcher.Watcher, error) {
+					return nil, nil
+				},
+				func(nw watcher.Watcher, err error) {
+					outcome <- err
+				},
+				watchSyncMaxWait)
+			var err error
+			Eventually(outcome).Within(2 * time.Second).Should(Receive(&err))
+			Expect(err).To(MatchError(ErrStaleAPIEndpoint))
+			Expect(err).To(MatchError(ContainSubstring("didn't spawn any 'staled' container engine process")))
+			Expect(time.Since(start)).To(And(
+				BeNumerically(">=", 400*time.Millisecond),
+				BeNumerically("<", 900*time.Millisecond)))
+		})
+
+		It("derives the stale threshold from the find window", func() {
+			Expect(staleSocketAttempts(0)).To(Equal(minStaleSocketAttempts))
+			Expect(staleSocketAttempts(3)).To(Equal(minStaleSocketAttempts))
+			Expect(staleSocketAttempts(10)).To(Equal(5))
+			Expect(staleSocketAttempts(42)).To(Equal(21))
+		})
+
+		It("waits for engine processes spawned late", func(ctx context.Context) {
+			sockdir := GinkgoT().TempDir()
+			lsock := Successful(net.Listen("unix", sockdir+"/api.sock"))
+			defer lsock.Close()
+
+			// spawn the engine process only after the socket activator has
+			// been found serving the API endpoint a couple of times.
+			sleepych := make(chan *exec.Cmd, 1)
+			go func() {
+				defer GinkgoRecover()
+				time.Sleep(100 * time.Millisecond)
+				sleepy := exec.Command("sleep", "10")
+				Expect(sleepy.Start()).To(Succeed())
+				sleepych <- sleepy
+			}()
+			defer func() {
+				sleepy := <-sleepych
+				_ = sleepy.Process.Kill()
+				_ = sleepy.Wait()
+			}()
+
+			outcome := make(chan error, 1)
+			start := time.Now()
+			activateAndStartWatch(ctx,
+				sockdir+"/api.sock",
+				0,
+				model.PIDType(os.Getpid()),
+				[]string{"sleep"},
+				procfsDaemonLocator{procroot: defaultProcRoot},
+				10, 60*time.Millisecond,
+				func(apipath string, pid model.PIDType) (watcher.Watcher, error) {
+					return nil, nil
+				},
+				func(nw watcher.Watcher, err error) {
+					outcome <- err
+				},
+				watchSyncMaxWait)
+			var err error
+			Eventually(outcome).Within(2 * time.Second).Should(Receive(&err))
+			Expect(err).To(MatchError(ErrActivatedEngineNotFound))
+			Expect(err).NotTo(MatchError(ErrStaleAPIEndpoint))
+			Expect(time.Since(start)).To(BeNumerically(">=", 540*time.Millisecond))
+		})
+
+		It("keeps looking for engine processes still starting", func(ctx context.Context) {
+			sockdir := GinkgoT().TempDir()
+			lsock := Successful(net.Listen("unix", sockdir+"/api.sock"))
+			defer lsock.Close()
+
+			sleepy := exec.Command("sleep", "10")
+			Expect(sleepy.Start()).To(Succeed())
+			defer func() {
+				_ = sleepy.Process.Kill()
+				_ = sleepy.Wait()
+			}()
+
+			outcome := make(chan error, 1)
+			start := time.Now()
+			activateAndStartWatch(ctx,
+				sockdir+"/api.sock",
+				0,
+				model.PIDType(os.Getpid()),
+				[]string{"sleep"},
+				procfsDaemonLocator{procroot: defaultProcRoot},
+				4, 50*time.Millisecond,
+				func(apipath string, pid model.PIDType) (watcher.Watcher, error) {
+					return nil, nil
+				},
+				func(nw watcher.Watcher, err error) {
+					outcome <- err
+				},
+				watchSyncMaxWait)
+			var err error
+			Eventually(outcome).Within(2 * time.Second).Should(Receive(&err))
+			Expect(err).To(MatchError(ErrActivatedEngineNotFound))
+			Expect(err).NotTo(MatchError(ErrStaleAPIEndpoint))
+			Expect(time.Since(start)).To(BeNumerically(">=", 200*time.Millisecond))
+		})
+
+		It("tries all candidate engine process names", func(ctx context.Context) {
+			sockdir := Successful(os.MkdirTemp("", "activated-*"))
+			defer os.RemoveAll(sockdir)
+			lsock := Successful(net.Listen("unix", sockdir+"/api.sock"))
+			defer lsock.Close()
+
+			ident := activator.EngineIdentification{
+				ProcessName:     "lazyd",
+				AltProcessNames: []string{"", "exe", "lazyd"},
+			}
+			Expect(ident.ProcessNames()).To(HaveExactElements("lazyd", "exe"))
+
+			locator := &namedDaemonLocator{name: "exe"}
+			pids := make(chan model.PIDType, 1)
+			outcome := make(chan error, 1)
+			activateAndStartWatch(ctx,
+				sockdir+"/api.sock",
+				0,
+				1,
+				ident.ProcessNames(),
+				locator,
+				3, 50*time.Millisecond,
+				func(apipath string, pid model.PIDType) (watcher.Watcher, error) {
+					pids <- pid
+					return nil, nil
+				},
+				func(nw watcher.Watcher, err error) {
+					outcome <- err
+				},
+				watchSyncMaxWait)
+			var err error
+			Eventually(outcome).Within(2 * time.Second).Should(Receive(&err))
+			Expect(err).To(MatchError(ContainSubstring("no 'lazyd' watcher")))
+			Expect(pids).To(Receive(Equal(model.PIDType(42))))
+			locator.mu.Lock()
+			defer locator.mu.Unlock()
+			Expect(locator.names).To(HaveExactElements("lazyd", "exe"))
+		})
+
+		It("configures finding socket-activated engine processes", func(ctx context.Context) {
+			tf := New(func() context.Context { return ctx })
+			Expect(tf.findattempts).To(Equal(defaultFindAttempts))
+			Expect(tf.findpolling).To(Equal(defaultFindPolling))
+
+			tf = New(func() context.Context { return ctx },
+				WithDaemonFindAttempts(42), WithDaemonFindPolling(time.Second))
+			Expect(tf.findattempts).To(Equal(42))
+			Expect(tf.findpolling).To(Equal(time.Second))
+
+			tf = New(func() context.Context { return ctx },
+				WithDaemonFindAttempts(0), WithDaemonFindPolling(-1))
+			Expect(tf.findattempts).To(Equal(defaultFindAttempts))
+			Expect(tf.findpolling).To(Equal(defaultFindPolling))
+		})
+
+	})
+
 })